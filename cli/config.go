@@ -1,7 +1,18 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/mcuadros/ofelia/core"
@@ -9,15 +20,25 @@ import (
 	logging "github.com/op/go-logging"
 
 	defaults "github.com/mcuadros/go-defaults"
-	gcfg "gopkg.in/gcfg.v1"
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/gcfg.v1/types"
 )
 
 const (
-	logFormat     = "%{color}%{shortfile} ▶ %{level}%{color:reset} %{message}"
-	jobExec       = "job-exec"
-	jobRun        = "job-run"
-	jobServiceRun = "job-service-run"
-	jobLocal      = "job-local"
+	logFormat      = "%{color}%{shortfile} ▶ %{level}%{color:reset} %{message}"
+	jobExec        = "job-exec"
+	jobRun         = "job-run"
+	jobServiceRun  = "job-service-run"
+	jobServiceExec = "job-service-exec"
+	jobLocal       = "job-local"
+	jobHTTP        = "job-http"
+	jobK8s         = "job-k8s"
+	jobCompose     = "job-compose"
+	jobSSH         = "job-ssh"
+	jobECS         = "job-ecs"
+	jobLambda      = "job-lambda"
+	jobNomad       = "job-nomad"
+	dockerSection  = "docker"
 )
 
 var IsDockerEnv bool
@@ -25,51 +46,243 @@ var IsDockerEnv bool
 // Config contains the configuration
 type Config struct {
 	Global struct {
-		middlewares.SlackConfig `mapstructure:",squash"`
-		middlewares.SaveConfig  `mapstructure:",squash"`
-		middlewares.MailConfig  `mapstructure:",squash"`
+		DockerConfig                `mapstructure:",squash"`
+		middlewares.LockConfig      `mapstructure:",squash"`
+		middlewares.SlackConfig     `mapstructure:",squash"`
+		middlewares.SaveConfig      `mapstructure:",squash"`
+		middlewares.MailConfig      `mapstructure:",squash"`
+		middlewares.WebhookConfig   `mapstructure:",squash"`
+		middlewares.S3Config        `mapstructure:",squash"`
+		middlewares.TeamsConfig     `mapstructure:",squash"`
+		middlewares.DiscordConfig   `mapstructure:",squash"`
+		middlewares.PingConfig      `mapstructure:",squash"`
+		middlewares.PagerDutyConfig `mapstructure:",squash"`
+		middlewares.OpsgenieConfig  `mapstructure:",squash"`
+		middlewares.MetricsConfig   `mapstructure:",squash"`
+		middlewares.SyslogConfig    `mapstructure:",squash"`
+		middlewares.GELFConfig      `mapstructure:",squash"`
+		middlewares.LokiConfig      `mapstructure:",squash"`
+		// RedactEnv are the names of the environment variables, and
+		// RedactPattern the regular expressions, masked in the outputs
+		RedactEnv     []string `mapstructure:"redact-env"`
+		RedactPattern []string `mapstructure:"redact-pattern"`
+		// MaxConcurrentJobs limits the jobs running at the same time, waiting
+		// up to MaxQueueTime for a free slot
+		MaxConcurrentJobs int           `mapstructure:"max-concurrent-jobs"`
+		MaxQueueTime      time.Duration `mapstructure:"max-queue-time"`
+		// WatchdogTolerance enables the watchdog reporting the jobs not run
+		// at their scheduled time, see core.Scheduler
+		WatchdogTolerance time.Duration `mapstructure:"watchdog-tolerance"`
+		// MaxParallelPulls limits the images pulled at the same time from the
+		// same registry
+		MaxParallelPulls int `mapstructure:"max-parallel-pulls"`
+		// VerifyCommand is the command running cosign verifying the images
+		// of the jobs, see core.ImageVerification
+		VerifyCommand string `mapstructure:"verify-command"`
+		// CronFormat is the format of the schedules of five fields, see
+		// core.ParseSchedule
+		CronFormat string `mapstructure:"cron-format"`
+		// SecretsDir, VaultAddress and VaultToken configure where the
+		// env-secret options of the jobs are read from, see core.Secrets
+		SecretsDir   string `mapstructure:"secrets-dir"`
+		VaultAddress string `mapstructure:"vault-address"`
+		VaultToken   string `mapstructure:"vault-token"`
+		// MiddlewareTags restricts middlewares to the jobs with the given
+		// tags, as `name:tag,...`, e.g. `pagerduty:critical`
+		MiddlewareTags []string `mapstructure:"middleware-tags"`
 	}
-	ExecJobs    map[string]*ExecJobConfig    `gcfg:"job-exec" mapstructure:"job-exec,squash"`
-	RunJobs     map[string]*RunJobConfig     `gcfg:"job-run" mapstructure:"job-run,squash"`
-	ServiceJobs map[string]*RunServiceConfig `gcfg:"job-service-run" mapstructure:"job-service-run,squash"`
-	LocalJobs   map[string]*LocalJobConfig   `gcfg:"job-local" mapstructure:"job-local,squash"`
+	ExecJobs        map[string]*ExecJobConfig     `mapstructure:"job-exec,squash"`
+	RunJobs         map[string]*RunJobConfig      `mapstructure:"job-run,squash"`
+	ServiceJobs     map[string]*RunServiceConfig  `mapstructure:"job-service-run,squash"`
+	ServiceExecJobs map[string]*ServiceExecConfig `mapstructure:"job-service-exec,squash"`
+	LocalJobs       map[string]*LocalJobConfig    `mapstructure:"job-local,squash"`
+	HTTPJobs        map[string]*HTTPJobConfig     `mapstructure:"job-http,squash"`
+	K8sJobs         map[string]*K8sJobConfig      `mapstructure:"job-k8s,squash"`
+	ComposeJobs     map[string]*ComposeJobConfig  `mapstructure:"job-compose,squash"`
+	SSHJobs         map[string]*SSHJobConfig      `mapstructure:"job-ssh,squash"`
+	ECSJobs         map[string]*ECSJobConfig      `mapstructure:"job-ecs,squash"`
+	LambdaJobs      map[string]*LambdaJobConfig   `mapstructure:"job-lambda,squash"`
+	NomadJobs       map[string]*NomadJobConfig    `mapstructure:"job-nomad,squash"`
+	// Dockers are the named docker daemons, used by the jobs with `host`
+	Dockers map[string]*DockerConfig `mapstructure:"docker,squash"`
+
+	dockerClients map[string]*docker.Client
 }
 
 // BuildFromDockerLabels buils a scheduler using the config from a docker labels
 func BuildFromDockerLabels() (*core.Scheduler, error) {
 	c := &Config{}
 
-	d, err := c.buildDockerClient()
+	d, err := buildDockerClient(DockerConfig{})
 	if err != nil {
 		return nil, err
 	}
 
-	labels, err := getLabels(d)
-	if err != nil {
+	if err := c.buildFromDocker(d); err != nil {
 		return nil, err
 	}
 
-	if err := c.buildFromDockerLabels(labels); err != nil {
+	return c.build()
+}
+
+// BuildFromFile buils a scheduler using the config from a file and the files
+// of a directory, if any
+func BuildFromFile(filename, dir string) (*core.Scheduler, error) {
+	c := &Config{}
+	if err := c.buildFromFiles(filename, dir); err != nil {
 		return nil, err
 	}
 
 	return c.build()
 }
 
-// BuildFromFile buils a scheduler using the config from a file
-func BuildFromFile(filename string) (*core.Scheduler, error) {
-	c := &Config{}
-	if err := gcfg.ReadFileInto(c, filename); err != nil {
+// reloadFromFiles updates the jobs of a running scheduler, built from c, with
+// the config from a file and the files of a directory, if any, on error the
+// scheduler is left untouched. The changes of the global section are only
+// applied on restart, they're logged.
+func (c *Config) reloadFromFiles(sh *core.Scheduler, filename, dir string) error {
+	n := &Config{}
+	if err := n.buildFromFiles(filename, dir); err != nil {
+		return err
+	}
+
+	defaults.SetDefaults(n)
+	if changed := changedOptions(c.Global, n.Global); len(changed) != 0 {
+		sh.Logger.Warningf(
+			"The options %s of the [global] section changed, restart ofelia to apply them",
+			strings.Join(changed, ", "),
+		)
+	}
+
+	d, err := buildDockerClient(n.Global.DockerConfig)
+	if err != nil {
+		return err
+	}
+
+	return n.updateScheduler(sh, d)
+}
+
+// changedOptions returns the names of the options with different values in the
+// given config structs, including the ones of the squashed structs
+func changedOptions(a, b interface{}) []string {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+
+	var changed []string
+	for i := 0; i < va.NumField(); i++ {
+		f := va.Type().Field(i)
+		if strings.HasSuffix(f.Tag.Get("mapstructure"), ",squash") {
+			changed = append(changed, changedOptions(va.Field(i).Interface(), vb.Field(i).Interface())...)
+			continue
+		}
+
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			changed = append(changed, optionName(f))
+		}
+	}
+
+	return changed
+}
+
+// buildFromFile loads the config from a file, see parseFile
+func (c *Config) buildFromFile(filename string) error {
+	s, err := parseFile(filename)
+	if err != nil {
+		return err
+	}
+
+	return c.decodeSections(s)
+}
+
+// errConfigDirWithDocker is returned by the commands given a config directory
+// when the config is read from the docker labels, which would ignore it
+var errConfigDirWithDocker = errors.New("--config-dir can't be used with --docker")
+
+// configDirExtensions are the extensions of the files read from a config
+// directory
+var configDirExtensions = map[string]bool{
+	".ini": true, ".conf": true, ".yml": true, ".yaml": true,
+}
+
+// buildFromFiles loads the config from a file and the files of a directory,
+// like `/etc/ofelia/conf.d`, merged after the file in order of name, see
+// sections.merge. Without directory the file is required, otherwise it's
+// skipped if it doesn't exist.
+func (c *Config) buildFromFiles(filename, dir string) error {
+	if dir == "" {
+		return c.buildFromFile(filename)
+	}
+
+	files, err := configDirFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	if filename != "" {
+		if _, err := os.Stat(filename); err == nil {
+			files = append([]string{filename}, files...)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	merged := newSections()
+	for _, f := range files {
+		s, err := parseFile(f)
+		if err != nil {
+			return fmt.Errorf("error reading %q: %s", f, err)
+		}
+
+		if err := merged.merge(s); err != nil {
+			return fmt.Errorf("error reading %q: %s", f, err)
+		}
+	}
+
+	return c.decodeSections(merged)
+}
+
+// configDirFiles returns the config files of a directory sorted by name, the
+// hidden files and the subdirectories are ignored
+func configDirFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
 		return nil, err
 	}
 
-	return c.build()
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		if configDirExtensions[strings.ToLower(filepath.Ext(name))] {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+
+	return files, nil
+}
+
+// parseFile returns the sections of a file, YAML if its extension is `.yml`
+// or `.yaml`, otherwise INI.
+func parseFile(filename string) (*sections, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yml", ".yaml":
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		return parseYAML(content)
+	default:
+		return parseIni(filename)
+	}
 }
 
 // BuildFromString buils a scheduler using the config from a string
 func BuildFromString(config string) (*core.Scheduler, error) {
 	c := &Config{}
-	if err := gcfg.ReadStringInto(c, config); err != nil {
+	if err := c.buildFromIni([]byte(config)); err != nil {
 		return nil, err
 	}
 
@@ -79,134 +292,777 @@ func BuildFromString(config string) (*core.Scheduler, error) {
 func (c *Config) build() (*core.Scheduler, error) {
 	defaults.SetDefaults(c)
 
-	d, err := c.buildDockerClient()
+	d, err := buildDockerClient(c.Global.DockerConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	sh := core.NewScheduler(c.buildLogger())
+	sh.MaxConcurrentJobs = c.Global.MaxConcurrentJobs
+	sh.MaxQueueTime = c.Global.MaxQueueTime
+	sh.WatchdogTolerance = c.Global.WatchdogTolerance
+	sh.MaxParallelPulls = c.Global.MaxParallelPulls
+	sh.VerifyCommand = c.Global.VerifyCommand
+	if err := core.ValidateCronFormat(c.Global.CronFormat); err != nil {
+		return nil, err
+	}
+
+	sh.CronFormat = c.Global.CronFormat
+	sh.Secrets = &core.Secrets{
+		Dir:          c.Global.SecretsDir,
+		VaultAddress: c.Global.VaultAddress,
+		VaultToken:   c.Global.VaultToken,
+	}
 	c.buildSchedulerMiddlewares(sh)
+	if len(c.Global.RedactEnv) != 0 || len(c.Global.RedactPattern) != 0 {
+		sh.Redaction, err = core.NewRedaction(c.Global.RedactEnv, c.Global.RedactPattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	jobs, err := c.buildJobs(d)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, j := range jobs {
+		if err := sh.AddJob(j); err != nil {
+			return nil, fmt.Errorf("invalid job %q: %s", j.GetName(), err)
+		}
+	}
+
+	return sh, nil
+}
+
+// jobConfig is implemented by all the job configurations
+type jobConfig interface {
+	core.Job
+	Disable(...core.Middleware)
+	middlewaresConfig() *JobMiddlewaresConfig
+}
+
+// middlewareNames are the names of the middlewares used by the
+// disable-middlewares option of the jobs and the middleware-tags option
+var middlewareNames = map[string]core.Middleware{
+	"overlap":   &middlewares.Overlap{},
+	"lock":      &middlewares.Lock{},
+	"slack":     &middlewares.Slack{},
+	"save":      &middlewares.Save{},
+	"mail":      &middlewares.Mail{},
+	"webhook":   &middlewares.Webhook{},
+	"s3":        &middlewares.S3{},
+	"teams":     &middlewares.Teams{},
+	"discord":   &middlewares.Discord{},
+	"ping":      &middlewares.Ping{},
+	"pagerduty": &middlewares.PagerDuty{},
+	"opsgenie":  &middlewares.Opsgenie{},
+	"metrics":   &middlewares.Metrics{},
+	"syslog":    &middlewares.Syslog{},
+	"gelf":      &middlewares.GELF{},
+	"loki":      &middlewares.Loki{},
+}
 
+// buildJobs sets the defaults, docker client and middlewares of the jobs
+func (c *Config) buildJobs(d *docker.Client) ([]jobConfig, error) {
+	if err := middlewares.Validate(&c.Global); err != nil {
+		return nil, err
+	}
+
+	var jobs []jobConfig
 	for name, j := range c.ExecJobs {
 		defaults.SetDefaults(j)
 
-		j.Client = d
+		client, err := c.dockerClient(d, j.DockerHost)
+		if err != nil {
+			return nil, fmt.Errorf("invalid job %q: %s", name, err)
+		}
+
+		j.Client = client
 		j.Name = name
-		j.buildMiddlewares()
-		sh.AddJob(j)
+		jobs = append(jobs, j)
 	}
 
 	for name, j := range c.RunJobs {
 		defaults.SetDefaults(j)
 
-		j.Client = d
+		if err := core.ValidateDelete(j.Delete); err != nil {
+			return nil, fmt.Errorf("invalid job %q: %s", name, err)
+		}
+
+		if err := j.ImageVerification.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid job %q: %s", name, err)
+		}
+
+		client, err := c.dockerClient(d, j.DockerHost)
+		if err != nil {
+			return nil, fmt.Errorf("invalid job %q: %s", name, err)
+		}
+
+		j.Client = client
 		j.Name = name
-		j.buildMiddlewares()
-		sh.AddJob(j)
+		jobs = append(jobs, j)
 	}
 
 	for name, j := range c.LocalJobs {
 		defaults.SetDefaults(j)
 
 		j.Name = name
-		j.buildMiddlewares()
-		sh.AddJob(j)
+		jobs = append(jobs, j)
+	}
+
+	for name, j := range c.HTTPJobs {
+		defaults.SetDefaults(j)
+
+		j.Name = name
+		jobs = append(jobs, j)
 	}
 
 	for name, j := range c.ServiceJobs {
 		defaults.SetDefaults(j)
+
+		if err := j.ImageVerification.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid job %q: %s", name, err)
+		}
+
 		j.Name = name
 		j.Client = d
-		j.buildMiddlewares()
-		sh.AddJob(j)
+		jobs = append(jobs, j)
 	}
 
-	return sh, nil
+	for name, j := range c.SSHJobs {
+		defaults.SetDefaults(j)
+
+		j.Name = name
+		jobs = append(jobs, j)
+	}
+
+	for name, j := range c.ComposeJobs {
+		defaults.SetDefaults(j)
+
+		j.Name = name
+		jobs = append(jobs, j)
+	}
+
+	for name, j := range c.ECSJobs {
+		defaults.SetDefaults(j)
+
+		j.Name = name
+		jobs = append(jobs, j)
+	}
+
+	for name, j := range c.LambdaJobs {
+		defaults.SetDefaults(j)
+
+		j.Name = name
+		jobs = append(jobs, j)
+	}
+
+	for name, j := range c.NomadJobs {
+		defaults.SetDefaults(j)
+
+		j.Name = name
+		jobs = append(jobs, j)
+	}
+
+	for name, j := range c.K8sJobs {
+		defaults.SetDefaults(j)
+
+		if err := core.ValidateDelete(j.Delete); err != nil {
+			return nil, fmt.Errorf("invalid job %q: %s", name, err)
+		}
+
+		j.Name = name
+		jobs = append(jobs, j)
+	}
+
+	for name, j := range c.ServiceExecJobs {
+		defaults.SetDefaults(j)
+
+		j.Client = d
+		j.Name = name
+		jobs = append(jobs, j)
+	}
+
+	for _, j := range jobs {
+		if err := c.buildJobMiddlewares(j); err != nil {
+			return nil, err
+		}
+	}
+
+	return jobs, nil
 }
 
-func (c *Config) buildDockerClient() (*docker.Client, error) {
-	d, err := docker.NewClientFromEnv()
+// dockerClient returns the client of the named docker daemon, or d if the
+// name is empty. The clients are built once, and only if d isn't nil, so the
+// jobs can be validated without connecting to the daemons.
+func (c *Config) dockerClient(d *docker.Client, name string) (*docker.Client, error) {
+	if name == "" {
+		return d, nil
+	}
+
+	config, ok := c.Dockers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown docker host %q", name)
+	}
+
+	if d == nil {
+		return nil, nil
+	}
+
+	if client, ok := c.dockerClients[name]; ok {
+		return client, nil
+	}
+
+	client, err := buildDockerClient(*config)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("docker host %q: %s", name, err)
+	}
+
+	if c.dockerClients == nil {
+		c.dockerClients = make(map[string]*docker.Client)
+	}
+
+	c.dockerClients[name] = client
+	return client, nil
+}
+
+// buildJobMiddlewares builds the middlewares of the job composing its config
+// with the global one, the options not set in the job are taken from the
+// global section, the ones set explicitly are kept even if they are the zero
+// value, e.g. `slack-only-on-error = false`, and disables the middlewares in DisableMiddlewares and the
+// ones restricted by MiddlewareTags to tags the job doesn't have.
+func (c *Config) buildJobMiddlewares(j jobConfig) error {
+	m := j.middlewaresConfig()
+	v := reflect.ValueOf(m).Elem()
+	g := reflect.ValueOf(&c.Global).Elem()
+	for i := 0; i < g.NumField(); i++ {
+		f := v.FieldByName(g.Type().Field(i).Name)
+		if f.IsValid() && (!middlewares.IsEmpty(f.Addr().Interface()) || m.isSet(f.Type())) {
+			mergeConfig(f, g.Field(i), m.set)
+		}
+	}
+
+	if err := middlewares.Validate(m); err != nil {
+		return fmt.Errorf("invalid job %q: %s", j.GetName(), err)
+	}
+
+	m.build(j)
+
+	for _, name := range m.DisableMiddlewares {
+		m, ok := middlewareNames[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("invalid job %q: unknown middleware %q", j.GetName(), name)
+		}
+
+		j.Disable(m)
+	}
+
+	for _, route := range c.Global.MiddlewareTags {
+		m, tags, err := parseMiddlewareTags(route)
+		if err != nil {
+			return err
+		}
+
+		if !j.GetTags().HasAny(tags...) {
+			j.Disable(m)
+		}
+	}
+
+	return nil
+}
+
+// parseMiddlewareTags parses a middleware-tags option, e.g.
+// `pagerduty:critical,db`
+func parseMiddlewareTags(route string) (core.Middleware, core.Tags, error) {
+	parts := strings.SplitN(route, ":", 2)
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("invalid middleware-tags %q: expected name:tags", route)
+	}
+
+	m, ok := middlewareNames[strings.TrimSpace(parts[0])]
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid middleware-tags %q: unknown middleware %q", route, parts[0])
+	}
+
+	return m, splitTags(parts[1]), nil
+}
+
+// mergeConfig sets the zero fields of the dst struct to the ones of src, except
+// the ones explicitly set
+func mergeConfig(dst, src reflect.Value, set map[string]bool) {
+	for i := 0; i < dst.NumField(); i++ {
+		if set[optionName(dst.Type().Field(i))] {
+			continue
+		}
+
+		f := dst.Field(i)
+		if reflect.DeepEqual(f.Interface(), reflect.Zero(f.Type()).Interface()) {
+			f.Set(src.Field(i))
+		}
+	}
+}
+
+// optionName returns the name of the option of a config field
+func optionName(f reflect.StructField) string {
+	return strings.ToLower(strings.SplitN(f.Tag.Get("mapstructure"), ",", 2)[0])
+}
+
+// updateScheduler updates the jobs of a scheduler to match the config. The jobs
+// not present in the config are removed and the new or modified ones are
+// added, the unmodified jobs are kept, so their history and running
+// executions are not affected.
+func (c *Config) updateScheduler(sh *core.Scheduler, d *docker.Client) error {
+	built, err := c.buildJobs(d)
+	if err != nil {
+		return err
+	}
+
+	jobs := make(map[string]jobConfig)
+	for _, j := range built {
+		jobs[jobKey(j)] = j
+	}
+
+	for _, j := range sh.GetJobs() {
+		key := jobKey(j)
+		if n, ok := jobs[key]; ok && sameJob(j, n) {
+			delete(jobs, key)
+			continue
+		}
+
+		if err := sh.RemoveJob(j); err != nil {
+			sh.Logger.Errorf("Error removing job %q: %s", j.GetName(), err)
+		}
+	}
+
+	for _, j := range jobs {
+		if err := sh.AddJob(j); err != nil {
+			sh.Logger.Errorf("Error adding job %q: %s", j.GetName(), err)
+		}
+	}
+
+	return nil
+}
+
+// jobKey returns a key identifying the job by its type and name
+func jobKey(j core.Job) string {
+	var t string
+	switch j.(type) {
+	case *ExecJobConfig:
+		t = jobExec
+	case *RunJobConfig:
+		t = jobRun
+	case *LocalJobConfig:
+		t = jobLocal
+	case *HTTPJobConfig:
+		t = jobHTTP
+	case *RunServiceConfig:
+		t = jobServiceRun
+	case *ServiceExecConfig:
+		t = jobServiceExec
+	case *K8sJobConfig:
+		t = jobK8s
+	case *ComposeJobConfig:
+		t = jobCompose
+	case *SSHJobConfig:
+		t = jobSSH
+	case *ECSJobConfig:
+		t = jobECS
+	case *LambdaJobConfig:
+		t = jobLambda
+	case *NomadJobConfig:
+		t = jobNomad
+	}
+
+	return fmt.Sprintf("%s.%s", t, j.GetName())
+}
+
+// sameJob returns true if both jobs have the same configuration
+func sameJob(a, b core.Job) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+
+	return bytes.Equal(ja, jb)
+}
+
+// decodeJobs decodes the values of the jobs of a type, by name, into the map of
+// the config of the type, recording the options set by every job, so they
+// aren't replaced by the global ones, see buildJobMiddlewares.
+func decodeJobs(input map[string]map[string]interface{}, output interface{}, strict bool) error {
+	if err := decode(input, output, strict); err != nil {
+		return err
+	}
+
+	setOptions(input, output)
+	return nil
+}
+
+// decodeContainerJobs decodes the jobs of the labels of the containers without
+// ofelia.service=true like decodeJobs, but without expanding the `${VAR}` of
+// the environment of ofelia, see expandEnv, since anyone able to start a
+// container could read them.
+func decodeContainerJobs(input map[string]map[string]interface{}, output interface{}) error {
+	if err := decodeWith(input, output, false, false); err != nil {
+		return err
+	}
+
+	setOptions(input, output)
+	return nil
+}
+
+// setOptions records the options set in the input of the decoded jobs, see
+// JobMiddlewaresConfig
+func setOptions(input map[string]map[string]interface{}, output interface{}) {
+	jobs := reflect.ValueOf(output).Elem()
+	for name, values := range input {
+		v := jobs.MapIndex(reflect.ValueOf(name))
+		if !v.IsValid() {
+			continue
+		}
+
+		j, ok := v.Interface().(jobConfig)
+		if !ok {
+			continue
+		}
+
+		m := j.middlewaresConfig()
+		m.set = make(map[string]bool, len(values))
+		for k := range values {
+			m.set[strings.ToLower(k)] = true
+		}
+	}
+}
+
+// decode decodes a map of string values into the given config struct, values
+// are converted weakly, e.g. "10s" is parsed into a time.Duration. If strict is
+// true, unknown keys are reported as an error.
+func decode(input, output interface{}, strict bool) error {
+	return decodeWith(input, output, strict, true)
+}
+
+// decodeWith is decode expanding the `${VAR}` of the values only if expand is
+// true, see expandEnv
+func decodeWith(input, output interface{}, strict, expand bool) error {
+	hooks := []mapstructure.DecodeHookFunc{blankHookFunc, lastValueHookFunc, boolHookFunc}
+	if expand {
+		hooks = append(hooks, expandEnvHookFunc)
+	}
+
+	hooks = append(hooks, exitCodesHookFunc, tagsHookFunc, mapstructure.StringToTimeDurationHookFunc())
+	d, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.ComposeDecodeHookFunc(hooks...),
+		WeaklyTypedInput: true,
+		ErrorUnused:      strict,
+		Result:           output,
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.Decode(input)
+}
+
+// envRegexp matches `${VAR}` and `${VAR:-default}`, and `$${VAR}`, escaping it
+var envRegexp = regexp.MustCompile(`\$(\$?)\{(\w+)(?::-([^}]*))?\}`)
+
+// expandEnv replaces the `${VAR}` in the value with the environment variable,
+// or the default of `${VAR:-default}` if it isn't set. The variables not set
+// without default are kept, since they may be meant for the shell of the
+// command, and `$${VAR}` is replaced with a literal `${VAR}`.
+func expandEnv(value string) string {
+	return envRegexp.ReplaceAllStringFunc(value, func(m string) string {
+		parts := envRegexp.FindStringSubmatch(m)
+		if parts[1] != "" {
+			return m[1:]
+		}
+
+		if v, ok := os.LookupEnv(parts[2]); ok {
+			return v
+		}
+
+		if strings.Contains(m, ":-") {
+			return parts[3]
+		}
+
+		return m
+	})
+}
+
+func expandEnvHookFunc(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String {
+		return data, nil
+	}
+
+	return expandEnv(data.(string)), nil
+}
+
+var (
+	blankType        = reflect.TypeOf(blankValue{})
+	deletePolicyType = reflect.TypeOf(core.DeleteAlways)
+)
+
+// blankHookFunc decodes the variables without value of the INI files, true for
+// the booleans, and the delete policies, and empty for the lists, like gcfg
+func blankHookFunc(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f != blankType {
+		return data, nil
 	}
 
-	return d, nil
+	switch {
+	case t.Kind() == reflect.Bool:
+		return true, nil
+	case t == deletePolicyType:
+		return string(core.DeleteAlways), nil
+	case t.Kind() == reflect.Slice:
+		return reflect.Zero(t).Interface(), nil
+	default:
+		return nil, errors.New("blank value not supported for type")
+	}
+}
+
+// lastValueHookFunc decodes the last value of the variables set several times
+// in the INI files, unless they're lists
+func lastValueHookFunc(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	v, ok := data.([]string)
+	if !ok || t.Kind() == reflect.Slice || len(v) == 0 {
+		return data, nil
+	}
+
+	return v[len(v)-1], nil
+}
+
+// boolHookFunc parses the booleans like gcfg, `yes`, `on` and `1` are true and
+// `no`, `off` and `0` false
+func boolHookFunc(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t.Kind() != reflect.Bool {
+		return data, nil
+	}
+
+	b, err := types.ParseBool(data.(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid boolean %q", data)
+	}
+
+	return b, nil
+}
+
+var exitCodesType = reflect.TypeOf(core.ExitCodes{})
+
+// exitCodesHookFunc parses the comma separated lists of exit codes, e.g.
+// `success-exit-codes = 0,2`
+func exitCodesHookFunc(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != exitCodesType {
+		return data, nil
+	}
+
+	var codes core.ExitCodes
+	for _, s := range strings.Split(data.(string), ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid exit code %q", s)
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+var tagsType = reflect.TypeOf(core.Tags{})
+
+// tagsHookFunc parses the comma separated lists of tags, e.g.
+// `tags = db,critical`
+func tagsHookFunc(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != tagsType {
+		return data, nil
+	}
+
+	return splitTags(data.(string)), nil
+}
+
+// splitTags splits a comma separated list of tags, ignoring the empty ones
+func splitTags(s string) core.Tags {
+	var tags core.Tags
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
 }
 
 func (c *Config) buildLogger() core.Logger {
 	stdout := logging.NewLogBackend(os.Stdout, "", 0)
 	// Set the backends to be used.
 	logging.SetBackend(stdout)
-	logging.SetFormatter(logging.MustStringFormatter(logFormat))
+	logging.SetFormatter(logFormatter)
 
 	return logging.MustGetLogger("ofelia")
 }
 
 func (c *Config) buildSchedulerMiddlewares(sh *core.Scheduler) {
+	sh.Use(middlewares.NewLock(&c.Global.LockConfig))
 	sh.Use(middlewares.NewSlack(&c.Global.SlackConfig))
 	sh.Use(middlewares.NewSave(&c.Global.SaveConfig))
 	sh.Use(middlewares.NewMail(&c.Global.MailConfig))
+	sh.Use(middlewares.NewWebhook(&c.Global.WebhookConfig))
+	sh.Use(middlewares.NewS3(&c.Global.S3Config))
+	sh.Use(middlewares.NewTeams(&c.Global.TeamsConfig))
+	sh.Use(middlewares.NewDiscord(&c.Global.DiscordConfig))
+	sh.Use(middlewares.NewPing(&c.Global.PingConfig))
+	sh.Use(middlewares.NewPagerDuty(&c.Global.PagerDutyConfig))
+	sh.Use(middlewares.NewOpsgenie(&c.Global.OpsgenieConfig))
+	sh.Use(middlewares.NewMetrics(&c.Global.MetricsConfig))
+	sh.Use(middlewares.NewSyslog(&c.Global.SyslogConfig))
+	sh.Use(middlewares.NewGELF(&c.Global.GELFConfig))
+	sh.Use(middlewares.NewLoki(&c.Global.LokiConfig))
 }
 
-// ExecJobConfig contains all configuration params needed to build a ExecJob
-type ExecJobConfig struct {
-	core.ExecJob              `mapstructure:",squash"`
-	middlewares.OverlapConfig `mapstructure:",squash"`
-	middlewares.SlackConfig   `mapstructure:",squash"`
-	middlewares.SaveConfig    `mapstructure:",squash"`
-	middlewares.MailConfig    `mapstructure:",squash"`
+// JobMiddlewaresConfig contains the configuration of the middlewares of a job,
+// embedded in the configuration of every job type
+type JobMiddlewaresConfig struct {
+	middlewares.OverlapConfig   `mapstructure:",squash"`
+	middlewares.LockConfig      `mapstructure:",squash"`
+	middlewares.SlackConfig     `mapstructure:",squash"`
+	middlewares.SaveConfig      `mapstructure:",squash"`
+	middlewares.MailConfig      `mapstructure:",squash"`
+	middlewares.WebhookConfig   `mapstructure:",squash"`
+	middlewares.S3Config        `mapstructure:",squash"`
+	middlewares.TeamsConfig     `mapstructure:",squash"`
+	middlewares.DiscordConfig   `mapstructure:",squash"`
+	middlewares.PingConfig      `mapstructure:",squash"`
+	middlewares.PagerDutyConfig `mapstructure:",squash"`
+	middlewares.OpsgenieConfig  `mapstructure:",squash"`
+	middlewares.MetricsConfig   `mapstructure:",squash"`
+	middlewares.SyslogConfig    `mapstructure:",squash"`
+	middlewares.GELFConfig      `mapstructure:",squash"`
+	middlewares.LokiConfig      `mapstructure:",squash"`
+
+	// DisableMiddlewares are the names of the middlewares, usually set in the
+	// global section, not used by the job
+	DisableMiddlewares []string `mapstructure:"disable-middlewares"`
+
+	// set are the options set in the config of the job, in lower case, see
+	// decodeJobs
+	set map[string]bool
+}
+
+func (c *JobMiddlewaresConfig) middlewaresConfig() *JobMiddlewaresConfig {
+	return c
+}
+
+// isSet returns true if any option of the given middleware config was set in
+// the config of the job
+func (c *JobMiddlewaresConfig) isSet(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if c.set[optionName(t.Field(i))] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// build adds the middlewares of the config to the job
+func (c *JobMiddlewaresConfig) build(j core.Job) {
+	j.Use(middlewares.NewOverlap(&c.OverlapConfig))
+	j.Use(middlewares.NewLock(&c.LockConfig))
+	j.Use(middlewares.NewSlack(&c.SlackConfig))
+	j.Use(middlewares.NewSave(&c.SaveConfig))
+	j.Use(middlewares.NewMail(&c.MailConfig))
+	j.Use(middlewares.NewWebhook(&c.WebhookConfig))
+	j.Use(middlewares.NewS3(&c.S3Config))
+	j.Use(middlewares.NewTeams(&c.TeamsConfig))
+	j.Use(middlewares.NewDiscord(&c.DiscordConfig))
+	j.Use(middlewares.NewPing(&c.PingConfig))
+	j.Use(middlewares.NewPagerDuty(&c.PagerDutyConfig))
+	j.Use(middlewares.NewOpsgenie(&c.OpsgenieConfig))
+	j.Use(middlewares.NewMetrics(&c.MetricsConfig))
+	j.Use(middlewares.NewSyslog(&c.SyslogConfig))
+	j.Use(middlewares.NewGELF(&c.GELFConfig))
+	j.Use(middlewares.NewLoki(&c.LokiConfig))
 }
 
-func (c *ExecJobConfig) buildMiddlewares() {
-	c.ExecJob.Use(middlewares.NewOverlap(&c.OverlapConfig))
-	c.ExecJob.Use(middlewares.NewSlack(&c.SlackConfig))
-	c.ExecJob.Use(middlewares.NewSave(&c.SaveConfig))
-	c.ExecJob.Use(middlewares.NewMail(&c.MailConfig))
+// ExecJobConfig contains all configuration params needed to build a ExecJob
+type ExecJobConfig struct {
+	core.ExecJob         `mapstructure:",squash"`
+	JobMiddlewaresConfig `mapstructure:",squash"`
+	// DockerHost is the name of the docker daemon of the job, one of the
+	// docker sections, by default the one of the global section
+	DockerHost string `mapstructure:"host"`
 }
 
 // RunServiceConfig contains all configuration params needed to build a RunJob
 type RunServiceConfig struct {
-	core.RunServiceJob        `mapstructure:",squash"`
-	middlewares.OverlapConfig `mapstructure:",squash"`
-	middlewares.SlackConfig   `mapstructure:",squash"`
-	middlewares.SaveConfig    `mapstructure:",squash"`
-	middlewares.MailConfig    `mapstructure:",squash"`
+	core.RunServiceJob   `mapstructure:",squash"`
+	JobMiddlewaresConfig `mapstructure:",squash"`
 }
 
 type RunJobConfig struct {
-	core.RunJob               `mapstructure:",squash"`
-	middlewares.OverlapConfig `mapstructure:",squash"`
-	middlewares.SlackConfig   `mapstructure:",squash"`
-	middlewares.SaveConfig    `mapstructure:",squash"`
-	middlewares.MailConfig    `mapstructure:",squash"`
+	core.RunJob          `mapstructure:",squash"`
+	JobMiddlewaresConfig `mapstructure:",squash"`
+	// DockerHost is the name of the docker daemon of the job, one of the
+	// docker sections, by default the one of the global section
+	DockerHost string `mapstructure:"host"`
 }
 
-func (c *RunJobConfig) buildMiddlewares() {
-	c.RunJob.Use(middlewares.NewOverlap(&c.OverlapConfig))
-	c.RunJob.Use(middlewares.NewSlack(&c.SlackConfig))
-	c.RunJob.Use(middlewares.NewSave(&c.SaveConfig))
-	c.RunJob.Use(middlewares.NewMail(&c.MailConfig))
+// ServiceExecConfig contains all configuration params needed to build a
+// ServiceExecJob
+type ServiceExecConfig struct {
+	core.ServiceExecJob  `mapstructure:",squash"`
+	JobMiddlewaresConfig `mapstructure:",squash"`
 }
 
-// LocalJobConfig contains all configuration params needed to build a RunJob
-type LocalJobConfig struct {
-	core.LocalJob             `mapstructure:",squash"`
-	middlewares.OverlapConfig `mapstructure:",squash"`
-	middlewares.SlackConfig   `mapstructure:",squash"`
-	middlewares.SaveConfig    `mapstructure:",squash"`
-	middlewares.MailConfig    `mapstructure:",squash"`
+// K8sJobConfig contains all configuration params needed to build a K8sJob
+type K8sJobConfig struct {
+	core.K8sJob          `mapstructure:",squash"`
+	JobMiddlewaresConfig `mapstructure:",squash"`
+}
+
+// ComposeJobConfig contains all configuration params needed to build a
+// ComposeJob
+type ComposeJobConfig struct {
+	core.ComposeJob      `mapstructure:",squash"`
+	JobMiddlewaresConfig `mapstructure:",squash"`
+}
+
+// SSHJobConfig contains all configuration params needed to build a SSHJob
+type SSHJobConfig struct {
+	core.SSHJob          `mapstructure:",squash"`
+	JobMiddlewaresConfig `mapstructure:",squash"`
 }
 
-func (c *LocalJobConfig) buildMiddlewares() {
-	c.LocalJob.Use(middlewares.NewOverlap(&c.OverlapConfig))
-	c.LocalJob.Use(middlewares.NewSlack(&c.SlackConfig))
-	c.LocalJob.Use(middlewares.NewSave(&c.SaveConfig))
-	c.LocalJob.Use(middlewares.NewMail(&c.MailConfig))
+// ECSJobConfig contains all configuration params needed to build an ECSJob
+type ECSJobConfig struct {
+	core.ECSJob          `mapstructure:",squash"`
+	JobMiddlewaresConfig `mapstructure:",squash"`
+}
+
+// LambdaJobConfig contains all configuration params needed to build a
+// LambdaJob
+type LambdaJobConfig struct {
+	core.LambdaJob       `mapstructure:",squash"`
+	JobMiddlewaresConfig `mapstructure:",squash"`
+}
+
+// NomadJobConfig contains all configuration params needed to build a NomadJob
+type NomadJobConfig struct {
+	core.NomadJob        `mapstructure:",squash"`
+	JobMiddlewaresConfig `mapstructure:",squash"`
+}
+
+// LocalJobConfig contains all configuration params needed to build a RunJob
+type LocalJobConfig struct {
+	core.LocalJob        `mapstructure:",squash"`
+	JobMiddlewaresConfig `mapstructure:",squash"`
 }
 
-func (c *RunServiceConfig) buildMiddlewares() {
-	c.RunServiceJob.Use(middlewares.NewOverlap(&c.OverlapConfig))
-	c.RunServiceJob.Use(middlewares.NewSlack(&c.SlackConfig))
-	c.RunServiceJob.Use(middlewares.NewSave(&c.SaveConfig))
-	c.RunServiceJob.Use(middlewares.NewMail(&c.MailConfig))
+// HTTPJobConfig contains all configuration params needed to build a HTTPJob
+type HTTPJobConfig struct {
+	core.HTTPJob         `mapstructure:",squash"`
+	JobMiddlewaresConfig `mapstructure:",squash"`
 }
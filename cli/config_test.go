@@ -1,8 +1,15 @@
 package cli
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
+	docker "github.com/fsouza/go-dockerclient"
+	dockertest "github.com/fsouza/go-dockerclient/testing"
 	"github.com/mcuadros/ofelia/core"
 	"github.com/mcuadros/ofelia/middlewares"
 	. "gopkg.in/check.v1"
@@ -30,15 +37,785 @@ func (s *SuiteConfig) TestBuildFromString(c *C) {
 
 		[job-service-run "bob"]
 		schedule = @every 10s
+
+		[job-service-exec "eve"]
+		schedule = @every 10s
+		service = web
+
+		[job-http "alice"]
+		schedule = @every 10s
+		url = http://example.com
+
+		[job-k8s "carol"]
+		schedule = @every 10s
+		image = busybox
+
+		[job-compose "dave"]
+		schedule = @every 10s
+		service = cron
+
+		[job-ssh "erin"]
+		schedule = @every 10s
+		host = example.com
+		command = uptime
+
+		[job-ecs "frank"]
+		schedule = @every 10s
+		cluster = default
+		task-definition = report
+
+		[job-lambda "grace"]
+		schedule = @every 10s
+		function = report
+
+		[job-nomad "heidi"]
+		schedule = @every 10s
+		job = report
+  `)
+
+	c.Assert(err, IsNil)
+	c.Assert(sh.Jobs, HasLen, 13)
+}
+
+func (s *SuiteConfig) TestBuildFromStringInvalid(c *C) {
+	_, err := BuildFromString(`
+		[job-run "foo"]
+		schedule = @every 10s
+		foo = bar
+  `)
+
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteConfig) TestBuildFromStringInvalidSchedule(c *C) {
+	_, err := BuildFromString(`
+		[global]
+		cron-format = standard
+
+		[job-local "foo"]
+		schedule = 0 25 * * *
+		command = echo foo
+  `)
+
+	c.Assert(err, ErrorMatches, `invalid job "foo": invalid schedule "0 25 \* \* \*": .*`)
+}
+
+func (s *SuiteConfig) TestBuildFromStringCronFormat(c *C) {
+	sh, err := BuildFromString(`
+		[job-local "foo"]
+		schedule = 0 1 * * *
+		command = echo foo
+  `)
+	c.Assert(err, IsNil)
+	c.Assert(sh.CronFormat, Equals, "")
+
+	now := time.Date(2020, 1, 1, 12, 30, 0, 0, time.Local)
+	c.Assert(sh.NextRuns(now, 1)["foo"], DeepEquals, []time.Time{time.Date(2020, 1, 1, 13, 1, 0, 0, time.Local)})
+
+	_, err = BuildFromString(`
+		[global]
+		cron-format = foo
+
+		[job-local "foo"]
+		schedule = 0 1 * * *
+		command = echo foo
+  `)
+	c.Assert(err, ErrorMatches, `invalid cron-format "foo": .*`)
+}
+
+func (s *SuiteConfig) TestBuildFromStringRedact(c *C) {
+	sh, err := BuildFromString(`
+		[global]
+		redact-env = DB_PASSWORD
+		redact-pattern = "token=\\w+"
+
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+  `)
+
+	c.Assert(err, IsNil)
+	c.Assert(sh.Redaction.Env, DeepEquals, []string{"DB_PASSWORD"})
+	c.Assert(sh.Redaction.Patterns, HasLen, 1)
+
+	_, err = BuildFromString(`
+		[global]
+		redact-pattern = (
+
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+  `)
+
+	c.Assert(err, ErrorMatches, `invalid redact pattern .*`)
+}
+
+func (s *SuiteConfig) TestBuildFromIniSyntax(c *C) {
+	conf := &Config{}
+	err := conf.buildFromIni([]byte(`
+		; comment
+		[Job-Local "foo"]
+		Schedule = @every 10s
+		command = sh -c "echo foo; echo '#bar'" ;comment
+		environment = FOO=foo
+		environment
+		environment = BAR=bar \
+baz
+		no-overlap
+		run-on-startup = yes
+		run-on-startup = off
+
+		[job-local "foo"]
+		dir = /tmp
+  `))
+
+	c.Assert(err, IsNil)
+	j := conf.LocalJobs["foo"]
+	c.Assert(j.Schedule, Equals, "@every 10s")
+	c.Assert(j.Command, Equals, "sh -c echo foo; echo '#bar'")
+	c.Assert(j.Environment, DeepEquals, []string{"BAR=bar baz"})
+	c.Assert(j.NoOverlap, Equals, true)
+	c.Assert(j.RunOnStartup, Equals, false)
+	c.Assert(j.Dir, Equals, "/tmp")
+
+	for _, config := range []string{
+		"[global]\nfoo = bar",
+		"[global]\nredact-pattern = \\w",
+		"[global]\nslack-webhook = \"foo",
+		"[global]\nslack-webhook",
+		"[global]\nslack-only-on-error = maybe",
+		"[job-local]\ncommand = foo",
+		"command = foo",
+	} {
+		err := (&Config{}).buildFromIni([]byte(config))
+		c.Assert(err, NotNil, Commentf("%s", config))
+	}
+}
+
+func (s *SuiteConfig) TestBuildFromStringMaxConcurrentJobs(c *C) {
+	sh, err := BuildFromString(`
+		[global]
+		max-concurrent-jobs = 2
+		max-queue-time = 10m
+		watchdog-tolerance = 5m
+		max-parallel-pulls = 2
+
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+	`)
+
+	c.Assert(err, IsNil)
+	c.Assert(sh.MaxConcurrentJobs, Equals, 2)
+	c.Assert(sh.MaxQueueTime, Equals, time.Minute*10)
+	c.Assert(sh.WatchdogTolerance, Equals, time.Minute*5)
+	c.Assert(sh.MaxParallelPulls, Equals, 2)
+}
+
+func (s *SuiteConfig) TestBuildFromIni(c *C) {
+	conf := &Config{}
+	err := conf.buildFromIni([]byte(`
+		[global]
+		slack-only-on-error = true
+
+		[job-run "foo"]
+		schedule = @every 10s
+		command = echo \"foo bar\" # comment
+		max-runtime = 1m30s
+		verify-key = /etc/ofelia/cosign.pub
+
+		[job-local "bar"]
+		schedule = @every 10s
+		environment = FOO=foo
+		environment = BAR=bar
+
+		[job-http "qux"]
+		schedule = @every 10s
+		url = http://example.com
+		expected-status = 200
+		expected-status = 204
+
+		[job-exec "baz"]
+		schedule = @every 10s
+		container = web
+		user = www-data
+		tty = true
+  `))
+
+	c.Assert(err, IsNil)
+	c.Assert(conf.Global.SlackOnlyOnError, Equals, true)
+	c.Assert(conf.RunJobs["foo"].Command, Equals, `echo "foo bar"`)
+	c.Assert(conf.RunJobs["foo"].MaxRuntime, Equals, time.Minute+time.Second*30)
+	c.Assert(conf.RunJobs["foo"].VerifyKey, Equals, "/etc/ofelia/cosign.pub")
+	c.Assert(conf.LocalJobs["bar"].Environment, DeepEquals, []string{"FOO=foo", "BAR=bar"})
+	c.Assert(conf.HTTPJobs["qux"].ExpectedStatus, DeepEquals, []int{200, 204})
+	c.Assert(conf.ExecJobs["baz"].User, Equals, "www-data")
+	c.Assert(conf.ExecJobs["baz"].TTY, Equals, true)
+}
+
+func (s *SuiteConfig) TestBuildFromIniEnv(c *C) {
+	os.Setenv("OFELIA_TEST_IMAGE", "busybox")
+	os.Setenv("OFELIA_TEST_RUNTIME", "1m")
+	defer os.Unsetenv("OFELIA_TEST_IMAGE")
+	defer os.Unsetenv("OFELIA_TEST_RUNTIME")
+
+	conf := &Config{}
+	err := conf.buildFromIni([]byte(`
+		[job-run "foo"]
+		schedule = ${OFELIA_TEST_SCHEDULE:-@every 10s}
+		image = ${OFELIA_TEST_IMAGE}:latest
+		command = sh -c 'echo ${HOME} $${OFELIA_TEST_IMAGE}'
+		max-runtime = ${OFELIA_TEST_RUNTIME}
+		volume = /srv/${OFELIA_TEST_IMAGE}:/data
+		volume = /tmp:/tmp
+  `))
+
+	c.Assert(err, IsNil)
+	c.Assert(conf.RunJobs["foo"].Schedule, Equals, "@every 10s")
+	c.Assert(conf.RunJobs["foo"].Image, Equals, "busybox:latest")
+	c.Assert(conf.RunJobs["foo"].Command, Equals, `sh -c 'echo `+os.Getenv("HOME")+` ${OFELIA_TEST_IMAGE}'`)
+	c.Assert(conf.RunJobs["foo"].MaxRuntime, Equals, time.Minute)
+	c.Assert(conf.RunJobs["foo"].Volume, DeepEquals, []string{"/srv/busybox:/data", "/tmp:/tmp"})
+}
+
+func (s *SuiteConfig) TestBuildFromIniDefaults(c *C) {
+	conf := &Config{}
+	err := conf.buildFromIni([]byte(`
+		[defaults "job-run"]
+		user = nobody
+		network = backend
+		pull = never
+		max-runtime = 1m
+
+		[job-run "foo"]
+		schedule = @every 10s
+		image = busybox
+
+		[job-run "bar"]
+		schedule = @every 10s
+		image = alpine
+		pull = always
+
+		[job-local "baz"]
+		schedule = @every 10s
+		command = echo baz
+  `))
+
+	c.Assert(err, IsNil)
+	c.Assert(conf.RunJobs["foo"].User, Equals, "nobody")
+	c.Assert(conf.RunJobs["foo"].Network, Equals, "backend")
+	c.Assert(conf.RunJobs["foo"].Pull, Equals, core.PullNever)
+	c.Assert(conf.RunJobs["foo"].MaxRuntime, Equals, time.Minute)
+	c.Assert(conf.RunJobs["bar"].Pull, Equals, core.PullAlways)
+	c.Assert(conf.RunJobs["bar"].Network, Equals, "backend")
+	c.Assert(conf.LocalJobs["baz"].Command, Equals, "echo baz")
+}
+
+func (s *SuiteConfig) TestBuildFromIniDefaultsInvalid(c *C) {
+	err := (&Config{}).buildFromIni([]byte(`
+		[defaults "job-local"]
+		image = busybox
+  `))
+	c.Assert(err, ErrorMatches, `(?s)invalid defaults of job-local jobs: .*image`)
+
+	err = (&Config{}).buildFromIni([]byte(`
+		[defaults "job-foo"]
+		user = nobody
+  `))
+	c.Assert(err, ErrorMatches, `unknown job type "job-foo"`)
+}
+
+func (s *SuiteConfig) TestBuildFromIniExitCodes(c *C) {
+	conf := &Config{}
+	err := conf.buildFromIni([]byte(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = rsync -a /src /dst
+		success-exit-codes = 0, 2
+		warning-exit-codes = 24
+  `))
+
+	c.Assert(err, IsNil)
+	c.Assert(conf.LocalJobs["foo"].SuccessExitCodes, DeepEquals, core.ExitCodes{0, 2})
+	c.Assert(conf.LocalJobs["foo"].WarningExitCodes, DeepEquals, core.ExitCodes{24})
+
+	err = (&Config{}).buildFromIni([]byte(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = grep foo
+		success-exit-codes = 0,one
+  `))
+	c.Assert(err, ErrorMatches, `(?s).*invalid exit code "one".*`)
+}
+
+func (s *SuiteConfig) TestBuildFromIniTags(c *C) {
+	conf := &Config{}
+	err := conf.buildFromIni([]byte(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+		tags = db, critical,
+  `))
+
+	c.Assert(err, IsNil)
+	c.Assert(conf.LocalJobs["foo"].Tags, DeepEquals, core.Tags{"db", "critical"})
+}
+
+func (s *SuiteConfig) TestExpandEnv(c *C) {
+	os.Setenv("OFELIA_TEST_FOO", "foo")
+	defer os.Unsetenv("OFELIA_TEST_FOO")
+
+	c.Assert(expandEnv("${OFELIA_TEST_FOO}-${OFELIA_TEST_FOO}"), Equals, "foo-foo")
+	c.Assert(expandEnv("${OFELIA_TEST_BAR:-bar}"), Equals, "bar")
+	c.Assert(expandEnv("${OFELIA_TEST_BAR:-}"), Equals, "")
+	c.Assert(expandEnv("${OFELIA_TEST_BAR}"), Equals, "${OFELIA_TEST_BAR}")
+	c.Assert(expandEnv("$${OFELIA_TEST_FOO}"), Equals, "${OFELIA_TEST_FOO}")
+	c.Assert(expandEnv("$OFELIA_TEST_FOO"), Equals, "$OFELIA_TEST_FOO")
+}
+
+func (s *SuiteConfig) TestLabelsExpandEnv(c *C) {
+	os.Setenv("OFELIA_TEST_FOO", "foo")
+	defer os.Unsetenv("OFELIA_TEST_FOO")
+
+	labels := map[string]map[string]string{
+		"ofelia": map[string]string{
+			serviceLabel: "true",
+			labelPrefix + "." + jobExec + ".job1.schedule": "@every 5s",
+			labelPrefix + "." + jobExec + ".job1.command":  "echo ${OFELIA_TEST_FOO}",
+		},
+		"some": map[string]string{
+			labelPrefix + "." + jobExec + ".job2.schedule": "@every 5s",
+			labelPrefix + "." + jobExec + ".job2.command":  "echo ${OFELIA_TEST_FOO}",
+		},
+	}
+
+	var conf Config
+	c.Assert(conf.buildFromDockerLabels(labels), IsNil)
+	c.Assert(conf.ExecJobs["job1"].Command, Equals, "echo foo")
+	c.Assert(conf.ExecJobs["job2"].Command, Equals, "echo ${OFELIA_TEST_FOO}")
+	c.Assert(conf.ExecJobs["job2"].Container, Equals, "some")
+	c.Assert(conf.ExecJobs["job1"].NoEnvPassthrough, Equals, false)
+	c.Assert(conf.ExecJobs["job2"].NoEnvPassthrough, Equals, true)
+
+	labels["some"][labelPrefix+"."+jobExec+".job1.command"] = "echo bar"
+	conf = Config{}
+	c.Assert(conf.buildFromDockerLabels(labels), ErrorMatches, `job-exec job "job1" is defined by the service container and container "some"`)
+}
+
+func (s *SuiteConfig) TestUpdateScheduler(c *C) {
+	sh, err := BuildFromString(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+
+		[job-local "bar"]
+		schedule = @every 10s
+		command = echo bar
+
+		[job-local "qux"]
+		schedule = @every 10s
+		command = echo qux
   `)
+	c.Assert(err, IsNil)
+
+	foo, bar := sh.GetJob("foo"), sh.GetJob("bar")
+
+	conf := &Config{}
+	err = conf.buildFromIni([]byte(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
 
+		[job-local "bar"]
+		schedule = @every 20s
+		command = echo bar
+
+		[job-exec "baz"]
+		schedule = @every 10s
+		command = echo baz
+  `))
 	c.Assert(err, IsNil)
-	c.Assert(sh.Jobs, HasLen, 5)
+
+	c.Assert(conf.updateScheduler(sh, nil), IsNil)
+	c.Assert(sh.Jobs, HasLen, 3)
+	c.Assert(sh.GetJob("qux"), IsNil)
+	c.Assert(sh.GetJob("baz"), NotNil)
+	c.Assert(sh.GetJob("foo"), Equals, foo)
+	c.Assert(sh.GetJob("bar"), Not(Equals), bar)
+	c.Assert(sh.GetJob("bar").GetSchedule(), Equals, "@every 20s")
+}
+
+func (s *SuiteConfig) TestBuildJobMiddlewares(c *C) {
+	sh, err := BuildFromString(`
+		[global]
+		slack-webhook = http://example.com/slack
+		save-folder = /tmp
+
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+		slack-only-on-error = true
+		disable-middlewares = save
+
+		[job-local "bar"]
+		schedule = @every 10s
+		command = echo bar
+  `)
+	c.Assert(err, IsNil)
+
+	foo := sh.GetJob("foo").(*LocalJobConfig)
+	c.Assert(foo.SlackWebhook, Equals, "http://example.com/slack")
+	c.Assert(foo.SlackOnlyOnError, Equals, true)
+	c.Assert(foo.SaveFolder, Equals, "")
+
+	bar := sh.GetJob("bar").(*LocalJobConfig)
+	c.Assert(bar.SlackWebhook, Equals, "")
+
+	foo.Use(sh.Middlewares()...)
+	c.Assert(foo.Middlewares(), HasLen, 1)
+	c.Assert(foo.Middlewares()[0].(*middlewares.Slack).SlackOnlyOnError, Equals, true)
+
+	bar.Use(sh.Middlewares()...)
+	c.Assert(bar.Middlewares(), HasLen, 2)
+	c.Assert(bar.Middlewares()[0].(*middlewares.Slack).SlackOnlyOnError, Equals, false)
+
+	_, err = BuildFromString(`
+		[job-local "foo"]
+		schedule = @every 10s
+		disable-middlewares = foo
+  `)
+	c.Assert(err, ErrorMatches, `invalid job "foo": unknown middleware "foo"`)
+}
+
+func (s *SuiteConfig) TestBuildJobsDeletePolicy(c *C) {
+	_, err := BuildFromString(`
+		[job-run "foo"]
+		schedule = @every 10s
+		image = alpine
+		delete = on-failure
+  `)
+	c.Assert(err, ErrorMatches, `invalid job "foo": unknown delete policy "on-failure"`)
+
+	conf := &Config{}
+	c.Assert(conf.buildFromIni([]byte(`
+		[job-run "foo"]
+		schedule = @every 10s
+		image = alpine
+		delete = No
+
+		[job-run "bar"]
+		schedule = @every 10s
+		image = alpine
+		delete
+
+		[job-k8s "baz"]
+		schedule = @every 10s
+		image = alpine
+		delete = off
+  `)), IsNil)
+
+	_, err = conf.buildJobs(nil)
+	c.Assert(err, IsNil)
+	c.Assert(conf.RunJobs["foo"].Delete, Equals, core.DeletePolicy("No"))
+	c.Assert(conf.RunJobs["bar"].Delete, Equals, core.DeleteAlways)
+	c.Assert(conf.K8sJobs["baz"].Delete, Equals, core.DeletePolicy("off"))
+}
+
+func (s *SuiteConfig) TestBuildJobsImageVerification(c *C) {
+	_, err := BuildFromString(`
+		[job-service-run "foo"]
+		schedule = @every 10s
+		image = alpine
+		verify-key = cosign.pub
+		verify-identity = foo
+  `)
+	c.Assert(err, ErrorMatches, `invalid job "foo": verify-key can't be combined .*`)
+
+	_, err = BuildFromString(`
+		[job-run "foo"]
+		schedule = @every 10s
+		image = alpine
+		verify-key = cosign.pub
+		verify-command = /tmp/foo
+  `)
+	c.Assert(err, NotNil)
+
+	sh, err := BuildFromString(`
+		[global]
+		verify-command = /usr/local/bin/cosign
+  `)
+	c.Assert(err, IsNil)
+	c.Assert(sh.VerifyCommand, Equals, "/usr/local/bin/cosign")
+}
+
+func (s *SuiteConfig) TestBuildJobMiddlewaresNotifyOn(c *C) {
+	_, err := BuildFromString(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+		slack-webhook = http://example.com/slack
+		slack-notify-on = errors
+  `)
+	c.Assert(err, ErrorMatches, `invalid job "foo": invalid slack-notify-on "errors": .*`)
+
+	_, err = BuildFromString(`
+		[global]
+		save-folder = /tmp
+		save-notify-on = failure
+  `)
+	c.Assert(err, ErrorMatches, `invalid save-notify-on "failure": .*`)
+}
+
+func (s *SuiteConfig) TestBuildJobMiddlewaresSave(c *C) {
+	_, err := BuildFromString(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+		save-folder = /tmp
+		save-path = {{.Job
+  `)
+	c.Assert(err, ErrorMatches, `invalid job "foo": invalid save-path "\{\{.Job": .*`)
+
+	_, err = BuildFromString(`
+		[global]
+		save-folder = /tmp
+		save-format = csv
+  `)
+	c.Assert(err, ErrorMatches, `invalid save-format "csv": expected files or jsonl`)
+}
+
+func (s *SuiteConfig) TestBuildJobMiddlewaresSyslog(c *C) {
+	_, err := BuildFromString(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+		syslog-address = udp://localhost:514
+		syslog-facility = foo
+  `)
+	c.Assert(err, ErrorMatches, `invalid job "foo": invalid syslog-facility "foo"`)
+
+	_, err = BuildFromString(`
+		[global]
+		syslog-address = localhost:514
+  `)
+	c.Assert(err, ErrorMatches, `invalid syslog-address "localhost:514"`)
+}
+
+func (s *SuiteConfig) TestBuildJobMiddlewaresZeroValue(c *C) {
+	sh, err := BuildFromString(`
+		[global]
+		slack-webhook = http://example.com/slack
+		slack-only-on-error = true
+
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+		slack-only-on-error = false
+
+		[job-local "bar"]
+		schedule = @every 10s
+		command = echo bar
+		slack-channel = bar
+  `)
+	c.Assert(err, IsNil)
+
+	foo := sh.GetJob("foo").(*LocalJobConfig)
+	c.Assert(foo.SlackWebhook, Equals, "http://example.com/slack")
+	c.Assert(foo.SlackOnlyOnError, Equals, false)
+
+	bar := sh.GetJob("bar").(*LocalJobConfig)
+	c.Assert(bar.SlackWebhook, Equals, "http://example.com/slack")
+	c.Assert(bar.SlackOnlyOnError, Equals, true)
+}
+
+func (s *SuiteConfig) TestBuildJobMiddlewaresTags(c *C) {
+	sh, err := BuildFromString(`
+		[global]
+		slack-webhook = http://example.com/slack
+		save-folder = /tmp
+		middleware-tags = slack:critical,db
+
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+		tags = critical
+
+		[job-local "bar"]
+		schedule = @every 10s
+		command = echo bar
+		tags = web
+		save-folder = /var/log
+  `)
+	c.Assert(err, IsNil)
+
+	foo := sh.GetJob("foo")
+	foo.Use(sh.Middlewares()...)
+	c.Assert(foo.Middlewares(), HasLen, 2)
+	c.Assert(foo.Middlewares()[0], FitsTypeOf, &middlewares.Slack{})
+
+	bar := sh.GetJob("bar")
+	bar.Use(sh.Middlewares()...)
+	c.Assert(bar.Middlewares(), HasLen, 1)
+	c.Assert(bar.Middlewares()[0].(*middlewares.Save).SaveFolder, Equals, "/var/log")
+
+	_, err = BuildFromString(`
+		[global]
+		middleware-tags = foo:critical
+
+		[job-local "foo"]
+		schedule = @every 10s
+  `)
+	c.Assert(err, ErrorMatches, `invalid middleware-tags "foo:critical": unknown middleware "foo"`)
+
+	_, err = BuildFromString(`
+		[global]
+		middleware-tags = critical
+
+		[job-local "foo"]
+		schedule = @every 10s
+  `)
+	c.Assert(err, ErrorMatches, `invalid middleware-tags "critical": expected name:tags`)
+}
+
+func (s *SuiteConfig) TestReloadFromFile(c *C) {
+	file, err := ioutil.TempFile("", "ofelia")
+	c.Assert(err, IsNil)
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+  `)
+	c.Assert(err, IsNil)
+	c.Assert(file.Close(), IsNil)
+
+	config := &Config{}
+	c.Assert(config.buildFromIni([]byte(`
+		[job-local "bar"]
+		schedule = @every 10s
+		command = echo bar
+  `)), IsNil)
+
+	sh, err := config.build()
+	c.Assert(err, IsNil)
+
+	err = config.reloadFromFiles(sh, file.Name(), "")
+	c.Assert(err, IsNil)
+	c.Assert(sh.Jobs, HasLen, 1)
+	c.Assert(sh.Jobs[0].GetName(), Equals, "foo")
+
+	err = config.reloadFromFiles(sh, "/non-existent-file", "")
+	c.Assert(err, NotNil)
+	c.Assert(sh.Jobs, HasLen, 1)
+}
+
+func (s *SuiteConfig) TestChangedOptions(c *C) {
+	a, b := &Config{}, &Config{}
+	c.Assert(a.buildFromIni([]byte(`
+		[global]
+		slack-webhook = http://foo
+		cron-format = seconds
+  `)), IsNil)
+	c.Assert(b.buildFromIni([]byte(`
+		[global]
+		slack-webhook = http://bar
+		cron-format = seconds
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+  `)), IsNil)
+
+	c.Assert(changedOptions(a.Global, a.Global), HasLen, 0)
+	c.Assert(changedOptions(a.Global, b.Global), DeepEquals, []string{"slack-webhook"})
+}
+
+func (s *SuiteConfig) TestBuildFromFiles(c *C) {
+	dir := c.MkDir()
+	file := filepath.Join(dir, "ofelia.conf")
+	c.Assert(ioutil.WriteFile(file, []byte(`
+		[global]
+		slack-webhook = http://foo
+		slack-only-on-error = true
+
+		[defaults "job-local"]
+		dir = /tmp
+	`), 0644), IsNil)
+
+	confd := filepath.Join(dir, "conf.d")
+	c.Assert(os.Mkdir(confd, 0755), IsNil)
+	for name, content := range map[string]string{
+		"10-foo.ini":  "[global]\nslack-webhook = http://bar\n[job-local \"foo\"]\nschedule = @hourly\ncommand = echo foo",
+		"20-bar.yml":  "job-local:\n  bar:\n    schedule: '@daily'\n    command: echo bar",
+		".hidden.ini": "[job-local \"qux\"]\ncommand = echo qux",
+		"README.md":   "# jobs",
+	} {
+		c.Assert(ioutil.WriteFile(filepath.Join(confd, name), []byte(content), 0644), IsNil)
+	}
+
+	conf := &Config{}
+	c.Assert(conf.buildFromFiles(file, confd), IsNil)
+	c.Assert(conf.Global.SlackWebhook, Equals, "http://bar")
+	c.Assert(conf.Global.SlackOnlyOnError, Equals, true)
+	c.Assert(conf.LocalJobs, HasLen, 2)
+	c.Assert(conf.LocalJobs["foo"].Command, Equals, "echo foo")
+	c.Assert(conf.LocalJobs["foo"].Dir, Equals, "/tmp")
+	c.Assert(conf.LocalJobs["bar"].Dir, Equals, "/tmp")
+
+	// the file is optional with a directory
+	conf = &Config{}
+	c.Assert(conf.buildFromFiles(filepath.Join(dir, "missing.conf"), confd), IsNil)
+	c.Assert(conf.LocalJobs, HasLen, 2)
+
+	err := ioutil.WriteFile(filepath.Join(confd, "30-foo.ini"), []byte("[job-local \"foo\"]\ncommand = echo foo"), 0644)
+	c.Assert(err, IsNil)
+	err = (&Config{}).buildFromFiles(file, confd)
+	c.Assert(err, ErrorMatches, `error reading ".*30-foo.ini": job-local "foo" is already defined`)
+}
+
+func (s *SuiteConfig) TestBuildJobsDockerHost(c *C) {
+	server, err := dockertest.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, IsNil)
+	defer server.Stop()
+
+	conf := &Config{}
+	err = conf.buildFromIni([]byte(`
+		[docker "remote"]
+		docker-host = ` + server.URL() + `
+
+		[job-run "foo"]
+		schedule = @every 10s
+		image = busybox
+		host = remote
+
+		[job-exec "bar"]
+		schedule = @every 10s
+		container = qux
+		host = remote
+
+		[job-run "baz"]
+		schedule = @every 10s
+		image = busybox
+	`))
+	c.Assert(err, IsNil)
+
+	local, err := docker.NewClient("unix:///var/run/docker.sock")
+	c.Assert(err, IsNil)
+
+	_, err = conf.buildJobs(local)
+	c.Assert(err, IsNil)
+	c.Assert(conf.RunJobs["foo"].Client.Endpoint(), Equals, server.URL())
+	c.Assert(conf.ExecJobs["bar"].Client, Equals, conf.RunJobs["foo"].Client)
+	c.Assert(conf.RunJobs["baz"].Client, Equals, local)
+
+	conf.RunJobs["baz"].DockerHost = "qux"
+	_, err = conf.buildJobs(nil)
+	c.Assert(err, ErrorMatches, `invalid job "baz": unknown docker host "qux"`)
 }
 
 func (s *SuiteConfig) TestExecJobBuildEmpty(c *C) {
 	j := &ExecJobConfig{}
-	j.buildMiddlewares()
+	j.build(j)
 
 	c.Assert(j.Middlewares(), HasLen, 0)
 }
@@ -46,11 +823,22 @@ func (s *SuiteConfig) TestExecJobBuildEmpty(c *C) {
 func (s *SuiteConfig) TestExecJobBuild(c *C) {
 	j := &ExecJobConfig{}
 	j.OverlapConfig.NoOverlap = true
-	j.buildMiddlewares()
+	j.build(j)
 
 	c.Assert(j.Middlewares(), HasLen, 1)
 }
 
+func (s *SuiteConfig) TestLabelValue(c *C) {
+	c.Assert(labelValue("command", "echo a,b"), Equals, "echo a,b")
+	c.Assert(labelValue("environment", "FOO=foo"), DeepEquals, []string{"FOO=foo"})
+	c.Assert(labelValue("environment", `FOO=a=b, BAR="b,c",BAZ='d,e',QUX`), DeepEquals, []string{
+		"FOO=a=b", `BAR="b,c"`, "BAZ='d,e'", "QUX",
+	})
+	c.Assert(labelValue("env-secret", "FOO=foo,BAR=vault:secret/bar#baz"), DeepEquals, []string{
+		"FOO=foo", "BAR=vault:secret/bar#baz",
+	})
+}
+
 func (s *SuiteConfig) TestLabelsConfig(c *C) {
 	testcases := []struct {
 		Labels         map[string]map[string]string
@@ -116,6 +904,7 @@ func (s *SuiteConfig) TestLabelsConfig(c *C) {
 					labelPrefix + "." + jobRun + ".job2.command":         "command2",
 					labelPrefix + "." + jobServiceRun + ".job3.schedule": "schedule3",
 					labelPrefix + "." + jobServiceRun + ".job3.command":  "command3",
+					labelPrefix + "." + jobServiceExec + ".job7.service": "service7",
 				},
 				"other": map[string]string{
 					requiredLabel: "true",
@@ -125,6 +914,7 @@ func (s *SuiteConfig) TestLabelsConfig(c *C) {
 					labelPrefix + "." + jobRun + ".job5.command":         "command5",
 					labelPrefix + "." + jobServiceRun + ".job6.schedule": "schedule6",
 					labelPrefix + "." + jobServiceRun + ".job6.command":  "command6",
+					labelPrefix + "." + jobServiceExec + ".job8.service": "service8",
 				},
 			},
 			ExpectedConfig: Config{
@@ -146,6 +936,9 @@ func (s *SuiteConfig) TestLabelsConfig(c *C) {
 						Command:  "command3",
 					}}},
 				},
+				ServiceExecJobs: map[string]*ServiceExecConfig{
+					"job7": &ServiceExecConfig{ServiceExecJob: core.ServiceExecJob{Service: "service7"}},
+				},
 			},
 			Comment: "Local/Run/Service jobs from non-service container ignored",
 		},
@@ -174,7 +967,8 @@ func (s *SuiteConfig) TestLabelsConfig(c *C) {
 							Schedule: "schedule2",
 							Command:  "command2",
 						},
-						Container: "other",
+						Container:        "other",
+						NoEnvPassthrough: true,
 					}},
 				},
 			},
@@ -196,7 +990,9 @@ func (s *SuiteConfig) TestLabelsConfig(c *C) {
 						Schedule: "schedule1",
 						Command:  "command1",
 					}},
-						OverlapConfig: middlewares.OverlapConfig{NoOverlap: true},
+						JobMiddlewaresConfig: JobMiddlewaresConfig{
+							OverlapConfig: middlewares.OverlapConfig{NoOverlap: true},
+						},
 					},
 				},
 			},
@@ -208,6 +1004,84 @@ func (s *SuiteConfig) TestLabelsConfig(c *C) {
 		var conf = Config{}
 		err := conf.buildFromDockerLabels(t.Labels)
 		c.Assert(err, IsNil)
+		clearSetOptions(&conf)
 		c.Assert(conf, DeepEquals, t.ExpectedConfig)
 	}
 }
+
+// clearSetOptions clears the options recorded as set by the jobs, so the
+// config can be compared with the expected one
+func clearSetOptions(conf *Config) {
+	v := reflect.ValueOf(conf).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).Kind() != reflect.Map {
+			continue
+		}
+
+		for _, k := range v.Field(i).MapKeys() {
+			if j, ok := v.Field(i).MapIndex(k).Interface().(jobConfig); ok {
+				j.middlewaresConfig().set = nil
+			}
+		}
+	}
+}
+
+func (s *SuiteConfig) TestLabelsEnvSecret(c *C) {
+	labels := map[string]map[string]string{
+		"some": map[string]string{
+			labelPrefix + "." + jobExec + ".job1.schedule":   "@every 5s",
+			labelPrefix + "." + jobExec + ".job1.command":    "echo foo",
+			labelPrefix + "." + jobExec + ".job1.env-secret": "FOO=foo",
+		},
+	}
+
+	var conf Config
+	err := conf.buildFromDockerLabels(labels)
+	c.Assert(err, ErrorMatches, `env-secret of job-exec job "job1" isn't allowed in container "some" without ofelia.service=true`)
+
+	labels["some"][serviceLabel] = "true"
+	conf = Config{}
+	c.Assert(conf.buildFromDockerLabels(labels), IsNil)
+	c.Assert(conf.ExecJobs["job1"].EnvSecret, DeepEquals, []string{"FOO=foo"})
+}
+
+func (s *SuiteConfig) TestServiceLabelsConfig(c *C) {
+	conf := &Config{ServiceJobs: map[string]*RunServiceConfig{"foo": {}}}
+	err := conf.buildFromServiceLabels(map[string]map[string]string{
+		"stack_web": {
+			requiredLabel: "true",
+			labelPrefix + "." + jobServiceExec + ".flush.schedule": "@hourly",
+			labelPrefix + "." + jobServiceExec + ".flush.command":  "flush-cache",
+			labelPrefix + "." + jobServiceExec + ".other.schedule": "@daily",
+			labelPrefix + "." + jobServiceExec + ".other.service":  "stack_db",
+			labelPrefix + "." + jobServiceRun + ".backup.schedule": "@daily",
+			labelPrefix + "." + jobServiceRun + ".backup.image":    "backup",
+			labelPrefix + "." + jobLocal + ".local.command":        "rm -rf /",
+			labelPrefix + "." + jobExec + ".exec.command":          "ls",
+		},
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(conf.LocalJobs, HasLen, 0)
+	c.Assert(conf.ExecJobs, HasLen, 0)
+	c.Assert(conf.ServiceJobs, HasLen, 2)
+	c.Assert(conf.ServiceJobs["backup"].Image, Equals, "backup")
+	c.Assert(conf.ServiceExecJobs, HasLen, 2)
+	c.Assert(conf.ServiceExecJobs["flush"].Service, Equals, "stack_web")
+	c.Assert(conf.ServiceExecJobs["flush"].Command, Equals, "flush-cache")
+	c.Assert(conf.ServiceExecJobs["other"].Service, Equals, "stack_db")
+}
+
+func (s *SuiteConfig) TestServiceLabelsConfigDuplicated(c *C) {
+	err := (&Config{}).buildFromServiceLabels(map[string]map[string]string{
+		"stack_web": {labelPrefix + "." + jobServiceRun + ".backup.image": "web"},
+		"stack_db":  {labelPrefix + "." + jobServiceRun + ".backup.image": "db"},
+	})
+	c.Assert(err, ErrorMatches, `job-service-run job "backup" is defined by services "stack_(web|db)" and "stack_(web|db)"`)
+
+	conf := &Config{ServiceExecJobs: map[string]*ServiceExecConfig{"flush": {}}}
+	err = conf.buildFromServiceLabels(map[string]map[string]string{
+		"stack_web": {labelPrefix + "." + jobServiceExec + ".flush.command": "flush-cache"},
+	})
+	c.Assert(err, ErrorMatches, `job-service-exec job "flush" of service "stack_web" is already defined`)
+}
@@ -1,29 +1,70 @@
 package cli
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	docker "github.com/fsouza/go-dockerclient"
 	"github.com/mcuadros/ofelia/core"
+	"github.com/mcuadros/ofelia/history"
+	"github.com/mcuadros/ofelia/rpc"
+	"github.com/mcuadros/ofelia/web"
 )
 
+const webShutdownTimeout = time.Second * 5
+
 // DaemonCommand daemon process
 type DaemonCommand struct {
-	ConfigFile         string `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
-	DockerLabelsConfig bool   `short:"d" long:"docker" description:"read configurations from docker labels"`
+	ConfigFile         string        `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
+	ConfigDir          string        `long:"config-dir" description:"directory of configuration files merged after the configuration file, e.g. /etc/ofelia/conf.d"`
+	DockerLabelsConfig bool          `short:"d" long:"docker" description:"read configurations from docker labels"`
+	WebAddr            string        `long:"web" description:"address to serve the HTTP API, e.g. :8081, disabled by default"`
+	WebTokens          []string      `long:"web-token" env:"OFELIA_WEB_TOKEN" env-delim:"," description:"token required as bearer token by the HTTP API, as scope:token with a scope of read, trigger or admin (default), can be specified multiple times"`
+	WebUser            string        `long:"web-user" description:"user required with basic auth by the HTTP API"`
+	WebPassword        string        `long:"web-password" env:"OFELIA_WEB_PASSWORD" description:"password of --web-user"`
+	WebTLSCert         string        `long:"web-tls-cert" description:"certificate file to serve the HTTP API over HTTPS"`
+	WebTLSKey          string        `long:"web-tls-key" description:"key file of --web-tls-cert"`
+	GRPCAddr           string        `long:"grpc" description:"address to serve the gRPC API, e.g. :8082, disabled by default, authenticated with --web-token and --web-user"`
+	GRPCTLSCert        string        `long:"grpc-tls-cert" description:"certificate file to serve the gRPC API over TLS"`
+	GRPCTLSKey         string        `long:"grpc-tls-key" description:"key file of --grpc-tls-cert"`
+	ControlSocket      string        `long:"control-socket" description:"unix socket to manage the jobs with the jobs commands, e.g. /var/run/ofelia.sock, disabled by default"`
+	HistoryFile        string        `long:"history-file" description:"file to persist the executions history, disabled by default"`
+	HistoryRetention   time.Duration `long:"history-retention" description:"time the persisted executions are kept, 0 keeps them forever" default:"168h"`
+	ShutdownTimeout    time.Duration `long:"shutdown-timeout" description:"time to wait for the running jobs on shutdown, 0 waits forever"`
+	ShutdownCancel     bool          `long:"shutdown-cancel" description:"cancel the running jobs after the shutdown timeout, stopping their containers"`
+	LogFormat          string        `long:"log-format" description:"format of the logs, text or json" default:"text"`
+	MaxOutputSize      int           `long:"max-output-size" description:"maximum bytes of the output of an execution kept in memory, the full output is written to a file, disabled by default"`
+	OutputDir          string        `long:"output-dir" description:"directory of the files with the full output, by default the temporary directory"`
 
 	config    *Config
 	scheduler *core.Scheduler
+	server    *web.Server
+	rpc       *rpc.Server
+	control   *rpc.Server
+	history   *history.BoltStore
 	signals   chan os.Signal
 	done      chan bool
 }
 
 // Execute runs the daemon
 func (c *DaemonCommand) Execute(args []string) error {
+	if c.DockerLabelsConfig && c.ConfigDir != "" {
+		return errConfigDirWithDocker
+	}
+
 	_, err := os.Stat("/.dockerenv")
 	IsDockerEnv = !os.IsNotExist(err)
 
+	if err := SetLogFormat(c.LogFormat); err != nil {
+		return err
+	}
+
 	if err := c.boot(); err != nil {
 		return err
 	}
@@ -43,9 +84,30 @@ func (c *DaemonCommand) boot() (err error) {
 	if c.DockerLabelsConfig {
 		c.scheduler, err = BuildFromDockerLabels()
 	} else {
-		c.scheduler, err = BuildFromFile(c.ConfigFile)
+		c.config = &Config{}
+		if err = c.config.buildFromFiles(c.ConfigFile, c.ConfigDir); err != nil {
+			return
+		}
+
+		c.scheduler, err = c.config.build()
+	}
+
+	if err != nil {
+		return
+	}
+
+	c.scheduler.MaxOutputSize = c.MaxOutputSize
+	c.scheduler.OutputDir = c.OutputDir
+	if c.HistoryFile == "" {
+		return
+	}
+
+	c.history, err = history.NewBoltStore(c.HistoryFile, c.HistoryRetention)
+	if err != nil {
+		return fmt.Errorf("error opening history file %q: %s", c.HistoryFile, err)
 	}
 
+	c.scheduler.History = c.history
 	return
 }
 
@@ -55,6 +117,165 @@ func (c *DaemonCommand) start() error {
 		return err
 	}
 
+	if c.DockerLabelsConfig {
+		if err := c.watchDockerEvents(); err != nil {
+			return err
+		}
+	}
+
+	if c.WebAddr != "" {
+		if err := c.startServer(); err != nil {
+			return err
+		}
+	}
+
+	if c.GRPCAddr != "" {
+		if err := c.startRPCServer(); err != nil {
+			return err
+		}
+	}
+
+	if c.ControlSocket != "" {
+		return c.startControlSocket()
+	}
+
+	return nil
+}
+
+func (c *DaemonCommand) watchDockerEvents() error {
+	d, err := buildDockerClient(DockerConfig{})
+	if err != nil {
+		return err
+	}
+
+	return watchDockerEvents(d, c.scheduler)
+}
+
+// startServer serves the HTTP API. Without credentials, only a loopback address
+// is accepted.
+func (c *DaemonCommand) startServer() error {
+	if (c.WebTLSCert == "") != (c.WebTLSKey == "") {
+		return errors.New("--web-tls-cert and --web-tls-key are required together")
+	}
+
+	auth, err := c.buildAuth()
+	if err != nil {
+		return err
+	}
+
+	if auth.IsEmpty() && !isLoopback(c.WebAddr) {
+		return fmt.Errorf("the HTTP API on %q requires --web-token or --web-user, or a loopback address", c.WebAddr)
+	}
+
+	c.server = web.NewServer(c.WebAddr, c.scheduler)
+	c.server.Auth = auth
+	c.server.TLSCert, c.server.TLSKey = c.WebTLSCert, c.WebTLSKey
+	if c.server.Auth.IsEmpty() {
+		c.scheduler.Logger.Warningf("The HTTP API isn't authenticated, see --web-token and --web-user")
+	}
+
+	go func() {
+		c.scheduler.Logger.Noticef("Serving HTTP API at %s", c.WebAddr)
+		if err := c.server.Start(); err != nil {
+			c.scheduler.Logger.Errorf("HTTP API error: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+// buildAuth returns the credentials of the HTTP and the gRPC APIs
+func (c *DaemonCommand) buildAuth() (web.Auth, error) {
+	if c.WebUser != "" && c.WebPassword == "" {
+		return web.Auth{}, errors.New("--web-password is required by --web-user")
+	}
+
+	auth := web.Auth{Username: c.WebUser, Password: c.WebPassword}
+	for _, t := range c.WebTokens {
+		token, err := web.ParseToken(t)
+		if err != nil {
+			return web.Auth{}, fmt.Errorf("invalid --web-token: %s", err)
+		}
+
+		auth.Tokens = append(auth.Tokens, token)
+	}
+
+	return auth, nil
+}
+
+// startRPCServer serves the gRPC API, with the credentials of the HTTP API.
+// Without credentials, only a loopback address is accepted.
+func (c *DaemonCommand) startRPCServer() error {
+	if (c.GRPCTLSCert == "") != (c.GRPCTLSKey == "") {
+		return errors.New("--grpc-tls-cert and --grpc-tls-key are required together")
+	}
+
+	auth, err := c.buildAuth()
+	if err != nil {
+		return err
+	}
+
+	if auth.IsEmpty() && !isLoopback(c.GRPCAddr) {
+		return fmt.Errorf("the gRPC API on %q requires --web-token or --web-user, or a loopback address", c.GRPCAddr)
+	}
+
+	c.rpc = rpc.NewServer(c.GRPCAddr, c.scheduler)
+	c.rpc.Auth = auth
+	c.rpc.TLSCert, c.rpc.TLSKey = c.GRPCTLSCert, c.GRPCTLSKey
+	go func() {
+		c.scheduler.Logger.Noticef("Serving gRPC API at %s", c.GRPCAddr)
+		if err := c.rpc.Start(); err != nil {
+			c.scheduler.Logger.Errorf("gRPC API error: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+// isLoopback returns true if the host of the address is a loopback address or
+// localhost, an empty host listens on every interface
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// startControlSocket serves the gRPC API on the control socket, only
+// accessible by the owner and the group of the daemon. The socket left by a
+// previous daemon is replaced, unless it's still serving.
+func (c *DaemonCommand) startControlSocket() error {
+	if conn, err := net.Dial("unix", c.ControlSocket); err == nil {
+		conn.Close()
+		return fmt.Errorf("control socket %q is already in use", c.ControlSocket)
+	}
+
+	os.Remove(c.ControlSocket)
+	l, err := net.Listen("unix", c.ControlSocket)
+	if err != nil {
+		return fmt.Errorf("error listening on control socket %q: %s", c.ControlSocket, err)
+	}
+
+	if err := os.Chmod(c.ControlSocket, 0660); err != nil {
+		l.Close()
+		return fmt.Errorf("error listening on control socket %q: %s", c.ControlSocket, err)
+	}
+
+	c.control = rpc.NewServer(c.ControlSocket, c.scheduler)
+	go func() {
+		c.scheduler.Logger.Noticef("Serving control socket at %s", c.ControlSocket)
+		if err := c.control.Serve(l); err != nil {
+			c.scheduler.Logger.Errorf("Control socket error: %s", err)
+		}
+	}()
+
 	return nil
 }
 
@@ -62,24 +283,88 @@ func (c *DaemonCommand) setSignals() {
 	c.signals = make(chan os.Signal, 1)
 	c.done = make(chan bool, 1)
 
-	signal.Notify(c.signals, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(c.signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
 	go func() {
-		sig := <-c.signals
-		c.scheduler.Logger.Warningf(
-			"Signal recieved: %s, shuting down the process\n", sig,
-		)
+		for sig := range c.signals {
+			if sig == syscall.SIGHUP {
+				c.reload()
+				continue
+			}
 
-		c.done <- true
+			c.scheduler.Logger.Warningf(
+				"Signal recieved: %s, shuting down the process\n", sig,
+			)
+
+			c.done <- true
+			return
+		}
 	}()
 }
 
+// reload updates the jobs of the scheduler with the current configuration,
+// the running executions are not affected.
+func (c *DaemonCommand) reload() {
+	c.scheduler.Logger.Noticef("Reloading configuration")
+
+	var err error
+	if c.DockerLabelsConfig {
+		var d *docker.Client
+		if d, err = buildDockerClient(DockerConfig{}); err == nil {
+			err = updateFromDockerLabels(d, c.scheduler)
+		}
+	} else {
+		err = c.config.reloadFromFiles(c.scheduler, c.ConfigFile, c.ConfigDir)
+	}
+
+	if err != nil {
+		c.scheduler.Logger.Errorf("Error reloading configuration: %s", err)
+	}
+}
+
 func (c *DaemonCommand) shutdown() error {
 	<-c.done
+	if c.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), webShutdownTimeout)
+		defer cancel()
+
+		if err := c.server.Shutdown(ctx); err != nil {
+			c.scheduler.Logger.Errorf("Error stopping the HTTP API: %s", err)
+		}
+	}
+
+	if c.rpc != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), webShutdownTimeout)
+		defer cancel()
+
+		if err := c.rpc.Shutdown(ctx); err != nil {
+			c.scheduler.Logger.Errorf("Error stopping the gRPC API: %s", err)
+		}
+	}
+
+	if c.control != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), webShutdownTimeout)
+		defer cancel()
+
+		if err := c.control.Shutdown(ctx); err != nil {
+			c.scheduler.Logger.Errorf("Error stopping the control socket: %s", err)
+		}
+	}
+
+	if c.history != nil {
+		defer c.history.Close()
+	}
+
 	if !c.scheduler.IsRunning() {
 		return nil
 	}
 
 	c.scheduler.Logger.Warningf("Waiting running jobs.")
-	return c.scheduler.Stop()
+	if n := c.scheduler.Shutdown(c.ShutdownTimeout, c.ShutdownCancel); n > 0 {
+		c.scheduler.Logger.Warningf("Shutdown completed, %d executions didn't finish in time.", n)
+		return nil
+	}
+
+	c.scheduler.Logger.Noticef("Shutdown completed, all the running jobs finished.")
+	return nil
 }
@@ -2,11 +2,13 @@ package cli
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
-	"github.com/mitchellh/mapstructure"
+	"github.com/mcuadros/ofelia/core"
 )
 
 const (
@@ -17,6 +19,23 @@ const (
 	serviceLabel        = labelPrefix + ".service"
 )
 
+var errNoContainers = errors.New("Couldn't find containers with label 'ofelia.enabled=true'")
+
+// containerEvents and serviceEvents are the docker events of the containers
+// and of the swarm services that can add or remove labeled jobs
+var (
+	containerEvents = map[string]bool{
+		"start":   true,
+		"die":     true,
+		"destroy": true,
+	}
+	serviceEvents = map[string]bool{
+		"create": true,
+		"update": true,
+		"remove": true,
+	}
+)
+
 func getLabels(d *docker.Client) (map[string]map[string]string, error) {
 	// sleep before querying containers
 	// because docker not always propagating labels in time
@@ -35,7 +54,7 @@ func getLabels(d *docker.Client) (map[string]map[string]string, error) {
 	}
 
 	if len(conts) == 0 {
-		return nil, errors.New("Couldn't find containers with label 'ofelia.enabled=true'")
+		return nil, errNoContainers
 	}
 
 	var labels = make(map[string]map[string]string)
@@ -58,11 +77,223 @@ func getLabels(d *docker.Client) (map[string]map[string]string, error) {
 	return labels, nil
 }
 
+// getServiceLabels returns the labels of the swarm services with the label
+// ofelia.enabled=true, by service name. It returns no labels if the daemon
+// isn't a swarm manager.
+func getServiceLabels(d *docker.Client) (map[string]map[string]string, error) {
+	services, err := d.ListServices(docker.ListServicesOptions{
+		Filters: map[string][]string{
+			"label": []string{requiredLabelFilter},
+		},
+	})
+	if err != nil {
+		if e, ok := err.(*docker.Error); ok && e.Status == http.StatusServiceUnavailable {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	labels := make(map[string]map[string]string)
+	for _, s := range services {
+		l := make(map[string]string)
+		for k, v := range s.Spec.Labels {
+			if strings.HasPrefix(k, labelPrefix) {
+				l[k] = v
+			}
+		}
+
+		labels[s.Spec.Name] = l
+	}
+
+	return labels, nil
+}
+
+// buildFromDocker loads the config from the labels of the containers and of
+// the swarm services, it returns errNoContainers if there are none.
+func (c *Config) buildFromDocker(d *docker.Client) error {
+	labels, err := getLabels(d)
+	if err != nil && err != errNoContainers {
+		return err
+	}
+
+	services, serr := getServiceLabels(d)
+	if serr != nil {
+		return fmt.Errorf("error listing services: %s", serr)
+	}
+
+	if len(labels) == 0 && len(services) == 0 {
+		return errNoContainers
+	}
+
+	if err := c.buildFromDockerLabels(labels); err != nil {
+		return err
+	}
+
+	return c.buildFromServiceLabels(services)
+}
+
+// watchDockerEvents listens to the docker events, updating the jobs of the
+// scheduler with the labels of the running containers every time a labeled
+// container is started or stopped, and of the swarm services every time a
+// service is created, updated or removed.
+func watchDockerEvents(d *docker.Client, sh *core.Scheduler) error {
+	events := make(chan *docker.APIEvents)
+	if err := d.AddEventListener(events); err != nil {
+		return err
+	}
+
+	go func() {
+		for e := range events {
+			switch {
+			case e.Type == "container" && containerEvents[e.Action]:
+				if e.Actor.Attributes[requiredLabel] != "true" {
+					continue
+				}
+			case e.Type == "service" && serviceEvents[e.Action]:
+				// the events of the services don't include their labels
+			default:
+				continue
+			}
+
+			sh.Logger.Debugf("Event %q of %s %s, updating jobs", e.Action, e.Type, e.Actor.ID)
+			if err := updateFromDockerLabels(d, sh); err != nil {
+				sh.Logger.Errorf("Error updating jobs from docker labels: %s", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func updateFromDockerLabels(d *docker.Client, sh *core.Scheduler) error {
+	c := &Config{}
+	if err := c.buildFromDocker(d); err != nil && err != errNoContainers {
+		return err
+	}
+
+	return c.updateScheduler(sh, d)
+}
+
+// labelValue returns the value of a label of a job, the environment and the
+// env-secret are comma-separated lists, the values with commas can be quoted,
+// e.g. `FOO=foo,BAR="bar,baz"`
+func labelValue(param, value string) interface{} {
+	if param != "environment" && param != "env-secret" {
+		return value
+	}
+
+	var env []string
+	var quote rune
+	start := 0
+	for i, r := range value {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			env = append(env, strings.TrimSpace(value[start:i]))
+			start = i + 1
+		}
+	}
+
+	return append(env, strings.TrimSpace(value[start:]))
+}
+
+// buildFromServiceLabels loads the job-service-run and job-service-exec jobs
+// of the labels of the swarm services, by service name. The service-exec jobs
+// are executed in the tasks of the labeled service unless they set `service`.
+// A job defined by several services, or already defined, is an error.
+func (c *Config) buildFromServiceLabels(labels map[string]map[string]string) error {
+	serviceJobs := make(map[string]map[string]interface{})
+	serviceExecJobs := make(map[string]map[string]interface{})
+	owners := make(map[string]string)
+	for service, l := range labels {
+		for k, v := range l {
+			parts := strings.Split(k, ".")
+			if len(parts) < 4 {
+				continue
+			}
+
+			jobs := serviceJobs
+			switch parts[1] {
+			case jobServiceRun:
+			case jobServiceExec:
+				jobs = serviceExecJobs
+			default:
+				continue
+			}
+
+			jobName := parts[2]
+			if owner, ok := owners[parts[1]+"."+jobName]; ok && owner != service {
+				return fmt.Errorf("%s job %q is defined by services %q and %q", parts[1], jobName, owner, service)
+			}
+
+			owners[parts[1]+"."+jobName] = service
+			if _, ok := jobs[jobName]; !ok {
+				jobs[jobName] = make(map[string]interface{})
+				if parts[1] == jobServiceExec {
+					jobs[jobName]["service"] = service
+				}
+			}
+
+			jobs[jobName][parts[3]] = labelValue(parts[3], v)
+		}
+	}
+
+	sc := &Config{}
+	if err := decodeJobs(serviceJobs, &sc.ServiceJobs, false); err != nil {
+		return err
+	}
+
+	if err := decodeJobs(serviceExecJobs, &sc.ServiceExecJobs, false); err != nil {
+		return err
+	}
+
+	for name, j := range sc.ServiceJobs {
+		if c.ServiceJobs == nil {
+			c.ServiceJobs = make(map[string]*RunServiceConfig)
+		}
+
+		if _, ok := c.ServiceJobs[name]; ok {
+			return fmt.Errorf("%s job %q of service %q is already defined", jobServiceRun, name, owners[jobServiceRun+"."+name])
+		}
+
+		c.ServiceJobs[name] = j
+	}
+
+	for name, j := range sc.ServiceExecJobs {
+		if c.ServiceExecJobs == nil {
+			c.ServiceExecJobs = make(map[string]*ServiceExecConfig)
+		}
+
+		if _, ok := c.ServiceExecJobs[name]; ok {
+			return fmt.Errorf("%s job %q of service %q is already defined", jobServiceExec, name, owners[jobServiceExec+"."+name])
+		}
+
+		c.ServiceExecJobs[name] = j
+	}
+
+	return nil
+}
+
 func (c *Config) buildFromDockerLabels(labels map[string]map[string]string) error {
-	execJobs := make(map[string]map[string]string)
-	localJobs := make(map[string]map[string]string)
-	runJobs := make(map[string]map[string]string)
-	serviceJobs := make(map[string]map[string]string)
+	execJobs := make(map[string]map[string]interface{})
+	containerExecJobs := make(map[string]map[string]interface{})
+	localJobs := make(map[string]map[string]interface{})
+	runJobs := make(map[string]map[string]interface{})
+	serviceJobs := make(map[string]map[string]interface{})
+	serviceExecJobs := make(map[string]map[string]interface{})
+	httpJobs := make(map[string]map[string]interface{})
+	k8sJobs := make(map[string]map[string]interface{})
+	composeJobs := make(map[string]map[string]interface{})
+	sshJobs := make(map[string]map[string]interface{})
+	ecsJobs := make(map[string]map[string]interface{})
+	lambdaJobs := make(map[string]map[string]interface{})
+	nomadJobs := make(map[string]map[string]interface{})
 
 	for c, l := range labels {
 		isServiceContaienr := func() bool {
@@ -83,31 +314,81 @@ func (c *Config) buildFromDockerLabels(labels map[string]map[string]string) erro
 			jobType, jobName, jopParam := parts[1], parts[2], parts[3]
 			switch {
 			case jobType == jobExec: // only job exec can be provided on the non-service container
-				if _, ok := execJobs[jobName]; !ok {
-					execJobs[jobName] = make(map[string]string)
+				// the secrets of ofelia are only for the jobs of the service container
+				if jopParam == "env-secret" && !isServiceContaienr {
+					return fmt.Errorf("env-secret of %s job %q isn't allowed in container %q without %s=true", jobExec, jobName, c, serviceLabel)
+				}
+
+				jobs := execJobs
+				if !isServiceContaienr {
+					jobs = containerExecJobs
 				}
-				execJobs[jobName][jopParam] = v
+
+				if _, ok := jobs[jobName]; !ok {
+					jobs[jobName] = make(map[string]interface{})
+				}
+				jobs[jobName][jopParam] = labelValue(jopParam, v)
 
 				// since this label was placed not on the service container
 				// this means we need to `exec` command in this container
 				if !isServiceContaienr {
-					execJobs[jobName]["container"] = c
+					jobs[jobName]["container"] = c
 				}
 			case jobType == jobLocal && isServiceContaienr:
 				if _, ok := localJobs[jobName]; !ok {
-					localJobs[jobName] = make(map[string]string)
+					localJobs[jobName] = make(map[string]interface{})
 				}
-				localJobs[jobName][jopParam] = v
+				localJobs[jobName][jopParam] = labelValue(jopParam, v)
 			case jobType == jobServiceRun && isServiceContaienr:
 				if _, ok := serviceJobs[jobName]; !ok {
-					serviceJobs[jobName] = make(map[string]string)
+					serviceJobs[jobName] = make(map[string]interface{})
+				}
+				serviceJobs[jobName][jopParam] = labelValue(jopParam, v)
+			case jobType == jobServiceExec && isServiceContaienr:
+				if _, ok := serviceExecJobs[jobName]; !ok {
+					serviceExecJobs[jobName] = make(map[string]interface{})
 				}
-				serviceJobs[jobName][jopParam] = v
+				serviceExecJobs[jobName][jopParam] = labelValue(jopParam, v)
 			case jobType == jobRun && isServiceContaienr:
 				if _, ok := runJobs[jobName]; !ok {
-					runJobs[jobName] = make(map[string]string)
+					runJobs[jobName] = make(map[string]interface{})
+				}
+				runJobs[jobName][jopParam] = labelValue(jopParam, v)
+			case jobType == jobHTTP && isServiceContaienr:
+				if _, ok := httpJobs[jobName]; !ok {
+					httpJobs[jobName] = make(map[string]interface{})
+				}
+				httpJobs[jobName][jopParam] = labelValue(jopParam, v)
+			case jobType == jobK8s && isServiceContaienr:
+				if _, ok := k8sJobs[jobName]; !ok {
+					k8sJobs[jobName] = make(map[string]interface{})
 				}
-				runJobs[jobName][jopParam] = v
+				k8sJobs[jobName][jopParam] = labelValue(jopParam, v)
+			case jobType == jobCompose && isServiceContaienr:
+				if _, ok := composeJobs[jobName]; !ok {
+					composeJobs[jobName] = make(map[string]interface{})
+				}
+				composeJobs[jobName][jopParam] = labelValue(jopParam, v)
+			case jobType == jobSSH && isServiceContaienr:
+				if _, ok := sshJobs[jobName]; !ok {
+					sshJobs[jobName] = make(map[string]interface{})
+				}
+				sshJobs[jobName][jopParam] = labelValue(jopParam, v)
+			case jobType == jobECS && isServiceContaienr:
+				if _, ok := ecsJobs[jobName]; !ok {
+					ecsJobs[jobName] = make(map[string]interface{})
+				}
+				ecsJobs[jobName][jopParam] = labelValue(jopParam, v)
+			case jobType == jobLambda && isServiceContaienr:
+				if _, ok := lambdaJobs[jobName]; !ok {
+					lambdaJobs[jobName] = make(map[string]interface{})
+				}
+				lambdaJobs[jobName][jopParam] = labelValue(jopParam, v)
+			case jobType == jobNomad && isServiceContaienr:
+				if _, ok := nomadJobs[jobName]; !ok {
+					nomadJobs[jobName] = make(map[string]interface{})
+				}
+				nomadJobs[jobName][jopParam] = labelValue(jopParam, v)
 			default:
 				// TODO: warn about unknown parameter
 			}
@@ -115,25 +396,89 @@ func (c *Config) buildFromDockerLabels(labels map[string]map[string]string) erro
 	}
 
 	if len(execJobs) > 0 {
-		if err := mapstructure.WeakDecode(execJobs, &c.ExecJobs); err != nil {
+		if err := decodeJobs(execJobs, &c.ExecJobs, false); err != nil {
 			return err
 		}
 	}
 
+	if len(containerExecJobs) > 0 {
+		for name, params := range containerExecJobs {
+			if _, ok := execJobs[name]; ok {
+				return fmt.Errorf("%s job %q is defined by the service container and container %q", jobExec, name, params["container"])
+			}
+		}
+
+		if err := decodeContainerJobs(containerExecJobs, &c.ExecJobs); err != nil {
+			return err
+		}
+
+		for name := range containerExecJobs {
+			c.ExecJobs[name].NoEnvPassthrough = true
+		}
+	}
+
 	if len(localJobs) > 0 {
-		if err := mapstructure.WeakDecode(localJobs, &c.LocalJobs); err != nil {
+		if err := decodeJobs(localJobs, &c.LocalJobs, false); err != nil {
 			return err
 		}
 	}
 
 	if len(serviceJobs) > 0 {
-		if err := mapstructure.WeakDecode(serviceJobs, &c.ServiceJobs); err != nil {
+		if err := decodeJobs(serviceJobs, &c.ServiceJobs, false); err != nil {
+			return err
+		}
+	}
+
+	if len(serviceExecJobs) > 0 {
+		if err := decodeJobs(serviceExecJobs, &c.ServiceExecJobs, false); err != nil {
 			return err
 		}
 	}
 
 	if len(runJobs) > 0 {
-		if err := mapstructure.WeakDecode(runJobs, &c.RunJobs); err != nil {
+		if err := decodeJobs(runJobs, &c.RunJobs, false); err != nil {
+			return err
+		}
+	}
+
+	if len(httpJobs) > 0 {
+		if err := decodeJobs(httpJobs, &c.HTTPJobs, false); err != nil {
+			return err
+		}
+	}
+
+	if len(k8sJobs) > 0 {
+		if err := decodeJobs(k8sJobs, &c.K8sJobs, false); err != nil {
+			return err
+		}
+	}
+
+	if len(composeJobs) > 0 {
+		if err := decodeJobs(composeJobs, &c.ComposeJobs, false); err != nil {
+			return err
+		}
+	}
+
+	if len(sshJobs) > 0 {
+		if err := decodeJobs(sshJobs, &c.SSHJobs, false); err != nil {
+			return err
+		}
+	}
+
+	if len(ecsJobs) > 0 {
+		if err := decodeJobs(ecsJobs, &c.ECSJobs, false); err != nil {
+			return err
+		}
+	}
+
+	if len(lambdaJobs) > 0 {
+		if err := decodeJobs(lambdaJobs, &c.LambdaJobs, false); err != nil {
+			return err
+		}
+	}
+
+	if len(nomadJobs) > 0 {
+		if err := decodeJobs(nomadJobs, &c.NomadJobs, false); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// rootfulPodmanSocket is the socket of the Docker compatible API of Podman run
+// as root, the rootless one is in $XDG_RUNTIME_DIR
+const rootfulPodmanSocket = "/run/podman/podman.sock"
+
+// DockerConfig contains the params to connect to the docker daemon, if none is
+// set the DOCKER_HOST, DOCKER_CERT_PATH and DOCKER_TLS_VERIFY environment
+// variables are used instead.
+type DockerConfig struct {
+	DockerHost string `mapstructure:"docker-host"`
+	// DockerCertPath is the directory with the `cert.pem` and `key.pem` used
+	// to authenticate the client, and the `ca.pem` used to verify the daemon
+	// when DockerTLSVerify is set.
+	DockerCertPath  string `mapstructure:"docker-cert-path"`
+	DockerTLSVerify bool   `mapstructure:"docker-tls-verify"`
+}
+
+// IsEmpty returns true if no param is set
+func (c *DockerConfig) IsEmpty() bool {
+	return c.DockerHost == "" && c.DockerCertPath == "" && !c.DockerTLSVerify
+}
+
+// buildDockerClient returns a client of the docker daemon of the config, or of
+// the environment if it's empty. A daemon set in the config is pinged, so
+// a wrong host or certificate fails on start instead of on the first job.
+func buildDockerClient(c DockerConfig) (*docker.Client, error) {
+	d, err := c.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// the version of the server is required by the options only available
+	// in newer versions of the API, like the environment of the exec jobs
+	d.SkipServerVersionCheck = false
+
+	if !c.IsEmpty() {
+		if err := d.Ping(); err != nil {
+			return nil, fmt.Errorf("error connecting to docker at %q: %s", d.Endpoint(), err)
+		}
+	}
+
+	return d, nil
+}
+
+func (c *DockerConfig) newClient() (*docker.Client, error) {
+	// the TLS options of the environment are only read by NewClientFromEnv
+	if c.IsEmpty() && os.Getenv("DOCKER_HOST") != "" {
+		return docker.NewClientFromEnv()
+	}
+
+	host := c.DockerHost
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+
+	// Podman is only looked for if no daemon is set
+	if host == "" {
+		host = defaultHost(defaultDockerHost)
+	}
+
+	if c.IsEmpty() && host == defaultDockerHost {
+		return docker.NewClientFromEnv()
+	}
+
+	if c.DockerCertPath == "" && !c.DockerTLSVerify {
+		return docker.NewClient(host)
+	}
+
+	path := c.DockerCertPath
+	if path == "" {
+		path = filepath.Join(os.Getenv("HOME"), ".docker")
+	}
+
+	// without CA the certificate of the daemon isn't verified
+	files := []string{filepath.Join(path, "cert.pem"), filepath.Join(path, "key.pem"), ""}
+	if c.DockerTLSVerify {
+		files[2] = filepath.Join(path, "ca.pem")
+	}
+
+	// the client ignores the missing files
+	for _, file := range files {
+		if _, err := os.Stat(file); file != "" && err != nil {
+			return nil, fmt.Errorf("error reading docker certificates: %s", err)
+		}
+	}
+
+	return docker.NewTLSClient(host, files[0], files[1], files[2])
+}
+
+// defaultHost returns the docker socket host, or the socket of Podman if the
+// docker one doesn't exist and Podman is running, rootless or as root
+func defaultHost(host string) string {
+	if _, err := os.Stat(strings.TrimPrefix(host, "unix://")); err == nil {
+		return host
+	}
+
+	sockets := []string{rootfulPodmanSocket}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		sockets = append([]string{filepath.Join(dir, "podman", "podman.sock")}, sockets...)
+	}
+
+	for _, socket := range sockets {
+		if _, err := os.Stat(socket); err == nil {
+			return "unix://" + socket
+		}
+	}
+
+	return host
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/fsouza/go-dockerclient/testing"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteDocker struct{}
+
+var _ = Suite(&SuiteDocker{})
+
+func (s *SuiteDocker) TestBuildDockerClient(c *C) {
+	server, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, IsNil)
+	defer server.Stop()
+
+	d, err := buildDockerClient(DockerConfig{DockerHost: server.URL()})
+	c.Assert(err, IsNil)
+	c.Assert(d.Endpoint(), Equals, server.URL())
+	c.Assert(d.SkipServerVersionCheck, Equals, false)
+}
+
+func (s *SuiteDocker) TestBuildDockerClientUnreachable(c *C) {
+	server, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, IsNil)
+	server.Stop()
+
+	_, err = buildDockerClient(DockerConfig{DockerHost: server.URL()})
+	c.Assert(err, ErrorMatches, `error connecting to docker at ".*": .*`)
+}
+
+func (s *SuiteDocker) TestBuildDockerClientMissingCerts(c *C) {
+	_, err := buildDockerClient(DockerConfig{
+		DockerHost:      "tcp://127.0.0.1:2376",
+		DockerCertPath:  c.MkDir(),
+		DockerTLSVerify: true,
+	})
+	c.Assert(err, ErrorMatches, `error reading docker certificates: .*cert.pem.*`)
+}
+
+func (s *SuiteDocker) TestBuildDockerClientFromEnv(c *C) {
+	dir := c.MkDir()
+	for k, v := range map[string]string{
+		"DOCKER_HOST":       "tcp://127.0.0.1:2376",
+		"DOCKER_TLS_VERIFY": "1",
+		"DOCKER_CERT_PATH":  dir,
+		"XDG_RUNTIME_DIR":   dir,
+	} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+
+	// the socket of Podman is ignored
+	podman := filepath.Join(dir, "podman", "podman.sock")
+	c.Assert(os.MkdirAll(filepath.Dir(podman), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(podman, nil, 0600), IsNil)
+
+	d, err := buildDockerClient(DockerConfig{})
+	c.Assert(err, IsNil)
+	c.Assert(d.Endpoint(), Equals, "tcp://127.0.0.1:2376")
+	c.Assert(d.TLSConfig, NotNil)
+}
+
+func (s *SuiteDocker) TestDefaultHostPodman(c *C) {
+	dir := c.MkDir()
+	docker := "unix://" + filepath.Join(dir, "docker.sock")
+
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+	c.Assert(defaultHost(docker), Equals, docker)
+
+	podman := filepath.Join(dir, "podman", "podman.sock")
+	c.Assert(os.MkdirAll(filepath.Dir(podman), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(podman, nil, 0600), IsNil)
+	c.Assert(defaultHost(docker), Equals, "unix://"+podman)
+
+	// the docker socket is preferred
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "docker.sock"), nil, 0600), IsNil)
+	c.Assert(defaultHost(docker), Equals, docker)
+}
+
+func (s *SuiteDocker) TestDockerConfigFromIni(c *C) {
+	conf := &Config{}
+	err := conf.buildFromIni([]byte(`
+		[global]
+		docker-host = tcp://docker.example.com:2376
+		docker-cert-path = /etc/ofelia/certs
+		docker-tls-verify = true
+	`))
+	c.Assert(err, IsNil)
+	c.Assert(conf.Global.DockerConfig, DeepEquals, DockerConfig{
+		DockerHost:      "tcp://docker.example.com:2376",
+		DockerCertPath:  "/etc/ofelia/certs",
+		DockerTLSVerify: true,
+	})
+}
@@ -0,0 +1,372 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/gcfg.v1/scanner"
+	"gopkg.in/gcfg.v1/token"
+)
+
+const (
+	globalSection   = "global"
+	defaultsSection = "defaults"
+)
+
+// utf8BOM is skipped at the start of the files, as written by some editors on
+// Windows
+var utf8BOM = []byte("\ufeff")
+
+// blankValue is the value of a variable without `=`, true for a boolean, while
+// it resets a variable set several times, like `environment`, see
+// blankHookFunc.
+type blankValue struct{}
+
+// sections are the values of a config file before decoding them: the global
+// section, and the jobs, the defaults and the named docker daemons by type and
+// name.
+type sections struct {
+	global map[string]interface{}
+	jobs   map[string]map[string]map[string]interface{}
+}
+
+func newSections() *sections {
+	return &sections{jobs: make(map[string]map[string]map[string]interface{})}
+}
+
+func (c *Config) buildFromIni(source interface{}) error {
+	s, err := parseIni(source)
+	if err != nil {
+		return err
+	}
+
+	return c.decodeSections(s)
+}
+
+// parseIni returns the sections of an INI file, by name or its content, with
+// the syntax of git-config, the one of gcfg: the names of the sections and of
+// the variables are case insensitive, the values can be quoted, with the
+// escape sequences \\, \", \n and \t, and a `;` or `#` out of quotes starts a
+// comment. A variable set several times is a list, see lastValueHookFunc.
+func parseIni(source interface{}) (*sections, error) {
+	var filename string
+	var src []byte
+	switch s := source.(type) {
+	case string:
+		content, err := ioutil.ReadFile(s)
+		if err != nil {
+			return nil, err
+		}
+
+		filename, src = s, bytes.TrimPrefix(content, utf8BOM)
+	case []byte:
+		src = s
+	default:
+		return nil, fmt.Errorf("invalid config source %T", source)
+	}
+
+	fset := token.NewFileSet()
+	file := fset.AddFile(filename, fset.Base(), len(src))
+
+	var s scanner.Scanner
+	var errs scanner.ErrorList
+	s.Init(file, src, func(p token.Position, m string) { errs.Add(p, m) }, 0)
+
+	out := newSections()
+	var values map[string]interface{}
+	pos, tok, lit := s.Scan()
+	for {
+		if errs.Len() > 0 {
+			return nil, errs.Err()
+		}
+
+		fail := func(msg string) error {
+			return fmt.Errorf("%s: %s", fset.Position(pos), msg)
+		}
+
+		switch tok {
+		case token.EOF:
+			return out, nil
+		case token.EOL, token.COMMENT:
+			pos, tok, lit = s.Scan()
+		case token.LBRACK:
+			if pos, tok, lit = s.Scan(); tok != token.IDENT {
+				return nil, fail("expected section name")
+			}
+
+			name, sub := strings.ToLower(lit), ""
+			if pos, tok, lit = s.Scan(); tok == token.STRING {
+				if sub = unquote(lit); sub == "" {
+					return nil, fail("empty subsection name")
+				}
+
+				pos, tok, lit = s.Scan()
+			}
+
+			if tok != token.RBRACK {
+				return nil, fail("expected right bracket")
+			}
+
+			if pos, tok, lit = s.Scan(); tok != token.EOL && tok != token.EOF && tok != token.COMMENT {
+				return nil, fail("expected EOL, EOF, or comment")
+			}
+
+			var err error
+			if values, err = out.section(name, sub); err != nil {
+				return nil, fail(err.Error())
+			}
+		case token.IDENT:
+			if values == nil {
+				return nil, fail("invalid config, keys found outside of any section")
+			}
+
+			name := strings.ToLower(lit)
+			if pos, tok, lit = s.Scan(); tok == token.EOL || tok == token.EOF || tok == token.COMMENT {
+				values[name] = blankValue{}
+				continue
+			}
+
+			if tok != token.ASSIGN {
+				return nil, fail("expected '='")
+			}
+
+			if pos, tok, lit = s.Scan(); tok != token.STRING {
+				return nil, fail("expected value")
+			}
+
+			addValue(values, name, unquote(lit))
+			if pos, tok, lit = s.Scan(); tok != token.EOL && tok != token.EOF && tok != token.COMMENT {
+				return nil, fail("expected EOL, EOF, or comment")
+			}
+		default:
+			return nil, fail("expected section header or variable declaration")
+		}
+	}
+}
+
+// section returns the values of the section with the given name and
+// subsection, the job type and name of the jobs. A section defined twice is
+// the same one.
+func (s *sections) section(name, sub string) (map[string]interface{}, error) {
+	if name == globalSection && sub == "" {
+		if s.global == nil {
+			s.global = make(map[string]interface{})
+		}
+
+		return s.global, nil
+	}
+
+	if name == globalSection || sub == "" {
+		return nil, fmt.Errorf("invalid section %q", strings.TrimSpace(name+" "+sub))
+	}
+
+	if _, ok := s.jobs[name]; !ok {
+		s.jobs[name] = make(map[string]map[string]interface{})
+	}
+
+	if _, ok := s.jobs[name][sub]; !ok {
+		s.jobs[name][sub] = make(map[string]interface{})
+	}
+
+	return s.jobs[name][sub], nil
+}
+
+// addValue sets the value of a variable, appending it to the previous ones if
+// it's set several times, unless reset by a blankValue
+func addValue(values map[string]interface{}, name, value string) {
+	switch v := values[name].(type) {
+	case string:
+		values[name] = []string{v, value}
+	case []string:
+		values[name] = append(v, value)
+	default:
+		values[name] = value
+	}
+}
+
+// unquote removes the quotes and the escape sequences of a value, already
+// validated by the scanner
+func unquote(s string) string {
+	var out []rune
+	var escaped bool
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+			switch r {
+			case 'n':
+				out = append(out, '\n')
+			case 't':
+				out = append(out, '\t')
+			case '\n':
+				// line continuation
+			default:
+				out = append(out, r)
+			}
+		case r == '\\':
+			escaped = true
+		case r != '"':
+			out = append(out, r)
+		}
+	}
+
+	return string(out)
+}
+
+// decodeSections decodes the global section and the jobs into the config
+func (c *Config) decodeSections(s *sections) error {
+	if s.global != nil {
+		if err := decode(s.global, &c.Global, true); err != nil {
+			return fmt.Errorf("invalid section %q: %s", globalSection, err)
+		}
+	}
+
+	return c.decodeSectionJobs(s.jobs)
+}
+
+// merge adds the sections of another file. The values of the global and the
+// defaults sections override the current ones, while a job, or a named docker
+// daemon, can't be defined twice.
+func (s *sections) merge(o *sections) error {
+	if o.global != nil {
+		if s.global == nil {
+			s.global = make(map[string]interface{})
+		}
+
+		mergeValues(s.global, o.global)
+	}
+
+	for jobType, jobs := range o.jobs {
+		if _, ok := s.jobs[jobType]; !ok {
+			s.jobs[jobType] = make(map[string]map[string]interface{})
+		}
+
+		for name, values := range jobs {
+			current, ok := s.jobs[jobType][name]
+			switch {
+			case !ok:
+				s.jobs[jobType][name] = values
+			case jobType == defaultsSection:
+				mergeValues(current, values)
+			default:
+				return fmt.Errorf("%s %q is already defined", jobType, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// mergeValues sets the values of src in dst, replacing the keys with the same
+// name regardless of the case
+func mergeValues(dst, src map[string]interface{}) {
+	for k, v := range src {
+		for existing := range dst {
+			if strings.EqualFold(existing, k) {
+				delete(dst, existing)
+			}
+		}
+
+		dst[k] = v
+	}
+}
+
+// decodeSectionJobs decodes the values of the jobs, and of the named docker
+// daemons, by type and name, into the config. The `defaults` type holds the
+// default values of the jobs by job type.
+func (c *Config) decodeSectionJobs(jobs map[string]map[string]map[string]interface{}) error {
+	if err := applyDefaults(jobs); err != nil {
+		return err
+	}
+
+	for jobType, j := range jobs {
+		output, err := c.jobsOutput(jobType)
+		if err != nil {
+			return err
+		}
+
+		if err := decodeJobs(j, output, true); err != nil {
+			return fmt.Errorf("invalid %s job: %s", jobType, err)
+		}
+	}
+
+	return nil
+}
+
+// jobsOutput returns the map of the config where the jobs of the given type
+// are decoded
+func (c *Config) jobsOutput(jobType string) (interface{}, error) {
+	switch jobType {
+	case jobExec:
+		return &c.ExecJobs, nil
+	case jobRun:
+		return &c.RunJobs, nil
+	case jobServiceRun:
+		return &c.ServiceJobs, nil
+	case jobServiceExec:
+		return &c.ServiceExecJobs, nil
+	case jobLocal:
+		return &c.LocalJobs, nil
+	case jobHTTP:
+		return &c.HTTPJobs, nil
+	case jobK8s:
+		return &c.K8sJobs, nil
+	case jobCompose:
+		return &c.ComposeJobs, nil
+	case jobSSH:
+		return &c.SSHJobs, nil
+	case jobECS:
+		return &c.ECSJobs, nil
+	case jobLambda:
+		return &c.LambdaJobs, nil
+	case jobNomad:
+		return &c.NomadJobs, nil
+	case dockerSection:
+		return &c.Dockers, nil
+	default:
+		return nil, fmt.Errorf("unknown job type %q", jobType)
+	}
+}
+
+// applyDefaults sets the values of the `defaults` sections, by job type, on
+// the jobs of that type not setting them, and removes the sections
+func applyDefaults(jobs map[string]map[string]map[string]interface{}) error {
+	sections, ok := jobs[defaultsSection]
+	if !ok {
+		return nil
+	}
+
+	delete(jobs, defaultsSection)
+	for jobType, values := range sections {
+		if jobType == dockerSection {
+			return fmt.Errorf("unknown job type %q", jobType)
+		}
+
+		// the values are validated even if there are no jobs of the type
+		output, err := (&Config{}).jobsOutput(jobType)
+		if err != nil {
+			return err
+		}
+
+		if err := decode(map[string]interface{}{defaultsSection: values}, output, true); err != nil {
+			return fmt.Errorf("invalid defaults of %s jobs: %s", jobType, err)
+		}
+
+		for _, job := range jobs[jobType] {
+			set := make(map[string]bool, len(job))
+			for k := range job {
+				set[strings.ToLower(k)] = true
+			}
+
+			for k, v := range values {
+				if !set[strings.ToLower(k)] {
+					job[k] = v
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mcuadros/ofelia/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// controlTimeout is the maximum time of the requests to the daemon, except
+// the ones following the logs
+const controlTimeout = time.Second * 30
+
+// ControlOptions are the options of the commands managing the jobs of a
+// running daemon over its control socket
+type ControlOptions struct {
+	Socket string `long:"socket" description:"control socket of the daemon, see daemon --control-socket" default:"/var/run/ofelia.sock"`
+}
+
+// call connects to the control socket and calls f with the client
+func (o *ControlOptions) call(f func(context.Context, rpc.OfeliaClient) error) error {
+	conn, err := grpc.Dial(o.Socket,
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("error connecting to %q: %s", o.Socket, err)
+	}
+
+	defer conn.Close()
+	if err := f(context.Background(), rpc.NewOfeliaClient(conn)); err != nil {
+		s := status.Convert(err)
+		if s.Code() == codes.Unavailable {
+			return fmt.Errorf("error connecting to %q: %s", o.Socket, s.Message())
+		}
+
+		return errors.New(s.Message())
+	}
+
+	return nil
+}
+
+// JobsListCommand lists the jobs of the running daemon
+type JobsListCommand struct {
+	ControlOptions
+}
+
+// Execute prints the jobs with their schedule and state
+func (c *JobsListCommand) Execute(args []string) error {
+	return c.list(os.Stdout)
+}
+
+func (c *JobsListCommand) list(out io.Writer) error {
+	return c.call(func(ctx context.Context, client rpc.OfeliaClient) error {
+		ctx, cancel := context.WithTimeout(ctx, controlTimeout)
+		defer cancel()
+
+		resp, err := client.ListJobs(ctx, &rpc.ListJobsRequest{})
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(resp.Jobs, func(i, j int) bool {
+			return resp.Jobs[i].Name < resp.Jobs[j].Name
+		})
+
+		w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSCHEDULE\tSTATE\tTAGS")
+		for _, j := range resp.Jobs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", j.Name, j.Schedule, jobState(j), strings.Join(j.Tags, ","))
+		}
+
+		return w.Flush()
+	})
+}
+
+func jobState(j *rpc.Job) string {
+	state := "idle"
+	if j.Running > 0 {
+		state = "running"
+	}
+
+	if j.Paused {
+		state += ", paused"
+	}
+
+	return state
+}
+
+// jobArgs are the positional arguments of the commands managing a job
+type jobArgs struct {
+	Job string `positional-arg-name:"job" description:"name of the job" required:"yes"`
+}
+
+// JobsRunCommand runs a job of the running daemon immediately
+type JobsRunCommand struct {
+	ControlOptions
+	Env  []string `long:"env" short:"e" description:"environment variable added to the job, as NAME=value, can be specified multiple times"`
+	Args struct {
+		Job  string   `positional-arg-name:"job" description:"name of the job" required:"yes"`
+		Args []string `positional-arg-name:"args" description:"arguments added to the command of the job"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// Execute runs the job, without waiting for it to finish
+func (c *JobsRunCommand) Execute(args []string) error {
+	return c.call(func(ctx context.Context, client rpc.OfeliaClient) error {
+		ctx, cancel := context.WithTimeout(ctx, controlTimeout)
+		defer cancel()
+
+		_, err := client.RunJob(ctx, &rpc.RunJobRequest{Name: c.Args.Job, Args: c.Args.Args, Env: c.Env})
+		return err
+	})
+}
+
+// JobsPauseCommand pauses a job of the running daemon, or resumes it
+type JobsPauseCommand struct {
+	ControlOptions
+	Resume bool    `long:"resume" description:"resume the paused job"`
+	Args   jobArgs `positional-args:"yes" required:"yes"`
+}
+
+// Execute pauses or resumes the job
+func (c *JobsPauseCommand) Execute(args []string) error {
+	return c.call(func(ctx context.Context, client rpc.OfeliaClient) error {
+		ctx, cancel := context.WithTimeout(ctx, controlTimeout)
+		defer cancel()
+
+		var err error
+		if c.Resume {
+			_, err = client.ResumeJob(ctx, &rpc.ResumeJobRequest{Name: c.Args.Job})
+		} else {
+			_, err = client.PauseJob(ctx, &rpc.PauseJobRequest{Name: c.Args.Job})
+		}
+
+		return err
+	})
+}
+
+// JobsLogsCommand prints the output of the last execution of a job of the
+// running daemon
+type JobsLogsCommand struct {
+	ControlOptions
+	Follow bool    `short:"f" long:"follow" description:"follow the output until the execution finishes"`
+	Args   jobArgs `positional-args:"yes" required:"yes"`
+}
+
+// Execute prints the output, and the error output to stderr
+func (c *JobsLogsCommand) Execute(args []string) error {
+	return c.logs(os.Stdout, os.Stderr)
+}
+
+func (c *JobsLogsCommand) logs(stdout, stderr io.Writer) error {
+	return c.call(func(ctx context.Context, client rpc.OfeliaClient) error {
+		stream, err := client.StreamLogs(ctx, &rpc.StreamLogsRequest{Name: c.Args.Job, Follow: c.Follow})
+		if err != nil {
+			return err
+		}
+
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+
+			w := stdout
+			if chunk.Stderr {
+				w = stderr
+			}
+
+			w.Write(chunk.Data)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+	"github.com/mcuadros/ofelia/rpc"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteJobs struct {
+	scheduler *core.Scheduler
+	server    *rpc.Server
+	options   ControlOptions
+}
+
+var _ = Suite(&SuiteJobs{})
+
+func (s *SuiteJobs) SetUpTest(c *C) {
+	var err error
+	s.scheduler, err = BuildFromString(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = "sh -c 'echo foo; echo bar >&2'"
+		tags = db,critical
+
+		[job-local "bar"]
+		schedule = @every 10s
+		command = echo bar
+	`)
+	c.Assert(err, IsNil)
+
+	s.options.Socket = filepath.Join(c.MkDir(), "ofelia.sock")
+	l, err := net.Listen("unix", s.options.Socket)
+	c.Assert(err, IsNil)
+
+	s.server = rpc.NewServer(s.options.Socket, s.scheduler)
+	go s.server.Serve(l)
+}
+
+func (s *SuiteJobs) TearDownTest(c *C) {
+	c.Assert(s.server.Shutdown(context.Background()), IsNil)
+}
+
+func (s *SuiteJobs) TestList(c *C) {
+	c.Assert(s.scheduler.PauseJob("bar"), IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	cmd := &JobsListCommand{ControlOptions: s.options}
+	c.Assert(cmd.list(buf), IsNil)
+	c.Assert(buf.String(), Equals, ""+
+		"NAME  SCHEDULE    STATE         TAGS\n"+
+		"bar   @every 10s  idle, paused  \n"+
+		"foo   @every 10s  idle          db,critical\n",
+	)
+}
+
+func (s *SuiteJobs) TestRunAndLogs(c *C) {
+	run := &JobsRunCommand{ControlOptions: s.options}
+	run.Args.Job = "foo"
+	c.Assert(run.Execute(nil), IsNil)
+
+	stdout, stderr := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	logs := &JobsLogsCommand{ControlOptions: s.options, Follow: true}
+	logs.Args.Job = "foo"
+
+	time.Sleep(time.Millisecond * 100)
+	c.Assert(logs.logs(stdout, stderr), IsNil)
+	c.Assert(stdout.String(), Equals, "foo\n")
+	c.Assert(stderr.String(), Equals, "bar\n")
+
+	logs.Args.Job = "bar"
+	c.Assert(logs.logs(stdout, stderr), ErrorMatches, `job "bar" has no executions`)
+}
+
+func (s *SuiteJobs) TestPause(c *C) {
+	cmd := &JobsPauseCommand{ControlOptions: s.options}
+	cmd.Args.Job = "foo"
+	c.Assert(cmd.Execute(nil), IsNil)
+	c.Assert(s.scheduler.IsPaused("foo"), Equals, true)
+
+	cmd.Resume = true
+	c.Assert(cmd.Execute(nil), IsNil)
+	c.Assert(s.scheduler.IsPaused("foo"), Equals, false)
+
+	cmd.Args.Job = "qux"
+	c.Assert(cmd.Execute(nil), ErrorMatches, core.ErrJobNotFound.Error())
+}
+
+func (s *SuiteJobs) TestSocketNotFound(c *C) {
+	cmd := &JobsListCommand{ControlOptions: ControlOptions{Socket: filepath.Join(c.MkDir(), "ofelia.sock")}}
+	c.Assert(cmd.list(bytes.NewBuffer(nil)), ErrorMatches, `error connecting to ".*ofelia.sock": .*no such file or directory.*`)
+}
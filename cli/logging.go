@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+	logging "github.com/op/go-logging"
+)
+
+// logFormatter is the formatter of the loggers built by the configs
+var logFormatter = logging.MustStringFormatter(logFormat)
+
+// SetLogFormat sets the format of the logs, text, the default, or json to write
+// a JSON object per line.
+func SetLogFormat(format string) error {
+	switch format {
+	case "", "text":
+		logFormatter = logging.MustStringFormatter(logFormat)
+	case "json":
+		logFormatter = &jsonFormatter{}
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+
+	return nil
+}
+
+// jsonFormatter formats the log records as JSON objects, the messages logged by
+// the jobs include the job, execution and duration fields.
+type jsonFormatter struct{}
+
+type jsonRecord struct {
+	Time      time.Time `json:"time"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+	Job       string    `json:"job,omitempty"`
+	Execution string    `json:"execution,omitempty"`
+	Duration  float64   `json:"duration,omitempty"`
+}
+
+func (f *jsonFormatter) Format(calldepth int, r *logging.Record, w io.Writer) error {
+	record := &jsonRecord{
+		Time:    r.Time,
+		Level:   r.Level.String(),
+		Message: r.Message(),
+	}
+
+	for _, arg := range r.Args {
+		if e, ok := arg.(*core.LogEntry); ok {
+			record.Job = e.Job
+			record.Execution = e.Execution
+			record.Duration = e.Duration.Seconds()
+			record.Message = e.Message
+		}
+	}
+
+	return json.NewEncoder(w).Encode(record)
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+	logging "github.com/op/go-logging"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteLogging struct{}
+
+var _ = Suite(&SuiteLogging{})
+
+func (s *SuiteLogging) TestSetLogFormat(c *C) {
+	defer SetLogFormat("text")
+
+	c.Assert(SetLogFormat("json"), IsNil)
+	c.Assert(logFormatter, FitsTypeOf, &jsonFormatter{})
+	c.Assert(SetLogFormat("foo"), ErrorMatches, `invalid log format "foo"`)
+}
+
+func (s *SuiteLogging) TestJSONFormatter(c *C) {
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	buf := bytes.NewBuffer(nil)
+
+	err := (&jsonFormatter{}).Format(0, &logging.Record{
+		Time:  date,
+		Level: logging.ERROR,
+		Args: []interface{}{&core.LogEntry{
+			Job:       "foo",
+			Execution: "bar",
+			Duration:  time.Second * 2,
+			Message:   "qux",
+		}},
+	}, buf)
+	c.Assert(err, IsNil)
+
+	var record jsonRecord
+	c.Assert(json.Unmarshal(buf.Bytes(), &record), IsNil)
+	c.Assert(record, DeepEquals, jsonRecord{
+		Time:      date,
+		Level:     "ERROR",
+		Message:   "qux",
+		Job:       "foo",
+		Execution: "bar",
+		Duration:  2,
+	})
+
+	buf.Reset()
+	err = (&jsonFormatter{}).Format(0, &logging.Record{
+		Time:  date,
+		Level: logging.NOTICE,
+		Args:  []interface{}{"foo"},
+	}, buf)
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, `{"time":"2020-01-01T00:00:00Z","level":"NOTICE","message":"foo"}`+"\n")
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+// NextCommand prints the next run times of the jobs
+type NextCommand struct {
+	ConfigFile         string `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
+	ConfigDir          string `long:"config-dir" description:"directory of configuration files merged after the configuration file, e.g. /etc/ofelia/conf.d"`
+	DockerLabelsConfig bool   `short:"d" long:"docker" description:"read configurations from docker labels"`
+	Count              int    `short:"n" long:"count" description:"number of run times printed for every job" default:"5"`
+	Args               struct {
+		Job string `positional-arg-name:"job" description:"name of the job, all the jobs by default"`
+	} `positional-args:"yes"`
+}
+
+// Execute prints the next run times of the given job, or of all the jobs
+func (c *NextCommand) Execute(args []string) error {
+	if c.DockerLabelsConfig && c.ConfigDir != "" {
+		return errConfigDirWithDocker
+	}
+
+	var sh *core.Scheduler
+	var err error
+	if c.DockerLabelsConfig {
+		sh, err = BuildFromDockerLabels()
+	} else {
+		sh, err = BuildFromFile(c.ConfigFile, c.ConfigDir)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	names := jobNames(sh)
+	if c.Args.Job != "" {
+		names = []string{c.Args.Job}
+	}
+
+	return printNextRuns(os.Stdout, sh, names, time.Now(), c.Count)
+}
+
+func printNextRuns(w io.Writer, sh *core.Scheduler, names []string, now time.Time, count int) error {
+	runs := sh.NextRuns(now, count)
+	for _, name := range names {
+		j := sh.GetJob(name)
+		if j == nil {
+			return fmt.Errorf("error with job %q: %s", name, core.ErrJobNotFound)
+		}
+
+		if j.GetSchedule() == "" && len(j.GetDependsOn()) == 0 {
+			fmt.Fprintf(w, "%s: runs on trigger\n", name)
+			continue
+		}
+
+		if j.GetSchedule() == "" {
+			fmt.Fprintf(w, "%s: runs after %s\n", name, strings.Join(j.GetDependsOn(), ", "))
+			continue
+		}
+
+		if j.GetSchedule() == core.RebootSchedule {
+			fmt.Fprintf(w, "%s: runs on start\n", name)
+			continue
+		}
+
+		if j.GetSchedule() == core.ManualSchedule {
+			fmt.Fprintf(w, "%s: runs manually\n", name)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s: %s\n", name, j.GetSchedule())
+		for _, next := range runs[name] {
+			fmt.Fprintf(w, "  %s\n", next.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"bytes"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteNext struct{}
+
+var _ = Suite(&SuiteNext{})
+
+func (s *SuiteNext) TestPrintNextRuns(c *C) {
+	sh, err := BuildFromString(`
+		[job-local "foo"]
+		schedule = 0 0 */6 * * *
+		command = echo foo
+
+		[job-local "bar"]
+		depends-on = foo
+		command = echo bar
+
+		[job-local "qux"]
+		schedule = @reboot
+		command = echo qux
+
+		[job-local "deploy"]
+		schedule = @manual
+		command = echo deploy
+
+		[job-local "quux"]
+		trigger = nats://localhost/jobs
+		command = echo quux
+	`)
+	c.Assert(err, IsNil)
+
+	now := time.Date(2020, 1, 1, 12, 30, 0, 0, time.Local)
+	buf := bytes.NewBuffer(nil)
+	c.Assert(printNextRuns(buf, sh, jobNames(sh), now, 2), IsNil)
+	c.Assert(buf.String(), Equals, "bar: runs after foo\n"+
+		"deploy: runs manually\n"+
+		"foo: 0 0 */6 * * *\n"+
+		"  "+time.Date(2020, 1, 1, 18, 0, 0, 0, time.Local).Format(time.RFC3339)+"\n"+
+		"  "+time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local).Format(time.RFC3339)+"\n"+
+		"quux: runs on trigger\n"+
+		"qux: runs on start\n",
+	)
+
+	err = printNextRuns(buf, sh, []string{"baz"}, now, 2)
+	c.Assert(err, ErrorMatches, `error with job "baz": .*`)
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+// RunCommand runs jobs once, out of their schedule
+type RunCommand struct {
+	ConfigFile         string   `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
+	ConfigDir          string   `long:"config-dir" description:"directory of configuration files merged after the configuration file, e.g. /etc/ofelia/conf.d"`
+	DockerLabelsConfig bool     `short:"d" long:"docker" description:"read configurations from docker labels"`
+	All                bool     `long:"all" description:"run all the jobs, one after another"`
+	LogFormat          string   `long:"log-format" description:"format of the logs, text or json" default:"text"`
+	Env                []string `long:"env" short:"e" description:"environment variable added to the job, as NAME=value, can be specified multiple times"`
+	Args               struct {
+		Job  string   `positional-arg-name:"job" description:"name of the job to run"`
+		Args []string `positional-arg-name:"args" description:"arguments added to the command of the job"`
+	} `positional-args:"yes"`
+}
+
+// Execute runs the job, or all the jobs, with all the middlewares and prints
+// their output. It fails if any execution fails, with the exit code of the job
+// if only one is run.
+func (c *RunCommand) Execute(args []string) error {
+	if (c.Args.Job == "") == !c.All {
+		return errors.New("a job name or --all is required")
+	}
+
+	if c.All && (len(c.Env) != 0 || len(c.Args.Args) != 0) {
+		return errors.New("--env and the arguments can't be used with --all")
+	}
+
+	if c.DockerLabelsConfig && c.ConfigDir != "" {
+		return errConfigDirWithDocker
+	}
+
+	if err := SetLogFormat(c.LogFormat); err != nil {
+		return err
+	}
+
+	var sh *core.Scheduler
+	var err error
+	if c.DockerLabelsConfig {
+		sh, err = BuildFromDockerLabels()
+	} else {
+		sh, err = BuildFromFile(c.ConfigFile, c.ConfigDir)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	names := []string{c.Args.Job}
+	if c.All {
+		names = jobNames(sh)
+	}
+
+	var failed []*core.Execution
+	for _, name := range names {
+		e, err := sh.RunJobOnceWithParams(name, core.RunParams{Args: c.Args.Args, Env: c.Env})
+		if err != nil {
+			return fmt.Errorf("error running job %q: %s", name, err)
+		}
+
+		os.Stdout.Write(e.Output())
+		os.Stderr.Write(e.ErrorOutput())
+		if e.Failed {
+			failed = append(failed, e)
+		}
+	}
+
+	switch {
+	case len(failed) == 0:
+		return nil
+	case len(names) == 1:
+		return failed[0].Error
+	default:
+		return fmt.Errorf("%d of %d jobs failed", len(failed), len(names))
+	}
+}
+
+func jobNames(sh *core.Scheduler) []string {
+	var names []string
+	for _, j := range sh.Jobs {
+		names = append(names, j.GetName())
+	}
+
+	sort.Strings(names)
+	return names
+}
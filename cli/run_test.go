@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/mcuadros/ofelia/core"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteRun struct {
+	file string
+}
+
+var _ = Suite(&SuiteRun{})
+
+func (s *SuiteRun) SetUpTest(c *C) {
+	file, err := ioutil.TempFile("", "ofelia")
+	c.Assert(err, IsNil)
+
+	_, err = file.WriteString(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+
+		[job-local "bar"]
+		schedule = @every 10s
+		command = sh -c 'exit 3'
+	`)
+	c.Assert(err, IsNil)
+	c.Assert(file.Close(), IsNil)
+
+	s.file = file.Name()
+}
+
+func (s *SuiteRun) TearDownTest(c *C) {
+	os.Remove(s.file)
+}
+
+func (s *SuiteRun) TestExecute(c *C) {
+	cmd := &RunCommand{ConfigFile: s.file}
+	cmd.Args.Job = "foo"
+	c.Assert(cmd.Execute(nil), IsNil)
+
+	cmd.Args.Job = "bar"
+	c.Assert(cmd.Execute(nil), DeepEquals, &core.ExitCodeError{ExitCode: 3})
+
+	cmd.Args.Job = "qux"
+	c.Assert(cmd.Execute(nil), ErrorMatches, `error running job "qux": .*`)
+}
+
+func (s *SuiteRun) TestExecuteAll(c *C) {
+	cmd := &RunCommand{ConfigFile: s.file, All: true}
+	c.Assert(cmd.Execute(nil), ErrorMatches, "1 of 2 jobs failed")
+
+	cmd.Args.Job = "foo"
+	c.Assert(cmd.Execute(nil), ErrorMatches, "a job name or --all is required")
+}
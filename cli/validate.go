@@ -1,29 +1,146 @@
 package cli
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+// nextRuns is the number of next run times printed for every job
+const nextRuns = 5
 
 // ValidateCommand validates the config file
 type ValidateCommand struct {
-	ConfigFile string `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
+	ConfigFile         string `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
+	ConfigDir          string `long:"config-dir" description:"directory of configuration files merged after the configuration file, e.g. /etc/ofelia/conf.d"`
+	DockerLabelsConfig bool   `short:"d" long:"docker" description:"read configurations from docker labels"`
 }
 
-// Execute runs the validation command
+// Execute runs the validation command, it fails if any job is invalid
 func (c *ValidateCommand) Execute(args []string) error {
-	fmt.Printf("Validating %q ... ", c.ConfigFile)
-	config, err := BuildFromFile(c.ConfigFile)
-	if err != nil {
+	if c.DockerLabelsConfig && c.ConfigDir != "" {
+		return errConfigDirWithDocker
+	}
+
+	config := &Config{}
+	if c.DockerLabelsConfig {
+		fmt.Print("Validating docker labels ... ")
+	} else if c.ConfigDir != "" {
+		fmt.Printf("Validating %q and %q ... ", c.ConfigFile, c.ConfigDir)
+	} else {
+		fmt.Printf("Validating %q ... ", c.ConfigFile)
+	}
+
+	if err := c.load(config); err != nil {
 		fmt.Println("ERROR")
 		return err
 	}
 
 	fmt.Println("OK")
-	fmt.Printf("Found %d jobs:\n", len(config.Jobs))
+	return validate(os.Stdout, config, time.Now())
+}
+
+func (c *ValidateCommand) load(config *Config) error {
+	if !c.DockerLabelsConfig {
+		return config.buildFromFiles(c.ConfigFile, c.ConfigDir)
+	}
+
+	d, err := buildDockerClient(DockerConfig{})
+	if err != nil {
+		return err
+	}
+
+	return config.buildFromDocker(d)
+}
 
-	for _, j := range config.Jobs {
-		fmt.Printf(
+// validate prints the jobs of the config with their next run times after now,
+// it returns an error if the schedule of any job is invalid.
+func validate(w io.Writer, config *Config, now time.Time) error {
+	if err := core.ValidateCronFormat(config.Global.CronFormat); err != nil {
+		return err
+	}
+
+	jobs, err := config.buildJobs(nil)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].GetName() < jobs[j].GetName()
+	})
+
+	fmt.Fprintf(w, "Found %d jobs:\n", len(jobs))
+
+	var invalid int
+	for _, j := range jobs {
+		fmt.Fprintf(w,
 			"- name: %s schedule: %q command: %q\n",
 			j.GetName(), j.GetSchedule(), j.GetCommand(),
 		)
+
+		if err := validateSchedule(w, j, config.Global.CronFormat, now); err != nil {
+			fmt.Fprintf(w, "  ERROR: %s\n", err)
+			invalid++
+		}
+	}
+
+	if invalid != 0 {
+		return fmt.Errorf("found %d invalid jobs", invalid)
+	}
+
+	return nil
+}
+
+func validateSchedule(w io.Writer, j core.Job, format string, now time.Time) error {
+	if j.GetTrigger() != "" {
+		t, err := core.ParseTrigger(j.GetTrigger())
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "  runs on messages of: %s\n", t)
+	}
+
+	if j.GetWatchPath() != "" {
+		fmt.Fprintf(w, "  runs on changes of: %s\n", j.GetWatchPath())
+	}
+
+	if j.GetSchedule() == "" {
+		if len(j.GetDependsOn()) == 0 && j.GetTrigger() == "" && j.GetWatchPath() == "" {
+			return core.ErrEmptySchedule
+		}
+
+		if len(j.GetDependsOn()) != 0 {
+			fmt.Fprintf(w, "  runs after: %s\n", strings.Join(j.GetDependsOn(), ", "))
+		}
+
+		return nil
+	}
+
+	if j.GetRunOnStartup() || j.GetSchedule() == core.RebootSchedule {
+		fmt.Fprintln(w, "  runs on start")
+	}
+
+	if j.GetSchedule() == core.ManualSchedule {
+		fmt.Fprintln(w, "  runs manually")
+	}
+
+	if core.IsFiveFieldSchedule(j.GetSchedule()) && format != core.CronStandard {
+		fmt.Fprintf(w, "  WARNING: %s\n", core.FiveFieldWarning(j.GetSchedule()))
+	}
+
+	runs, err := core.NextRuns(j.GetSchedule(), format, now, nextRuns)
+	if err != nil {
+		return err
+	}
+
+	for _, next := range runs {
+		fmt.Fprintf(w, "  next: %s\n", next.Format(time.RFC3339))
 	}
 
 	return nil
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"bytes"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteValidate struct{}
+
+var _ = Suite(&SuiteValidate{})
+
+func (s *SuiteValidate) TestValidate(c *C) {
+	config := &Config{}
+	c.Assert(config.buildFromIni([]byte(`
+		[job-local "foo"]
+		schedule = 0 12 * * *
+		command = echo foo
+
+		[job-local "bar"]
+		depends-on = foo
+		command = echo bar
+
+		[job-local "qux"]
+		schedule = @reboot
+		command = echo qux
+
+		[job-local "quux"]
+		trigger = redis://:secret@localhost/jobs
+		watch-path = /srv/incoming
+		command = echo quux
+	`)), IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(validate(buf, config, time.Now()), IsNil)
+	c.Assert(buf.String(), Matches, `(?s)Found 4 jobs:
+- name: bar schedule: "" command: "echo bar"
+  runs after: foo
+- name: foo schedule: "0 12 \* \* \*" command: "echo foo"
+  WARNING: the schedule "0 12 \* \* \*" of five fields .*
+(  next: .*\n){5}- name: quux schedule: "" command: "echo quux"
+  runs on messages of: redis://localhost:6379/jobs
+  runs on changes of: /srv/incoming
+- name: qux schedule: "@reboot" command: "echo qux"
+  runs on start
+`)
+}
+
+func (s *SuiteValidate) TestValidateInvalid(c *C) {
+	config := &Config{}
+	c.Assert(config.buildFromIni([]byte(`
+		[job-local "foo"]
+		schedule = 0 0 25 * * *
+		command = echo foo
+
+		[job-local "bar"]
+		command = echo bar
+
+		[job-local "qux"]
+		schedule = @daily
+		command = echo qux
+	`)), IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	err := validate(buf, config, time.Now())
+	c.Assert(err, ErrorMatches, "found 2 invalid jobs")
+	c.Assert(buf.String(), Matches, `(?s).*name: bar.*\n  ERROR: unable to add a job with a empty schedule.*`)
+	c.Assert(buf.String(), Matches, `(?s).*name: foo.*\n  ERROR: invalid schedule "0 0 25 \* \* \*": End of range \(25\) above maximum.*`)
+}
+
+func (s *SuiteValidate) TestExecuteConfigDirWithDocker(c *C) {
+	cmd := &ValidateCommand{ConfigDir: "/etc/ofelia/conf.d", DockerLabelsConfig: true}
+	c.Assert(cmd.Execute(nil), Equals, errConfigDirWithDocker)
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func (c *Config) buildFromYAML(content []byte) error {
+	s, err := parseYAML(content)
+	if err != nil {
+		return err
+	}
+
+	return c.decodeSections(s)
+}
+
+// parseYAML returns the sections of a YAML document, with the same sections
+// and keys as the INI files: the `global` section and a map of jobs by name
+// for every job type. The sections starting with `x-` are ignored, to hold the
+// anchors shared by the jobs.
+func parseYAML(content []byte) (*sections, error) {
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	out := newSections()
+	for name, section := range document {
+		if strings.HasPrefix(name, "x-") {
+			continue
+		}
+
+		values, err := yamlMap(section)
+		if err != nil {
+			return nil, fmt.Errorf("invalid section %q: %s", name, err)
+		}
+
+		if strings.EqualFold(name, globalSection) {
+			out.global = values
+			continue
+		}
+
+		jobType := strings.ToLower(name)
+		out.jobs[jobType] = make(map[string]map[string]interface{})
+		for jobName, job := range values {
+			if out.jobs[jobType][jobName], err = yamlMap(job); err != nil {
+				return nil, fmt.Errorf("invalid %s job %q: %s", jobType, jobName, err)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// yamlMap converts a YAML mapping into a map with string keys, an empty value
+// is an empty map
+func yamlMap(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a mapping")
+	}
+
+	values := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		values[fmt.Sprint(k)] = v
+	}
+
+	return values, nil
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteYAML struct{}
+
+var _ = Suite(&SuiteYAML{})
+
+func (s *SuiteYAML) TestBuildFromYAML(c *C) {
+	conf := &Config{}
+	err := conf.buildFromYAML([]byte(`
+global:
+  slack-only-on-error: true
+
+x-defaults: &defaults
+  schedule: "@every 10s"
+  max-runtime: 1m30s
+
+job-run:
+  foo:
+    <<: *defaults
+    image: busybox
+    command: |
+      echo "foo bar"
+  baz:
+    <<: *defaults
+    image: alpine
+
+job-local:
+  bar:
+    schedule: "@every 10s"
+    command: echo bar
+    environment:
+      - FOO=foo
+      - BAR=bar
+
+job-http:
+  qux:
+    schedule: "@every 10s"
+    url: http://example.com
+    expected-status: [200, 204]
+`))
+
+	c.Assert(err, IsNil)
+	c.Assert(conf.Global.SlackOnlyOnError, Equals, true)
+	c.Assert(conf.RunJobs["foo"].Command, Equals, "echo \"foo bar\"\n")
+	c.Assert(conf.RunJobs["foo"].MaxRuntime, Equals, time.Minute+time.Second*30)
+	c.Assert(conf.RunJobs["baz"].Image, Equals, "alpine")
+	c.Assert(conf.RunJobs["baz"].MaxRuntime, Equals, time.Minute+time.Second*30)
+	c.Assert(conf.LocalJobs["bar"].Environment, DeepEquals, []string{"FOO=foo", "BAR=bar"})
+	c.Assert(conf.HTTPJobs["qux"].ExpectedStatus, DeepEquals, []int{200, 204})
+}
+
+func (s *SuiteYAML) TestBuildFromYAMLDefaults(c *C) {
+	conf := &Config{}
+	err := conf.buildFromYAML([]byte(`
+defaults:
+  job-exec:
+    user: www-data
+
+job-exec:
+  foo:
+    schedule: "@every 10s"
+    container: web
+  bar:
+    schedule: "@every 10s"
+    container: web
+    user: root
+`))
+
+	c.Assert(err, IsNil)
+	c.Assert(conf.ExecJobs["foo"].User, Equals, "www-data")
+	c.Assert(conf.ExecJobs["bar"].User, Equals, "root")
+}
+
+func (s *SuiteYAML) TestBuildFromYAMLInvalid(c *C) {
+	err := (&Config{}).buildFromYAML([]byte("job-run: foo"))
+	c.Assert(err, ErrorMatches, `invalid section "job-run": expected a mapping`)
+
+	err = (&Config{}).buildFromYAML([]byte("job-run:\n  foo:\n    imagen: busybox"))
+	c.Assert(err, ErrorMatches, `(?s)invalid job-run job: .*imagen`)
+}
+
+func (s *SuiteYAML) TestBuildFromFile(c *C) {
+	dir := c.MkDir()
+	yml := filepath.Join(dir, "ofelia.yml")
+	c.Assert(ioutil.WriteFile(yml, []byte("job-local:\n  foo:\n    command: echo foo"), 0644), IsNil)
+
+	ini := filepath.Join(dir, "ofelia.conf")
+	c.Assert(ioutil.WriteFile(ini, []byte("[job-local \"foo\"]\ncommand = echo foo"), 0644), IsNil)
+
+	for _, file := range []string{yml, ini} {
+		conf := &Config{}
+		c.Assert(conf.buildFromFile(file), IsNil)
+		c.Assert(conf.LocalJobs["foo"].Command, Equals, "echo foo")
+	}
+}
@@ -0,0 +1,361 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	amqpFrameMethod    = 1
+	amqpFrameHeartbeat = 8
+	amqpFrameEnd       = 0xCE
+)
+
+// amqpHeartbeat is the maximum heartbeat, in seconds, accepted from the broker,
+// or the one requested if the broker disables them
+var amqpHeartbeat uint16 = 60
+
+// the AMQP methods used, as class and method id
+var (
+	amqpConnectionStart   = [2]uint16{10, 10}
+	amqpConnectionStartOk = [2]uint16{10, 11}
+	amqpConnectionTune    = [2]uint16{10, 30}
+	amqpConnectionTuneOk  = [2]uint16{10, 31}
+	amqpConnectionOpen    = [2]uint16{10, 40}
+	amqpConnectionOpenOk  = [2]uint16{10, 41}
+	amqpConnectionClose   = [2]uint16{10, 50}
+	amqpChannelOpen       = [2]uint16{20, 10}
+	amqpChannelOpenOk     = [2]uint16{20, 11}
+	amqpChannelClose      = [2]uint16{20, 40}
+	amqpBasicQos          = [2]uint16{60, 10}
+	amqpBasicQosOk        = [2]uint16{60, 11}
+	amqpBasicConsume      = [2]uint16{60, 20}
+	amqpBasicConsumeOk    = [2]uint16{60, 21}
+	amqpBasicDeliver      = [2]uint16{60, 60}
+	amqpBasicAck          = [2]uint16{60, 80}
+)
+
+// amqpTrigger consumes a queue of an AMQP 0-9-1 broker, like RabbitMQ. The
+// messages are acknowledged once the execution they triggered finishes, and
+// at most prefetch messages are unacknowledged, so the executions triggered
+// at the same time are bounded. The queue must exist.
+type amqpTrigger struct {
+	addr     string
+	tls      bool
+	queue    string
+	vhost    string
+	user     string
+	password string
+	prefetch uint16
+}
+
+func newAMQPTrigger(u *url.URL, queue string) (*amqpTrigger, error) {
+	t := &amqpTrigger{
+		addr:     hostPort(u, "5672"),
+		queue:    queue,
+		vhost:    u.Query().Get("vhost"),
+		user:     "guest",
+		password: "guest",
+		prefetch: 1,
+	}
+
+	if v := u.Query().Get("prefetch"); v != "" {
+		prefetch, err := strconv.ParseUint(v, 10, 16)
+		if err != nil || prefetch == 0 {
+			return nil, fmt.Errorf("invalid prefetch %q", v)
+		}
+
+		t.prefetch = uint16(prefetch)
+	}
+
+	if u.Scheme == "amqps" {
+		t.tls = true
+		t.addr = hostPort(u, "5671")
+	}
+
+	if t.vhost == "" {
+		t.vhost = "/"
+	}
+
+	if u.User != nil {
+		t.user = u.User.Username()
+		t.password, _ = u.User.Password()
+	}
+
+	return t, nil
+}
+
+func (t *amqpTrigger) String() string {
+	scheme := "amqp"
+	if t.tls {
+		scheme = "amqps"
+	}
+
+	s := scheme + "://" + t.addr + "/" + t.queue + "?vhost=" + url.QueryEscape(t.vhost)
+	if t.prefetch != 1 {
+		s += "&prefetch=" + strconv.Itoa(int(t.prefetch))
+	}
+
+	return s
+}
+
+func (t *amqpTrigger) Listen(stop <-chan struct{}, fire func() <-chan struct{}) error {
+	c, err := dialTrigger(t.addr, t.tls, stop)
+	if err != nil {
+		return stopped(stop, err)
+	}
+
+	defer c.Close()
+	return stopped(stop, t.listen(&amqpConn{triggerConn: c}, fire))
+}
+
+func (t *amqpTrigger) listen(c *amqpConn, fire func() <-chan struct{}) error {
+	if _, err := io.WriteString(c, "AMQP\x00\x00\x09\x01"); err != nil {
+		return err
+	}
+
+	if _, err := c.readMethod(amqpConnectionStart); err != nil {
+		return err
+	}
+
+	startOk := &amqpArgs{}
+	startOk.table()
+	startOk.shortstr("PLAIN")
+	startOk.longstr("\x00" + t.user + "\x00" + t.password)
+	startOk.shortstr("en_US")
+	if err := c.writeMethod(0, amqpConnectionStartOk, startOk); err != nil {
+		return err
+	}
+
+	tune, err := c.readMethod(amqpConnectionTune)
+	if err != nil {
+		return err
+	}
+
+	if len(tune) < 8 {
+		return fmt.Errorf("amqp: invalid tune method")
+	}
+
+	// the limits of the server are accepted, and its heartbeat up to
+	// amqpHeartbeat
+	heartbeat := binary.BigEndian.Uint16(tune[6:])
+	if heartbeat == 0 || heartbeat > amqpHeartbeat {
+		heartbeat = amqpHeartbeat
+	}
+
+	tuneOk := &amqpArgs{}
+	tuneOk.Write(tune[:6])
+	tuneOk.short(heartbeat)
+	if err := c.writeMethod(0, amqpConnectionTuneOk, tuneOk); err != nil {
+		return err
+	}
+
+	open := &amqpArgs{}
+	open.shortstr(t.vhost)
+	open.shortstr("")
+	open.WriteByte(0)
+	if err := c.writeMethod(0, amqpConnectionOpen, open); err != nil {
+		return err
+	}
+
+	if _, err := c.readMethod(amqpConnectionOpenOk); err != nil {
+		return err
+	}
+
+	channel := &amqpArgs{}
+	channel.shortstr("")
+	if err := c.writeMethod(1, amqpChannelOpen, channel); err != nil {
+		return err
+	}
+
+	if _, err := c.readMethod(amqpChannelOpenOk); err != nil {
+		return err
+	}
+
+	qos := &amqpArgs{}
+	qos.long(0)
+	qos.short(t.prefetch)
+	qos.WriteByte(0)
+	if err := c.writeMethod(1, amqpBasicQos, qos); err != nil {
+		return err
+	}
+
+	if _, err := c.readMethod(amqpBasicQosOk); err != nil {
+		return err
+	}
+
+	consume := &amqpArgs{}
+	consume.short(0)
+	consume.shortstr(t.queue)
+	consume.shortstr("ofelia")
+	consume.WriteByte(0)
+	consume.table()
+	if err := c.writeMethod(1, amqpBasicConsume, consume); err != nil {
+		return err
+	}
+
+	if _, err := c.readMethod(amqpBasicConsumeOk); err != nil {
+		return err
+	}
+
+	c.keepalive(
+		time.Duration(heartbeat)*time.Second,
+		[]byte{amqpFrameHeartbeat, 0, 0, 0, 0, 0, 0, amqpFrameEnd},
+	)
+
+	for {
+		// the content of the messages, following the deliveries, is ignored
+		deliver, err := c.readMethod(amqpBasicDeliver)
+		if err != nil {
+			return err
+		}
+
+		tag, err := amqpDeliveryTag(deliver)
+		if err != nil {
+			return err
+		}
+
+		// the message is redelivered if the connection is lost before
+		finished := fire()
+		go func() {
+			<-finished
+			ack := &amqpArgs{}
+			ack.longlong(tag)
+			ack.WriteByte(0)
+			c.writeMethod(1, amqpBasicAck, ack)
+		}()
+	}
+}
+
+// amqpDeliveryTag returns the delivery tag of the arguments of a deliver
+// method, following the consumer tag
+func amqpDeliveryTag(args []byte) (uint64, error) {
+	if len(args) < 1 || len(args) < 1+int(args[0])+8 {
+		return 0, fmt.Errorf("amqp: invalid deliver method")
+	}
+
+	return binary.BigEndian.Uint64(args[1+int(args[0]):]), nil
+}
+
+// amqpConn is the connection of an AMQP trigger, the frames are written by
+// the trigger, the acknowledgements and the heartbeats
+type amqpConn struct {
+	*triggerConn
+}
+
+func (c *amqpConn) writeMethod(channel uint16, method [2]uint16, args *amqpArgs) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return writeAMQPMethod(c, channel, method, args)
+}
+
+// amqpArgs are the arguments of a method
+type amqpArgs struct {
+	bytes.Buffer
+}
+
+func (a *amqpArgs) short(v uint16) {
+	binary.Write(a, binary.BigEndian, v)
+}
+
+func (a *amqpArgs) long(v uint32) {
+	binary.Write(a, binary.BigEndian, v)
+}
+
+func (a *amqpArgs) longlong(v uint64) {
+	binary.Write(a, binary.BigEndian, v)
+}
+
+func (a *amqpArgs) shortstr(s string) {
+	a.WriteByte(byte(len(s)))
+	a.WriteString(s)
+}
+
+func (a *amqpArgs) longstr(s string) {
+	binary.Write(a, binary.BigEndian, uint32(len(s)))
+	a.WriteString(s)
+}
+
+// table writes an empty field table
+func (a *amqpArgs) table() {
+	binary.Write(a, binary.BigEndian, uint32(0))
+}
+
+func writeAMQPMethod(w io.Writer, channel uint16, method [2]uint16, args *amqpArgs) error {
+	payload := &amqpArgs{}
+	payload.short(method[0])
+	payload.short(method[1])
+	payload.Write(args.Bytes())
+
+	frame := &amqpArgs{}
+	frame.WriteByte(amqpFrameMethod)
+	frame.short(channel)
+	frame.longstr(payload.String())
+	frame.WriteByte(amqpFrameEnd)
+
+	_, err := w.Write(frame.Bytes())
+	return err
+}
+
+// readMethod reads frames until a method frame and returns the arguments of
+// the method, an error if it isn't the expected one. The frames of other
+// kinds, like the content of the messages and the heartbeats, are skipped.
+func (c *amqpConn) readMethod(method [2]uint16) ([]byte, error) {
+	for {
+		c.waitRead()
+
+		var header struct {
+			Kind    byte
+			Channel uint16
+			Size    uint32
+		}
+
+		if err := binary.Read(c.r, binary.BigEndian, &header); err != nil {
+			return nil, err
+		}
+
+		payload := make([]byte, header.Size+1)
+		if _, err := io.ReadFull(c.r, payload); err != nil {
+			return nil, err
+		}
+
+		if payload[header.Size] != amqpFrameEnd {
+			return nil, fmt.Errorf("amqp: invalid frame end")
+		}
+
+		if header.Kind != amqpFrameMethod {
+			continue
+		}
+
+		if header.Size < 4 {
+			return nil, fmt.Errorf("amqp: invalid method frame")
+		}
+
+		m := [2]uint16{binary.BigEndian.Uint16(payload), binary.BigEndian.Uint16(payload[2:])}
+		args := payload[4:header.Size]
+		switch {
+		case m == method:
+			return args, nil
+		case m == amqpConnectionClose || m == amqpChannelClose:
+			return nil, amqpCloseError(args)
+		default:
+			return nil, fmt.Errorf("amqp: unexpected method %d.%d", m[0], m[1])
+		}
+	}
+}
+
+// amqpCloseError returns the error of the arguments of a close method
+func amqpCloseError(args []byte) error {
+	if len(args) < 3 || len(args) < 3+int(args[2]) {
+		return fmt.Errorf("amqp: closed by the server")
+	}
+
+	code := binary.BigEndian.Uint16(args)
+	return fmt.Errorf("amqp: %s (%d)", args[3:3+int(args[2])], code)
+}
@@ -0,0 +1,196 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteAMQP struct{}
+
+var _ = Suite(&SuiteAMQP{})
+
+// readTestAMQPFrame reads a method frame sent by the client
+func readTestAMQPFrame(r *bufio.Reader) ([2]uint16, []byte) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return [2]uint16{}, nil
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return [2]uint16{}, nil
+	}
+
+	m := [2]uint16{binary.BigEndian.Uint16(payload), binary.BigEndian.Uint16(payload[2:])}
+	return m, payload[4 : len(payload)-1]
+}
+
+func writeTestAMQPMethod(w io.Writer, channel uint16, method [2]uint16, args ...byte) {
+	a := &amqpArgs{}
+	a.Write(args)
+	writeAMQPMethod(w, channel, method, a)
+}
+
+// writeTestAMQPDeliver writes a delivery with the given tag followed by its
+// content header and body
+func writeTestAMQPDeliver(conn net.Conn, tag uint64) {
+	deliver := &amqpArgs{}
+	deliver.shortstr("ofelia")
+	deliver.longlong(tag)
+	deliver.WriteByte(0)
+	deliver.shortstr("")
+	deliver.shortstr("jobs")
+	writeAMQPMethod(conn, 1, amqpBasicDeliver, deliver)
+	conn.Write([]byte{2, 0, 1, 0, 0, 0, 1, 0, amqpFrameEnd})
+	conn.Write([]byte{3, 0, 1, 0, 0, 0, 1, 'x', amqpFrameEnd})
+}
+
+// serveTestAMQP serves the handshake of a connection, up to the consumption
+// of the queue, with the given heartbeat
+func serveTestAMQP(c *C, heartbeat byte, handler func(conn net.Conn, r *bufio.Reader)) string {
+	return serveTrigger(c, func(conn net.Conn, r *bufio.Reader) {
+		io.ReadFull(r, make([]byte, 8))
+		writeTestAMQPMethod(conn, 0, amqpConnectionStart, 0, 9)
+		readTestAMQPFrame(r)
+		writeTestAMQPMethod(conn, 0, amqpConnectionTune, 0x07, 0xff, 0, 2, 0, 0, 0, heartbeat)
+		readTestAMQPFrame(r)
+		readTestAMQPFrame(r)
+		writeTestAMQPMethod(conn, 0, amqpConnectionOpenOk, 0)
+		readTestAMQPFrame(r)
+		writeTestAMQPMethod(conn, 1, amqpChannelOpenOk, 0, 0, 0, 0)
+		readTestAMQPFrame(r)
+		writeTestAMQPMethod(conn, 1, amqpBasicQosOk)
+		readTestAMQPFrame(r)
+		writeTestAMQPMethod(conn, 1, amqpBasicConsumeOk, 6, 'o', 'f', 'e', 'l', 'i', 'a')
+		handler(conn, r)
+	})
+}
+
+func (s *SuiteAMQP) TestListen(c *C) {
+	addr := serveTrigger(c, func(conn net.Conn, r *bufio.Reader) {
+		protocol := make([]byte, 8)
+		io.ReadFull(r, protocol)
+		c.Check(string(protocol), Equals, "AMQP\x00\x00\x09\x01")
+
+		writeTestAMQPMethod(conn, 0, amqpConnectionStart, 0, 9)
+		m, args := readTestAMQPFrame(r)
+		c.Check(m, Equals, amqpConnectionStartOk)
+		c.Check(string(args), Equals, "\x00\x00\x00\x00\x05PLAIN\x00\x00\x00\x0a\x00user\x00pass\x05en_US")
+
+		writeTestAMQPMethod(conn, 0, amqpConnectionTune, 0x07, 0xff, 0, 2, 0, 0, 0, 60)
+		m, args = readTestAMQPFrame(r)
+		c.Check(m, Equals, amqpConnectionTuneOk)
+		c.Check(args, DeepEquals, []byte{0x07, 0xff, 0, 2, 0, 0, 0, 60})
+
+		m, args = readTestAMQPFrame(r)
+		c.Check(m, Equals, amqpConnectionOpen)
+		c.Check(string(args), Equals, "\x04prod\x00\x00")
+		writeTestAMQPMethod(conn, 0, amqpConnectionOpenOk, 0)
+
+		m, _ = readTestAMQPFrame(r)
+		c.Check(m, Equals, amqpChannelOpen)
+		writeTestAMQPMethod(conn, 1, amqpChannelOpenOk, 0, 0, 0, 0)
+
+		m, args = readTestAMQPFrame(r)
+		c.Check(m, Equals, amqpBasicQos)
+		c.Check(args, DeepEquals, []byte{0, 0, 0, 0, 0, 2, 0})
+		writeTestAMQPMethod(conn, 1, amqpBasicQosOk)
+
+		m, args = readTestAMQPFrame(r)
+		c.Check(m, Equals, amqpBasicConsume)
+		c.Check(string(args), Equals, "\x00\x00\x04jobs\x06ofelia\x00\x00\x00\x00\x00")
+		writeTestAMQPMethod(conn, 1, amqpBasicConsumeOk, 6, 'o', 'f', 'e', 'l', 'i', 'a')
+
+		writeTestAMQPDeliver(conn, 1)
+		writeTestAMQPDeliver(conn, 2)
+		io.Copy(ioutil.Discard, r)
+	})
+
+	t, err := ParseTrigger(fmt.Sprintf("amqp://user:pass@%s/jobs?vhost=prod&prefetch=2", addr))
+	c.Assert(err, IsNil)
+	c.Assert(listenTrigger(c, t, 2), IsNil)
+}
+
+func (s *SuiteAMQP) TestListenClosed(c *C) {
+	addr := serveTrigger(c, func(conn net.Conn, r *bufio.Reader) {
+		io.ReadFull(r, make([]byte, 8))
+		writeTestAMQPMethod(conn, 0, amqpConnectionStart)
+		readTestAMQPFrame(r)
+
+		close := &amqpArgs{}
+		close.short(403)
+		close.shortstr("ACCESS_REFUSED")
+		close.short(0)
+		close.short(0)
+		writeAMQPMethod(conn, 0, amqpConnectionClose, close)
+	})
+
+	t, err := ParseTrigger(fmt.Sprintf("amqp://%s/jobs", addr))
+	c.Assert(err, IsNil)
+	c.Assert(listenTrigger(c, t, 1), ErrorMatches, `amqp: ACCESS_REFUSED \(403\)`)
+}
+
+func (s *SuiteAMQP) TestListenAckAfterRun(c *C) {
+	acked := make(chan []byte, 1)
+	addr := serveTestAMQP(c, 60, func(conn net.Conn, r *bufio.Reader) {
+		writeTestAMQPDeliver(conn, 7)
+		m, args := readTestAMQPFrame(r)
+		c.Check(m, Equals, amqpBasicAck)
+		acked <- args
+		io.Copy(ioutil.Discard, r)
+	})
+
+	t, err := ParseTrigger(fmt.Sprintf("amqp://%s/jobs", addr))
+	c.Assert(err, IsNil)
+
+	stop := make(chan struct{})
+	run := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- t.Listen(stop, func() <-chan struct{} { return run })
+	}()
+
+	select {
+	case <-acked:
+		c.Fatal("acknowledged before the execution finished")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	close(run)
+	select {
+	case args := <-acked:
+		c.Assert(args, DeepEquals, []byte{0, 0, 0, 0, 0, 0, 0, 7, 0})
+	case <-time.After(time.Second * 5):
+		c.Fatal("timeout waiting for the acknowledgement")
+	}
+
+	close(stop)
+	c.Assert(<-done, IsNil)
+}
+
+func (s *SuiteAMQP) TestListenHeartbeat(c *C) {
+	addr := serveTestAMQP(c, 1, func(conn net.Conn, r *bufio.Reader) {
+		// a heartbeat is sent every half a second, then the broker stops
+		// responding
+		heartbeat := make([]byte, 8)
+		io.ReadFull(r, heartbeat)
+		c.Check(heartbeat, DeepEquals, []byte{amqpFrameHeartbeat, 0, 0, 0, 0, 0, 0, amqpFrameEnd})
+		time.Sleep(time.Second * 3)
+	})
+
+	t, err := ParseTrigger(fmt.Sprintf("amqp://%s/jobs", addr))
+	c.Assert(err, IsNil)
+	c.Assert(listenTrigger(c, t, 1), ErrorMatches, ".*i/o timeout")
+}
+
+func (s *SuiteAMQP) TestParsePrefetch(c *C) {
+	_, err := ParseTrigger("amqp://rabbit/jobs?prefetch=0")
+	c.Assert(err, ErrorMatches, `invalid trigger "amqp://rabbit/jobs\?prefetch=0": invalid prefetch "0"`)
+}
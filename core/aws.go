@@ -0,0 +1,451 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	awsTimeout = time.Second * 30
+	// awsContainerCredentialsHost serves the credentials of the task role to
+	// the containers of the ECS tasks
+	awsContainerCredentialsHost = "http://169.254.170.2"
+	// awsInstanceMetadataHost serves the credentials of the instance profile
+	// to the EC2 instances, awsMetadataTimeout is short since it's the last
+	// source of the credentials tried, usually unreachable out of EC2
+	awsInstanceMetadataHost = "http://169.254.169.254"
+	awsMetadataTimeout      = time.Second
+)
+
+// AWSConfig contains the region and credentials used by the AWS jobs, if they
+// aren't set the AWS_REGION environment variable is used, and the credentials
+// are looked up as LoadAWSCredentials does.
+type AWSConfig struct {
+	AWSRegion          string `mapstructure:"aws-region"`
+	AWSAccessKeyID     string `mapstructure:"aws-access-key-id"`
+	AWSSecretAccessKey string `mapstructure:"aws-secret-access-key"`
+	// AWSEndpoint replaces the endpoints of the AWS services, e.g. the URL of
+	// LocalStack.
+	AWSEndpoint string `mapstructure:"aws-endpoint"`
+}
+
+func (c *AWSConfig) buildClient() (*awsClient, error) {
+	region := c.AWSRegion
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region == "" {
+			region = os.Getenv(env)
+		}
+	}
+
+	if region == "" {
+		return nil, fmt.Errorf("aws-region is required")
+	}
+
+	client := &awsClient{
+		region:   region,
+		endpoint: c.AWSEndpoint,
+		client:   &http.Client{Timeout: awsTimeout},
+	}
+
+	var err error
+	client.credentials, err = LoadAWSCredentials(c.AWSAccessKeyID, c.AWSSecretAccessKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.credentials.AccessKeyID == "" {
+		return nil, fmt.Errorf("no AWS credentials found, aws-access-key-id and aws-secret-access-key are required")
+	}
+
+	return client, nil
+}
+
+// AWSCredentials are the credentials signing the requests to AWS, the
+// SessionToken is only set for temporary credentials
+type AWSCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"Token"`
+}
+
+// LoadAWSCredentials returns the given credentials, if any, or the first ones
+// found in the chain of the AWS SDKs: the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables, the
+// profile AWS_PROFILE, or default, of the shared credentials file, the task
+// role when running in ECS and the instance profile when running in EC2. The
+// credentials are empty if none is found, it's up to the caller to fail or
+// to send anonymous requests.
+func LoadAWSCredentials(accessKeyID, secretAccessKey string) (AWSCredentials, error) {
+	if accessKeyID != "" {
+		return AWSCredentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey}, nil
+	}
+
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return AWSCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	for _, load := range []func() (AWSCredentials, error){
+		sharedAWSCredentials,
+		containerAWSCredentials,
+		instanceAWSCredentials,
+	} {
+		creds, err := load()
+		if err != nil || creds.AccessKeyID != "" {
+			return creds, err
+		}
+	}
+
+	return AWSCredentials{}, nil
+}
+
+// sharedAWSCredentials reads the credentials of the profile of the shared
+// credentials file, AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials
+func sharedAWSCredentials() (AWSCredentials, error) {
+	filename := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if filename == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return AWSCredentials{}, nil
+		}
+
+		filename = filepath.Join(home, ".aws", "credentials")
+	}
+
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return AWSCredentials{}, nil
+	} else if err != nil {
+		return AWSCredentials{}, err
+	}
+
+	defer f.Close()
+
+	var creds AWSCredentials
+	var section string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if section != profile || len(kv) != 2 {
+			continue
+		}
+
+		value := strings.TrimSpace(kv[1])
+		switch strings.TrimSpace(kv[0]) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = value
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = value
+		case "aws_session_token":
+			creds.SessionToken = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return AWSCredentials{}, fmt.Errorf("error reading AWS credentials file %q: %s", filename, err)
+	}
+
+	return creds, nil
+}
+
+// containerAWSCredentials returns the credentials of the task role of the ECS
+// task running Ofelia
+func containerAWSCredentials() (AWSCredentials, error) {
+	url := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		url = awsContainerCredentialsHost + uri
+	}
+
+	if url == "" {
+		return AWSCredentials{}, nil
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	var creds AWSCredentials
+	if err := doJSON(&http.Client{Timeout: awsTimeout}, req, &creds); err != nil {
+		return AWSCredentials{}, fmt.Errorf("error reading AWS credentials of the task role: %s", err)
+	}
+
+	return creds, nil
+}
+
+// instanceAWSCredentials returns the credentials of the instance profile of
+// the EC2 instance running Ofelia, using the IMDSv2. No credentials are
+// returned out of EC2, when the metadata service isn't reachable or if
+// AWS_EC2_METADATA_DISABLED is true.
+func instanceAWSCredentials() (AWSCredentials, error) {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return AWSCredentials{}, nil
+	}
+
+	host := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	if host == "" {
+		host = awsInstanceMetadataHost
+	}
+
+	host = strings.TrimSuffix(host, "/")
+	client := &http.Client{Timeout: awsMetadataTimeout}
+
+	req, err := http.NewRequest("PUT", host+"/latest/api/token", nil)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+	token, err := readMetadata(client, req)
+	if err != nil {
+		return AWSCredentials{}, nil
+	}
+
+	path := host + "/latest/meta-data/iam/security-credentials/"
+	req, _ = http.NewRequest("GET", path, nil)
+	req.Header.Set("X-Aws-Ec2-Metadata-Token", token)
+	role, err := readMetadata(client, req)
+	if err != nil || role == "" {
+		return AWSCredentials{}, nil
+	}
+
+	req, _ = http.NewRequest("GET", path+strings.SplitN(role, "\n", 2)[0], nil)
+	req.Header.Set("X-Aws-Ec2-Metadata-Token", token)
+
+	var creds AWSCredentials
+	if err := doJSON(client, req, &creds); err != nil {
+		return AWSCredentials{}, fmt.Errorf("error reading AWS credentials of the instance profile: %s", err)
+	}
+
+	return creds, nil
+}
+
+// readMetadata returns the content of a path of the instance metadata
+func readMetadata(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	return strings.TrimSpace(string(b)), err
+}
+
+// awsClient is a minimal client of the AWS APIs, signing the requests with the
+// Signature Version 4
+type awsClient struct {
+	region      string
+	endpoint    string
+	credentials AWSCredentials
+	client      *http.Client
+}
+
+// url returns the URL of the endpoint of the service in the region
+func (c *awsClient) url(service string) string {
+	if c.endpoint != "" {
+		return strings.TrimSuffix(c.endpoint, "/")
+	}
+
+	return fmt.Sprintf("https://%s.%s.amazonaws.com", service, c.region)
+}
+
+// call calls an action of the services using the JSON 1.1 protocol, like ECS
+// and CloudWatch Logs, target is the prefix of the actions of the service.
+func (c *awsClient) call(service, target, action string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.url(service)+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target+"."+action)
+	c.sign(req, service, body, time.Now())
+
+	return doJSON(c.client, req, out)
+}
+
+func (c *awsClient) sign(req *http.Request, service string, body []byte, now time.Time) {
+	SignAWSRequest(req, c.credentials, c.region, service, body, now)
+}
+
+// SignAWSRequest signs the request to the service in the region with the
+// Signature Version 4, every header already set is signed. The request is
+// left unsigned if the credentials are empty, to be sent anonymously.
+func SignAWSRequest(req *http.Request, creds AWSCredentials, region, service string, body []byte, now time.Time) {
+	date := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", date)
+	if creds.AccessKeyID == "" {
+		return
+	}
+
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := []string{"host"}
+	values := map[string]string{"host": req.URL.Host}
+	for name, v := range req.Header {
+		name = strings.ToLower(name)
+		headers = append(headers, name)
+		values[name] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	sort.Strings(headers)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+
+	// the path is escaped twice, except for S3
+	path := req.URL.EscapedPath()
+	if service != "s3" {
+		segments := strings.Split(path, "/")
+		for i, s := range segments {
+			segments[i] = awsEscape(s)
+		}
+
+		path = strings.Join(segments, "/")
+	}
+
+	if path == "" {
+		path = "/"
+	}
+
+	signedHeaders := strings.Join(headers, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.Replace(req.URL.Query().Encode(), "+", "%20", -1),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+
+	scope := strings.Join([]string{date[:8], region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		date,
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, v := range []string{date[:8], region, service, "aws4_request"} {
+		key = hmacSHA256(key, v)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign)),
+	))
+}
+
+// awsEscape escapes all the characters but the unreserved ones
+func awsEscape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) != -1 {
+			b.WriteByte(c)
+			continue
+		}
+
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
+
+func hexSHA256(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsError returns the error of a response of AWS, with its type and message
+func awsError(code int, body []byte) error {
+	var e struct {
+		Type         string `json:"__type"`
+		Message      string `json:"message"`
+		MessageUpper string `json:"Message"`
+	}
+
+	if json.Unmarshal(body, &e) != nil || e.Message+e.MessageUpper == "" {
+		return fmt.Errorf("unexpected status code %d: %s", code, bytes.TrimSpace(body))
+	}
+
+	if e.Type == "" {
+		return fmt.Errorf("%s", e.Message+e.MessageUpper)
+	}
+
+	// the type can be prefixed by the namespace of the service
+	e.Type = e.Type[strings.LastIndex(e.Type, "#")+1:]
+	return fmt.Errorf("%s: %s", e.Type, e.Message+e.MessageUpper)
+}
+
+// doJSON sends the request and decodes the JSON response into out, the AWS
+// errors are returned with their type and message
+func doJSON(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return awsError(resp.StatusCode, b)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
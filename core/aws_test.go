@@ -0,0 +1,180 @@
+package core
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteAWS struct{}
+
+var _ = Suite(&SuiteAWS{})
+
+// TestSign uses the get-vanilla request of the test suite of the Signature
+// Version 4
+func (s *SuiteAWS) TestSign(c *C) {
+	client := &awsClient{
+		region: "us-east-1",
+		credentials: AWSCredentials{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		},
+	}
+
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	c.Assert(err, IsNil)
+
+	client.sign(req, "service", nil, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	c.Assert(req.Header.Get("X-Amz-Date"), Equals, "20150830T123600Z")
+	c.Assert(req.Header.Get("Authorization"), Equals, "AWS4-HMAC-SHA256 "+
+		"Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, "+
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+	)
+}
+
+func (s *SuiteAWS) TestAWSEscape(c *C) {
+	c.Assert(awsEscape("foo-bar_baz.qux~"), Equals, "foo-bar_baz.qux~")
+	c.Assert(awsEscape("arn:aws:lambda foo"), Equals, "arn%3Aaws%3Alambda%20foo")
+}
+
+func (s *SuiteAWS) TestSignAnonymous(c *C) {
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	c.Assert(err, IsNil)
+
+	SignAWSRequest(req, AWSCredentials{}, "us-east-1", "s3", nil, time.Now())
+	c.Assert(req.Header.Get("Authorization"), Equals, "")
+}
+
+// unsetAWSCredentials hides the credentials of the environment running the
+// tests, returning a function restoring them
+func unsetAWSCredentials() func() {
+	var restore []func()
+	for _, env := range []string{
+		"AWS_ACCESS_KEY_ID",
+		"AWS_PROFILE",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+		"AWS_EC2_METADATA_SERVICE_ENDPOINT",
+	} {
+		restore = append(restore, setEnv(env, ""))
+	}
+
+	restore = append(restore,
+		setEnv("AWS_SHARED_CREDENTIALS_FILE", "/nonexistent"),
+		setEnv("AWS_EC2_METADATA_DISABLED", "true"),
+	)
+
+	return func() {
+		for _, fn := range restore {
+			fn()
+		}
+	}
+}
+
+func (s *SuiteAWS) TestCredentials(c *C) {
+	defer unsetAWSCredentials()()
+
+	config := &AWSConfig{AWSRegion: "eu-west-1"}
+	_, err := config.buildClient()
+	c.Assert(err, ErrorMatches, "no AWS credentials found.*")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Authorization"), Equals, "qux")
+		w.Write([]byte(`{"AccessKeyId":"foo","SecretAccessKey":"bar","Token":"baz"}`))
+	}))
+	defer server.Close()
+
+	defer setEnv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "qux")()
+	os.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", server.URL)
+
+	client, err := config.buildClient()
+	c.Assert(err, IsNil)
+	c.Assert(client.credentials, DeepEquals, AWSCredentials{AccessKeyID: "foo", SecretAccessKey: "bar", SessionToken: "baz"})
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "foo")
+	client, err = config.buildClient()
+	c.Assert(err, IsNil)
+	c.Assert(client.credentials.AccessKeyID, Equals, "foo")
+	c.Assert(client.url("ecs"), Equals, "https://ecs.eu-west-1.amazonaws.com")
+}
+
+func (s *SuiteAWS) TestCredentialsSharedFile(c *C) {
+	defer unsetAWSCredentials()()
+
+	filename := filepath.Join(c.MkDir(), "credentials")
+	c.Assert(ioutil.WriteFile(filename, []byte(`[default]
+aws_access_key_id = foo
+aws_secret_access_key = bar
+
+[qux]
+aws_access_key_id=baz
+aws_secret_access_key=qux
+aws_session_token=quux
+`), 0600), IsNil)
+
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", filename)
+	creds, err := LoadAWSCredentials("", "")
+	c.Assert(err, IsNil)
+	c.Assert(creds, DeepEquals, AWSCredentials{AccessKeyID: "foo", SecretAccessKey: "bar"})
+
+	defer setEnv("AWS_PROFILE", "qux")()
+	creds, err = LoadAWSCredentials("", "")
+	c.Assert(err, IsNil)
+	c.Assert(creds, DeepEquals, AWSCredentials{AccessKeyID: "baz", SecretAccessKey: "qux", SessionToken: "quux"})
+
+	// the credentials of the config take precedence
+	creds, err = LoadAWSCredentials("key", "secret")
+	c.Assert(err, IsNil)
+	c.Assert(creds, DeepEquals, AWSCredentials{AccessKeyID: "key", SecretAccessKey: "secret"})
+}
+
+func (s *SuiteAWS) TestCredentialsInstanceProfile(c *C) {
+	defer unsetAWSCredentials()()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/api/token":
+			c.Assert(r.Method, Equals, "PUT")
+			w.Write([]byte("token"))
+		case "/latest/meta-data/iam/security-credentials/":
+			c.Assert(r.Header.Get("X-Aws-Ec2-Metadata-Token"), Equals, "token")
+			w.Write([]byte("role\n"))
+		case "/latest/meta-data/iam/security-credentials/role":
+			c.Assert(r.Header.Get("X-Aws-Ec2-Metadata-Token"), Equals, "token")
+			w.Write([]byte(`{"Code":"Success","AccessKeyId":"foo","SecretAccessKey":"bar","Token":"baz"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	creds, err := LoadAWSCredentials("", "")
+	c.Assert(err, IsNil)
+	c.Assert(creds, DeepEquals, AWSCredentials{})
+
+	os.Setenv("AWS_EC2_METADATA_DISABLED", "")
+	os.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", server.URL)
+	creds, err = LoadAWSCredentials("", "")
+	c.Assert(err, IsNil)
+	c.Assert(creds, DeepEquals, AWSCredentials{AccessKeyID: "foo", SecretAccessKey: "bar", SessionToken: "baz"})
+}
+
+// setEnv sets the environment variable and returns a function restoring it
+func setEnv(name, value string) func() {
+	old, ok := os.LookupEnv(name)
+	os.Setenv(name, value)
+
+	return func() {
+		if ok {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
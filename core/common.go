@@ -3,12 +3,17 @@ package core
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	docker "github.com/fsouza/go-dockerclient"
 )
@@ -19,12 +24,97 @@ var (
 	ErrSkippedExecution = errors.New("skipped execution")
 	ErrUnexpected       = errors.New("error unexpected, docker has returned exit code -1, maybe wrong user?")
 	ErrMaxTimeRunning   = errors.New("the job has exceed the maximum allowed time running.")
+	// ErrCanceledExecution is returned by the jobs when the execution is
+	// canceled by calling `Execution.Cancel` before it finishes.
+	ErrCanceledExecution = errors.New("the execution has been canceled.")
 )
 
+// ExitCodeError is returned by the jobs when the command finishes with a
+// non-zero exit code.
+type ExitCodeError struct {
+	ExitCode int
+}
+
+func (e *ExitCodeError) Error() string {
+	return fmt.Sprintf("error non-zero exit code: %d", e.ExitCode)
+}
+
+// ContainerState is the state of the container of an execution once it
+// finished, as reported by docker.
+type ContainerState struct {
+	ExitCode  int
+	OOMKilled bool
+	Error     string
+}
+
+// Reason returns why the container finished, if docker reported it, e.g.
+// `killed by OOM`
+func (s *ContainerState) Reason() string {
+	switch {
+	case s == nil:
+		return ""
+	case s.OOMKilled:
+		return "killed by OOM"
+	default:
+		return s.Error
+	}
+}
+
+// ExitCodes is a list of exit codes, configured as a comma separated list,
+// e.g. `0,2`.
+type ExitCodes []int
+
+// Contains returns true if code is one of the exit codes
+func (c ExitCodes) Contains(code int) bool {
+	for _, v := range c {
+		if v == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Tags are the tags of a job, configured as a comma separated list, e.g.
+// `db,critical`.
+type Tags []string
+
+// HasAny returns true if any of the given tags is one of the tags
+func (t Tags) HasAny(tags ...string) bool {
+	for _, tag := range tags {
+		for _, v := range t {
+			if v == tag {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 type Job interface {
 	GetName() string
 	GetSchedule() string
 	GetCommand() string
+	GetDependsOn() []string
+	GetTrigger() string
+	GetWatchPath() string
+	GetWatchDebounce() time.Duration
+	GetWatchExisting() bool
+	GetTemplates() bool
+	GetAllowEnv() []string
+	GetAllowArgs() bool
+	GetCatchUp() time.Duration
+	GetRunOnStartup() bool
+	GetAlertAfterFailures() int
+	GetPriority() int
+	GetSuccessExitCodes() ExitCodes
+	GetWarningExitCodes() ExitCodes
+	GetMaxDurationWarning() time.Duration
+	GetTags() Tags
+	GetJitter() time.Duration
+	NextJobs(*Execution) []string
+	NextRetry(attempt int) (time.Duration, bool)
 	Middlewares() []Middleware
 	Use(...Middleware)
 	Run(*Context) error
@@ -44,6 +134,7 @@ type Context struct {
 	current     int
 	executed    bool
 	middlewares []Middleware
+	slowTimer   *time.Timer
 }
 
 func NewContext(s *Scheduler, j Job, e *Execution) *Context {
@@ -60,6 +151,28 @@ func (c *Context) Start() {
 	c.Execution.Start()
 	c.Job.AddHistory(c.Execution)
 	c.Job.NotifyStart()
+	c.watchDuration()
+}
+
+// watchDuration warns once the execution runs longer than the
+// max-duration-warning of the job, flagging it as slow while still running,
+// see checkDuration.
+func (c *Context) watchDuration() {
+	max := c.Job.GetMaxDurationWarning()
+	if max == 0 {
+		return
+	}
+
+	e, name := c.Execution, c.Job.GetName()
+	c.slowTimer = time.AfterFunc(max, func() {
+		e.update(func() { e.Slow = true })
+		c.Logger.Warningf("%s", &LogEntry{
+			Job:       name,
+			Execution: e.ID,
+			Duration:  max,
+			Message:   fmt.Sprintf("Running for longer than the max-duration-warning of %s", max),
+		})
+	})
 }
 
 func (c *Context) Next() error {
@@ -89,7 +202,74 @@ func (c *Context) doNext() error {
 	}
 
 	c.executed = true
-	return c.Job.Run(c)
+	return c.runJob()
+}
+
+// runJob runs the job, if it fails is retried as many times as the job allows.
+// The slot of the concurrent jobs is released while waiting for the retry, and
+// the wait ends if the execution is canceled.
+func (c *Context) runJob() error {
+	for attempt := 1; ; attempt++ {
+		err := c.runAttempt()
+		if err == nil || err == ErrSkippedExecution || err == ErrCanceledExecution {
+			return err
+		}
+
+		delay, ok := c.Job.NextRetry(attempt)
+		if !ok {
+			return err
+		}
+
+		c.Log(fmt.Sprintf("Failed with error %q, retrying in %s (attempt %d)", err, delay, attempt))
+		select {
+		case <-c.Execution.Done():
+			return ErrCanceledExecution
+		case <-time.After(delay):
+		}
+	}
+}
+
+// runAttempt runs the job once, holding a slot of the concurrent jobs
+func (c *Context) runAttempt() error {
+	release, err := c.Scheduler.acquireSlot(c)
+	if err != nil {
+		return err
+	}
+
+	defer release()
+	return c.mapExitCode(c.Job.Run(c))
+}
+
+// isFailure returns true if the error fails the execution, the exit codes the
+// job considers a success or a warning don't, see mapExitCode
+func (c *Context) isFailure(err error) bool {
+	e, ok := err.(*ExitCodeError)
+	if !ok {
+		return err != nil
+	}
+
+	return !c.Job.GetSuccessExitCodes().Contains(e.ExitCode) && !c.Job.GetWarningExitCodes().Contains(e.ExitCode)
+}
+
+// mapExitCode returns nil if the error is the exit code of the command and the
+// job considers it a success or a warning, the warnings are flagged in the
+// execution.
+func (c *Context) mapExitCode(err error) error {
+	e, ok := err.(*ExitCodeError)
+	if !ok {
+		return err
+	}
+
+	switch {
+	case c.Job.GetSuccessExitCodes().Contains(e.ExitCode):
+		return nil
+	case c.Job.GetWarningExitCodes().Contains(e.ExitCode):
+		c.Execution.update(func() { c.Execution.Warning = true })
+		c.Log(fmt.Sprintf("Finished with warning, exit code %d", e.ExitCode))
+		return nil
+	}
+
+	return err
 }
 
 func (c *Context) getNext() (Middleware, bool) {
@@ -107,21 +287,60 @@ func (c *Context) Stop(err error) {
 	}
 
 	c.Execution.Stop(err)
+	c.checkDuration()
 	c.Job.NotifyStop()
 }
 
+// checkDuration flags the finished execution as slow if it took longer than
+// the max-duration-warning of the job, the skipped ones never are.
+func (c *Context) checkDuration() {
+	if c.slowTimer != nil {
+		c.slowTimer.Stop()
+	}
+
+	max := c.Job.GetMaxDurationWarning()
+	e := c.Execution
+	slow := max != 0 && !e.Skipped && e.Duration > max
+	e.update(func() { e.Slow = slow })
+	if !slow {
+		return
+	}
+
+	c.Log(fmt.Sprintf("Took %s, longer than the max-duration-warning of %s", e.Duration, max))
+}
+
 func (c *Context) Log(msg string) {
-	msg = fmt.Sprintf("[Job %q (%s)] %s", c.Job.GetName(), c.Execution.ID, msg)
+	entry := &LogEntry{
+		Job:       c.Job.GetName(),
+		Execution: c.Execution.ID,
+		Duration:  c.Execution.Duration,
+		Message:   msg,
+	}
+
 	switch {
 	case c.Execution.Failed:
-		c.Logger.Errorf(msg)
-	case c.Execution.Skipped:
-		c.Logger.Warningf(msg)
+		c.Logger.Errorf("%s", entry)
+	case c.Execution.Skipped, c.Execution.Warning, c.Execution.Slow:
+		c.Logger.Warningf("%s", entry)
 	default:
-		c.Logger.Noticef(msg)
+		c.Logger.Noticef("%s", entry)
 	}
 }
 
+// LogEntry is a message logged by a Context, the loggers can use its fields
+// to write structured logs.
+type LogEntry struct {
+	Job       string
+	Execution string
+	// Duration of the execution, zero until it finishes
+	Duration time.Duration
+	Message  string
+}
+
+func (e *LogEntry) String() string {
+	return fmt.Sprintf("[Job %q (%s)] %s", e.Job, e.Execution, e.Message)
+}
+
 // Execution contains all the information relative to a Job execution.
 type Execution struct {
 	ID        string
@@ -130,39 +349,246 @@ type Execution struct {
 	IsRunning bool
 	Failed    bool
 	Skipped   bool
-	Error     error
+	// Warning is set when the command finished with one of the warning exit
+	// codes of the job, the execution isn't failed. It's only set by the exit
+	// codes, the slow executions are flagged by Slow.
+	Warning bool
+	// Slow is set once the execution runs longer than the max-duration-warning
+	// of the job, while still running, and kept if it finished after it.
+	Slow  bool
+	Error error
+	// PullDuration is the time spent pulling the image of the jobs running
+	// a container, waiting for other pulls included.
+	PullDuration time.Duration
+	// Container is the final state of the container of the jobs running one,
+	// nil for the rest of the jobs.
+	Container *ContainerState
+	// Args and Environment are the arguments and the environment variables
+	// added to the ones of the job by a manual run, see RunParams. Only the
+	// names of the variables are kept in the history and the API, see
+	// EnvNames.
+	Args        []string
+	Environment []string
 
 	OutputStream, ErrorStream io.ReadWriter `json:"-"`
+
+	redactor  *Redactor
+	followers *followers
+	lock      sync.Mutex
+	done      chan struct{}
 }
 
 // NewExecution returns a new Execution, with a random ID
 func NewExecution() *Execution {
 	return &Execution{
-		ID:           randomID(),
+		ID:           newULID(time.Now()),
 		OutputStream: bytes.NewBuffer(nil),
 		ErrorStream:  bytes.NewBuffer(nil),
 	}
 }
 
+// Output returns what the job wrote to the output stream. If the stream is a
+// *bytes.Buffer, as it's by default, or an *OutputBuffer, the content is not
+// consumed so it can be read more than once. The secrets are masked if the
+// scheduler has a Redaction.
+func (e *Execution) Output() []byte {
+	return e.redactor.Redact(readStream(e.OutputStream))
+}
+
+// ErrorOutput returns what the job wrote to the error stream, same as Output.
+func (e *Execution) ErrorOutput() []byte {
+	return e.redactor.Redact(readStream(e.ErrorStream))
+}
+
+// Redact returns the content with the secrets of the execution masked, as the
+// outputs, see Redaction.
+func (e *Execution) Redact(b []byte) []byte {
+	return e.redactor.Redact(b)
+}
+
+// TailOutput returns the last n bytes of the output, preceded by "..." if
+// truncated, without splitting a UTF-8 character. It's shared by the
+// middlewares, the history and the web UI showing the outputs.
+func TailOutput(output []byte, n int) string {
+	if len(output) <= n {
+		return string(output)
+	}
+
+	output = output[len(output)-n:]
+	for i := 0; i < len(output) && i < utf8.UTFMax; i++ {
+		if utf8.RuneStart(output[i]) {
+			output = output[i:]
+			break
+		}
+	}
+
+	return "..." + string(output)
+}
+
+// removeOutputFiles deletes the files with the full output of the streams
+// exceeding MaxOutputSize, see OutputBuffer.
+func (e *Execution) removeOutputFiles() {
+	for _, s := range []io.ReadWriter{e.OutputStream, e.ErrorStream} {
+		if f, ok := s.(*followStream); ok {
+			s = f.ReadWriter
+		}
+
+		if b, ok := s.(*OutputBuffer); ok {
+			b.Remove()
+		}
+	}
+}
+
+// addSecret masks the given value in the outputs and the errors of the
+// execution, e.g. the value of a secret read for the execution
+func (e *Execution) addSecret(value string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.redactor = e.redactor.with(value)
+}
+
+func readStream(s io.ReadWriter) []byte {
+	switch b := s.(type) {
+	case *bytes.Buffer:
+		return b.Bytes()
+	case *OutputBuffer:
+		return b.Bytes()
+	case *followStream:
+		return b.bytes()
+	}
+
+	if s == nil {
+		return nil
+	}
+
+	content, _ := ioutil.ReadAll(s)
+	return content
+}
+
+// Cancel requests the execution to stop as soon as possible, the jobs
+// supporting it return ErrCanceledExecution. Calling Cancel more than once has
+// no effect.
+func (e *Execution) Cancel() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.done == nil {
+		e.done = make(chan struct{})
+	}
+
+	select {
+	case <-e.done:
+	default:
+		close(e.done)
+	}
+}
+
+// Done returns a channel that is closed when the execution is canceled.
+func (e *Execution) Done() <-chan struct{} {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.done == nil {
+		e.done = make(chan struct{})
+	}
+
+	return e.done
+}
+
+// IsCanceled returns true if Cancel was called.
+func (e *Execution) IsCanceled() bool {
+	select {
+	case <-e.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// Snapshot returns a copy of the state of the execution, safe to read while
+// the execution is running, e.g. by the HTTP API. The streams are shared.
+func (e *Execution) Snapshot() *Execution {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return &Execution{
+		ID:           e.ID,
+		Date:         e.Date,
+		Duration:     e.Duration,
+		IsRunning:    e.IsRunning,
+		Failed:       e.Failed,
+		Skipped:      e.Skipped,
+		Warning:      e.Warning,
+		Slow:         e.Slow,
+		Error:        e.Error,
+		PullDuration: e.PullDuration,
+		Container:    e.Container,
+		Args:         e.Args,
+		Environment:  e.Environment,
+		OutputStream: e.OutputStream,
+		ErrorStream:  e.ErrorStream,
+		redactor:     e.redactor,
+	}
+}
+
+// update runs fn changing the state of the execution, so Snapshot doesn't
+// read it meanwhile
+func (e *Execution) update(fn func()) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	fn()
+}
+
 // Start start the exection, initialize the running flags and the start date.
 func (e *Execution) Start() {
-	e.IsRunning = true
-	e.Date = time.Now()
+	e.update(func() {
+		e.IsRunning = true
+		e.Date = time.Now()
+	})
 }
 
 // Stop stops the executions, if a ErrSkippedExecution is given the exection
 // is mark as skipped, if any other error is given the exection is mark as
-// failed. Also mark the exection as IsRunning false and save the duration time
+// failed. Also mark the exection as IsRunning false and save the duration time,
+// and closes the streams.
 func (e *Execution) Stop(err error) {
-	e.IsRunning = false
-	e.Duration = time.Since(e.Date)
+	for _, s := range []io.ReadWriter{e.OutputStream, e.ErrorStream} {
+		if c, ok := s.(io.Closer); ok {
+			c.Close()
+		}
+	}
 
 	if err != nil && err != ErrSkippedExecution {
-		e.Error = err
-		e.Failed = true
-	} else if err == ErrSkippedExecution {
-		e.Skipped = true
+		err = e.redactError(err)
+	}
+
+	e.update(func() {
+		e.IsRunning = false
+		e.Duration = time.Since(e.Date)
+
+		if err != nil && err != ErrSkippedExecution {
+			e.Error = err
+			e.Failed = true
+		} else if err == ErrSkippedExecution {
+			e.Skipped = true
+		}
+	})
+
+	// the followers get the final state of the execution
+	if e.followers != nil {
+		e.followers.close()
+	}
+}
+
+// redactError returns the error with the secrets of its message masked, the
+// error is kept as is if it doesn't contain any
+func (e *Execution) redactError(err error) error {
+	msg := err.Error()
+	if redacted := string(e.redactor.Redact([]byte(msg))); redacted != msg {
+		return errors.New(redacted)
 	}
+
+	return err
 }
 
 // Middleware can wrap any job execution, allowing to execution code before
@@ -202,6 +628,27 @@ func (c *middlewareContainer) Use(ms ...Middleware) {
 	}
 }
 
+// Disable prevents the middlewares of the same type as the given ones from
+// being used, e.g. the middlewares of the scheduler, removing them if they
+// were already in use.
+func (c *middlewareContainer) Disable(ms ...Middleware) {
+	if c.m == nil {
+		c.m = make(map[string]Middleware, 0)
+	}
+
+	for _, m := range ms {
+		t := reflect.TypeOf(m).String()
+		for i, o := range c.order {
+			if o == t {
+				c.order = append(c.order[:i], c.order[i+1:]...)
+				break
+			}
+		}
+
+		c.m[t] = nil
+	}
+}
+
 func (c *middlewareContainer) Middlewares() []Middleware {
 	var ms []Middleware
 	for _, t := range c.order {
@@ -219,13 +666,29 @@ type Logger interface {
 	Warningf(format string, args ...interface{})
 }
 
-func randomID() string {
-	b := make([]byte, 6)
-	if _, err := rand.Read(b); err != nil {
+// crockford is the base32 alphabet of the ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID, a random ID sortable by its time: 48 bits with the
+// milliseconds since the epoch followed by 80 random bits, encoded in 26
+// characters.
+func newULID(t time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(t.UnixNano()/int64(time.Millisecond))<<16)
+	if _, err := rand.Read(b[6:]); err != nil {
 		panic(err)
 	}
 
-	return fmt.Sprintf("%x", b)
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+
+	var id [26]byte
+	for i := len(id) - 1; i >= 0; i-- {
+		id[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(id[:])
 }
 
 func buildPullOptions(image string) (docker.PullImageOptions, docker.AuthConfiguration) {
@@ -250,12 +713,45 @@ func buildPullOptions(image string) (docker.PullImageOptions, docker.AuthConfigu
 	}, buildAuthConfiguration(registry)
 }
 
+// buildAuthConfiguration returns the credentials for the given registry from
+// the docker config file, the file is read on every call, so changes are
+// applied without restarting the process.
 func buildAuthConfiguration(registry string) docker.AuthConfiguration {
 	var auth docker.AuthConfiguration
-	if dockercfg == nil {
+	dockercfg, err := docker.NewAuthConfigurationsFromDockerCfg()
+	if err != nil {
 		return auth
 	}
 
 	auth, _ = dockercfg.Configs[registry]
 	return auth
 }
+
+func buildAuthConfigurationFromFile(filename, registry string) (docker.AuthConfiguration, error) {
+	var auth docker.AuthConfiguration
+	cfg, err := docker.NewAuthConfigurationsFromFile(filename)
+	if err != nil {
+		return auth, fmt.Errorf("error reading auth file %q: %s", filename, err)
+	}
+
+	auth, _ = cfg.Configs[registry]
+	return auth, nil
+}
+
+// openInput returns the input of a job, the given string or the content of
+// the given file, or nil if both are empty
+func openInput(input, file string) (io.ReadCloser, error) {
+	switch {
+	case input != "":
+		return ioutil.NopCloser(strings.NewReader(input)), nil
+	case file != "":
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading input file: %s", err)
+		}
+
+		return f, nil
+	default:
+		return nil, nil
+	}
+}
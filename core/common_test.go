@@ -3,6 +3,7 @@ package core
 import (
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -29,6 +30,12 @@ func (s *SuiteCommon) TestNewContext(c *C) {
 	c.Assert(ctx.middlewares, HasLen, 1)
 }
 
+func (s *SuiteCommon) TestTailOutput(c *C) {
+	c.Assert(TailOutput([]byte("foo"), 10), Equals, "foo")
+	c.Assert(TailOutput([]byte("foobar"), 3), Equals, "...bar")
+	c.Assert(TailOutput([]byte("fooñbar"), 4), Equals, "...bar")
+}
+
 func (s *SuiteCommon) TestContextNextError(c *C) {
 	mA := &TestMiddlewareAltA{}
 	mB := &TestMiddlewareAltB{}
@@ -49,24 +56,24 @@ func (s *SuiteCommon) TestContextNextError(c *C) {
 	c.Assert(mA.Called, Equals, 1)
 	c.Assert(mB.Called, Equals, 0)
 	c.Assert(mC.Called, Equals, 0)
-	c.Assert(j.Called, Equals, 0)
+	c.Assert(j.Called(), Equals, 0)
 	c.Assert(ctx.Execution.IsRunning, Equals, true)
 
 	err = ctx.Next()
 	c.Assert(err, IsNil)
 	c.Assert(mB.Called, Equals, 1)
 	c.Assert(mC.Called, Equals, 0)
-	c.Assert(j.Called, Equals, 0)
+	c.Assert(j.Called(), Equals, 0)
 	c.Assert(ctx.Execution.IsRunning, Equals, false)
 
 	err = ctx.Next()
 	c.Assert(err, IsNil)
 	c.Assert(mC.Called, Equals, 0)
-	c.Assert(j.Called, Equals, 0)
+	c.Assert(j.Called(), Equals, 0)
 
 	err = ctx.Next()
 	c.Assert(err, IsNil)
-	c.Assert(j.Called, Equals, 0)
+	c.Assert(j.Called(), Equals, 0)
 }
 
 func (s *SuiteCommon) TestContextNextNested(c *C) {
@@ -89,7 +96,7 @@ func (s *SuiteCommon) TestContextNextNested(c *C) {
 	c.Assert(mA.Called, Equals, 1)
 	c.Assert(mB.Called, Equals, 1)
 	c.Assert(mC.Called, Equals, 1)
-	c.Assert(j.Called, Equals, 1)
+	c.Assert(j.Called(), Equals, 1)
 }
 
 func (s *SuiteCommon) TestContextNextNestedError(c *C) {
@@ -113,7 +120,7 @@ func (s *SuiteCommon) TestContextNextNestedError(c *C) {
 	c.Assert(mA.Called, Equals, 1)
 	c.Assert(mB.Called, Equals, 0)
 	c.Assert(mC.Called, Equals, 0)
-	c.Assert(j.Called, Equals, 0)
+	c.Assert(j.Called(), Equals, 0)
 }
 
 func (s *SuiteCommon) TestContextNextContinueOnStop(c *C) {
@@ -138,7 +145,7 @@ func (s *SuiteCommon) TestContextNextContinueOnStop(c *C) {
 	c.Assert(mA.Called, Equals, 1)
 	c.Assert(mB.Called, Equals, 0)
 	c.Assert(mC.Called, Equals, 1)
-	c.Assert(j.Called, Equals, 0)
+	c.Assert(j.Called(), Equals, 0)
 }
 
 func (s *SuiteCommon) TestContextNext(c *C) {
@@ -160,28 +167,199 @@ func (s *SuiteCommon) TestContextNext(c *C) {
 	c.Assert(mA.Called, Equals, 1)
 	c.Assert(mB.Called, Equals, 0)
 	c.Assert(mC.Called, Equals, 0)
-	c.Assert(j.Called, Equals, 0)
+	c.Assert(j.Called(), Equals, 0)
 	c.Assert(ctx.Execution.IsRunning, Equals, true)
 
 	err = ctx.Next()
 	c.Assert(err, IsNil)
 	c.Assert(mB.Called, Equals, 1)
 	c.Assert(mC.Called, Equals, 0)
-	c.Assert(j.Called, Equals, 0)
+	c.Assert(j.Called(), Equals, 0)
 	c.Assert(ctx.Execution.IsRunning, Equals, true)
 
 	err = ctx.Next()
 	c.Assert(err, IsNil)
 	c.Assert(mC.Called, Equals, 1)
-	c.Assert(j.Called, Equals, 0)
+	c.Assert(j.Called(), Equals, 0)
 
 	err = ctx.Next()
 	c.Assert(err, IsNil)
-	c.Assert(j.Called, Equals, 1)
+	c.Assert(j.Called(), Equals, 1)
+
+	err = ctx.Next()
+	c.Assert(err, IsNil)
+	c.Assert(j.Called(), Equals, 1)
+}
+
+func (s *SuiteCommon) TestContextNextRetries(c *C) {
+	j := &TestFailingJob{Fails: 2}
+	j.Retries = 3
+	j.RetryDelay = time.Millisecond
+
+	h := NewScheduler(&TestLogger{})
+	ctx := NewContext(h, j, NewExecution())
+	ctx.Start()
+
+	err := ctx.Next()
+	c.Assert(err, IsNil)
+	c.Assert(j.Called, Equals, 3)
+	c.Assert(ctx.Execution.Failed, Equals, false)
+
+	j = &TestFailingJob{Fails: 5}
+	j.Retries = 3
+
+	ctx = NewContext(h, j, NewExecution())
+	ctx.Start()
 
 	err = ctx.Next()
 	c.Assert(err, IsNil)
+	c.Assert(j.Called, Equals, 4)
+	c.Assert(ctx.Execution.Failed, Equals, true)
+}
+
+func (s *SuiteCommon) TestContextNextRetryCanceled(c *C) {
+	j := &TestFailingJob{Fails: 5}
+	j.Retries = 3
+	j.RetryDelay = time.Hour
+
+	h := NewScheduler(&TestLogger{})
+	h.MaxConcurrentJobs = 1
+	ctx := NewContext(h, j, NewExecution())
+	ctx.Start()
+
+	done := make(chan struct{})
+	go func() {
+		ctx.Next()
+		close(done)
+	}()
+
+	// the slot is free while waiting for the retry
+	time.Sleep(time.Millisecond * 50)
+	other := NewContext(h, &TestJob{}, NewExecution())
+	release, err := h.acquireSlot(other)
+	c.Assert(err, IsNil)
+	release()
+
+	ctx.Execution.Cancel()
+	<-done
 	c.Assert(j.Called, Equals, 1)
+	c.Assert(ctx.Execution.Error, Equals, ErrCanceledExecution)
+}
+
+func (s *SuiteCommon) TestContextNextExitCodes(c *C) {
+	h := NewScheduler(&TestLogger{})
+	run := func(code int) (*Execution, int) {
+		j := &TestExitCodeJob{ExitCode: code}
+		j.SuccessExitCodes = ExitCodes{0, 2}
+		j.WarningExitCodes = ExitCodes{24}
+		j.Retries = 3
+
+		ctx := NewContext(h, j, NewExecution())
+		ctx.Start()
+		c.Assert(ctx.Next(), IsNil)
+
+		return ctx.Execution, j.Called
+	}
+
+	e, called := run(2)
+	c.Assert(e.Failed, Equals, false)
+	c.Assert(e.Warning, Equals, false)
+	c.Assert(called, Equals, 1)
+
+	e, called = run(24)
+	c.Assert(e.Failed, Equals, false)
+	c.Assert(e.Warning, Equals, true)
+	c.Assert(called, Equals, 1)
+
+	e, called = run(1)
+	c.Assert(e.Failed, Equals, true)
+	c.Assert(e.Warning, Equals, false)
+	c.Assert(e.Error, DeepEquals, &ExitCodeError{ExitCode: 1})
+	c.Assert(called, Equals, 4)
+}
+
+func (s *SuiteCommon) TestContextStopMaxDurationWarning(c *C) {
+	h := NewScheduler(&TestLogger{})
+	run := func(err error, sleep time.Duration) *Execution {
+		j := &TestJob{}
+		j.MaxDurationWarning = time.Millisecond * 50
+
+		ctx := NewContext(h, j, NewExecution())
+		ctx.Start()
+		time.Sleep(sleep)
+		ctx.Stop(err)
+
+		return ctx.Execution
+	}
+
+	e := run(nil, 0)
+	c.Assert(e.Slow, Equals, false)
+	c.Assert(e.Warning, Equals, false)
+
+	e = run(nil, time.Millisecond*100)
+	c.Assert(e.Slow, Equals, true)
+	c.Assert(e.Warning, Equals, false)
+
+	e = run(errors.New("foo"), time.Millisecond*100)
+	c.Assert(e.Slow, Equals, true)
+	c.Assert(e.Failed, Equals, true)
+	c.Assert(e.Warning, Equals, false)
+
+	e = run(ErrSkippedExecution, time.Millisecond*100)
+	c.Assert(e.Slow, Equals, false)
+}
+
+func (s *SuiteCommon) TestContextStartMaxDurationWarning(c *C) {
+	j := &TestJob{}
+	j.MaxDurationWarning = time.Millisecond * 50
+
+	ctx := NewContext(NewScheduler(&TestLogger{}), j, NewExecution())
+	ctx.Start()
+	c.Assert(ctx.Execution.Snapshot().Slow, Equals, false)
+
+	// flagged while still running
+	time.Sleep(time.Millisecond * 100)
+	c.Assert(ctx.Execution.Snapshot().Slow, Equals, true)
+	c.Assert(ctx.Execution.Snapshot().IsRunning, Equals, true)
+
+	ctx.Stop(nil)
+	c.Assert(ctx.Execution.Slow, Equals, true)
+}
+
+func (s *SuiteCommon) TestNewULID(c *C) {
+	c.Assert(newULID(time.Unix(0, 0)), Matches, "0000000000[0-9A-HJKMNP-TV-Z]{16}")
+
+	t := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	id := newULID(t)
+	c.Assert(id, HasLen, 26)
+	c.Assert(id[:10], Equals, "01DXJ3BK48")
+	c.Assert(newULID(t) < newULID(t.Add(time.Millisecond)), Equals, true)
+	c.Assert(newULID(t), Not(Equals), id)
+}
+
+func (s *SuiteCommon) TestExecutionOutput(c *C) {
+	exe := NewExecution()
+	exe.OutputStream.Write([]byte("foo"))
+	exe.ErrorStream.Write([]byte("bar"))
+
+	c.Assert(string(exe.Output()), Equals, "foo")
+	c.Assert(string(exe.Output()), Equals, "foo")
+	c.Assert(string(exe.ErrorOutput()), Equals, "bar")
+}
+
+func (s *SuiteCommon) TestExecutionCancel(c *C) {
+	exe := NewExecution()
+	c.Assert(exe.IsCanceled(), Equals, false)
+
+	exe.Cancel()
+	exe.Cancel()
+	c.Assert(exe.IsCanceled(), Equals, true)
+
+	select {
+	case <-exe.Done():
+	default:
+		c.Fatal("done channel should be closed")
+	}
 }
 
 func (s *SuiteCommon) TestExecutionStart(c *C) {
@@ -230,6 +408,14 @@ func (s *SuiteCommon) TestExecutionStopErrorSkip(c *C) {
 	c.Assert(exe.Duration.Seconds() > .0, Equals, true)
 }
 
+func (s *SuiteCommon) TestTagsHasAny(c *C) {
+	tags := Tags{"db", "critical"}
+	c.Assert(tags.HasAny("critical"), Equals, true)
+	c.Assert(tags.HasAny("web", "db"), Equals, true)
+	c.Assert(tags.HasAny("web"), Equals, false)
+	c.Assert(Tags(nil).HasAny("db"), Equals, false)
+}
+
 func (s *SuiteCommon) TestMiddlewareContainerUseTwice(c *C) {
 	mA := &TestMiddleware{}
 	mB := &TestMiddleware{}
@@ -243,6 +429,18 @@ func (s *SuiteCommon) TestMiddlewareContainerUseTwice(c *C) {
 	c.Assert(ms[0], Equals, mA)
 }
 
+func (s *SuiteCommon) TestMiddlewareContainerDisable(c *C) {
+	mA := &TestMiddleware{}
+	mB := &TestMiddlewareAltA{}
+
+	container := &middlewareContainer{}
+	container.Use(mA)
+	container.Disable(&TestMiddleware{}, &TestMiddlewareAltA{})
+	container.Use(mA, mB)
+
+	c.Assert(container.Middlewares(), HasLen, 0)
+}
+
 func (s *SuiteCommon) TestMiddlewareContainerUseNil(c *C) {
 	var m Middleware
 
@@ -299,16 +497,47 @@ type TestMiddlewareAltC struct{ TestMiddleware }
 
 type TestJob struct {
 	BareJob
-	Called int
+	called int32
 }
 
 func (j *TestJob) Run(ctx *Context) error {
-	j.Called++
+	atomic.AddInt32(&j.called, 1)
 	time.Sleep(time.Millisecond * 500)
 
 	return nil
 }
 
+// Called returns the times the job ran, it's safe to call while running
+func (j *TestJob) Called() int {
+	return int(atomic.LoadInt32(&j.called))
+}
+
+type TestFailingJob struct {
+	BareJob
+	Called int
+	Fails  int
+}
+
+func (j *TestFailingJob) Run(ctx *Context) error {
+	j.Called++
+	if j.Called <= j.Fails {
+		return errors.New("foo")
+	}
+
+	return nil
+}
+
+type TestExitCodeJob struct {
+	BareJob
+	Called   int
+	ExitCode int
+}
+
+func (j *TestExitCodeJob) Run(ctx *Context) error {
+	j.Called++
+	return &ExitCodeError{ExitCode: j.ExitCode}
+}
+
 type TestLogger struct{}
 
 func (*TestLogger) Criticalf(format string, args ...interface{}) {}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/gobs/args"
+)
+
+// ComposeJob runs a service of a compose project once, executing `docker
+// compose run --rm` on the host running ofelia.
+type ComposeJob struct {
+	BareJob `mapstructure:",squash"`
+	// File are the compose files of the project, by default the compose file
+	// of the working directory, and Project the name of the project.
+	File    []string
+	Project string
+	Service string
+	// Environment are set in the container of the service, as `NAME=value`
+	Environment []string
+	// EnvSecret are added to the environment as `NAME=secret`, read on every
+	// execution from a file of /run/secrets or from Vault, see Secrets.
+	EnvSecret []string `mapstructure:"env-secret"`
+	// ComposeCommand is the command running compose, `docker compose` by
+	// default, e.g. `docker-compose` for the standalone version.
+	ComposeCommand string `mapstructure:"compose-command"`
+}
+
+func NewComposeJob() *ComposeJob {
+	return &ComposeJob{}
+}
+
+// GetEnvironment returns the environment of the job
+func (j *ComposeJob) GetEnvironment() []string {
+	return j.Environment
+}
+
+// GetCommand returns the compose command run by the job
+func (j *ComposeJob) GetCommand() string {
+	return strings.Join(j.buildArgs(j.Command, j.Environment), " ")
+}
+
+func (j *ComposeJob) Run(ctx *Context) error {
+	command, err := ctx.RenderCommand(j.Command)
+	if err != nil {
+		return err
+	}
+
+	env, err := buildEnvironment(ctx, j.Environment, j.EnvSecret, true)
+	if err != nil {
+		return err
+	}
+
+	args := j.buildArgs(command, env)
+	bin, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+
+	return runCommand(ctx, &exec.Cmd{
+		Path:   bin,
+		Args:   args,
+		Stdout: ctx.Execution.OutputStream,
+		Stderr: ctx.Execution.ErrorStream,
+	})
+}
+
+func (j *ComposeJob) buildArgs(command string, env []string) []string {
+	compose := j.ComposeCommand
+	if compose == "" {
+		compose = "docker compose"
+	}
+
+	cmd := args.GetArgs(compose)
+	for _, f := range j.File {
+		cmd = append(cmd, "-f", f)
+	}
+
+	if j.Project != "" {
+		cmd = append(cmd, "-p", j.Project)
+	}
+
+	cmd = append(cmd, "run", "--rm", "-T")
+	for _, e := range env {
+		cmd = append(cmd, "-e", e)
+	}
+
+	cmd = append(cmd, j.Service)
+	return append(cmd, args.GetArgs(command)...)
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteComposeJob struct {
+	dir string
+}
+
+var _ = Suite(&SuiteComposeJob{})
+
+func (s *SuiteComposeJob) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+
+	// fake compose printing its arguments
+	script := "#!/bin/sh\necho \"$@\"\n[ \"$FAIL\" = \"\" ] || exit 3\n"
+	err := ioutil.WriteFile(filepath.Join(s.dir, "compose"), []byte(script), 0755)
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteComposeJob) TestRun(c *C) {
+	job := &ComposeJob{}
+	job.ComposeCommand = filepath.Join(s.dir, "compose") + " --ansi never"
+	job.File = []string{"/srv/app/compose.yml", "/srv/app/compose.prod.yml"}
+	job.Project = "app"
+	job.Service = "cron"
+	job.Environment = []string{"FOO=foo"}
+	job.Command = `php artisan "schedule:run"`
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e})
+	c.Assert(err, IsNil)
+	c.Assert(string(e.Output()), Equals, "--ansi never -f /srv/app/compose.yml -f /srv/app/compose.prod.yml -p app run --rm -T -e OFELIA_EXECUTION_ID="+e.ID+" -e FOO=foo cron php artisan schedule:run\n")
+}
+
+func (s *SuiteComposeJob) TestRunExitCode(c *C) {
+	os.Setenv("FAIL", "1")
+	defer os.Unsetenv("FAIL")
+
+	job := &ComposeJob{ComposeCommand: filepath.Join(s.dir, "compose")}
+	job.Service = "cron"
+
+	err := job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, DeepEquals, &ExitCodeError{ExitCode: 3})
+}
+
+func (s *SuiteComposeJob) TestGetCommand(c *C) {
+	job := &ComposeJob{}
+	job.Service = "cron"
+	job.Command = "true"
+
+	c.Assert(job.GetCommand(), Equals, "docker compose run --rm -T cron true")
+}
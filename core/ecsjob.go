@@ -0,0 +1,319 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gobs/args"
+)
+
+const (
+	ecsPollInterval = time.Second
+	ecsTarget       = "AmazonEC2ContainerServiceV20141113"
+	logsTarget      = "Logs_20140328"
+)
+
+// ECSJob runs a task definition on an ECS cluster, on Fargate or EC2, and
+// waits for the task to stop. The command and environment of the container
+// are overridden, its exit code is the one of the execution and its logs, if
+// it uses the awslogs driver, are read from CloudWatch Logs once it stops.
+type ECSJob struct {
+	BareJob   `mapstructure:",squash"`
+	AWSConfig `mapstructure:",squash"`
+	Cluster   string
+	// TaskDefinition is the family, the `family:revision` or the ARN of the
+	// task definition of the task.
+	TaskDefinition string `mapstructure:"task-definition"`
+	// Container is the container of the task definition whose command and
+	// environment are overridden, by default the first one.
+	Container string
+	// LaunchType is `FARGATE` or `EC2`, by default the capacity provider
+	// strategy of the cluster is used.
+	LaunchType string `mapstructure:"launch-type"`
+	// Subnets, SecurityGroups and AssignPublicIP are the network
+	// configuration of the tasks using the `awsvpc` network mode, required by
+	// Fargate.
+	Subnets        []string
+	SecurityGroups []string `mapstructure:"security-groups"`
+	AssignPublicIP bool     `mapstructure:"assign-public-ip"`
+	Environment    []string
+	// EnvSecret are added to the environment as `NAME=secret`, read on every
+	// execution from a file of /run/secrets or from Vault, see Secrets.
+	EnvSecret []string `mapstructure:"env-secret"`
+	// MaxRuntime is the maximum time the task is allowed to run, after that
+	// it's stopped and the execution fails with ErrMaxTimeRunning.
+	MaxRuntime time.Duration `mapstructure:"max-runtime"`
+}
+
+func NewECSJob() *ECSJob {
+	return &ECSJob{}
+}
+
+// GetEnvironment returns the environment of the job
+func (j *ECSJob) GetEnvironment() []string {
+	return j.Environment
+}
+
+func (j *ECSJob) Run(ctx *Context) error {
+	c, err := j.buildClient()
+	if err != nil {
+		return err
+	}
+
+	var def ecsTaskDefinitionOutput
+	if err := c.call("ecs", ecsTarget, "DescribeTaskDefinition", map[string]string{"taskDefinition": j.TaskDefinition}, &def); err != nil {
+		return fmt.Errorf("error describing task definition %q: %s", j.TaskDefinition, err)
+	}
+
+	container, err := j.findContainer(def.TaskDefinition.ContainerDefinitions)
+	if err != nil {
+		return err
+	}
+
+	input, err := j.buildRunTask(ctx, container.Name)
+	if err != nil {
+		return err
+	}
+
+	var run struct {
+		Tasks    []ecsTask `json:"tasks"`
+		Failures []struct {
+			Arn    string `json:"arn"`
+			Reason string `json:"reason"`
+		} `json:"failures"`
+	}
+
+	if err := c.call("ecs", ecsTarget, "RunTask", input, &run); err != nil {
+		return fmt.Errorf("error running ecs task: %s", err)
+	}
+
+	if len(run.Tasks) == 0 {
+		if len(run.Failures) != 0 {
+			return fmt.Errorf("error running ecs task: %s", run.Failures[0].Reason)
+		}
+
+		return fmt.Errorf("error running ecs task: no task started")
+	}
+
+	arn := run.Tasks[0].TaskArn
+	ctx.Logger.Noticef("Started ecs task %s", arn)
+
+	task, err := j.watchTask(ctx.Execution, c, arn)
+	if err == ErrMaxTimeRunning || err == ErrCanceledExecution {
+		input := map[string]string{"cluster": j.Cluster, "task": arn, "reason": "Stopped by Ofelia: " + err.Error()}
+		if serr := c.call("ecs", ecsTarget, "StopTask", input, nil); serr != nil {
+			ctx.Logger.Warningf("Error stopping ecs task %s: %s", arn, serr)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := j.fetchLogs(ctx.Execution, c, container, arn); err != nil {
+		ctx.Logger.Warningf("Error fetching logs of ecs task %s: %s", arn, err)
+	}
+
+	for _, ct := range task.Containers {
+		if ct.Name != container.Name {
+			continue
+		}
+
+		switch {
+		case ct.ExitCode == nil:
+			return fmt.Errorf("ecs task %s stopped: %s", arn, task.reason(ct.Reason))
+		case *ct.ExitCode != 0:
+			return &ExitCodeError{ExitCode: *ct.ExitCode}
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("ecs task %s stopped: %s", arn, task.reason(""))
+}
+
+// findContainer returns the container of the task definition overridden by
+// the job
+func (j *ECSJob) findContainer(containers []ecsContainerDefinition) (ecsContainerDefinition, error) {
+	for _, c := range containers {
+		if j.Container == "" || c.Name == j.Container {
+			return c, nil
+		}
+	}
+
+	return ecsContainerDefinition{}, fmt.Errorf("container %q not found in task definition %q", j.Container, j.TaskDefinition)
+}
+
+func (j *ECSJob) buildRunTask(ctx *Context, container string) (map[string]interface{}, error) {
+	command, err := ctx.RenderCommand(j.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	environment, err := buildEnvironment(ctx, j.Environment, j.EnvSecret, true)
+	if err != nil {
+		return nil, err
+	}
+
+	env := []map[string]string{}
+	for _, v := range environment {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) == 1 {
+			parts = append(parts, "")
+		}
+
+		env = append(env, map[string]string{"name": parts[0], "value": parts[1]})
+	}
+
+	override := map[string]interface{}{"name": container, "environment": env}
+	if command != "" {
+		override["command"] = args.GetArgs(command)
+	}
+
+	input := map[string]interface{}{
+		"cluster":        j.Cluster,
+		"taskDefinition": j.TaskDefinition,
+		"count":          1,
+		"startedBy":      "ofelia",
+		"overrides": map[string]interface{}{
+			"containerOverrides": []interface{}{override},
+		},
+	}
+
+	if j.LaunchType != "" {
+		input["launchType"] = j.LaunchType
+	}
+
+	if len(j.Subnets) != 0 {
+		assignPublicIP := "DISABLED"
+		if j.AssignPublicIP {
+			assignPublicIP = "ENABLED"
+		}
+
+		input["networkConfiguration"] = map[string]interface{}{
+			"awsvpcConfiguration": map[string]interface{}{
+				"subnets":        j.Subnets,
+				"securityGroups": j.SecurityGroups,
+				"assignPublicIp": assignPublicIP,
+			},
+		}
+	}
+
+	return input, nil
+}
+
+// watchTask polls the task until it stops
+func (j *ECSJob) watchTask(e *Execution, c *awsClient, arn string) (*ecsTask, error) {
+	maxRuntime := j.MaxRuntime
+	if maxRuntime == 0 {
+		maxRuntime = maxProcessDuration
+	}
+
+	timeout := time.After(maxRuntime)
+	for {
+		var tasks struct {
+			Tasks []ecsTask `json:"tasks"`
+		}
+
+		input := map[string]interface{}{"cluster": j.Cluster, "tasks": []string{arn}}
+		if err := c.call("ecs", ecsTarget, "DescribeTasks", input, &tasks); err != nil {
+			return nil, fmt.Errorf("error describing ecs task: %s", err)
+		}
+
+		if len(tasks.Tasks) == 0 {
+			return nil, fmt.Errorf("ecs task %s not found", arn)
+		}
+
+		if tasks.Tasks[0].LastStatus == "STOPPED" {
+			return &tasks.Tasks[0], nil
+		}
+
+		select {
+		case <-e.Done():
+			return nil, ErrCanceledExecution
+		case <-timeout:
+			return nil, ErrMaxTimeRunning
+		case <-time.After(ecsPollInterval):
+		}
+	}
+}
+
+// fetchLogs writes the logs of the container to the output of the execution,
+// if it uses the awslogs driver
+func (j *ECSJob) fetchLogs(e *Execution, c *awsClient, container ecsContainerDefinition, arn string) error {
+	logs := container.LogConfiguration
+	group, prefix := logs.Options["awslogs-group"], logs.Options["awslogs-stream-prefix"]
+	if logs.LogDriver != "awslogs" || group == "" || prefix == "" {
+		return nil
+	}
+
+	input := map[string]interface{}{
+		"logGroupName":  group,
+		"logStreamName": prefix + "/" + container.Name + "/" + arn[strings.LastIndex(arn, "/")+1:],
+		"startFromHead": true,
+	}
+
+	for {
+		var events struct {
+			Events []struct {
+				Message string `json:"message"`
+			} `json:"events"`
+			NextForwardToken string `json:"nextForwardToken"`
+		}
+
+		if err := c.call("logs", logsTarget, "GetLogEvents", input, &events); err != nil {
+			return err
+		}
+
+		for _, event := range events.Events {
+			fmt.Fprintln(e.OutputStream, event.Message)
+		}
+
+		// the same token is returned at the end of the stream
+		if len(events.Events) == 0 || events.NextForwardToken == input["nextToken"] {
+			return nil
+		}
+
+		input["nextToken"] = events.NextForwardToken
+	}
+}
+
+type ecsTaskDefinitionOutput struct {
+	TaskDefinition struct {
+		ContainerDefinitions []ecsContainerDefinition `json:"containerDefinitions"`
+	} `json:"taskDefinition"`
+}
+
+type ecsContainerDefinition struct {
+	Name             string `json:"name"`
+	LogConfiguration struct {
+		LogDriver string            `json:"logDriver"`
+		Options   map[string]string `json:"options"`
+	} `json:"logConfiguration"`
+}
+
+// ecsTask contains the fields used of the tasks
+type ecsTask struct {
+	TaskArn       string `json:"taskArn"`
+	LastStatus    string `json:"lastStatus"`
+	StopCode      string `json:"stopCode"`
+	StoppedReason string `json:"stoppedReason"`
+	Containers    []struct {
+		Name     string `json:"name"`
+		ExitCode *int   `json:"exitCode"`
+		Reason   string `json:"reason"`
+	} `json:"containers"`
+}
+
+// reason returns the reason the task stopped, the one of the container if any
+func (t *ecsTask) reason(container string) string {
+	switch {
+	case container != "":
+		return container
+	case t.StoppedReason != "":
+		return t.StoppedReason
+	default:
+		return t.StopCode
+	}
+}
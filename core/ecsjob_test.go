@@ -0,0 +1,173 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteECSJob struct {
+	server  *httptest.Server
+	run     map[string]interface{}
+	status  string
+	code    string
+	polls   int
+	stopped bool
+	tokens  []interface{}
+}
+
+var _ = Suite(&SuiteECSJob{})
+
+const ecsTaskFixture = "arn:aws:ecs:eu-west-1:123456789012:task/foo/8f2b"
+
+func (s *SuiteECSJob) SetUpTest(c *C) {
+	s.run, s.status, s.code, s.polls, s.stopped, s.tokens = nil, "STOPPED", "0", 0, false, nil
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Authorization"), Matches, "AWS4-HMAC-SHA256 Credential=foo/.*/eu-west-1/.*")
+
+		var input map[string]interface{}
+		c.Assert(json.NewDecoder(r.Body).Decode(&input), IsNil)
+
+		switch r.Header.Get("X-Amz-Target") {
+		case ecsTarget + ".DescribeTaskDefinition":
+			if input["taskDefinition"] != "report:3" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"__type":"ClientException","message":"Unable to describe task definition."}`)
+				return
+			}
+
+			fmt.Fprint(w, `{"taskDefinition":{"containerDefinitions":[
+				{"name":"sidecar"},
+				{"name":"app","logConfiguration":{"logDriver":"awslogs","options":{"awslogs-group":"/ecs/report","awslogs-stream-prefix":"ecs"}}}
+			]}}`)
+		case ecsTarget + ".RunTask":
+			s.run = input
+			fmt.Fprintf(w, `{"tasks":[{"taskArn":%q}]}`, ecsTaskFixture)
+		case ecsTarget + ".DescribeTasks":
+			c.Assert(input["tasks"], DeepEquals, []interface{}{ecsTaskFixture})
+			s.polls++
+			if s.polls < 2 {
+				fmt.Fprint(w, `{"tasks":[{"lastStatus":"RUNNING"}]}`)
+				return
+			}
+
+			fmt.Fprintf(w, `{"tasks":[{"lastStatus":%q,"stoppedReason":"Essential container in task exited","containers":[{"name":"app","exitCode":%s}]}]}`, s.status, s.code)
+		case ecsTarget + ".StopTask":
+			s.stopped = true
+			fmt.Fprint(w, `{}`)
+		case logsTarget + ".GetLogEvents":
+			c.Assert(input["logGroupName"], Equals, "/ecs/report")
+			c.Assert(input["logStreamName"], Equals, "ecs/app/8f2b")
+			s.tokens = append(s.tokens, input["nextToken"])
+			if input["nextToken"] == "f/2" {
+				fmt.Fprint(w, `{"events":[],"nextForwardToken":"f/2"}`)
+				return
+			}
+
+			fmt.Fprint(w, `{"events":[{"message":"foo"},{"message":"bar"}],"nextForwardToken":"f/2"}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type":"com.amazon.coral.service#UnknownOperationException"}`)
+		}
+	}))
+}
+
+func (s *SuiteECSJob) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *SuiteECSJob) buildJob() *ECSJob {
+	job := &ECSJob{AWSConfig: AWSConfig{
+		AWSRegion:          "eu-west-1",
+		AWSAccessKeyID:     "foo",
+		AWSSecretAccessKey: "bar",
+		AWSEndpoint:        s.server.URL,
+	}}
+
+	job.Name = "report"
+	job.Cluster = "foo"
+	job.TaskDefinition = "report:3"
+	job.Container = "app"
+	job.LaunchType = "FARGATE"
+	job.Subnets = []string{"subnet-1"}
+	job.Command = `generate "last week"`
+	job.Environment = []string{"FOO=foo"}
+
+	return job
+}
+
+func (s *SuiteECSJob) TestRun(c *C) {
+	e := NewExecution()
+	err := s.buildJob().Run(&Context{Execution: e, Logger: &TestLogger{}})
+	c.Assert(err, IsNil)
+	c.Assert(string(e.Output()), Equals, "foo\nbar\n")
+	c.Assert(s.tokens, DeepEquals, []interface{}{nil, "f/2"})
+	c.Assert(s.stopped, Equals, false)
+
+	c.Assert(s.run["cluster"], Equals, "foo")
+	c.Assert(s.run["launchType"], Equals, "FARGATE")
+	c.Assert(s.run["networkConfiguration"], DeepEquals, map[string]interface{}{
+		"awsvpcConfiguration": map[string]interface{}{
+			"subnets":        []interface{}{"subnet-1"},
+			"securityGroups": nil,
+			"assignPublicIp": "DISABLED",
+		},
+	})
+
+	c.Assert(s.run["overrides"], DeepEquals, map[string]interface{}{
+		"containerOverrides": []interface{}{map[string]interface{}{
+			"name":    "app",
+			"command": []interface{}{"generate", "last week"},
+			"environment": []interface{}{
+				map[string]interface{}{"name": "OFELIA_EXECUTION_ID", "value": e.ID},
+				map[string]interface{}{"name": "FOO", "value": "foo"},
+			},
+		}},
+	})
+}
+
+func (s *SuiteECSJob) TestRunFailed(c *C) {
+	s.code = "3"
+
+	err := s.buildJob().Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, DeepEquals, &ExitCodeError{ExitCode: 3})
+}
+
+func (s *SuiteECSJob) TestRunNotStarted(c *C) {
+	s.code = "null"
+
+	err := s.buildJob().Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, ErrorMatches, "ecs task .* stopped: Essential container in task exited")
+}
+
+func (s *SuiteECSJob) TestRunMaxRuntime(c *C) {
+	s.status = "RUNNING"
+
+	job := s.buildJob()
+	job.MaxRuntime = time.Millisecond * 100
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, Equals, ErrMaxTimeRunning)
+	c.Assert(s.stopped, Equals, true)
+}
+
+func (s *SuiteECSJob) TestRunContainerNotFound(c *C) {
+	job := s.buildJob()
+	job.Container = "qux"
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, ErrorMatches, `container "qux" not found in task definition "report:3"`)
+}
+
+func (s *SuiteECSJob) TestRunError(c *C) {
+	job := s.buildJob()
+	job.TaskDefinition = "qux"
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, ErrorMatches, `error describing task definition "qux": ClientException: Unable to describe task definition.`)
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// parseEnvSpecs parses the environment of a job, as `NAME=value` or `NAME`.
+// The value is everything after the first `=`, so it can contain `=`, and the
+// quotes around it are removed, e.g. `NAME="a,b"`. `NAME` alone passes the
+// variable of the environment of ofelia, and is skipped if it isn't set, or is
+// an error if passthrough is false.
+func parseEnvSpecs(specs []string, passthrough bool) ([]string, error) {
+	var env []string
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		name := parts[0]
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid environment variable %q", spec)
+		}
+
+		if len(parts) == 1 {
+			if !passthrough {
+				return nil, fmt.Errorf("environment variable %q without value isn't allowed", spec)
+			}
+
+			if v, ok := os.LookupEnv(name); ok {
+				env = append(env, name+"="+v)
+			}
+
+			continue
+		}
+
+		env = append(env, name+"="+unquote(parts[1]))
+	}
+
+	return env, nil
+}
+
+// ValidateEnv returns an error if any of the environment variables isn't
+// `NAME=value`
+func ValidateEnv(env []string) error {
+	for _, v := range env {
+		if i := strings.Index(v, "="); i < 1 || strings.ContainsAny(v[:i], " \t") {
+			return fmt.Errorf("invalid environment variable %q, expected NAME=value", v)
+		}
+	}
+
+	return nil
+}
+
+// EnvNames returns the names of the environment variables, `NAME=value`,
+// without their values, which can be secrets
+func EnvNames(env []string) []string {
+	names := make([]string, len(env))
+	for i, v := range env {
+		if j := strings.Index(v, "="); j >= 0 {
+			v = v[:j]
+		}
+
+		names[i] = v
+	}
+
+	return names
+}
+
+// unquote removes the double or single quotes around s, if any
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+
+	return s
+}
+
+// ExecutionIDEnv is the environment variable with the ID of the execution set
+// in the commands, so their logs can be correlated with the ones of ofelia.
+const ExecutionIDEnv = "OFELIA_EXECUTION_ID"
+
+// buildEnvironment renders the templates of the environment of a job and
+// parses it, see parseEnvSpecs, followed by the secrets of the job, as
+// `NAME=secret`, see Secrets, and by the environment of the execution. The
+// environment starts with ExecutionIDEnv.
+func buildEnvironment(ctx *Context, specs, secrets []string, passthrough bool) ([]string, error) {
+	env, err := ctx.RenderAll(specs)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err = parseEnvSpecs(env, passthrough)
+	if err != nil {
+		return nil, err
+	}
+
+	var s *Secrets
+	if ctx.Scheduler != nil {
+		s = ctx.Scheduler.Secrets
+	}
+
+	for _, spec := range secrets {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid env-secret %q: expected NAME=secret", spec)
+		}
+
+		value, err := s.Resolve(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		ctx.Execution.addSecret(value)
+		env = append(env, parts[0]+"="+value)
+	}
+
+	env = append(env, ctx.Execution.Environment...)
+	return append([]string{ExecutionIDEnv + "=" + ctx.Execution.ID}, env...), nil
+}
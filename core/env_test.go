@@ -0,0 +1,95 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteEnv struct{}
+
+var _ = Suite(&SuiteEnv{})
+
+func (s *SuiteEnv) TestParseEnvSpecs(c *C) {
+	os.Setenv("OFELIA_TEST_ENV", "foo")
+	defer os.Unsetenv("OFELIA_TEST_ENV")
+
+	env, err := parseEnvSpecs([]string{
+		"FOO=foo",
+		"URL=postgres://db/app?sslmode=disable&x=y",
+		`LIST="a,b,c"`,
+		"QUOTED='bar baz'",
+		`PARTIAL="foo`,
+		"EMPTY=",
+		"OFELIA_TEST_ENV",
+		"OFELIA_TEST_UNSET",
+	}, true)
+
+	c.Assert(err, IsNil)
+	c.Assert(env, DeepEquals, []string{
+		"FOO=foo",
+		"URL=postgres://db/app?sslmode=disable&x=y",
+		"LIST=a,b,c",
+		"QUOTED=bar baz",
+		`PARTIAL="foo`,
+		"EMPTY=",
+		"OFELIA_TEST_ENV=foo",
+	})
+}
+
+func (s *SuiteEnv) TestParseEnvSpecsNoPassthrough(c *C) {
+	os.Setenv("OFELIA_TEST_ENV", "foo")
+	defer os.Unsetenv("OFELIA_TEST_ENV")
+
+	env, err := parseEnvSpecs([]string{"FOO=foo"}, false)
+	c.Assert(err, IsNil)
+	c.Assert(env, DeepEquals, []string{"FOO=foo"})
+
+	_, err = parseEnvSpecs([]string{"FOO=foo", "OFELIA_TEST_ENV"}, false)
+	c.Assert(err, ErrorMatches, `environment variable "OFELIA_TEST_ENV" without value isn't allowed`)
+}
+
+func (s *SuiteEnv) TestParseEnvSpecsInvalid(c *C) {
+	_, err := parseEnvSpecs([]string{"=foo"}, true)
+	c.Assert(err, ErrorMatches, `invalid environment variable "=foo"`)
+
+	_, err = parseEnvSpecs([]string{"FOO BAR=foo"}, true)
+	c.Assert(err, ErrorMatches, `invalid environment variable "FOO BAR=foo"`)
+}
+
+func (s *SuiteEnv) TestParseEnvSpecsEmpty(c *C) {
+	env, err := parseEnvSpecs(nil, true)
+	c.Assert(err, IsNil)
+	c.Assert(env, IsNil)
+}
+
+func (s *SuiteEnv) TestBuildEnvironmentSecrets(c *C) {
+	dir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "db_password"), []byte("s3cr3t\n"), 0600)
+	c.Assert(err, IsNil)
+
+	sh := NewScheduler(&TestLogger{})
+	sh.Secrets = &Secrets{Dir: dir}
+	e := NewExecution()
+	ctx := &Context{Scheduler: sh, Execution: e}
+
+	env, err := buildEnvironment(ctx, []string{"FOO=foo"}, []string{"DB_PASSWORD=db_password"}, true)
+	c.Assert(err, IsNil)
+	c.Assert(env, DeepEquals, []string{"OFELIA_EXECUTION_ID=" + e.ID, "FOO=foo", "DB_PASSWORD=s3cr3t"})
+
+	e.OutputStream.Write([]byte("password: s3cr3t"))
+	c.Assert(string(e.Output()), Equals, "password: [REDACTED]")
+
+	e.Environment = []string{"FOO=bar"}
+	env, err = buildEnvironment(ctx, []string{"FOO=foo"}, nil, true)
+	c.Assert(err, IsNil)
+	c.Assert(env, DeepEquals, []string{"OFELIA_EXECUTION_ID=" + e.ID, "FOO=foo", "FOO=bar"})
+
+	_, err = buildEnvironment(ctx, nil, []string{"DB_PASSWORD"}, true)
+	c.Assert(err, ErrorMatches, `invalid env-secret "DB_PASSWORD": expected NAME=secret`)
+
+	_, err = buildEnvironment(ctx, nil, []string{"DB_PASSWORD=missing"}, true)
+	c.Assert(err, ErrorMatches, `error reading secret "missing": .*no such file or directory`)
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/gobs/args"
@@ -11,16 +12,114 @@ type ExecJob struct {
 	BareJob   `mapstructure:",squash"`
 	Client    *docker.Client `json:"-"`
 	Container string
-	User      string `default:"root"`
-	TTY       bool   `default:"false"`
+	// ContainerLabel selects the container by a label instead of its name,
+	// e.g. `com.docker.compose.service=web`, the command is executed in the
+	// first running container matching it, or in all if AllContainers is set.
+	ContainerLabel string `mapstructure:"container-label"`
+	AllContainers  bool   `mapstructure:"all-containers"`
+	User           string `default:"root"`
+	TTY            bool   `default:"false"`
+	// Environment and Workdir are set on the command, similar to
+	// `docker exec --env --workdir`, they require API 1.25 and 1.35.
+	Environment []string
+	Workdir     string
+	// EnvSecret are added to the environment as `NAME=secret`, read on every
+	// execution from a file of /run/secrets or from Vault, see Secrets.
+	EnvSecret []string `mapstructure:"env-secret"`
+	// NoEnvPassthrough refuses the `NAME` of Environment without value, which
+	// passes the variable of ofelia, set on the jobs of the labels of the
+	// containers without ofelia.service=true, see parseEnvSpecs.
+	NoEnvPassthrough bool `mapstructure:"-" json:"-"`
+	// Input or the content of InputFile is written to the stdin of the
+	// command, e.g. a SQL script executed by `psql`.
+	Input     string
+	InputFile string `mapstructure:"input-file"`
+	// WaitHealthy is the maximum time to wait for the container to be running
+	// and, if it has a healthcheck, healthy before executing the command,
+	// e.g. while it's restarting. Zero executes it right away.
+	WaitHealthy time.Duration `mapstructure:"wait-healthy"`
 }
 
+// execExitTimeout is the maximum time the exec is waited to be reported as
+// finished once its streams are closed, Podman reports it as running until the
+// exec session is cleaned up
+const execExitTimeout = time.Second * 5
+
 func NewExecJob(c *docker.Client) *ExecJob {
 	return &ExecJob{Client: c}
 }
 
+// GetEnvironment returns the environment of the job
+func (j *ExecJob) GetEnvironment() []string {
+	return j.Environment
+}
+
 func (j *ExecJob) Run(ctx *Context) error {
-	exec, err := j.buildExec()
+	containers, err := j.getContainers()
+	if err != nil {
+		return err
+	}
+
+	var failed error
+	for _, container := range containers {
+		if err := j.runOnContainer(ctx, container); err != nil {
+			if len(containers) == 1 {
+				return err
+			}
+
+			ctx.Logger.Errorf("Error executing in container %s: %s", container, err)
+			failed = fmt.Errorf("error executing in container %s: %s", container, err)
+		}
+	}
+
+	return failed
+}
+
+// getContainers returns the containers where the command is executed. The
+// first request to the API, besides checking that the containers exist,
+// negotiates the version of the API required by options like Environment.
+func (j *ExecJob) getContainers() ([]string, error) {
+	if j.ContainerLabel == "" {
+		if _, err := j.Client.InspectContainer(j.Container); err != nil {
+			return nil, fmt.Errorf("error inspecting container %q: %s", j.Container, err)
+		}
+
+		return []string{j.Container}, nil
+	}
+
+	containers, err := j.Client.ListContainers(docker.ListContainersOptions{
+		Filters: map[string][]string{
+			"label": {j.ContainerLabel},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing containers: %s", err)
+	}
+
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("no running containers with label %q", j.ContainerLabel)
+	}
+
+	if !j.AllContainers {
+		containers = containers[:1]
+	}
+
+	ids := make([]string, len(containers))
+	for i, c := range containers {
+		ids[i] = c.ID
+	}
+
+	return ids, nil
+}
+
+func (j *ExecJob) runOnContainer(ctx *Context, container string) error {
+	if j.WaitHealthy != 0 {
+		if err := j.waitHealthy(ctx.Execution, container); err != nil {
+			return err
+		}
+	}
+
+	exec, err := j.buildExec(ctx, container)
 	if err != nil {
 		return err
 	}
@@ -32,15 +131,63 @@ func (j *ExecJob) Run(ctx *Context) error {
 	return j.inspectExec(exec)
 }
 
-func (j *ExecJob) buildExec() (*docker.Exec, error) {
+// waitHealthy polls the container until it's running and healthy, failing
+// after WaitHealthy or if the execution is canceled
+func (j *ExecJob) waitHealthy(e *Execution, container string) error {
+	timeout := time.After(j.WaitHealthy)
+	for {
+		c, err := j.Client.InspectContainer(container)
+		if err != nil {
+			return fmt.Errorf("error inspecting container %q: %s", container, err)
+		}
+
+		state := containerState(c)
+		if state == "running" || state == "healthy" {
+			return nil
+		}
+
+		select {
+		case <-e.Done():
+			return ErrCanceledExecution
+		case <-timeout:
+			return fmt.Errorf("container %q not healthy after %s: %s", container, j.WaitHealthy, state)
+		case <-time.After(watchDuration):
+		}
+	}
+}
+
+// containerState returns the state of the container, e.g. `restarting`, or
+// its health status if it's running and has a healthcheck, e.g. `starting`
+func containerState(c *docker.Container) string {
+	state := c.State.StateString()
+	if state == "running" && c.State.Health.Status != "" && c.State.Health.Status != "none" {
+		return c.State.Health.Status
+	}
+
+	return state
+}
+
+func (j *ExecJob) buildExec(ctx *Context, container string) (*docker.Exec, error) {
+	command, err := ctx.RenderCommand(j.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := buildEnvironment(ctx, j.Environment, j.EnvSecret, !j.NoEnvPassthrough)
+	if err != nil {
+		return nil, err
+	}
+
 	exec, err := j.Client.CreateExec(docker.CreateExecOptions{
-		AttachStdin:  false,
+		AttachStdin:  j.Input != "" || j.InputFile != "",
 		AttachStdout: true,
 		AttachStderr: true,
 		Tty:          j.TTY,
-		Cmd:          args.GetArgs(j.Command),
-		Container:    j.Container,
+		Cmd:          args.GetArgs(command),
+		Container:    container,
 		User:         j.User,
+		Env:          env,
+		WorkingDir:   j.Workdir,
 	})
 
 	if err != nil {
@@ -51,14 +198,24 @@ func (j *ExecJob) buildExec() (*docker.Exec, error) {
 }
 
 func (j *ExecJob) startExec(e *Execution, exec *docker.Exec) error {
-	err := j.Client.StartExec(exec.ID, docker.StartExecOptions{
+	input, err := openInput(j.Input, j.InputFile)
+	if err != nil {
+		return err
+	}
+
+	opts := docker.StartExecOptions{
 		Tty:          j.TTY,
 		OutputStream: e.OutputStream,
 		ErrorStream:  e.ErrorStream,
 		RawTerminal:  j.TTY,
-	})
+	}
 
-	if err != nil {
+	if input != nil {
+		defer input.Close()
+		opts.InputStream = input
+	}
+
+	if err := j.Client.StartExec(exec.ID, opts); err != nil {
 		return fmt.Errorf("error starting exec: %s", err)
 	}
 
@@ -67,6 +224,10 @@ func (j *ExecJob) startExec(e *Execution, exec *docker.Exec) error {
 
 func (j *ExecJob) inspectExec(exec *docker.Exec) error {
 	i, err := j.Client.InspectExec(exec.ID)
+	for timeout := time.Now().Add(execExitTimeout); err == nil && i.Running && time.Now().Before(timeout); {
+		time.Sleep(watchDuration)
+		i, err = j.Client.InspectExec(exec.ID)
+	}
 
 	if err != nil {
 		return fmt.Errorf("error inspecting exec: %s", err)
@@ -78,6 +239,6 @@ func (j *ExecJob) inspectExec(exec *docker.Exec) error {
 	case -1:
 		return ErrUnexpected
 	default:
-		return fmt.Errorf("error non-zero exit code: %d", i.ExitCode)
+		return &ExitCodeError{ExitCode: i.ExitCode}
 	}
 }
@@ -3,6 +3,11 @@ package core
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"time"
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/fsouza/go-dockerclient/testing"
@@ -23,8 +28,14 @@ func (s *SuiteExecJob) SetUpTest(c *C) {
 	s.server, err = testing.NewServer("127.0.0.1:0", nil, nil)
 	c.Assert(err, IsNil)
 
+	// the environment of the execs requires the API 1.25
+	s.server.CustomHandler("/version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"ApiVersion": "1.35"})
+	}))
+
 	s.client, err = docker.NewClient(s.server.URL())
 	c.Assert(err, IsNil)
+	s.client.SkipServerVersionCheck = false
 
 	s.buildContainer(c)
 }
@@ -58,6 +69,154 @@ func (s *SuiteExecJob) TestRun(c *C) {
 	c.Assert(exec.ProcessConfig.Tty, Equals, true)
 }
 
+func (s *SuiteExecJob) TestRunEnvironmentWorkdir(c *C) {
+	var opts docker.CreateExecOptions
+	s.server.CustomHandler("/containers/.*/exec", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		json.Unmarshal(body, &opts)
+
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &ExecJob{Client: s.client}
+	job.Container = ContainerFixture
+	job.Command = "env"
+	job.Environment = []string{"FOO=foo", "BAR=bar"}
+	job.Workdir = "/tmp"
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e})
+	c.Assert(err, IsNil)
+	c.Assert(opts.Env, DeepEquals, []string{"OFELIA_EXECUTION_ID=" + e.ID, "FOO=foo", "BAR=bar"})
+	c.Assert(opts.WorkingDir, Equals, "/tmp")
+}
+
+func (s *SuiteExecJob) TestRunInput(c *C) {
+	input := make(chan string, 1)
+	s.server.CustomHandler("/exec/.*/start", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		c.Assert(err, IsNil)
+		defer conn.Close()
+
+		b, _ := ioutil.ReadAll(conn)
+		input <- string(b)
+	}))
+
+	file := filepath.Join(c.MkDir(), "input.sql")
+	c.Assert(ioutil.WriteFile(file, []byte("SELECT 1;\n"), 0644), IsNil)
+
+	job := &ExecJob{Client: s.client}
+	job.Container = ContainerFixture
+	job.Command = "psql"
+	job.InputFile = file
+
+	err := job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, IsNil)
+	c.Assert(<-input, Equals, "SELECT 1;\n")
+}
+
+func (s *SuiteExecJob) TestRunExecStillRunning(c *C) {
+	var inspects int
+	s.server.CustomHandler("/exec/.*/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inspects++
+		if inspects < 3 {
+			json.NewEncoder(w).Encode(map[string]interface{}{"Running": true, "ExitCode": -1})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"Running": false, "ExitCode": 2})
+	}))
+
+	job := &ExecJob{Client: s.client}
+	job.Container = ContainerFixture
+	job.Command = "false"
+
+	err := job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, DeepEquals, &ExitCodeError{ExitCode: 2})
+	c.Assert(inspects, Equals, 3)
+}
+
+func (s *SuiteExecJob) TestRunWaitHealthy(c *C) {
+	var inspects int
+	s.server.CustomHandler("/containers/.*/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inspects++
+		health := "starting"
+		if inspects > 2 {
+			health = "healthy"
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"State": map[string]interface{}{"Running": true, "Health": map[string]string{"Status": health}},
+		})
+	}))
+
+	job := &ExecJob{Client: s.client}
+	job.Container = ContainerFixture
+	job.Command = "echo foo"
+	job.WaitHealthy = time.Second
+
+	err := job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, IsNil)
+	c.Assert(inspects, Equals, 3)
+}
+
+func (s *SuiteExecJob) TestRunWaitHealthyTimeout(c *C) {
+	job := &ExecJob{Client: s.client}
+	job.Container = ContainerFixture
+	job.Command = "echo foo"
+	job.WaitHealthy = time.Millisecond * 300
+
+	err := job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, ErrorMatches, `container "test-container" not healthy after 300ms: created`)
+	c.Assert(s.countExecs(c, ContainerFixture), Equals, 0)
+}
+
+func (s *SuiteExecJob) TestRunContainerLabel(c *C) {
+	s.createLabeledContainer(c, "web-1")
+	s.createLabeledContainer(c, "web-2")
+
+	job := &ExecJob{Client: s.client}
+	job.ContainerLabel = "service=web"
+	job.Command = "echo foo"
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, IsNil)
+	c.Assert(s.countExecs(c, "web-1")+s.countExecs(c, "web-2"), Equals, 1)
+
+	job.AllContainers = true
+	err = job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, IsNil)
+	c.Assert(s.countExecs(c, "web-1")+s.countExecs(c, "web-2"), Equals, 3)
+	c.Assert(s.countExecs(c, ContainerFixture), Equals, 0)
+
+	job.ContainerLabel = "service=db"
+	err = job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteExecJob) createLabeledContainer(c *C, name string) {
+	container, err := s.client.CreateContainer(docker.CreateContainerOptions{
+		Name: name,
+		Config: &docker.Config{
+			Image:  "test",
+			Labels: map[string]string{"service": "web"},
+		},
+	})
+	c.Assert(err, IsNil)
+
+	err = s.client.StartContainer(container.ID, nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteExecJob) countExecs(c *C, name string) int {
+	container, err := s.client.InspectContainer(name)
+	c.Assert(err, IsNil)
+
+	return len(container.ExecIDs)
+}
+
 func (s *SuiteExecJob) buildContainer(c *C) {
 	inputbuf := bytes.NewBuffer(nil)
 	tr := tar.NewWriter(inputbuf)
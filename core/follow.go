@@ -0,0 +1,197 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+const (
+	// followBuffer is the number of chunks buffered for every follower, a
+	// follower not reading them in time is dropped so it never blocks the job
+	followBuffer = 256
+	// maxPendingLine is the size of an incomplete line sent to the followers
+	// anyway, e.g. a progress bar without new lines
+	maxPendingLine = 64 * 1024
+)
+
+// OutputChunk is a chunk written to the output, or the error output if Stderr,
+// of an execution. Dropped is the last chunk received by a follower dropped
+// for not reading them in time, without data.
+type OutputChunk struct {
+	Stderr  bool
+	Data    []byte
+	Dropped bool
+}
+
+// followers are the channels receiving the output of a running execution, the
+// output is sent by complete lines so the secrets written across several
+// writes are masked, pending are the incomplete lines of the output and of
+// the error output.
+type followers struct {
+	mu      sync.Mutex
+	chans   map[chan OutputChunk]struct{}
+	closed  bool
+	redact  func([]byte) []byte
+	pending [2][]byte
+}
+
+// write sends the complete lines of the data written to the output, or the
+// error output if stderr, keeping the last incomplete line until it's
+// completed or exceeds maxPendingLine
+func (f *followers) write(stderr bool, p []byte) {
+	i := streamIndex(stderr)
+	data := append(f.pending[i], p...)
+	n := bytes.LastIndexByte(data, '\n') + 1
+	if n == 0 && len(data) >= maxPendingLine {
+		n = len(data)
+	}
+
+	f.pending[i] = append([]byte(nil), data[n:]...)
+	if n != 0 {
+		f.send(OutputChunk{Stderr: stderr, Data: data[:n]})
+	}
+}
+
+func (f *followers) send(c OutputChunk) {
+	if len(f.chans) == 0 {
+		return
+	}
+
+	c.Data = f.redact(c.Data)
+	for ch := range f.chans {
+		// the last slot of the buffer is kept for the dropped chunk
+		if len(ch) < followBuffer {
+			ch <- c
+			continue
+		}
+
+		ch <- OutputChunk{Dropped: true}
+		delete(f.chans, ch)
+		close(ch)
+	}
+}
+
+// streamIndex returns the index of the output, or the error output if stderr,
+// in followers.pending
+func streamIndex(stderr bool) int {
+	if stderr {
+		return 1
+	}
+
+	return 0
+}
+
+func (f *followers) remove(ch chan OutputChunk) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.chans[ch]; ok {
+		delete(f.chans, ch)
+		close(ch)
+	}
+}
+
+func (f *followers) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, p := range f.pending {
+		if len(p) != 0 {
+			f.send(OutputChunk{Stderr: i == 1, Data: p})
+		}
+	}
+
+	for ch := range f.chans {
+		close(ch)
+	}
+
+	f.chans, f.pending, f.closed = nil, [2][]byte{}, true
+}
+
+// followStream is an output stream of an execution sending what is written to
+// the followers of the execution
+type followStream struct {
+	io.ReadWriter
+	followers *followers
+	stderr    bool
+}
+
+func (s *followStream) Write(p []byte) (int, error) {
+	s.followers.mu.Lock()
+	defer s.followers.mu.Unlock()
+
+	n, err := s.ReadWriter.Write(p)
+	if n > 0 {
+		s.followers.write(s.stderr, p[:n])
+	}
+
+	return n, err
+}
+
+func (s *followStream) Close() error {
+	if c, ok := s.ReadWriter.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+func (s *followStream) bytes() []byte {
+	s.followers.mu.Lock()
+	defer s.followers.mu.Unlock()
+
+	return readStream(s.ReadWriter)
+}
+
+// written returns the output written to the stream, or the error output if
+// stderr, without the incomplete line to be sent to the followers
+func (f *followers) written(s io.ReadWriter, stderr bool) []byte {
+	b := readStream(s)
+	if p := f.pending[streamIndex(stderr)]; bytes.HasSuffix(b, p) {
+		b = b[:len(b)-len(p)]
+	}
+
+	return b
+}
+
+// followable wraps the streams of the execution so its output can be followed
+// while it's running, see Follow
+func (e *Execution) followable() {
+	f := &followers{chans: make(map[chan OutputChunk]struct{}), redact: e.Redact}
+	e.OutputStream = &followStream{ReadWriter: e.OutputStream, followers: f}
+	e.ErrorStream = &followStream{ReadWriter: e.ErrorStream, followers: f, stderr: true}
+	e.followers = f
+}
+
+// Follow returns the output and the error output written so far by the
+// execution, and a channel receiving the chunks written after them, with the
+// secrets masked as in Output, closed once the execution stops. The output is
+// sent by complete lines, the incomplete line written so far is the first
+// chunk once it's completed. If the chunks aren't read in time, the channel
+// receives a Dropped chunk and is closed. The returned function stops
+// following the execution.
+//
+// The channel is nil if the execution can't be followed, because it wasn't
+// run by a scheduler or it already stopped.
+func (e *Execution) Follow() (output, errorOutput []byte, chunks <-chan OutputChunk, stop func()) {
+	f := e.followers
+	if f == nil {
+		return e.Output(), e.ErrorOutput(), nil, func() {}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		output = e.Redact(readStream(e.OutputStream.(*followStream).ReadWriter))
+		errorOutput = e.Redact(readStream(e.ErrorStream.(*followStream).ReadWriter))
+		return output, errorOutput, nil, func() {}
+	}
+
+	output = e.Redact(f.written(e.OutputStream.(*followStream).ReadWriter, false))
+	errorOutput = e.Redact(f.written(e.ErrorStream.(*followStream).ReadWriter, true))
+	ch := make(chan OutputChunk, followBuffer+1)
+	f.chans[ch] = struct{}{}
+	return output, errorOutput, ch, func() { f.remove(ch) }
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type SuiteFollow struct{}
+
+var _ = Suite(&SuiteFollow{})
+
+func (s *SuiteFollow) TestFollow(c *C) {
+	e := NewExecution()
+	e.followable()
+	e.addSecret("secret")
+	e.Start()
+
+	e.OutputStream.Write([]byte("foo\nba"))
+	output, errorOutput, chunks, stop := e.Follow()
+	defer stop()
+
+	// the incomplete line is sent once completed
+	c.Assert(string(output), Equals, "foo\n")
+	c.Assert(errorOutput, HasLen, 0)
+
+	e.OutputStream.Write([]byte("r\nqux"))
+	e.ErrorStream.Write([]byte("the sec"))
+	e.ErrorStream.Write([]byte("ret\n"))
+	e.Stop(nil)
+
+	c.Assert(<-chunks, DeepEquals, OutputChunk{Data: []byte("bar\n")})
+	c.Assert(<-chunks, DeepEquals, OutputChunk{Stderr: true, Data: []byte("the [REDACTED]\n")})
+	c.Assert(<-chunks, DeepEquals, OutputChunk{Data: []byte("qux")})
+	_, ok := <-chunks
+	c.Assert(ok, Equals, false)
+
+	c.Assert(string(e.Output()), Equals, "foo\nbar\nqux")
+	c.Assert(string(e.ErrorOutput()), Equals, "the [REDACTED]\n")
+
+	// the execution already stopped
+	output, _, chunks, _ = e.Follow()
+	c.Assert(string(output), Equals, "foo\nbar\nqux")
+	c.Assert(chunks, IsNil)
+}
+
+func (s *SuiteFollow) TestFollowLongLine(c *C) {
+	e := NewExecution()
+	e.followable()
+
+	_, _, chunks, stop := e.Follow()
+	defer stop()
+
+	line := make([]byte, maxPendingLine)
+	e.OutputStream.Write(line[:maxPendingLine/2])
+	c.Assert(chunks, HasLen, 0)
+
+	e.OutputStream.Write(line[maxPendingLine/2:])
+	c.Assert(<-chunks, DeepEquals, OutputChunk{Data: line})
+}
+
+func (s *SuiteFollow) TestFollowStop(c *C) {
+	e := NewExecution()
+	e.followable()
+
+	_, _, chunks, stop := e.Follow()
+	stop()
+	_, ok := <-chunks
+	c.Assert(ok, Equals, false)
+
+	e.OutputStream.Write([]byte("foo"))
+	e.Stop(nil)
+	c.Assert(string(e.Output()), Equals, "foo")
+}
+
+func (s *SuiteFollow) TestFollowSlow(c *C) {
+	e := NewExecution()
+	e.followable()
+
+	_, _, chunks, stop := e.Follow()
+	defer stop()
+
+	for i := 0; i <= followBuffer; i++ {
+		e.OutputStream.Write([]byte("foo\n"))
+	}
+
+	// the follower is dropped instead of blocking the job
+	for i := 0; i < followBuffer; i++ {
+		c.Assert(<-chunks, DeepEquals, OutputChunk{Data: []byte("foo\n")})
+	}
+
+	c.Assert(<-chunks, DeepEquals, OutputChunk{Dropped: true})
+	_, ok := <-chunks
+	c.Assert(ok, Equals, false)
+}
+
+func (s *SuiteFollow) TestFollowNotFollowable(c *C) {
+	e := NewExecution()
+	e.OutputStream.Write([]byte("foo"))
+
+	output, _, chunks, stop := e.Follow()
+	stop()
+	c.Assert(string(output), Equals, "foo")
+	c.Assert(chunks, IsNil)
+}
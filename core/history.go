@@ -0,0 +1,10 @@
+package core
+
+// HistoryStore persists the executions of the jobs, allowing to keep their
+// history across restarts.
+type HistoryStore interface {
+	// Save stores a finished execution of the given job.
+	Save(job string, e *Execution) error
+	// Load returns the stored executions of the given job, sorted by date.
+	Load(job string) ([]*Execution, error)
+}
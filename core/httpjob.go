@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPJob performs an HTTP request, the response body is written to the
+// output of the execution.
+type HTTPJob struct {
+	BareJob `mapstructure:",squash"`
+	URL     string
+	Method  string `default:"GET"`
+	// Header are the headers of the request, as `Name: value`
+	Header []string
+	Body   string
+	// ExpectedStatus are the status codes considered successful, by default
+	// any 2xx status code.
+	ExpectedStatus []int `mapstructure:"expected-status"`
+	// Timeout of the request, 30s by default.
+	Timeout time.Duration
+}
+
+const defaultHTTPTimeout = time.Second * 30
+
+func NewHTTPJob() *HTTPJob {
+	return &HTTPJob{}
+}
+
+// GetCommand returns the method and URL of the request
+func (j *HTTPJob) GetCommand() string {
+	return fmt.Sprintf("%s %s", j.method(), j.URL)
+}
+
+func (j *HTTPJob) Run(ctx *Context) error {
+	req, err := j.buildRequest()
+	if err != nil {
+		return err
+	}
+
+	c, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-ctx.Execution.Done():
+			cancel()
+		case <-c.Done():
+		}
+	}()
+
+	timeout := j.Timeout
+	if timeout == 0 {
+		timeout = defaultHTTPTimeout
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req.WithContext(c))
+	if ctx.Execution.IsCanceled() {
+		return ErrCanceledExecution
+	}
+
+	if err != nil {
+		return fmt.Errorf("error requesting %q: %s", j.URL, err)
+	}
+
+	defer resp.Body.Close()
+	if _, err := io.Copy(ctx.Execution.OutputStream, resp.Body); err != nil {
+		return fmt.Errorf("error reading response: %s", err)
+	}
+
+	if !j.isExpectedStatus(resp.StatusCode) {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (j *HTTPJob) buildRequest() (*http.Request, error) {
+	var body io.Reader
+	if j.Body != "" {
+		body = strings.NewReader(j.Body)
+	}
+
+	req, err := http.NewRequest(j.method(), j.URL, body)
+	if err != nil {
+		return nil, fmt.Errorf("error building request: %s", err)
+	}
+
+	for _, h := range j.Header {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid header %q", h)
+		}
+
+		req.Header.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	return req, nil
+}
+
+func (j *HTTPJob) method() string {
+	if j.Method == "" {
+		return http.MethodGet
+	}
+
+	return strings.ToUpper(j.Method)
+}
+
+func (j *HTTPJob) isExpectedStatus(code int) bool {
+	if len(j.ExpectedStatus) == 0 {
+		return code >= 200 && code < 300
+	}
+
+	for _, c := range j.ExpectedStatus {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteHTTPJob struct{}
+
+var _ = Suite(&SuiteHTTPJob{})
+
+func (s *SuiteHTTPJob) TestRun(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, Equals, http.MethodPost)
+		c.Assert(r.Header.Get("Authorization"), Equals, "Bearer foo")
+
+		body, _ := ioutil.ReadAll(r.Body)
+		c.Assert(string(body), Equals, "bar")
+
+		w.Write([]byte("qux"))
+	}))
+
+	defer ts.Close()
+
+	job := &HTTPJob{}
+	job.URL = ts.URL
+	job.Method = "post"
+	job.Header = []string{"Authorization: Bearer foo"}
+	job.Body = "bar"
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e})
+	c.Assert(err, IsNil)
+	c.Assert(string(e.Output()), Equals, "qux")
+	c.Assert(job.GetCommand(), Equals, "POST "+ts.URL)
+}
+
+func (s *SuiteHTTPJob) TestRunUnexpectedStatus(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	defer ts.Close()
+
+	job := &HTTPJob{}
+	job.URL = ts.URL
+
+	err := job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, ErrorMatches, "unexpected status code 404")
+
+	job.ExpectedStatus = []int{200, 404}
+	err = job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteHTTPJob) TestRunCanceled(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	}))
+
+	defer ts.Close()
+
+	job := &HTTPJob{}
+	job.URL = ts.URL
+
+	e := NewExecution()
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		e.Cancel()
+	}()
+
+	err := job.Run(&Context{Execution: e})
+	c.Assert(err, Equals, ErrCanceledExecution)
+}
@@ -0,0 +1,78 @@
+//go:build integration
+// +build integration
+
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	. "gopkg.in/check.v1"
+)
+
+// SuiteIntegration runs the docker jobs against the engine of DOCKER_HOST,
+// Docker or Podman, with `go test -tags integration ./core`
+type SuiteIntegration struct {
+	client  *docker.Client
+	network *docker.Network
+}
+
+var _ = Suite(&SuiteIntegration{})
+
+const integrationImage = "docker.io/library/alpine:3.12"
+
+func (s *SuiteIntegration) SetUpSuite(c *C) {
+	var err error
+	s.client, err = docker.NewClientFromEnv()
+	c.Assert(err, IsNil)
+	s.client.SkipServerVersionCheck = false
+
+	s.network, err = s.client.CreateNetwork(docker.CreateNetworkOptions{
+		Name: fmt.Sprintf("ofelia-integration-%d", time.Now().UnixNano()),
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteIntegration) TearDownSuite(c *C) {
+	c.Assert(s.client.RemoveNetwork(s.network.ID), IsNil)
+}
+
+func (s *SuiteIntegration) TestRunJob(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Name = "integration"
+	job.Image = integrationImage
+	job.Pull = PullIfNotPresent
+	job.Delete = DeleteAlways
+	job.Network = s.network.Name
+	job.NetworkAlias = []string{"qux"}
+	job.Command = `sh -c "echo foo; echo bar >&2; exit 3"`
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e})
+	c.Assert(err, DeepEquals, &ExitCodeError{ExitCode: 3})
+	c.Assert(string(e.Output()), Equals, "foo\n")
+	c.Assert(string(e.ErrorOutput()), Equals, "bar\n")
+}
+
+func (s *SuiteIntegration) TestExecJob(c *C) {
+	run := &RunJob{Client: s.client, Image: integrationImage, Pull: PullIfNotPresent}
+	c.Assert(run.pullImage(&Context{Execution: NewExecution()}), IsNil)
+
+	container, err := s.client.CreateContainer(docker.CreateContainerOptions{
+		Config: &docker.Config{Image: integrationImage, Cmd: []string{"sleep", "60"}},
+	})
+	c.Assert(err, IsNil)
+	defer s.client.RemoveContainer(docker.RemoveContainerOptions{ID: container.ID, Force: true})
+	c.Assert(s.client.StartContainer(container.ID, nil), IsNil)
+
+	job := &ExecJob{Client: s.client}
+	job.Container = container.ID
+	job.Command = `sh -c "echo $FOO; exit 2"`
+	job.Environment = []string{"FOO=foo"}
+
+	e := NewExecution()
+	err = job.Run(&Context{Execution: e})
+	c.Assert(err, DeepEquals, &ExitCodeError{ExitCode: 2})
+	c.Assert(string(e.Output()), Equals, "foo\n")
+}
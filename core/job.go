@@ -1,14 +1,88 @@
 package core
 
 import (
+	"math"
 	"sync"
 	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRetryBackoff = 2
+	defaultHistoryLimit = 10
 )
 
 type BareJob struct {
 	Schedule string
 	Name     string
 	Command  string
+	// Retries is the number of times a failed execution is retried, waiting
+	// RetryDelay before the first retry, the delay is multiplied by
+	// RetryBackoff (2 by default) on every new attempt.
+	Retries      int
+	RetryDelay   time.Duration `mapstructure:"retry-delay"`
+	RetryBackoff float64       `mapstructure:"retry-backoff"`
+	// DependsOn are the jobs that run this job when they succeed, a job with
+	// dependencies doesn't require a schedule. OnSuccess and OnFailure are the
+	// jobs run after this job succeeds or fails.
+	DependsOn []string `mapstructure:"depends-on"`
+	OnSuccess []string `mapstructure:"on-success"`
+	OnFailure []string `mapstructure:"on-failure"`
+	// Trigger is the URL of a message queue running the job on every message
+	// received, in addition to its schedule, see ParseTrigger. A job with a
+	// trigger doesn't require a schedule.
+	Trigger string
+	// WatchPath is a directory, or a glob pattern of files, running the job
+	// when files are created or modified in it, once they didn't change for
+	// WatchDebounce, see NewWatchTrigger. A job with a watch path doesn't
+	// require a schedule. With WatchExisting the files existing when the
+	// trigger starts run the job too.
+	WatchPath     string        `mapstructure:"watch-path"`
+	WatchDebounce time.Duration `mapstructure:"watch-debounce"`
+	WatchExisting bool          `mapstructure:"watch-existing"`
+	// Templates renders the command, the environment, the volumes and the
+	// payloads of the job as templates on every execution, see
+	// Context.Render. It's opt-in so the commands using `{{` literally, like
+	// `docker ps --format`, are run as is.
+	Templates bool
+	// AllowEnv are the names of the environment variables a manual run can
+	// set, see RunParams, the other ones are rejected. None by default, since
+	// a variable like LD_PRELOAD or PATH runs any command.
+	AllowEnv []string `mapstructure:"allow-env"`
+	// AllowArgs accepts the arguments of a manual run, added to the command
+	// of the job, see RunParams. They're rejected by default.
+	AllowArgs bool `mapstructure:"allow-args"`
+	// CatchUp is the maximum lateness of a missed execution, if the scheduled
+	// time after the last execution passed while ofelia was down, the job is
+	// run once on start unless it's later than CatchUp. Zero disables it.
+	CatchUp time.Duration `mapstructure:"catch-up"`
+	// RunOnStartup runs the job once when the scheduler starts, besides its
+	// schedule. The jobs with the `@reboot` schedule are only run on start.
+	RunOnStartup bool `mapstructure:"run-on-startup"`
+	// Jitter is the maximum random delay applied to the scheduled executions,
+	// spreading the executions of jobs sharing the same schedule.
+	Jitter time.Duration
+	// HistoryLimit is the number of finished executions kept in the history,
+	// the oldest ones are dropped. By default 10.
+	HistoryLimit int `mapstructure:"history-limit"`
+	// AlertAfterFailures if set, makes the report middlewares notify only the
+	// given consecutive failure of the job, and the recovery after it. The
+	// history keeps at least as many executions.
+	AlertAfterFailures int `mapstructure:"alert-after-failures"`
+	// Priority orders the executions waiting for a free slot when the
+	// scheduler limits the concurrent jobs, the higher ones run first.
+	Priority int
+	// SuccessExitCodes are the non-zero exit codes considered a success, and
+	// WarningExitCodes the ones considered a success with a warning, e.g. the
+	// exit code 24 of rsync when files vanished during the transfer.
+	SuccessExitCodes ExitCodes `mapstructure:"success-exit-codes"`
+	WarningExitCodes ExitCodes `mapstructure:"warning-exit-codes"`
+	// MaxDurationWarning flags the executions taking longer as slow, the
+	// successful ones are also warnings, to catch the jobs slowly degrading.
+	MaxDurationWarning time.Duration `mapstructure:"max-duration-warning"`
+	// Tags group the jobs, e.g. to route the reports of the critical jobs to
+	// PagerDuty with the middleware-tags option of the global section.
+	Tags Tags
 
 	middlewareContainer
 	running int32
@@ -28,14 +102,143 @@ func (j *BareJob) GetCommand() string {
 	return j.Command
 }
 
+func (j *BareJob) GetDependsOn() []string {
+	return j.DependsOn
+}
+
+func (j *BareJob) GetTrigger() string {
+	return j.Trigger
+}
+
+func (j *BareJob) GetWatchPath() string {
+	return j.WatchPath
+}
+
+func (j *BareJob) GetWatchDebounce() time.Duration {
+	return j.WatchDebounce
+}
+
+func (j *BareJob) GetWatchExisting() bool {
+	return j.WatchExisting
+}
+
+func (j *BareJob) GetTemplates() bool {
+	return j.Templates
+}
+
+func (j *BareJob) GetAllowEnv() []string {
+	return j.AllowEnv
+}
+
+func (j *BareJob) GetAllowArgs() bool {
+	return j.AllowArgs
+}
+
+func (j *BareJob) GetCatchUp() time.Duration {
+	return j.CatchUp
+}
+
+func (j *BareJob) GetRunOnStartup() bool {
+	return j.RunOnStartup
+}
+
+func (j *BareJob) GetAlertAfterFailures() int {
+	return j.AlertAfterFailures
+}
+
+func (j *BareJob) GetPriority() int {
+	return j.Priority
+}
+
+func (j *BareJob) GetSuccessExitCodes() ExitCodes {
+	return j.SuccessExitCodes
+}
+
+func (j *BareJob) GetWarningExitCodes() ExitCodes {
+	return j.WarningExitCodes
+}
+
+func (j *BareJob) GetMaxDurationWarning() time.Duration {
+	return j.MaxDurationWarning
+}
+
+func (j *BareJob) GetTags() Tags {
+	return j.Tags
+}
+
+func (j *BareJob) GetJitter() time.Duration {
+	return j.Jitter
+}
+
+// NextJobs returns the jobs to run after the given execution of the job
+func (j *BareJob) NextJobs(e *Execution) []string {
+	switch {
+	case e.Skipped:
+		return nil
+	case e.Failed:
+		return j.OnFailure
+	default:
+		return j.OnSuccess
+	}
+}
+
+// NextRetry returns the time to wait before the given retry attempt, starting
+// at 1, and false if the job shouldn't be retried anymore.
+func (j *BareJob) NextRetry(attempt int) (time.Duration, bool) {
+	if attempt > j.Retries {
+		return 0, false
+	}
+
+	backoff := j.RetryBackoff
+	if backoff == 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	return time.Duration(float64(j.RetryDelay) * math.Pow(backoff, float64(attempt-1))), true
+}
+
 func (j *BareJob) History() []*Execution {
-	return j.history
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	h := make([]*Execution, len(j.history))
+	copy(h, j.history)
+	return h
 }
 
+// AddHistory adds the executions to the history, dropping the oldest finished
+// executions over the HistoryLimit. The running executions are always kept.
 func (j *BareJob) AddHistory(e ...*Execution) {
 	j.lock.Lock()
 	defer j.lock.Unlock()
 	j.history = append(j.history, e...)
+
+	limit := j.HistoryLimit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	if limit <= j.AlertAfterFailures {
+		limit = j.AlertAfterFailures + 1
+	}
+
+	excess := len(j.history) - limit
+	if excess <= 0 {
+		return
+	}
+
+	h := make([]*Execution, 0, limit)
+	for _, e := range j.history {
+		if excess > 0 && !e.Snapshot().IsRunning {
+			excess--
+			e.removeOutputFiles()
+			continue
+		}
+
+		h = append(h, e)
+	}
+
+	j.history = h
 }
 
 func (j *BareJob) Running() int32 {
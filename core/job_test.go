@@ -1,6 +1,10 @@
 package core
 
-import . "gopkg.in/check.v1"
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
 
 type SuiteBareJob struct{}
 
@@ -18,6 +22,26 @@ func (s *SuiteBareJob) TestGetters(c *C) {
 	c.Assert(job.GetCommand(), Equals, "qux")
 }
 
+func (s *SuiteBareJob) TestNextRetry(c *C) {
+	job := &BareJob{Retries: 3, RetryDelay: time.Second}
+
+	delay, ok := job.NextRetry(1)
+	c.Assert(ok, Equals, true)
+	c.Assert(delay, Equals, time.Second)
+
+	delay, ok = job.NextRetry(3)
+	c.Assert(ok, Equals, true)
+	c.Assert(delay, Equals, time.Second*4)
+
+	_, ok = job.NextRetry(4)
+	c.Assert(ok, Equals, false)
+
+	job.RetryBackoff = 1.5
+	delay, ok = job.NextRetry(2)
+	c.Assert(ok, Equals, true)
+	c.Assert(delay, Equals, time.Millisecond*1500)
+}
+
 func (s *SuiteBareJob) TestHistory(c *C) {
 	eA := NewExecution()
 	eB := NewExecution()
@@ -31,6 +55,59 @@ func (s *SuiteBareJob) TestHistory(c *C) {
 	c.Assert(h[1], DeepEquals, eB)
 }
 
+func (s *SuiteBareJob) TestHistoryLimit(c *C) {
+	job := &BareJob{HistoryLimit: 3}
+
+	running := NewExecution()
+	running.Start()
+	job.AddHistory(running)
+
+	var finished []*Execution
+	for i := 0; i < 4; i++ {
+		e := NewExecution()
+		finished = append(finished, e)
+		job.AddHistory(e)
+	}
+
+	h := job.History()
+	c.Assert(h, HasLen, 3)
+	c.Assert(h[0], Equals, running)
+	c.Assert(h[1], Equals, finished[2])
+	c.Assert(h[2], Equals, finished[3])
+
+	job = &BareJob{}
+	for i := 0; i < defaultHistoryLimit*2; i++ {
+		job.AddHistory(NewExecution())
+	}
+
+	c.Assert(job.History(), HasLen, defaultHistoryLimit)
+
+	job.AlertAfterFailures = defaultHistoryLimit
+	job.AddHistory(NewExecution())
+	c.Assert(job.History(), HasLen, defaultHistoryLimit+1)
+}
+
+func (s *SuiteBareJob) TestHistoryLimitConcurrentStop(c *C) {
+	job := &BareJob{HistoryLimit: 1}
+
+	running := NewExecution()
+	running.Start()
+	job.AddHistory(running)
+
+	done := make(chan struct{})
+	go func() {
+		running.Stop(nil)
+		close(done)
+	}()
+
+	for i := 0; i < 10; i++ {
+		job.AddHistory(NewExecution())
+	}
+
+	<-done
+	c.Assert(job.History(), HasLen, 1)
+}
+
 func (s *SuiteBareJob) TestNotifyStartStop(c *C) {
 	job := &BareJob{}
 
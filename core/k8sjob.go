@@ -0,0 +1,576 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gobs/args"
+)
+
+const (
+	k8sTimeout = time.Second * 30
+	// k8sWatchTimeout is the duration of every watch of a Job, renewed
+	// after k8sWatchRetry until the Job finishes
+	k8sWatchTimeout = time.Minute * 5
+	k8sWatchRetry   = time.Second
+	// k8sServiceAccountDir contains the credentials of the pods running in a
+	// cluster, used when KubeAPI is not set
+	k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// k8sPodCheckInterval is the interval of the checks of the pods of a running
+// Job, failed if they can't start
+var k8sPodCheckInterval = time.Second * 10
+
+// k8sStartFailures are the reasons of the waiting containers that don't start
+// without changing the Job or the cluster, e.g. a wrong image or a missing
+// secret, failed at once instead of waiting for max-runtime
+var k8sStartFailures = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"ErrImageNeverPull":          true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// K8sJob creates a Kubernetes Job running the command in a new pod and waits
+// for its completion, the logs of the pod are the output of the execution. The
+// Kubernetes API is called directly, by default with the service account of
+// the pod when ofelia runs inside the cluster, and the Job is watched, not
+// polled, like client-go does.
+type K8sJob struct {
+	BareJob `mapstructure:",squash"`
+	Image   string
+	// Namespace of the Kubernetes Job, by default the namespace of ofelia
+	// when it runs inside the cluster, or `default`.
+	Namespace      string
+	ServiceAccount string `mapstructure:"service-account"`
+	Environment    []string
+	// EnvSecret are added to the environment as `NAME=secret`, read on every
+	// execution from a file of /run/secrets or from Vault, see Secrets.
+	EnvSecret []string `mapstructure:"env-secret"`
+	// CPURequest, CPULimit, MemoryRequest and MemoryLimit are the resources of
+	// the container, using the Kubernetes quantities, e.g. `500m` or `256Mi`.
+	CPURequest    string `mapstructure:"cpu-request"`
+	CPULimit      string `mapstructure:"cpu-limit"`
+	MemoryRequest string `mapstructure:"memory-request"`
+	MemoryLimit   string `mapstructure:"memory-limit"`
+	// MaxRuntime is the maximum time the Kubernetes Job is allowed to run,
+	// after that it's deleted and the execution fails with ErrMaxTimeRunning.
+	MaxRuntime time.Duration `mapstructure:"max-runtime"`
+	// Delete is the delete policy of the Kubernetes Job once finished, the
+	// same as the one of the RunJob containers.
+	Delete DeletePolicy `default:"true"`
+	// KubeAPI is the URL of the Kubernetes API server, authenticated with the
+	// bearer token KubeToken and verified with the CA certificate file
+	// KubeCA. By default the service account of the pod is used.
+	KubeAPI   string `mapstructure:"kube-api"`
+	KubeToken string `mapstructure:"kube-token"`
+	KubeCA    string `mapstructure:"kube-ca"`
+	// KubeConfig is the path of a kubeconfig file, its current context is used
+	// instead of KubeAPI, see loadKubeConfig.
+	KubeConfig string `mapstructure:"kube-config"`
+}
+
+func NewK8sJob() *K8sJob {
+	return &K8sJob{}
+}
+
+// GetEnvironment returns the environment of the job
+func (j *K8sJob) GetEnvironment() []string {
+	return j.Environment
+}
+
+func (j *K8sJob) Run(ctx *Context) error {
+	c, err := j.buildClient()
+	if err != nil {
+		return err
+	}
+
+	ns := j.Namespace
+	if ns == "" {
+		ns = c.namespace
+	}
+
+	manifest, err := j.buildJob(ctx)
+	if err != nil {
+		return err
+	}
+
+	var job k8sObject
+	if err := c.do("POST", "/apis/batch/v1/namespaces/"+ns+"/jobs", manifest, &job); err != nil {
+		return fmt.Errorf("error creating kubernetes job: %s", err)
+	}
+
+	name := job.Metadata.Name
+	ctx.Logger.Noticef("Created kubernetes job %s/%s", ns, name)
+
+	succeeded, err := j.watchJob(ctx.Execution, c, ns, name)
+	if err == nil {
+		var code int
+		code, err = j.fetchLogs(ctx.Execution, c, ns, name)
+		switch {
+		case err != nil:
+			err = fmt.Errorf("error fetching logs of kubernetes job: %s", err)
+		case code != 0:
+			err = &ExitCodeError{ExitCode: code}
+		case !succeeded:
+			err = fmt.Errorf("kubernetes job %s/%s failed", ns, name)
+		}
+	}
+
+	del, derr := shouldDelete(j.Delete, ctx.isFailure(err))
+	if derr != nil && err == nil {
+		err = derr
+	}
+
+	// the jobs still running are always deleted
+	_, stuck := err.(*k8sStartError)
+	if del || stuck || err == ErrMaxTimeRunning || err == ErrCanceledExecution {
+		body := map[string]string{"propagationPolicy": "Background"}
+		if derr := c.do("DELETE", "/apis/batch/v1/namespaces/"+ns+"/jobs/"+name, body, nil); derr != nil {
+			ctx.Logger.Warningf("Error deleting kubernetes job %s/%s: %s", ns, name, derr)
+		}
+	}
+
+	return err
+}
+
+// watchJob watches the Kubernetes Job until it finishes and returns if it
+// succeeded, its pods are checked meanwhile to fail if they can't start
+func (j *K8sJob) watchJob(e *Execution, c *k8sClient, ns, name string) (bool, error) {
+	maxRuntime := j.MaxRuntime
+	if maxRuntime == 0 {
+		maxRuntime = maxProcessDuration
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type result struct {
+		succeeded bool
+		err       error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		succeeded, err := c.watchJob(ctx, ns, name)
+		done <- result{succeeded, err}
+	}()
+
+	ticker := time.NewTicker(k8sPodCheckInterval)
+	defer ticker.Stop()
+
+	timeout := time.After(maxRuntime)
+	for {
+		select {
+		case r := <-done:
+			if r.err != nil {
+				return false, fmt.Errorf("error watching kubernetes job: %s", r.err)
+			}
+
+			return r.succeeded, nil
+		case <-e.Done():
+			return false, ErrCanceledExecution
+		case <-timeout:
+			return false, ErrMaxTimeRunning
+		case <-ticker.C:
+			if err := checkPods(c, ns, name); err != nil {
+				return false, err
+			}
+		}
+	}
+}
+
+// checkPods returns a k8sStartError if a container of the pods of the job is
+// waiting for one of k8sStartFailures. The errors listing the pods are
+// ignored, the watch of the job fails if the API does.
+func checkPods(c *k8sClient, ns, name string) error {
+	pods, err := c.listPods(ns, name)
+	if err != nil {
+		return nil
+	}
+
+	for _, pod := range pods {
+		statuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+		for _, s := range statuses {
+			if w := s.State.Waiting; w != nil && k8sStartFailures[w.Reason] {
+				return &k8sStartError{Pod: pod.Metadata.Name, Reason: w.Reason, Message: w.Message}
+			}
+		}
+	}
+
+	return nil
+}
+
+// k8sStartError is the error of a pod of a Job that can't start
+type k8sStartError struct {
+	Pod     string
+	Reason  string
+	Message string
+}
+
+func (e *k8sStartError) Error() string {
+	msg := fmt.Sprintf("pod %s can't start: %s", e.Pod, e.Reason)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+
+	return msg
+}
+
+// fetchLogs writes the logs of the pod of the job to the output of the
+// execution and returns the exit code of its container
+func (j *K8sJob) fetchLogs(e *Execution, c *k8sClient, ns, name string) (int, error) {
+	pods, err := c.listPods(ns, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(pods) == 0 {
+		return 0, fmt.Errorf("no pods found")
+	}
+
+	var code int
+	pod := pods[len(pods)-1]
+	for _, s := range pod.Status.ContainerStatuses {
+		if t := s.State.Terminated; t != nil && t.ExitCode != 0 {
+			code = t.ExitCode
+		}
+	}
+
+	return code, c.do("GET", "/api/v1/namespaces/"+ns+"/pods/"+pod.Metadata.Name+"/log", nil, e.OutputStream)
+}
+
+func (j *K8sJob) buildJob(ctx *Context) (interface{}, error) {
+	command, err := ctx.RenderCommand(j.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	environment, err := buildEnvironment(ctx, j.Environment, j.EnvSecret, true)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := map[string]map[string]string{}
+	setResource := func(kind, name, value string) {
+		if value == "" {
+			return
+		}
+
+		if resources[kind] == nil {
+			resources[kind] = make(map[string]string)
+		}
+
+		resources[kind][name] = value
+	}
+
+	setResource("requests", "cpu", j.CPURequest)
+	setResource("requests", "memory", j.MemoryRequest)
+	setResource("limits", "cpu", j.CPULimit)
+	setResource("limits", "memory", j.MemoryLimit)
+
+	var env []map[string]string
+	for _, v := range environment {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) == 1 {
+			parts = append(parts, "")
+		}
+
+		env = append(env, map[string]string{"name": parts[0], "value": parts[1]})
+	}
+
+	container := map[string]interface{}{
+		"name":      "job",
+		"image":     j.Image,
+		"env":       env,
+		"resources": resources,
+	}
+
+	if command != "" {
+		container["args"] = args.GetArgs(command)
+	}
+
+	return map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"generateName": k8sName(j.Name),
+			"labels":       map[string]string{"app.kubernetes.io/managed-by": "ofelia"},
+		},
+		"spec": map[string]interface{}{
+			"backoffLimit": 0,
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"restartPolicy":      "Never",
+					"serviceAccountName": j.ServiceAccount,
+					"containers":         []interface{}{container},
+				},
+			},
+		},
+	}, nil
+}
+
+var k8sInvalidChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// k8sName returns the prefix of the name of the Kubernetes Jobs, a valid DNS
+// label with room for the random suffix
+func k8sName(job string) string {
+	name := k8sInvalidChars.ReplaceAllString(strings.ToLower(job), "-")
+	if len(name) > 40 {
+		name = name[:40]
+	}
+
+	return "ofelia-" + strings.Trim(name, "-") + "-"
+}
+
+// buildClient returns a client of the Kubernetes API with the credentials of
+// KubeConfig, KubeAPI or the service account, in that order, its namespace is
+// the one of the credentials.
+func (j *K8sJob) buildClient() (*k8sClient, error) {
+	c := &k8sClient{url: j.KubeAPI, token: j.KubeToken, namespace: "default"}
+	ca := j.KubeCA
+
+	var tlsConfig *tls.Config
+	switch {
+	case j.KubeConfig != "":
+		kc, err := loadKubeConfig(j.KubeConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error reading kubeconfig: %s", err)
+		}
+
+		c.url, c.token, tlsConfig = kc.server, kc.token, kc.tls
+		if kc.namespace != "" {
+			c.namespace = kc.namespace
+		}
+	case c.url == "":
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" {
+			return nil, fmt.Errorf("kube-api is required when running outside of kubernetes")
+		}
+
+		token, err := ioutil.ReadFile(k8sServiceAccountDir + "/token")
+		if err != nil {
+			return nil, fmt.Errorf("error reading service account token: %s", err)
+		}
+
+		ns, err := ioutil.ReadFile(k8sServiceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("error reading namespace: %s", err)
+		}
+
+		c.url = "https://" + net.JoinHostPort(host, port)
+		c.token = strings.TrimSpace(string(token))
+		c.namespace = strings.TrimSpace(string(ns))
+		ca = k8sServiceAccountDir + "/ca.crt"
+	}
+
+	if ca != "" && tlsConfig == nil {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA certificate: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("invalid CA certificate %q", ca)
+		}
+
+		tlsConfig = &tls.Config{RootCAs: pool}
+	}
+
+	transport := http.DefaultTransport
+	if tlsConfig != nil {
+		transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		}
+	}
+
+	c.client = &http.Client{Transport: transport, Timeout: k8sTimeout}
+	c.watchClient = &http.Client{Transport: transport}
+	return c, nil
+}
+
+// k8sClient is a minimal client of the Kubernetes REST API, the watches use
+// watchClient, without timeout since they're long requests
+type k8sClient struct {
+	url         string
+	token       string
+	namespace   string
+	client      *http.Client
+	watchClient *http.Client
+}
+
+// k8sEvent is an event of a watch, the object is a Status if it's an error
+type k8sEvent struct {
+	Type   string    `json:"type"`
+	Object k8sObject `json:"object"`
+}
+
+// k8sObject contains the fields used of the Jobs, the Pods and the Status of
+// the errors
+type k8sObject struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Message string `json:"message"`
+	Status  struct {
+		Succeeded             int                  `json:"succeeded"`
+		Failed                int                  `json:"failed"`
+		InitContainerStatuses []k8sContainerStatus `json:"initContainerStatuses"`
+		ContainerStatuses     []k8sContainerStatus `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+type k8sContainerStatus struct {
+	State struct {
+		Waiting *struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"waiting"`
+		Terminated *struct {
+			ExitCode int `json:"exitCode"`
+		} `json:"terminated"`
+	} `json:"state"`
+}
+
+// watchJob watches the Job until it finishes, or the context is done, and
+// returns if it succeeded. The first event of every watch is the current state
+// of the Job, so the watch is renewed without missing its end.
+func (c *k8sClient) watchJob(ctx context.Context, ns, name string) (bool, error) {
+	q := url.Values{
+		"watch":          {"true"},
+		"fieldSelector":  {"metadata.name=" + name},
+		"timeoutSeconds": {fmt.Sprint(int(k8sWatchTimeout.Seconds()))},
+	}
+
+	path := "/apis/batch/v1/namespaces/" + ns + "/jobs?" + q.Encode()
+	for {
+		resp, err := c.send(ctx, c.watchClient, "GET", path, nil)
+		if err != nil {
+			return false, err
+		}
+
+		d := json.NewDecoder(resp.Body)
+		for {
+			var ev k8sEvent
+			if err = d.Decode(&ev); err != nil {
+				break
+			}
+
+			switch {
+			case ev.Type == "ERROR":
+				resp.Body.Close()
+				return false, errors.New(ev.Object.Message)
+			case ev.Type == "DELETED":
+				resp.Body.Close()
+				return false, fmt.Errorf("kubernetes job %s/%s was deleted", ns, name)
+			case ev.Object.Status.Succeeded > 0 || ev.Object.Status.Failed > 0:
+				resp.Body.Close()
+				return ev.Object.Status.Succeeded > 0, nil
+			}
+		}
+
+		resp.Body.Close()
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			return false, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(k8sWatchRetry):
+		}
+	}
+}
+
+// listPods returns the pods of the job
+func (c *k8sClient) listPods(ns, job string) ([]k8sObject, error) {
+	var pods struct {
+		Items []k8sObject `json:"items"`
+	}
+
+	q := url.Values{"labelSelector": {"job-name=" + job}}
+	if err := c.do("GET", "/api/v1/namespaces/"+ns+"/pods?"+q.Encode(), nil, &pods); err != nil {
+		return nil, err
+	}
+
+	return pods.Items, nil
+}
+
+// do sends the request with body encoded as JSON, the response is decoded into
+// out, or copied if it's a writer.
+func (c *k8sClient) do(method, path string, body, out interface{}) error {
+	resp, err := c.send(context.Background(), c.client, method, path, body)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case io.Writer:
+		_, err = io.Copy(out, resp.Body)
+		return err
+	default:
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+}
+
+// send sends the request with body encoded as JSON and returns the response,
+// or an error with the message of the API if it failed
+func (c *k8sClient) send(ctx context.Context, client *http.Client, method, path string, body interface{}) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.url, "/")+path, r)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+
+		var status k8sObject
+		json.NewDecoder(resp.Body).Decode(&status)
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, status.Message)
+	}
+
+	return resp, nil
+}
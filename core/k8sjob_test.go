@@ -0,0 +1,263 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteK8sJob struct {
+	server  *httptest.Server
+	job     map[string]interface{}
+	status  string
+	code    int
+	waiting string
+	delete  bool
+}
+
+var _ = Suite(&SuiteK8sJob{})
+
+func (s *SuiteK8sJob) SetUpTest(c *C) {
+	s.job, s.status, s.code, s.waiting, s.delete = nil, "succeeded", 0, "", false
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/apis/batch/v1/namespaces/foo/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			s.watch(w, r)
+			return
+		}
+
+		c.Assert(r.Method, Equals, "POST")
+		c.Assert(r.Header.Get("Authorization"), Equals, "Bearer qux")
+		c.Assert(json.NewDecoder(r.Body).Decode(&s.job), IsNil)
+		fmt.Fprint(w, `{"metadata":{"name":"ofelia-bar-x1"}}`)
+	})
+
+	mux.HandleFunc("/apis/batch/v1/namespaces/foo/jobs/ofelia-bar-x1", func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, Equals, "DELETE")
+		s.delete = true
+	})
+
+	mux.HandleFunc("/api/v1/namespaces/foo/pods", func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Query().Get("labelSelector"), Equals, "job-name=ofelia-bar-x1")
+		if s.waiting != "" {
+			fmt.Fprintf(w, `{"items":[{"metadata":{"name":"pod-1"},"status":{"containerStatuses":[{"state":{"waiting":{"reason":%q,"message":"Back-off pulling image"}}}]}}]}`, s.waiting)
+			return
+		}
+
+		fmt.Fprintf(w, `{"items":[{"metadata":{"name":"pod-1"},"status":{"containerStatuses":[{"state":{"terminated":{"exitCode":%d}}}]}}]}`, s.code)
+	})
+
+	mux.HandleFunc("/api/v1/namespaces/foo/pods/pod-1/log", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "foo bar\n")
+	})
+
+	s.server = httptest.NewServer(mux)
+}
+
+func (s *SuiteK8sJob) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+// watch writes the events of a watch of the job, the job is active and then
+// it has the status of the test, or it stays active until the watch is closed
+func (s *SuiteK8sJob) watch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("watch") != "true" || q.Get("fieldSelector") != "metadata.name=ofelia-bar-x1" {
+		http.Error(w, `{"message":"unexpected watch"}`, http.StatusBadRequest)
+		return
+	}
+
+	fmt.Fprint(w, `{"type":"ADDED","object":{"status":{"active":1}}}`+"\n")
+	w.(http.Flusher).Flush()
+
+	if s.status == "active" {
+		<-r.Context().Done()
+		return
+	}
+
+	fmt.Fprintf(w, `{"type":"MODIFIED","object":{"status":{%q:1}}}`+"\n", s.status)
+}
+
+func (s *SuiteK8sJob) buildJob() *K8sJob {
+	job := &K8sJob{KubeAPI: s.server.URL, KubeToken: "qux", Namespace: "foo"}
+	job.Name = "Bar"
+	job.Image = "busybox"
+	job.Command = `echo "foo bar"`
+	job.Environment = []string{"FOO=foo"}
+	job.MemoryLimit = "256Mi"
+
+	return job
+}
+
+func (s *SuiteK8sJob) TestRun(c *C) {
+	e := NewExecution()
+	err := s.buildJob().Run(&Context{Execution: e, Logger: &TestLogger{}})
+	c.Assert(err, IsNil)
+	c.Assert(string(e.Output()), Equals, "foo bar\n")
+	c.Assert(s.delete, Equals, true)
+
+	c.Assert(s.job["metadata"].(map[string]interface{})["generateName"], Equals, "ofelia-bar-")
+	spec := s.job["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	c.Assert(spec["restartPolicy"], Equals, "Never")
+
+	container := spec["containers"].([]interface{})[0].(map[string]interface{})
+	c.Assert(container["image"], Equals, "busybox")
+	c.Assert(container["args"], DeepEquals, []interface{}{"echo", "foo bar"})
+	c.Assert(container["env"], DeepEquals, []interface{}{
+		map[string]interface{}{"name": "OFELIA_EXECUTION_ID", "value": e.ID},
+		map[string]interface{}{"name": "FOO", "value": "foo"},
+	})
+	c.Assert(container["resources"], DeepEquals, map[string]interface{}{
+		"limits": map[string]interface{}{"memory": "256Mi"},
+	})
+}
+
+func (s *SuiteK8sJob) TestRunFailed(c *C) {
+	s.status, s.code = "failed", 3
+
+	job := s.buildJob()
+	job.Delete = DeleteNever
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}, Job: job})
+	c.Assert(err, DeepEquals, &ExitCodeError{ExitCode: 3})
+	c.Assert(s.delete, Equals, false)
+}
+
+func (s *SuiteK8sJob) TestRunSuccessExitCode(c *C) {
+	s.status, s.code = "failed", 3
+
+	job := s.buildJob()
+	job.Delete = DeleteOnSuccess
+	job.SuccessExitCodes = ExitCodes{0, 3}
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}, Job: job})
+	c.Assert(err, DeepEquals, &ExitCodeError{ExitCode: 3})
+	c.Assert(s.delete, Equals, true)
+}
+
+func (s *SuiteK8sJob) TestRunMaxRuntime(c *C) {
+	s.status = "active"
+
+	job := s.buildJob()
+	job.Delete = DeleteNever
+	job.MaxRuntime = time.Millisecond * 100
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, Equals, ErrMaxTimeRunning)
+	c.Assert(s.delete, Equals, true)
+}
+
+func (s *SuiteK8sJob) TestRunStartFailure(c *C) {
+	defer func(interval time.Duration) { k8sPodCheckInterval = interval }(k8sPodCheckInterval)
+	k8sPodCheckInterval = time.Millisecond * 50
+	s.status, s.waiting = "active", "ImagePullBackOff"
+
+	job := s.buildJob()
+	job.Delete = DeleteNever
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}, Job: job})
+	c.Assert(err, ErrorMatches, "pod pod-1 can't start: ImagePullBackOff: Back-off pulling image")
+	c.Assert(s.delete, Equals, true)
+}
+
+func (s *SuiteK8sJob) TestRunPendingPod(c *C) {
+	defer func(interval time.Duration) { k8sPodCheckInterval = interval }(k8sPodCheckInterval)
+	k8sPodCheckInterval = time.Millisecond * 20
+	s.status, s.waiting = "active", "ContainerCreating"
+
+	job := s.buildJob()
+	job.MaxRuntime = time.Millisecond * 200
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}, Job: job})
+	c.Assert(err, Equals, ErrMaxTimeRunning)
+}
+
+func (s *SuiteK8sJob) TestRunKubeConfig(c *C) {
+	server := httptest.NewTLSServer(s.server.Config.Handler)
+	defer server.Close()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	dir := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "token"), []byte("qux\n"), 0600), IsNil)
+
+	config := filepath.Join(dir, "config")
+	c.Assert(ioutil.WriteFile(config, []byte(fmt.Sprintf(`
+apiVersion: v1
+kind: Config
+current-context: prod
+contexts:
+- name: dev
+  context: {cluster: dev, user: dev}
+- name: prod
+  context: {cluster: prod, user: ofelia, namespace: foo}
+clusters:
+- name: prod
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+users:
+- name: ofelia
+  user:
+    tokenFile: token
+`, server.URL, base64.StdEncoding.EncodeToString(ca))), 0600), IsNil)
+
+	job := s.buildJob()
+	job.KubeAPI, job.KubeToken, job.Namespace = "", "", ""
+	job.KubeConfig = config
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e, Logger: &TestLogger{}, Job: job})
+	c.Assert(err, IsNil)
+	c.Assert(string(e.Output()), Equals, "foo bar\n")
+}
+
+func (s *SuiteK8sJob) TestWatchJobRenewed(c *C) {
+	var watches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		watches++
+		status := "active"
+		if watches == 2 {
+			status = "succeeded"
+		}
+
+		fmt.Fprintf(w, `{"type":"ADDED","object":{"status":{%q:1}}}`+"\n", status)
+	}))
+	defer server.Close()
+
+	job := &K8sJob{KubeAPI: server.URL}
+	client, err := job.buildClient()
+	c.Assert(err, IsNil)
+
+	succeeded, err := job.watchJob(NewExecution(), client, "foo", "bar")
+	c.Assert(err, IsNil)
+	c.Assert(succeeded, Equals, true)
+	c.Assert(watches, Equals, 2)
+}
+
+func (s *SuiteK8sJob) TestWatchJobError(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type":"ERROR","object":{"message":"too old resource version"}}`+"\n")
+	}))
+	defer server.Close()
+
+	job := &K8sJob{KubeAPI: server.URL}
+	client, err := job.buildClient()
+	c.Assert(err, IsNil)
+
+	_, err = job.watchJob(NewExecution(), client, "foo", "bar")
+	c.Assert(err, ErrorMatches, "error watching kubernetes job: too old resource version")
+}
+
+func (s *SuiteK8sJob) TestK8sName(c *C) {
+	c.Assert(k8sName("Foo_Bar.baz"), Equals, "ofelia-foo-bar-baz-")
+	c.Assert(len(k8sName("a-very-long-name-of-a-job-with-more-than-forty-chars")), Equals, 48)
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// kubeConfig contains the fields used of a kubeconfig file, the configuration
+// of kubectl
+type kubeConfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string      `yaml:"token"`
+			TokenFile             string      `yaml:"tokenFile"`
+			ClientCertificate     string      `yaml:"client-certificate"`
+			ClientCertificateData string      `yaml:"client-certificate-data"`
+			ClientKey             string      `yaml:"client-key"`
+			ClientKeyData         string      `yaml:"client-key-data"`
+			Exec                  interface{} `yaml:"exec"`
+			AuthProvider          interface{} `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// kubeContext is the API server, the credentials and the namespace of a
+// context of a kubeconfig file
+type kubeContext struct {
+	server    string
+	token     string
+	namespace string
+	tls       *tls.Config
+}
+
+// loadKubeConfig reads the current context of a kubeconfig file. The users
+// authenticated with a token, a token file or a client certificate are
+// supported, not the ones of the exec and auth-provider plugins, e.g. the
+// cloud providers, which require a service account token instead. The relative
+// paths are relative to the file.
+func loadKubeConfig(path string) (*kubeContext, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var kc kubeConfig
+	if err := yaml.Unmarshal(content, &kc); err != nil {
+		return nil, err
+	}
+
+	if kc.CurrentContext == "" {
+		return nil, errors.New("missing current-context")
+	}
+
+	dir := filepath.Dir(path)
+	read := func(data, file string) ([]byte, error) {
+		if data != "" {
+			return base64.StdEncoding.DecodeString(data)
+		}
+
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+
+		return ioutil.ReadFile(file)
+	}
+
+	for _, ctx := range kc.Contexts {
+		if ctx.Name != kc.CurrentContext {
+			continue
+		}
+
+		c := &kubeContext{namespace: ctx.Context.Namespace, tls: &tls.Config{}}
+		found := false
+		for _, cl := range kc.Clusters {
+			if cl.Name != ctx.Context.Cluster {
+				continue
+			}
+
+			found = true
+			c.server = cl.Cluster.Server
+			c.tls.InsecureSkipVerify = cl.Cluster.InsecureSkipTLSVerify
+			if cl.Cluster.CertificateAuthorityData == "" && cl.Cluster.CertificateAuthority == "" {
+				break
+			}
+
+			pem, err := read(cl.Cluster.CertificateAuthorityData, cl.Cluster.CertificateAuthority)
+			if err != nil {
+				return nil, fmt.Errorf("error reading CA certificate of cluster %q: %s", cl.Name, err)
+			}
+
+			c.tls.RootCAs = x509.NewCertPool()
+			if !c.tls.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("invalid CA certificate of cluster %q", cl.Name)
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("cluster %q not found", ctx.Context.Cluster)
+		}
+
+		for _, u := range kc.Users {
+			if u.Name != ctx.Context.User {
+				continue
+			}
+
+			if u.User.Exec != nil || u.User.AuthProvider != nil {
+				return nil, fmt.Errorf("the plugins of user %q aren't supported", u.Name)
+			}
+
+			c.token = u.User.Token
+			if u.User.TokenFile != "" {
+				token, err := read("", u.User.TokenFile)
+				if err != nil {
+					return nil, fmt.Errorf("error reading token of user %q: %s", u.Name, err)
+				}
+
+				c.token = strings.TrimSpace(string(token))
+			}
+
+			if u.User.ClientCertificateData == "" && u.User.ClientCertificate == "" {
+				break
+			}
+
+			cert, err := read(u.User.ClientCertificateData, u.User.ClientCertificate)
+			if err != nil {
+				return nil, fmt.Errorf("error reading client certificate of user %q: %s", u.Name, err)
+			}
+
+			key, err := read(u.User.ClientKeyData, u.User.ClientKey)
+			if err != nil {
+				return nil, fmt.Errorf("error reading client key of user %q: %s", u.Name, err)
+			}
+
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid client certificate of user %q: %s", u.Name, err)
+			}
+
+			c.tls.Certificates = []tls.Certificate{pair}
+		}
+
+		return c, nil
+	}
+
+	return nil, fmt.Errorf("context %q not found", kc.CurrentContext)
+}
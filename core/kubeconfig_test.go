@@ -0,0 +1,53 @@
+package core
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteKubeConfig struct{}
+
+var _ = Suite(&SuiteKubeConfig{})
+
+func (s *SuiteKubeConfig) TestLoadKubeConfig(c *C) {
+	dir := c.MkDir()
+	config := filepath.Join(dir, "config")
+	for content, expected := range map[string]string{
+		`current-context: foo`: `context "foo" not found`,
+		`
+current-context: foo
+contexts:
+- {name: foo, context: {cluster: foo, user: foo}}`: `cluster "foo" not found`,
+		`
+current-context: foo
+contexts:
+- {name: foo, context: {cluster: foo, user: foo}}
+clusters:
+- {name: foo, cluster: {server: "https://foo"}}
+users:
+- {name: foo, user: {exec: {command: aws}}}`: `the plugins of user "foo" aren't supported`,
+		`clusters: []`: `missing current-context`,
+	} {
+		c.Assert(ioutil.WriteFile(config, []byte(content), 0600), IsNil)
+		_, err := loadKubeConfig(config)
+		c.Assert(err, ErrorMatches, expected)
+	}
+
+	c.Assert(ioutil.WriteFile(config, []byte(`
+current-context: foo
+contexts:
+- {name: foo, context: {cluster: foo, user: foo}}
+clusters:
+- {name: foo, cluster: {server: "https://foo", insecure-skip-tls-verify: true}}
+users:
+- {name: foo, user: {token: bar}}`), 0600), IsNil)
+
+	kc, err := loadKubeConfig(config)
+	c.Assert(err, IsNil)
+	c.Assert(kc.server, Equals, "https://foo")
+	c.Assert(kc.token, Equals, "bar")
+	c.Assert(kc.namespace, Equals, "")
+	c.Assert(kc.tls.InsecureSkipVerify, Equals, true)
+}
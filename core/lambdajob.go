@@ -0,0 +1,144 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// lambdaTimeout is the maximum time waited for the response of a function,
+// longer than the maximum timeout of the functions
+const lambdaTimeout = time.Minute * 16
+
+// LambdaJob invokes an AWS Lambda function with a payload, the response of
+// the function is written to the output of the execution and the errors of
+// the function fail the execution.
+type LambdaJob struct {
+	BareJob   `mapstructure:",squash"`
+	AWSConfig `mapstructure:",squash"`
+	// Function is the name or the ARN of the function, and Qualifier its
+	// version or alias, by default `$LATEST`.
+	Function  string
+	Qualifier string
+	// Payload is the JSON event the function is invoked with, it can use the
+	// templates of the commands, e.g. `{"date": "{{.Date "2006-01-02"}}"}`.
+	Payload string
+	// Async invokes the function asynchronously, the execution succeeds once
+	// the event is queued, without waiting for the function.
+	Async bool
+}
+
+func NewLambdaJob() *LambdaJob {
+	return &LambdaJob{}
+}
+
+// GetCommand returns the function invoked
+func (j *LambdaJob) GetCommand() string {
+	if j.Qualifier != "" {
+		return j.Function + ":" + j.Qualifier
+	}
+
+	return j.Function
+}
+
+func (j *LambdaJob) Run(ctx *Context) error {
+	c, err := j.buildClient()
+	if err != nil {
+		return err
+	}
+
+	c.client.Timeout = lambdaTimeout
+
+	req, err := j.buildRequest(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	cctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-ctx.Execution.Done():
+			cancel()
+		case <-cctx.Done():
+		}
+	}()
+
+	resp, err := c.client.Do(req.WithContext(cctx))
+	if ctx.Execution.IsCanceled() {
+		return ErrCanceledExecution
+	}
+
+	if err != nil {
+		return fmt.Errorf("error invoking function %q: %s", j.Function, err)
+	}
+
+	defer resp.Body.Close()
+	payload, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %s", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("error invoking function %q: %s", j.Function, awsError(resp.StatusCode, payload))
+	}
+
+	// the last 4 KB of the logs of the synchronous invocations
+	if logs := resp.Header.Get("X-Amz-Log-Result"); logs != "" {
+		if b, err := base64.StdEncoding.DecodeString(logs); err == nil {
+			ctx.Execution.ErrorStream.Write(b)
+		}
+	}
+
+	ctx.Execution.OutputStream.Write(payload)
+
+	if kind := resp.Header.Get("X-Amz-Function-Error"); kind != "" {
+		var e struct {
+			ErrorType    string `json:"errorType"`
+			ErrorMessage string `json:"errorMessage"`
+		}
+
+		if json.Unmarshal(payload, &e) != nil || e.ErrorMessage == "" {
+			return fmt.Errorf("function error: %s", kind)
+		}
+
+		return fmt.Errorf("function error: %s: %s", e.ErrorType, e.ErrorMessage)
+	}
+
+	return nil
+}
+
+func (j *LambdaJob) buildRequest(ctx *Context, c *awsClient) (*http.Request, error) {
+	payload, err := ctx.Render(j.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	u := c.url("lambda") + "/2015-03-31/functions/" + awsEscape(j.Function) + "/invocations"
+	if j.Qualifier != "" {
+		u += "?" + url.Values{"Qualifier": {j.Qualifier}}.Encode()
+	}
+
+	body := []byte(payload)
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error building request: %s", err)
+	}
+
+	if j.Async {
+		req.Header.Set("X-Amz-Invocation-Type", "Event")
+	} else {
+		req.Header.Set("X-Amz-Invocation-Type", "RequestResponse")
+		req.Header.Set("X-Amz-Log-Type", "Tail")
+	}
+
+	c.sign(req, "lambda", body, time.Now())
+	return req, nil
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteLambdaJob struct {
+	server  *httptest.Server
+	request *http.Request
+	payload string
+}
+
+var _ = Suite(&SuiteLambdaJob{})
+
+func (s *SuiteLambdaJob) SetUpTest(c *C) {
+	s.request, s.payload = nil, ""
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.request, s.payload = r, string(body)
+
+		switch r.URL.EscapedPath() {
+		case "/2015-03-31/functions/report/invocations":
+			if r.Header.Get("X-Amz-Invocation-Type") == "Event" {
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+
+			w.Header().Set("X-Amz-Log-Result", base64.StdEncoding.EncodeToString([]byte("START RequestId: 1\nEND RequestId: 1\n")))
+			fmt.Fprint(w, `{"rows":42}`)
+		case "/2015-03-31/functions/fail/invocations":
+			w.Header().Set("X-Amz-Function-Error", "Unhandled")
+			fmt.Fprint(w, `{"errorType":"ValueError","errorMessage":"invalid date"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"Type":"User","message":"Function not found"}`)
+		}
+	}))
+}
+
+func (s *SuiteLambdaJob) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *SuiteLambdaJob) buildJob(function string) *LambdaJob {
+	job := &LambdaJob{AWSConfig: AWSConfig{
+		AWSRegion:          "eu-west-1",
+		AWSAccessKeyID:     "foo",
+		AWSSecretAccessKey: "bar",
+		AWSEndpoint:        s.server.URL,
+	}}
+
+	job.Name = "report"
+	job.Function = function
+	job.Payload = `{"job": "{{.JobName}}"}`
+	job.Templates = true
+
+	return job
+}
+
+func (s *SuiteLambdaJob) TestRun(c *C) {
+	job := s.buildJob("report")
+	job.Qualifier = "live"
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e, Job: job, Logger: &TestLogger{}})
+	c.Assert(err, IsNil)
+	c.Assert(string(e.Output()), Equals, `{"rows":42}`)
+	c.Assert(string(e.ErrorOutput()), Equals, "START RequestId: 1\nEND RequestId: 1\n")
+	c.Assert(job.GetCommand(), Equals, "report:live")
+
+	c.Assert(s.payload, Equals, `{"job": "report"}`)
+	c.Assert(s.request.URL.Query().Get("Qualifier"), Equals, "live")
+	c.Assert(s.request.Header.Get("X-Amz-Invocation-Type"), Equals, "RequestResponse")
+	c.Assert(s.request.Header.Get("Authorization"), Matches, "AWS4-HMAC-SHA256 Credential=foo/.*/eu-west-1/lambda/aws4_request, .*")
+}
+
+func (s *SuiteLambdaJob) TestRunAsync(c *C) {
+	job := s.buildJob("report")
+	job.Async = true
+
+	e := NewExecution()
+	c.Assert(job.Run(&Context{Execution: e, Job: job, Logger: &TestLogger{}}), IsNil)
+	c.Assert(s.request.Header.Get("X-Amz-Invocation-Type"), Equals, "Event")
+	c.Assert(e.Output(), HasLen, 0)
+}
+
+func (s *SuiteLambdaJob) TestRunFunctionError(c *C) {
+	job := s.buildJob("fail")
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e, Job: job, Logger: &TestLogger{}})
+	c.Assert(err, ErrorMatches, "function error: ValueError: invalid date")
+	c.Assert(string(e.Output()), Equals, `{"errorType":"ValueError","errorMessage":"invalid date"}`)
+}
+
+func (s *SuiteLambdaJob) TestRunNotFound(c *C) {
+	job := s.buildJob("arn:aws:lambda:eu-west-1:123456789012:function:qux")
+
+	err := job.Run(&Context{Execution: NewExecution(), Job: job, Logger: &TestLogger{}})
+	c.Assert(err, ErrorMatches, `error invoking function ".*:qux": Function not found`)
+	c.Assert(s.request.URL.EscapedPath(), Equals, "/2015-03-31/functions/arn%3Aaws%3Alambda%3Aeu-west-1%3A123456789012%3Afunction%3Aqux/invocations")
+}
+
+func (s *SuiteLambdaJob) TestRunCanceled(c *C) {
+	s.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 200)
+	})
+
+	e := NewExecution()
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		e.Cancel()
+	}()
+
+	job := s.buildJob("report")
+	c.Assert(job.Run(&Context{Execution: e, Job: job, Logger: &TestLogger{}}), Equals, ErrCanceledExecution)
+}
@@ -1,43 +1,104 @@
 package core
 
 import (
+	"os"
 	"os/exec"
+	"syscall"
 
 	"github.com/gobs/args"
 )
 
 type LocalJob struct {
-	BareJob     `mapstructure:",squash"`
-	Dir         string
+	BareJob `mapstructure:",squash"`
+	Dir     string
+	// Environment are added to the environment of ofelia, as `NAME=value`
 	Environment []string
+	// EnvSecret are added to the environment as `NAME=secret`, read on every
+	// execution from a file of /run/secrets or from Vault, see Secrets.
+	EnvSecret []string `mapstructure:"env-secret"`
+	// Shell runs the command with `<shell> -c <command>`, e.g. /bin/sh, instead
+	// of executing it directly.
+	Shell string
 }
 
 func NewLocalJob() *LocalJob {
 	return &LocalJob{}
 }
 
+// GetEnvironment returns the environment of the job
+func (j *LocalJob) GetEnvironment() []string {
+	return j.Environment
+}
+
 func (j *LocalJob) Run(ctx *Context) error {
 	cmd, err := j.buildCommand(ctx)
 	if err != nil {
 		return err
 	}
 
-	return cmd.Run()
+	return runCommand(ctx, cmd)
+}
+
+// runCommand runs the command until it exits, or kills it if the execution is
+// canceled
+func runCommand(ctx *Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if e, ok := err.(*exec.ExitError); ok {
+			if status, ok := e.Sys().(syscall.WaitStatus); ok && status.Exited() {
+				return &ExitCodeError{ExitCode: status.ExitStatus()}
+			}
+		}
+
+		return err
+	case <-ctx.Execution.Done():
+		cmd.Process.Kill()
+		<-done
+		return ErrCanceledExecution
+	}
 }
 
 func (j *LocalJob) buildCommand(ctx *Context) (*exec.Cmd, error) {
-	args := args.GetArgs(j.Command)
+	command, err := ctx.RenderCommand(j.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	environment, err := buildEnvironment(ctx, j.Environment, j.EnvSecret, true)
+	if err != nil {
+		return nil, err
+	}
+
+	args := args.GetArgs(command)
+	if j.Shell != "" {
+		args = []string{j.Shell, "-c", command}
+	}
+
 	bin, err := exec.LookPath(args[0])
 	if err != nil {
 		return nil, err
 	}
 
+	var env []string
+	if len(environment) != 0 {
+		env = append(os.Environ(), environment...)
+	}
+
 	return &exec.Cmd{
 		Path:   bin,
 		Args:   args,
 		Stdout: ctx.Execution.OutputStream,
 		Stderr: ctx.Execution.ErrorStream,
-		Env:    j.Environment,
+		Env:    env,
 		Dir:    j.Dir,
 	}, nil
 }
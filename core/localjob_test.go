@@ -2,6 +2,8 @@ package core
 
 import (
 	"bytes"
+	"os"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
@@ -22,3 +24,75 @@ func (s *SuiteLocalJob) TestRun(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(b.String(), Equals, "foo bar\n")
 }
+
+func (s *SuiteLocalJob) TestRunEnvironmentDir(c *C) {
+	job := &LocalJob{}
+	job.Command = `sh -c "echo $FOO $OFELIA_EXECUTION_ID $PATH; pwd"`
+	job.Environment = []string{"FOO=foo"}
+	job.Dir = "/"
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e})
+	c.Assert(err, IsNil)
+	c.Assert(string(e.Output()), Equals, "foo "+e.ID+" "+os.Getenv("PATH")+"\n/\n")
+}
+
+func (s *SuiteLocalJob) TestRunTemplate(c *C) {
+	job := &LocalJob{}
+	job.Name = "foo"
+	job.Command = `sh -c "echo {{.JobName}} $BAR"`
+	job.Templates = true
+	job.Environment = []string{"BAR={{.ExecutionID}}"}
+
+	e := NewExecution()
+	err := job.Run(&Context{Job: job, Execution: e})
+	c.Assert(err, IsNil)
+	c.Assert(string(e.Output()), Equals, "foo "+e.ID+"\n")
+}
+
+func (s *SuiteLocalJob) TestRunShell(c *C) {
+	job := &LocalJob{}
+	job.Command = `echo foo | tr a-z A-Z && echo bar`
+	job.Shell = "/bin/sh"
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e})
+	c.Assert(err, IsNil)
+	c.Assert(string(e.Output()), Equals, "FOO\nbar\n")
+}
+
+func (s *SuiteLocalJob) TestRunArgs(c *C) {
+	for _, shell := range []string{"", "/bin/sh"} {
+		job := &LocalJob{}
+		job.Command = `echo`
+		job.Shell = shell
+
+		e := NewExecution()
+		e.Args = []string{"a b", "$HOME; echo `id`"}
+		err := job.Run(&Context{Execution: e})
+		c.Assert(err, IsNil)
+		c.Assert(string(e.Output()), Equals, "a b $HOME; echo `id`\n")
+	}
+}
+
+func (s *SuiteLocalJob) TestRunCanceled(c *C) {
+	job := &LocalJob{}
+	job.Command = `sleep 10`
+
+	e := NewExecution()
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		e.Cancel()
+	}()
+
+	err := job.Run(&Context{Execution: e})
+	c.Assert(err, Equals, ErrCanceledExecution)
+}
+
+func (s *SuiteLocalJob) TestRunExitCode(c *C) {
+	job := &LocalJob{}
+	job.Command = `sh -c "exit 3"`
+
+	err := job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, DeepEquals, &ExitCodeError{ExitCode: 3})
+}
@@ -0,0 +1,345 @@
+package core
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	nomadPollInterval = time.Second
+	nomadTimeout      = time.Second * 30
+	defaultNomadAddr  = "http://127.0.0.1:4646"
+)
+
+// NomadJob dispatches a parameterized Nomad batch job and waits for its
+// allocations to finish, the logs of their tasks are the output of the
+// execution. The Nomad HTTP API is called directly, by default the one of the
+// NOMAD_ADDR and NOMAD_TOKEN environment variables.
+type NomadJob struct {
+	BareJob `mapstructure:",squash"`
+	// Job is the ID of the parameterized job dispatched
+	Job       string
+	Namespace string
+	// Payload and Meta, as `KEY=value`, are the payload and metadata of the
+	// dispatched job, they can use the templates of the commands.
+	Payload string
+	Meta    []string
+	// MaxRuntime is the maximum time the dispatched job is allowed to run,
+	// after that it's stopped and the execution fails with ErrMaxTimeRunning.
+	MaxRuntime time.Duration `mapstructure:"max-runtime"`
+	// NomadAddr is the URL of the Nomad API, authenticated with the ACL token
+	// NomadToken and verified with the CA certificate file NomadCA.
+	NomadAddr  string `mapstructure:"nomad-addr"`
+	NomadToken string `mapstructure:"nomad-token"`
+	NomadCA    string `mapstructure:"nomad-ca"`
+}
+
+func NewNomadJob() *NomadJob {
+	return &NomadJob{}
+}
+
+// GetCommand returns the job dispatched
+func (j *NomadJob) GetCommand() string {
+	return j.Job
+}
+
+func (j *NomadJob) Run(ctx *Context) error {
+	c, err := j.buildClient()
+	if err != nil {
+		return err
+	}
+
+	input, err := j.buildDispatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	var dispatch struct {
+		DispatchedJobID string
+	}
+
+	if err := c.do("POST", j.path("/v1/job/"+url.PathEscape(j.Job)+"/dispatch", nil), input, &dispatch); err != nil {
+		return fmt.Errorf("error dispatching nomad job %q: %s", j.Job, err)
+	}
+
+	id := dispatch.DispatchedJobID
+	ctx.Logger.Noticef("Dispatched nomad job %s", id)
+
+	allocs, err := j.watchJob(ctx.Execution, c, id)
+	if err == ErrMaxTimeRunning || err == ErrCanceledExecution {
+		if serr := c.do("DELETE", j.path("/v1/job/"+url.PathEscape(id), nil), nil, nil); serr != nil {
+			ctx.Logger.Warningf("Error stopping nomad job %s: %s", id, serr)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var code int
+	var failed []string
+	for _, a := range allocs {
+		for _, task := range a.taskNames() {
+			if err := j.fetchLogs(ctx.Execution, c, a.ID, task); err != nil {
+				ctx.Logger.Warningf("Error fetching logs of nomad task %s/%s: %s", a.ID, task, err)
+			}
+
+			state := a.TaskStates[task]
+			if exit := state.exitCode(); exit != 0 && code == 0 {
+				code = exit
+			}
+		}
+
+		if a.ClientStatus != "complete" {
+			failed = append(failed, fmt.Sprintf("allocation %s is %s", a.ID, a.ClientStatus))
+		}
+	}
+
+	switch {
+	case code != 0:
+		return &ExitCodeError{ExitCode: code}
+	case len(failed) != 0:
+		return fmt.Errorf("nomad job %s failed: %s", id, strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+func (j *NomadJob) buildDispatch(ctx *Context) (interface{}, error) {
+	payload, err := ctx.Render(j.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	specs, err := ctx.RenderAll(j.Meta)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := make(map[string]string)
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid meta %q, expected KEY=value", spec)
+		}
+
+		meta[parts[0]] = parts[1]
+	}
+
+	input := map[string]interface{}{"Meta": meta}
+	if payload != "" {
+		input["Payload"] = base64.StdEncoding.EncodeToString([]byte(payload))
+	}
+
+	return input, nil
+}
+
+// watchJob polls the allocations of the dispatched job until all of them
+// finished
+func (j *NomadJob) watchJob(e *Execution, c *nomadClient, id string) ([]nomadAllocation, error) {
+	maxRuntime := j.MaxRuntime
+	if maxRuntime == 0 {
+		maxRuntime = maxProcessDuration
+	}
+
+	timeout := time.After(maxRuntime)
+	for {
+		var allocs []nomadAllocation
+		if err := c.do("GET", j.path("/v1/job/"+url.PathEscape(id)+"/allocations", nil), nil, &allocs); err != nil {
+			return nil, fmt.Errorf("error listing allocations of nomad job: %s", err)
+		}
+
+		finished := len(allocs) != 0
+		for _, a := range allocs {
+			if a.ClientStatus == "pending" || a.ClientStatus == "running" {
+				finished = false
+			}
+		}
+
+		if finished {
+			return allocs, nil
+		}
+
+		select {
+		case <-e.Done():
+			return nil, ErrCanceledExecution
+		case <-timeout:
+			return nil, ErrMaxTimeRunning
+		case <-time.After(nomadPollInterval):
+		}
+	}
+}
+
+// fetchLogs writes the stdout and stderr of the task to the output of the
+// execution
+func (j *NomadJob) fetchLogs(e *Execution, c *nomadClient, alloc, task string) error {
+	for _, s := range []struct {
+		kind string
+		w    io.Writer
+	}{{"stdout", e.OutputStream}, {"stderr", e.ErrorStream}} {
+		q := url.Values{"task": {task}, "type": {s.kind}, "origin": {"start"}, "plain": {"true"}}
+		if err := c.do("GET", j.path("/v1/client/fs/logs/"+url.PathEscape(alloc), q), nil, s.w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// path returns the path with the query and the namespace of the job
+func (j *NomadJob) path(path string, q url.Values) string {
+	if j.Namespace != "" {
+		if q == nil {
+			q = url.Values{}
+		}
+
+		q.Set("namespace", j.Namespace)
+	}
+
+	if len(q) == 0 {
+		return path
+	}
+
+	return path + "?" + q.Encode()
+}
+
+func (j *NomadJob) buildClient() (*nomadClient, error) {
+	c := &nomadClient{url: j.NomadAddr, token: j.NomadToken}
+	if c.url == "" {
+		c.url = os.Getenv("NOMAD_ADDR")
+	}
+
+	if c.url == "" {
+		c.url = defaultNomadAddr
+	}
+
+	if c.token == "" {
+		c.token = os.Getenv("NOMAD_TOKEN")
+	}
+
+	ca := j.NomadCA
+	if ca == "" {
+		ca = os.Getenv("NOMAD_CACERT")
+	}
+
+	transport := http.DefaultTransport
+	if ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA certificate: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("invalid CA certificate %q", ca)
+		}
+
+		transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}
+	}
+
+	c.client = &http.Client{Transport: transport, Timeout: nomadTimeout}
+	return c, nil
+}
+
+// nomadAllocation contains the fields used of the allocations
+type nomadAllocation struct {
+	ID           string
+	ClientStatus string
+	TaskStates   map[string]nomadTaskState
+}
+
+// taskNames returns the names of the tasks of the allocation, sorted
+func (a *nomadAllocation) taskNames() []string {
+	var names []string
+	for name := range a.TaskStates {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+type nomadTaskState struct {
+	Events []struct {
+		Type     string
+		ExitCode int
+	}
+}
+
+// exitCode returns the exit code of the last termination of the task
+func (s *nomadTaskState) exitCode() int {
+	for i := len(s.Events) - 1; i >= 0; i-- {
+		if s.Events[i].Type == "Terminated" {
+			return s.Events[i].ExitCode
+		}
+	}
+
+	return 0
+}
+
+// nomadClient is a minimal client of the Nomad HTTP API
+type nomadClient struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// do sends the request with body encoded as JSON, the response is decoded into
+// out, or copied if it's a writer.
+func (c *nomadClient) do(method, path string, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.url, "/")+path, r)
+	if err != nil {
+		return err
+	}
+
+	if c.token != "" {
+		req.Header.Set("X-Nomad-Token", c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		// the errors of Nomad are plain text
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case io.Writer:
+		_, err = io.Copy(out, resp.Body)
+		return err
+	default:
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteNomadJob struct {
+	server   *httptest.Server
+	dispatch map[string]interface{}
+	status   string
+	code     int
+	polls    int
+	stopped  bool
+}
+
+var _ = Suite(&SuiteNomadJob{})
+
+func (s *SuiteNomadJob) SetUpTest(c *C) {
+	s.dispatch, s.status, s.code, s.polls, s.stopped = nil, "complete", 0, 0, false
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/job/report/dispatch", func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, Equals, "POST")
+		c.Assert(r.Header.Get("X-Nomad-Token"), Equals, "qux")
+		c.Assert(r.URL.Query().Get("namespace"), Equals, "batch")
+		c.Assert(json.NewDecoder(r.Body).Decode(&s.dispatch), IsNil)
+		fmt.Fprint(w, `{"DispatchedJobID":"report/dispatch-1"}`)
+	})
+
+	mux.HandleFunc("/v1/job/report/dispatch-1/allocations", func(w http.ResponseWriter, r *http.Request) {
+		s.polls++
+		if s.polls < 2 {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+
+		fmt.Fprintf(w, `[{"ID":"a1","ClientStatus":%q,"TaskStates":{"main":{"Events":[
+			{"Type":"Started"},{"Type":"Terminated","ExitCode":%d}
+		]}}}]`, s.status, s.code)
+	})
+
+	mux.HandleFunc("/v1/job/report/dispatch-1", func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, Equals, "DELETE")
+		s.stopped = true
+	})
+
+	mux.HandleFunc("/v1/client/fs/logs/a1", func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Query().Get("task"), Equals, "main")
+		c.Assert(r.URL.Query().Get("plain"), Equals, "true")
+		fmt.Fprintf(w, "%s\n", r.URL.Query().Get("type"))
+	})
+
+	s.server = httptest.NewServer(mux)
+}
+
+func (s *SuiteNomadJob) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *SuiteNomadJob) buildJob() *NomadJob {
+	job := &NomadJob{NomadAddr: s.server.URL, NomadToken: "qux", Namespace: "batch"}
+	job.Name = "report"
+	job.Job = "report"
+	job.Payload = "foo"
+	job.Meta = []string{"JOB={{.JobName}}"}
+	job.Templates = true
+
+	return job
+}
+
+func (s *SuiteNomadJob) TestRun(c *C) {
+	job := s.buildJob()
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e, Job: job, Logger: &TestLogger{}})
+	c.Assert(err, IsNil)
+	c.Assert(string(e.Output()), Equals, "stdout\n")
+	c.Assert(string(e.ErrorOutput()), Equals, "stderr\n")
+	c.Assert(s.stopped, Equals, false)
+
+	c.Assert(s.dispatch, DeepEquals, map[string]interface{}{
+		"Payload": "Zm9v",
+		"Meta":    map[string]interface{}{"JOB": "report"},
+	})
+}
+
+func (s *SuiteNomadJob) TestRunFailed(c *C) {
+	s.status, s.code = "failed", 3
+
+	err := s.buildJob().Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, DeepEquals, &ExitCodeError{ExitCode: 3})
+}
+
+func (s *SuiteNomadJob) TestRunLost(c *C) {
+	s.status = "lost"
+
+	err := s.buildJob().Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, ErrorMatches, "nomad job report/dispatch-1 failed: allocation a1 is lost")
+}
+
+func (s *SuiteNomadJob) TestRunMaxRuntime(c *C) {
+	s.status = "running"
+
+	job := s.buildJob()
+	job.MaxRuntime = time.Millisecond * 100
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, Equals, ErrMaxTimeRunning)
+	c.Assert(s.stopped, Equals, true)
+}
+
+func (s *SuiteNomadJob) TestRunInvalidMeta(c *C) {
+	job := s.buildJob()
+	job.Meta = []string{"foo"}
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, ErrorMatches, `invalid meta "foo", expected KEY=value`)
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sync"
+)
+
+// OutputBuffer is an output stream of an execution keeping up to Max bytes in
+// memory. Once the output exceeds it, the whole output is written to a file in
+// Dir, by default the temporary directory, and only the last Max bytes are
+// kept in memory.
+type OutputBuffer struct {
+	Max int
+	Dir string
+	// Prefix of the name of the file, e.g. the job and the execution.
+	Prefix string
+
+	mu        sync.Mutex
+	buf       []byte
+	read      int
+	truncated bool
+	file      *os.File
+	path      string
+	err       error
+}
+
+// NewOutputBuffer returns a new OutputBuffer
+func NewOutputBuffer(max int, dir, prefix string) *OutputBuffer {
+	return &OutputBuffer{Max: max, Dir: dir, Prefix: prefix}
+}
+
+// Write writes p to the buffer, moving the output to the file once it exceeds
+// Max. It fails only if the file can't be written, the memory keeps the last
+// bytes anyway.
+func (b *OutputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.path == "" && len(b.buf)+len(p) > b.Max && b.err == nil {
+		b.err = b.spill()
+	}
+
+	if b.file != nil {
+		if _, err := b.file.Write(p); err != nil {
+			b.err = err
+		}
+	}
+
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.Max {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.Max:]...)
+		b.truncated = true
+	}
+
+	return len(p), b.err
+}
+
+var outputInvalidChars = regexp.MustCompile(`[^\w.-]+`)
+
+// spill creates the file with the current content of the buffer
+func (b *OutputBuffer) spill() error {
+	prefix := outputInvalidChars.ReplaceAllString(b.Prefix, "-")
+	f, err := ioutil.TempFile(b.Dir, "ofelia-"+prefix+"-*.log")
+	if err != nil {
+		return fmt.Errorf("error creating output file: %s", err)
+	}
+
+	b.file, b.path = f, f.Name()
+	_, err = f.Write(b.buf)
+	return err
+}
+
+// Bytes returns the output kept in memory, the whole output if it didn't
+// exceed Max, otherwise a notice with the path of the file with the full
+// output, if it could be written, followed by its last bytes.
+func (b *OutputBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.bytes()
+}
+
+func (b *OutputBuffer) bytes() []byte {
+	if !b.truncated {
+		return b.buf
+	}
+
+	notice := fmt.Sprintf("[output truncated to the last %d bytes]\n", b.Max)
+	if b.path != "" {
+		notice = fmt.Sprintf("[output truncated to the last %d bytes, see the full output at %s]\n", b.Max, b.path)
+	}
+
+	return append([]byte(notice), b.buf...)
+}
+
+// Read reads the content returned by Bytes
+func (b *OutputBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	content := b.bytes()
+	if b.read >= len(content) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, content[b.read:])
+	b.read += n
+	return n, nil
+}
+
+// Path returns the path of the file with the full output, empty if the output
+// didn't exceed Max.
+func (b *OutputBuffer) Path() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.path
+}
+
+// Remove closes and deletes the file with the full output, if any, e.g. once
+// the execution is dropped from the history.
+func (b *OutputBuffer) Remove() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.file != nil {
+		b.file.Close()
+		b.file = nil
+	}
+
+	if b.path == "" {
+		return nil
+	}
+
+	err := os.Remove(b.path)
+	b.path = ""
+	return err
+}
+
+// Close closes the file, the file is kept so it can be read later.
+func (b *OutputBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.file == nil {
+		return nil
+	}
+
+	err := b.file.Close()
+	b.file = nil
+	return err
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteOutputBuffer struct{}
+
+var _ = Suite(&SuiteOutputBuffer{})
+
+func (s *SuiteOutputBuffer) TestWrite(c *C) {
+	b := NewOutputBuffer(10, c.MkDir(), "foo")
+	b.Write([]byte("foo "))
+	b.Write([]byte("bar"))
+	c.Assert(string(b.Bytes()), Equals, "foo bar")
+	c.Assert(b.Path(), Equals, "")
+	c.Assert(b.Close(), IsNil)
+}
+
+func (s *SuiteOutputBuffer) TestWriteSpill(c *C) {
+	dir := c.MkDir()
+	b := NewOutputBuffer(10, dir, "foo/bar")
+	b.Write([]byte("foo bar "))
+	b.Write([]byte("baz qux"))
+	b.Write([]byte(" quux"))
+
+	c.Assert(filepath.Dir(b.Path()), Equals, dir)
+	c.Assert(filepath.Base(b.Path()), Matches, `ofelia-foo-bar-.*\.log`)
+	c.Assert(string(b.Bytes()), Equals, "[output truncated to the last 10 bytes, see the full output at "+b.Path()+"]\nz qux quux")
+	c.Assert(b.Close(), IsNil)
+
+	content, err := ioutil.ReadFile(b.Path())
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo bar baz qux quux")
+
+	all, err := ioutil.ReadAll(b)
+	c.Assert(err, IsNil)
+	c.Assert(string(all), Equals, string(b.Bytes()))
+}
+
+func (s *SuiteOutputBuffer) TestWriteSpillError(c *C) {
+	b := NewOutputBuffer(3, filepath.Join(c.MkDir(), "missing"), "foo")
+	_, err := b.Write([]byte("foo bar"))
+	c.Assert(err, ErrorMatches, "error creating output file: .*")
+	c.Assert(string(b.Bytes()), Equals, "[output truncated to the last 3 bytes]\nbar")
+}
+
+func (s *SuiteOutputBuffer) TestSchedulerMaxOutputSize(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.MaxOutputSize = 5
+	sc.OutputDir = c.MkDir()
+
+	e := sc.newExecution(job)
+	e.OutputStream.Write([]byte(strings.Repeat("x", 10)))
+	e.Stop(nil)
+
+	c.Assert(string(e.Output()), Matches, `\[output truncated .*\]\nxxxxx`)
+	c.Assert(e.ErrorOutput(), HasLen, 0)
+}
+
+func (s *SuiteOutputBuffer) TestAddHistoryRemovesFiles(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.HistoryLimit = 1
+
+	sc := NewScheduler(&TestLogger{})
+	sc.MaxOutputSize = 5
+	sc.OutputDir = c.MkDir()
+
+	e := sc.newExecution(job)
+	e.OutputStream.Write([]byte(strings.Repeat("x", 10)))
+	e.Stop(nil)
+	job.AddHistory(e)
+
+	path := e.OutputStream.(*followStream).ReadWriter.(*OutputBuffer).Path()
+	_, err := os.Stat(path)
+	c.Assert(err, IsNil)
+
+	// the file is deleted once the execution is dropped from the history
+	job.AddHistory(NewExecution())
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// podmanClients caches whether the daemon of each client is Podman
+var podmanClients sync.Map
+
+// isPodman returns true if the daemon of the client is Podman, whose Docker
+// compatible API differs in a few details, e.g. the networks are connected
+// when the container is created. The daemon is asked once, and is assumed to
+// be Docker if its version can't be read.
+func isPodman(c *docker.Client) bool {
+	if v, ok := podmanClients.Load(c); ok {
+		return v.(bool)
+	}
+
+	env, err := c.Version()
+	if err != nil {
+		return false
+	}
+
+	var components []struct{ Name string }
+	env.GetJSON("Components", &components)
+
+	var podman bool
+	for _, component := range components {
+		if strings.HasPrefix(component.Name, "Podman") {
+			podman = true
+		}
+	}
+
+	podmanClients.Store(c, podman)
+	return podman
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/fsouza/go-dockerclient/testing"
+	. "gopkg.in/check.v1"
+)
+
+type SuitePodman struct {
+	server *testing.DockerServer
+}
+
+var _ = Suite(&SuitePodman{})
+
+func (s *SuitePodman) SetUpTest(c *C) {
+	var err error
+	s.server, err = testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *SuitePodman) TearDownTest(c *C) {
+	s.server.Stop()
+}
+
+func (s *SuitePodman) TestIsPodman(c *C) {
+	var versions int
+	s.server.CustomHandler("/version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		versions++
+		json.NewEncoder(w).Encode(podmanVersion)
+	}))
+
+	client, err := docker.NewClient(s.server.URL())
+	c.Assert(err, IsNil)
+	c.Assert(isPodman(client), Equals, true)
+	c.Assert(isPodman(client), Equals, true)
+	c.Assert(versions, Equals, 1)
+}
+
+func (s *SuitePodman) TestIsPodmanDocker(c *C) {
+	client, err := docker.NewClient(s.server.URL())
+	c.Assert(err, IsNil)
+	c.Assert(isPodman(client), Equals, false)
+}
+
+// podmanVersion is the response of the version endpoint of Podman
+var podmanVersion = map[string]interface{}{
+	"ApiVersion": "1.40",
+	"Version":    "4.3.1",
+	"Components": []map[string]interface{}{
+		{"Name": "Podman Engine", "Version": "4.3.1"},
+	},
+}
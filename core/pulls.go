@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"sync"
+)
+
+// defaultRegistry is the registry of the images without one
+const defaultRegistry = "docker.io"
+
+// pulls deduplicates the concurrent pulls of the same image on the same
+// daemon, the executions pulling an image already being pulled wait for it and
+// share its result, and limits the images pulled at the same time from the
+// same registry.
+type pulls struct {
+	mu         sync.Mutex
+	limit      int
+	running    map[string]*pull
+	registries map[string]chan struct{}
+}
+
+// pull is a running pull, done is closed once it finishes. A canceled pull
+// isn't shared, the executions waiting for it pull the image themselves.
+type pull struct {
+	done     chan struct{}
+	err      error
+	canceled bool
+}
+
+func newPulls(limit int) *pulls {
+	return &pulls{
+		limit:      limit,
+		running:    make(map[string]*pull),
+		registries: make(map[string]chan struct{}),
+	}
+}
+
+// do runs fn, pulling the image identified by key, e.g. the daemon and the
+// image, from the registry, waiting for a free slot of the registry if
+// limited, or waits for the running pull with the same key, returning its
+// error. The context of fn is canceled once cancel is closed, and the waits
+// return ErrCanceledExecution.
+func (p *pulls) do(cancel <-chan struct{}, key, registry string, fn func(context.Context) error) error {
+	p.mu.Lock()
+	for {
+		r, ok := p.running[key]
+		if !ok {
+			break
+		}
+
+		p.mu.Unlock()
+		select {
+		case <-r.done:
+			if !r.canceled {
+				return r.err
+			}
+		case <-cancel:
+			return ErrCanceledExecution
+		}
+
+		p.mu.Lock()
+	}
+
+	r := &pull{done: make(chan struct{})}
+	p.running[key] = r
+
+	var slots chan struct{}
+	if p.limit > 0 {
+		slots = p.registries[registry]
+		if slots == nil {
+			slots = make(chan struct{}, p.limit)
+			p.registries[registry] = slots
+		}
+	}
+
+	p.mu.Unlock()
+
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		case <-cancel:
+			p.finish(key, r, ErrCanceledExecution, true)
+			return ErrCanceledExecution
+		}
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-cancel:
+			stop()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := fn(ctx)
+	canceled := ctx.Err() != nil
+	stop()
+
+	if slots != nil {
+		<-slots
+	}
+
+	if canceled {
+		err = ErrCanceledExecution
+	}
+
+	p.finish(key, r, err, canceled)
+	return err
+}
+
+// finish ends the running pull with the given error, waking up the executions
+// waiting for it
+func (p *pulls) finish(key string, r *pull, err error, canceled bool) {
+	p.mu.Lock()
+	delete(p.running, key)
+	p.mu.Unlock()
+
+	r.err, r.canceled = err, canceled
+	close(r.done)
+}
@@ -0,0 +1,202 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuitePulls struct{}
+
+var _ = Suite(&SuitePulls{})
+
+func (s *SuitePulls) TestDoSameImage(c *C) {
+	p := newPulls(0)
+
+	var calls int32
+	release := make(chan struct{})
+	fn := func(context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return errors.New("foo")
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = p.do(nil, "foo:latest", defaultRegistry, fn)
+		}(i)
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	wg.Wait()
+
+	c.Assert(atomic.LoadInt32(&calls), Equals, int32(1))
+	for _, err := range errs {
+		c.Assert(err, ErrorMatches, "foo")
+	}
+
+	// the finished pulls aren't shared
+	c.Assert(p.do(nil, "foo:latest", defaultRegistry, func(context.Context) error { return nil }), IsNil)
+}
+
+func (s *SuitePulls) TestDoRegistryLimit(c *C) {
+	p := newPulls(2)
+
+	var running, max int32
+	fn := func(context.Context) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond * 20)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for _, image := range []string{"a", "b", "c", "d", "e"} {
+		wg.Add(1)
+		go func(image string) {
+			defer wg.Done()
+			p.do(nil, image, defaultRegistry, fn)
+		}(image)
+	}
+
+	wg.Wait()
+	c.Assert(atomic.LoadInt32(&max), Equals, int32(2))
+
+	// other registries have their own limit
+	release := make(chan struct{})
+	go p.do(nil, "a", defaultRegistry, func(context.Context) error { <-release; return nil })
+	go p.do(nil, "b", defaultRegistry, func(context.Context) error { <-release; return nil })
+	time.Sleep(time.Millisecond * 20)
+
+	c.Assert(p.do(nil, "quay.io/a", "quay.io", func(context.Context) error { return nil }), IsNil)
+	close(release)
+}
+
+func (s *SuitePulls) TestDoCanceled(c *C) {
+	p := newPulls(1)
+
+	// the running pull is canceled through its context
+	cancel := make(chan struct{})
+	started := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- p.do(cancel, "a", defaultRegistry, func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+
+	<-started
+
+	// waiting for the slot of the registry
+	waiting := make(chan struct{})
+	go func() {
+		errs <- p.do(waiting, "b", defaultRegistry, func(context.Context) error { return nil })
+	}()
+
+	time.Sleep(time.Millisecond * 20)
+	close(waiting)
+	c.Assert(<-errs, Equals, ErrCanceledExecution)
+
+	close(cancel)
+	c.Assert(<-errs, Equals, ErrCanceledExecution)
+
+	// the slot was released
+	c.Assert(p.do(nil, "b", defaultRegistry, func(context.Context) error { return nil }), IsNil)
+}
+
+func (s *SuitePulls) TestDoCanceledShared(c *C) {
+	p := newPulls(0)
+
+	cancel := make(chan struct{})
+	started := make(chan struct{})
+	go p.do(cancel, "a", defaultRegistry, func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	<-started
+
+	// the executions waiting for a canceled pull pull the image themselves
+	errs := make(chan error, 1)
+	go func() {
+		errs <- p.do(nil, "a", defaultRegistry, func(context.Context) error { return nil })
+	}()
+
+	time.Sleep(time.Millisecond * 20)
+	close(cancel)
+	c.Assert(<-errs, IsNil)
+
+	// and the waits are canceled with their execution
+	release := make(chan struct{})
+	go p.do(nil, "a", defaultRegistry, func(context.Context) error { <-release; return nil })
+	time.Sleep(time.Millisecond * 20)
+
+	waiting := make(chan struct{})
+	close(waiting)
+	c.Assert(p.do(waiting, "a", defaultRegistry, nil), Equals, ErrCanceledExecution)
+	close(release)
+}
+
+func (s *SuitePulls) TestSchedulerPullImage(c *C) {
+	sc := NewScheduler(&TestLogger{})
+	ctx := &Context{Execution: NewExecution()}
+
+	err := sc.pullImage(ctx, "unix:///var/run/docker.sock", "foo", "", func(context.Context) error {
+		time.Sleep(time.Millisecond * 10)
+		return nil
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(ctx.Execution.PullDuration >= time.Millisecond*10, Equals, true)
+	c.Assert(sc.pulls, NotNil)
+
+	// without scheduler the image is pulled directly
+	var nilScheduler *Scheduler
+	c.Assert(nilScheduler.pullImage(ctx, "", "foo", "", func(context.Context) error { return nil }), IsNil)
+}
+
+func (s *SuitePulls) TestSchedulerPullImageDaemons(c *C) {
+	sc := NewScheduler(&TestLogger{})
+
+	var calls int32
+	release := make(chan struct{})
+	fn := func(context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return nil
+	}
+
+	// the pulls of the same image to other daemons aren't shared
+	var wg sync.WaitGroup
+	for _, daemon := range []string{"tcp://a:2375", "tcp://b:2375"} {
+		wg.Add(1)
+		go func(daemon string) {
+			defer wg.Done()
+			sc.pullImage(&Context{Execution: NewExecution()}, daemon, "foo", "", fn)
+		}(daemon)
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	c.Assert(atomic.LoadInt32(&calls), Equals, int32(2))
+	close(release)
+	wg.Wait()
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// redactedText replaces the secrets masked by a Redactor
+const redactedText = "[REDACTED]"
+
+// Redaction masks the secrets in the output and the errors of the executions:
+// the values of the environment variables with the given names, of ofelia or
+// set in the environment of the job, and the matches of the patterns.
+type Redaction struct {
+	Env      []string
+	Patterns []*regexp.Regexp
+}
+
+// NewRedaction returns a Redaction of the given environment variables and
+// patterns, it fails if a pattern isn't a valid regular expression
+func NewRedaction(env, patterns []string) (*Redaction, error) {
+	r := &Redaction{Env: env}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %s", p, err)
+		}
+
+		r.Patterns = append(r.Patterns, re)
+	}
+
+	return r, nil
+}
+
+// environmentJob is implemented by the jobs with an environment, see
+// parseEnvSpecs
+type environmentJob interface {
+	GetEnvironment() []string
+}
+
+// Redactor returns the Redactor of the executions of the given job
+func (r *Redaction) Redactor(j Job) *Redactor {
+	var env []string
+	if e, ok := j.(environmentJob); ok {
+		// an invalid environment fails the execution anyway
+		env, _ = parseEnvSpecs(e.GetEnvironment(), true)
+	}
+
+	values := make(map[string]bool)
+	for _, name := range r.Env {
+		values[os.Getenv(name)] = true
+		for _, v := range env {
+			if strings.HasPrefix(v, name+"=") {
+				values[strings.TrimPrefix(v, name+"=")] = true
+			}
+		}
+	}
+
+	red := &Redactor{patterns: r.Patterns}
+	for v := range values {
+		if v != "" {
+			red.values = append(red.values, v)
+		}
+	}
+
+	red.sort()
+	return red
+}
+
+// Redactor masks the secrets of the executions of a job, see Redaction
+type Redactor struct {
+	values   []string
+	patterns []*regexp.Regexp
+}
+
+// with returns a copy of the Redactor masking the given value too, a nil
+// Redactor returns a new one
+func (r *Redactor) with(value string) *Redactor {
+	red := &Redactor{}
+	if r != nil {
+		red.values = append(red.values, r.values...)
+		red.patterns = r.patterns
+	}
+
+	if value != "" {
+		red.values = append(red.values, value)
+	}
+
+	red.sort()
+	return red
+}
+
+// sort sorts the values by length, the longest first, in case a value
+// contains another one
+func (r *Redactor) sort() {
+	sort.Slice(r.values, func(i, j int) bool {
+		return len(r.values[i]) > len(r.values[j])
+	})
+}
+
+// Redact returns the content with the secrets replaced by `[REDACTED]`, a nil
+// Redactor returns the content as is.
+func (r *Redactor) Redact(b []byte) []byte {
+	if r == nil || len(b) == 0 {
+		return b
+	}
+
+	for _, v := range r.values {
+		b = bytes.Replace(b, []byte(v), []byte(redactedText), -1)
+	}
+
+	for _, re := range r.patterns {
+		b = re.ReplaceAllLiteral(b, []byte(redactedText))
+	}
+
+	return b
+}
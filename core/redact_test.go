@@ -0,0 +1,69 @@
+package core
+
+import (
+	"errors"
+	"os"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteRedaction struct{}
+
+var _ = Suite(&SuiteRedaction{})
+
+func (s *SuiteRedaction) TestRedactor(c *C) {
+	os.Setenv("OFELIA_TEST_SECRET", "qux")
+	defer os.Unsetenv("OFELIA_TEST_SECRET")
+
+	r, err := NewRedaction(
+		[]string{"OFELIA_TEST_SECRET", "DB_PASSWORD", "OFELIA_TEST_EMPTY"},
+		[]string{`token=\w+`},
+	)
+	c.Assert(err, IsNil)
+
+	job := &LocalJob{Environment: []string{"DB_PASSWORD=s3cr3t", "DB_USER=foo"}}
+	red := r.Redactor(job)
+
+	content := []byte("user foo, password s3cr3t, qux and token=abc123")
+	c.Assert(string(red.Redact(content)), Equals, "user foo, password [REDACTED], [REDACTED] and [REDACTED]")
+	c.Assert(string(content), Equals, "user foo, password s3cr3t, qux and token=abc123")
+
+	red = r.Redactor(&TestJob{})
+	c.Assert(string(red.Redact(content)), Equals, "user foo, password s3cr3t, [REDACTED] and [REDACTED]")
+
+	red = nil
+	c.Assert(string(red.Redact(content)), Equals, string(content))
+}
+
+func (s *SuiteRedaction) TestNewRedactionInvalid(c *C) {
+	_, err := NewRedaction(nil, []string{"("})
+	c.Assert(err, ErrorMatches, `invalid redact pattern "\(": .*`)
+}
+
+func (s *SuiteRedaction) TestExecution(c *C) {
+	r, err := NewRedaction([]string{"DB_PASSWORD"}, nil)
+	c.Assert(err, IsNil)
+
+	job := &LocalJob{Environment: []string{"DB_PASSWORD=s3cr3t"}}
+	job.Name = "foo"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.Redaction = r
+
+	e := sc.newExecution(job)
+	e.Start()
+	e.OutputStream.Write([]byte("password s3cr3t"))
+	e.ErrorStream.Write([]byte("error s3cr3t"))
+	exitErr := &ExitCodeError{ExitCode: 2}
+	e.Stop(exitErr)
+
+	c.Assert(string(e.Output()), Equals, "password [REDACTED]")
+	c.Assert(string(e.ErrorOutput()), Equals, "error [REDACTED]")
+	c.Assert(string(e.Redact([]byte("s3cr3t"))), Equals, "[REDACTED]")
+	c.Assert(e.Error, Equals, exitErr)
+
+	e = sc.newExecution(job)
+	e.Start()
+	e.Stop(errors.New("invalid password s3cr3t"))
+	c.Assert(e.Error, ErrorMatches, `invalid password \[REDACTED\]`)
+}
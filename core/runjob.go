@@ -1,30 +1,162 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/gobs/args"
+	"gopkg.in/gcfg.v1/types"
 )
 
-var dockercfg *docker.AuthConfigurations
+// Pull policies of the RunJob images, by default the image is always pulled
+const (
+	PullAlways       = "always"
+	PullIfNotPresent = "if-not-present"
+	PullNever        = "never"
+)
 
-func init() {
-	dockercfg, _ = docker.NewAuthConfigurationsFromDockerCfg()
-}
+// logsGrace is the time the logs of a container are followed after it should
+// have stopped
+const logsGrace = time.Second * 10
+
+// DeletePolicy is the delete policy of the RunJob containers and of the
+// Kubernetes Jobs, a boolean, with any of the spellings of the INI files, e.g.
+// `yes` or `0`, or DeleteOnSuccess
+type DeletePolicy string
+
+// Delete policies of the RunJob containers, by default the container is always
+// deleted once finished
+const (
+	DeleteAlways    DeletePolicy = "true"
+	DeleteNever     DeletePolicy = "false"
+	DeleteOnSuccess DeletePolicy = "on-success"
+)
 
 type RunJob struct {
-	BareJob   `mapstructure:",squash"`
-	Client    *docker.Client `json:"-"`
-	User      string         `default:"root"`
-	TTY       bool           `default:"false"`
-	Delete    bool           `default:"true"`
-	Image     string
-	Network   string
-	Container string
+	BareJob `mapstructure:",squash"`
+	Client  *docker.Client `json:"-"`
+	User    string         `default:"root"`
+	TTY     bool           `default:"false"`
+	Delete  DeletePolicy   `default:"true"`
+	Pull    string         `default:"always"`
+	Image   string
+	// Platform is the variant of the image pulled and run, as
+	// `os/arch[/variant]`, e.g. `linux/arm64`, similar to `docker run
+	// --platform`. With the if-not-present policy the image is pulled if the
+	// one present is of another platform, the container is created from the
+	// image of the platform, see platformImage.
+	Platform string
+	// Network is a comma-separated list of networks, by name or ID, the
+	// container is connected to before being started, every network with the
+	// NetworkAlias aliases.
+	Network      string
+	NetworkAlias []string `mapstructure:"network-alias"`
+	Container    string
+	// Entrypoint and Workdir override the default ones of the image, similar
+	// to `docker run --entrypoint --workdir`.
+	Entrypoint string
+	Workdir    string
+	// Volume are mounted in the container using the `docker run --volume`
+	// syntax: `[src:]dst[:ro|rw[,z|Z]]`, src can be a path or a named volume.
+	Volume []string
+	// VolumesFrom are the containers whose volumes are mounted in the
+	// container, similar to `docker run --volumes-from`: `container[:ro|rw]`.
+	VolumesFrom []string `mapstructure:"volumes-from"`
+	// EnvSecret are added to the environment as `NAME=secret`, read on every
+	// execution from a file of /run/secrets or from Vault, see Secrets.
+	EnvSecret []string `mapstructure:"env-secret"`
+	// RegistryUsername and RegistryPassword are the credentials used to pull
+	// the image, alternatively AuthFile can point to a docker config file. If
+	// none is given, the default docker config file is used.
+	RegistryUsername string `mapstructure:"registry-username"`
+	RegistryPassword string `mapstructure:"registry-password"`
+	AuthFile         string `mapstructure:"auth-file"`
+
+	// ImageVerification verifies the signature of the image before running
+	// it, if set.
+	ImageVerification `mapstructure:",squash"`
+
+	// MaxRuntime is the maximum time the container is allowed to run, after
+	// that it's stopped and the execution fails with ErrMaxTimeRunning.
+	MaxRuntime time.Duration `mapstructure:"max-runtime"`
+	// StopSignal is sent to the container when the execution is canceled or
+	// exceeds MaxRuntime, and StopGrace is the time it has to exit before it's
+	// killed, similar to `docker run --stop-signal --stop-timeout`.
+	StopSignal string        `mapstructure:"stop-signal"`
+	StopGrace  time.Duration `mapstructure:"stop-grace"`
+	// LogsTail is the number of lines of the logs of the container added to
+	// the output of the execution once the container finishes, zero means all
+	// of them, written while the container runs so it can be followed.
+	LogsTail int `mapstructure:"logs-tail"`
+	// AutoRemoveImage removes the image once the container is deleted, keeping
+	// the disk usage bounded when the image is only used by the job. The image
+	// is kept if it's used by other containers, or if the container is kept.
+	AutoRemoveImage bool `mapstructure:"auto-remove-image"`
+	// Input or the content of InputFile is written to the stdin of the
+	// container, e.g. a SQL script executed by `psql`.
+	Input     string
+	InputFile string `mapstructure:"input-file"`
+
+	// Memory and MemorySwap are the limits in bytes of the container.
+	Memory     int64
+	MemorySwap int64 `mapstructure:"memory-swap"`
+	// CPUShares, CPUQuota and CPUSet are equivalent to the `docker run`
+	// flags --cpu-shares, --cpu-quota and --cpuset-cpus.
+	CPUShares int64  `mapstructure:"cpu-shares"`
+	CPUQuota  int64  `mapstructure:"cpu-quota"`
+	CPUSet    string `mapstructure:"cpu-set"`
+	// Ulimits are set with the `docker run --ulimit` syntax:
+	// `name=soft[:hard]`, e.g. `nofile=1024:2048`, ShmSize is the size in
+	// bytes of /dev/shm.
+	Ulimits []string
+	ShmSize int64 `mapstructure:"shm-size"`
+	// Tmpfs are mounted in the container using the `docker run --tmpfs`
+	// syntax: `path[:options]`, e.g. `/tmp:rw,size=64m`.
+	Tmpfs []string
+
+	// LogDriver is the logging driver of the container, configured with the
+	// LogOpt options as `key=value`, similar to `docker run --log-driver
+	// --log-opt`. By default the driver of the daemon is used.
+	LogDriver string   `mapstructure:"log-driver"`
+	LogOpt    []string `mapstructure:"log-opt"`
+	// Labels are set on the container as `key=value`, similar to `docker run
+	// --label`.
+	Labels []string
+
+	// Hostname, DNS, DNSSearch and ExtraHosts are equivalent to the `docker
+	// run` flags --hostname, --dns, --dns-search and --add-host, ExtraHosts
+	// with the syntax `host:ip`.
+	Hostname   string
+	DNS        []string
+	DNSSearch  []string `mapstructure:"dns-search"`
+	ExtraHosts []string `mapstructure:"extra-hosts"`
+
+	// Privileged, CapAdd, CapDrop and SecurityOpt are equivalent to the `docker
+	// run` flags --privileged, --cap-add, --cap-drop and --security-opt.
+	Privileged  bool
+	CapAdd      []string `mapstructure:"cap-add"`
+	CapDrop     []string `mapstructure:"cap-drop"`
+	SecurityOpt []string `mapstructure:"security-opt"`
+
+	// Device are host devices added to the container using the `docker run
+	// --device` syntax: `host[:container][:permissions]`.
+	Device []string
+	// GPUs are the GPUs added to the container, similar to `docker run --gpus`:
+	// `all`, a number of GPUs or `device=<id>[,<id>...]`.
+	GPUs string
 }
 
+// networkModes are the values of Network that set the network mode of the
+// container instead of connecting it to a network
+var networkModes = map[string]bool{"host": true, "none": true}
+
 func NewRunJob(c *docker.Client) *RunJob {
 	return &RunJob{Client: c}
 }
@@ -33,11 +165,22 @@ func (j *RunJob) Run(ctx *Context) error {
 	var container *docker.Container
 	var err error
 	if j.Image != "" && j.Container == "" {
-		if err = j.pullImage(); err != nil {
+		if err = j.pullImage(ctx); err != nil {
+			return err
+		}
+
+		var image string
+		image, err = j.verifyImage(ctx, j.Client, j.Image)
+		if err != nil {
+			return err
+		}
+
+		image, err = j.platformImage(image)
+		if err != nil {
 			return err
 		}
 
-		container, err = j.buildContainer()
+		container, err = j.buildContainer(ctx, image)
 		if err != nil {
 			return err
 		}
@@ -48,65 +191,635 @@ func (j *RunJob) Run(ctx *Context) error {
 		}
 	}
 
-	if err := j.startContainer(ctx.Execution, container); err != nil {
+	detach, err := j.attachInput(container.ID)
+	if err != nil {
 		return err
 	}
 
-	if err := j.watchContainer(container.ID); err != nil {
+	started := time.Now()
+	if err := j.startContainer(ctx.Execution, container); err != nil {
 		return err
 	}
 
+	var logs func() error
+	if j.LogsTail == 0 {
+		logs = j.followLogs(ctx.Execution, container.ID, started)
+	}
+
+	err = j.watchContainer(ctx.Execution, container.ID)
+	if detach != nil {
+		if derr := detach(); derr != nil {
+			ctx.Logger.Warningf("Error writing input of container %s: %s", container.ID, derr)
+		}
+	}
+
+	if err == ErrMaxTimeRunning || err == ErrCanceledExecution {
+		j.stopContainer(ctx, container.ID)
+	}
+
+	j.inspectState(ctx, container.ID)
+
+	var lerr error
+	if logs != nil {
+		lerr = logs()
+	} else {
+		lerr = j.fetchLogs(ctx.Execution, container.ID, started)
+	}
+
+	if lerr != nil {
+		ctx.Logger.Warningf("Error fetching logs of container %s: %s", container.ID, lerr)
+	}
+
 	if j.Container == "" {
-		return j.deleteContainer(container.ID)
+		deleted, derr := j.deleteContainer(container.ID, ctx.isFailure(err))
+		if derr != nil && err == nil {
+			err = derr
+		}
+
+		// the image of a kept container can't be removed
+		if deleted {
+			j.removeImage(ctx)
+		}
 	}
-	return nil
+
+	return err
 }
 
-func (j *RunJob) pullImage() error {
+func (j *RunJob) pullImage(ctx *Context) error {
+	switch j.Pull {
+	case PullNever:
+		return nil
+	case PullIfNotPresent:
+		img, err := j.Client.InspectImage(j.Image)
+		if err == nil && j.matchesPlatform(img) {
+			return nil
+		}
+
+		if err != nil && err != docker.ErrNoSuchImage {
+			return fmt.Errorf("error inspecting image %q: %s", j.Image, err)
+		}
+	case PullAlways, "":
+	default:
+		return fmt.Errorf("unknown pull policy %q", j.Pull)
+	}
+
 	o, a := buildPullOptions(j.Image)
-	if err := j.Client.PullImage(o, a); err != nil {
+	o.Platform = j.Platform
+	switch {
+	case j.RegistryUsername != "":
+		a = docker.AuthConfiguration{
+			Username:      j.RegistryUsername,
+			Password:      j.RegistryPassword,
+			ServerAddress: o.Registry,
+		}
+	case j.AuthFile != "":
+		var err error
+		a, err = buildAuthConfigurationFromFile(j.AuthFile, o.Registry)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the pulls of the same image for other platforms aren't shared
+	image := j.Image
+	if j.Platform != "" {
+		image += " " + j.Platform
+	}
+
+	err := ctx.Scheduler.pullImage(ctx, j.Client.Endpoint(), image, o.Registry, func(c context.Context) error {
+		o.Context = c
+		return j.Client.PullImage(o, a)
+	})
+
+	if err != nil {
 		return fmt.Errorf("error pulling image %q: %s", j.Image, err)
 	}
 
 	return nil
 }
 
-func (j *RunJob) buildContainer() (*docker.Container, error) {
+// matchesPlatform returns true if the image is of the os and architecture of
+// the Platform of the job, or if it's not set
+func (j *RunJob) matchesPlatform(img *docker.Image) bool {
+	if j.Platform == "" {
+		return true
+	}
+
+	parts := strings.Split(j.Platform, "/")
+	if len(parts) < 2 {
+		return false
+	}
+
+	return parts[0] == img.OS && parts[1] == img.Architecture
+}
+
+// platformImage returns the ID of the local image of the Platform of the job,
+// so the container is created from the image of the platform and not from the
+// one of the host, the image is returned as is if the Platform isn't set. The
+// Docker client doesn't pass the platform when creating a container.
+func (j *RunJob) platformImage(image string) (string, error) {
+	if j.Platform == "" {
+		return image, nil
+	}
+
+	img, err := j.Client.InspectImage(image)
+	if err != nil {
+		return "", fmt.Errorf("error inspecting image %q: %s", image, err)
+	}
+
+	if !j.matchesPlatform(img) {
+		return "", fmt.Errorf("image %q is %s/%s, not of the platform %q", image, img.OS, img.Architecture, j.Platform)
+	}
+
+	return img.ID, nil
+}
+
+// buildContainer creates the container of the given image, the image of the
+// job, its verified reference by digest or the ID of the image of the
+// platform.
+func (j *RunJob) buildContainer(ctx *Context, image string) (*docker.Container, error) {
+	command, err := ctx.RenderCommand(j.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	volume, err := ctx.RenderAll(j.Volume)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := buildEnvironment(ctx, nil, j.EnvSecret, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var entrypoint []string
+	if j.Entrypoint != "" {
+		entrypoint = args.GetArgs(j.Entrypoint)
+	}
+
+	hostConfig := j.buildHostConfig()
+	volumes := make(map[string]struct{})
+	for _, spec := range volume {
+		src, dst, err := parseVolumeSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		if src == "" {
+			volumes[dst] = struct{}{}
+			continue
+		}
+
+		hostConfig.Binds = append(hostConfig.Binds, spec)
+	}
+
+	for _, spec := range j.VolumesFrom {
+		if err := validateVolumesFromSpec(spec); err != nil {
+			return nil, err
+		}
+
+		hostConfig.VolumesFrom = append(hostConfig.VolumesFrom, spec)
+	}
+
+	for _, spec := range j.Device {
+		d, err := parseDeviceSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		hostConfig.Devices = append(hostConfig.Devices, d)
+	}
+
+	for _, spec := range j.Ulimits {
+		u, err := parseUlimitSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		hostConfig.Ulimits = append(hostConfig.Ulimits, u)
+	}
+
+	for _, spec := range j.Tmpfs {
+		dst, options, err := parseTmpfsSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		if hostConfig.Tmpfs == nil {
+			hostConfig.Tmpfs = make(map[string]string)
+		}
+
+		hostConfig.Tmpfs[dst] = options
+	}
+
+	if j.LogDriver != "" || len(j.LogOpt) != 0 {
+		config, err := parseKeyValueSpecs("log-opt", j.LogOpt)
+		if err != nil {
+			return nil, err
+		}
+
+		hostConfig.LogConfig = docker.LogConfig{Type: j.LogDriver, Config: config}
+	}
+
+	labels, err := parseKeyValueSpecs("label", j.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	if j.GPUs != "" {
+		r, err := parseGPUs(j.GPUs)
+		if err != nil {
+			return nil, err
+		}
+
+		hostConfig.DeviceRequests = append(hostConfig.DeviceRequests, r)
+	}
+
+	networks, err := j.findNetworks()
+	if err != nil {
+		return nil, err
+	}
+
+	// Podman connects the networks when the container is created, the API of
+	// the older versions of Docker only accepts one network there
+	podman := isPodman(j.Client)
+	networkingConfig := &docker.NetworkingConfig{}
+	if podman && len(networks) != 0 {
+		networkingConfig.EndpointsConfig = make(map[string]*docker.EndpointConfig)
+		for _, network := range networks {
+			networkingConfig.EndpointsConfig[network.Name] = &docker.EndpointConfig{Aliases: j.NetworkAlias}
+		}
+	}
+
 	c, err := j.Client.CreateContainer(docker.CreateContainerOptions{
 		Config: &docker.Config{
-			Image:        j.Image,
-			AttachStdin:  false,
+			Image:        image,
+			AttachStdin:  j.hasInput(),
+			OpenStdin:    j.hasInput(),
+			StdinOnce:    j.hasInput(),
 			AttachStdout: true,
 			AttachStderr: true,
 			Tty:          j.TTY,
-			Cmd:          args.GetArgs(j.Command),
+			Cmd:          args.GetArgs(command),
+			Env:          env,
+			Entrypoint:   entrypoint,
+			WorkingDir:   j.Workdir,
+			Hostname:     j.Hostname,
 			User:         j.User,
+			StopSignal:   j.StopSignal,
+			Volumes:      volumes,
+			Labels:       labels,
 		},
-		NetworkingConfig: &docker.NetworkingConfig{},
+		HostConfig:       hostConfig,
+		NetworkingConfig: networkingConfig,
 	})
 
 	if err != nil {
 		return c, fmt.Errorf("error creating exec: %s", err)
 	}
 
-	if j.Network != "" {
-		networkOpts := docker.NetworkFilterOpts{}
-		networkOpts["name"] = map[string]bool{}
-		networkOpts["name"][j.Network] = true
-		if networks, err := j.Client.FilteredListNetworks(networkOpts); err == nil {
-			for _, network := range networks {
-				if err := j.Client.ConnectNetwork(network.ID, docker.NetworkConnectionOptions{
-					Container: c.ID,
-				}); err != nil {
-					return c, fmt.Errorf("error connecting container to network: %s", err)
-				}
-			}
+	if !podman {
+		if err := j.connectNetworks(c, networks); err != nil {
+			return c, err
 		}
 	}
 
 	return c, nil
 }
 
+// findNetworks returns the networks of Network, none if it's a network mode
+func (j *RunJob) findNetworks() ([]docker.Network, error) {
+	if j.Network == "" || networkModes[j.Network] {
+		return nil, nil
+	}
+
+	all, err := j.Client.ListNetworks()
+	if err != nil {
+		return nil, fmt.Errorf("error listing networks: %s", err)
+	}
+
+	var networks []docker.Network
+	for _, name := range strings.Split(j.Network, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		network, ok := findNetwork(all, name)
+		if !ok {
+			return nil, fmt.Errorf("network %q not found", name)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func (j *RunJob) connectNetworks(c *docker.Container, networks []docker.Network) error {
+	for _, network := range networks {
+		opts := docker.NetworkConnectionOptions{Container: c.ID}
+		if len(j.NetworkAlias) != 0 {
+			opts.EndpointConfig = &docker.EndpointConfig{Aliases: j.NetworkAlias}
+		}
+
+		if err := j.Client.ConnectNetwork(network.ID, opts); err != nil {
+			return fmt.Errorf("error connecting container to network %q: %s", network.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// findNetwork returns the network with the exact given name or ID
+func findNetwork(networks []docker.Network, name string) (docker.Network, bool) {
+	for _, n := range networks {
+		if n.Name == name || n.ID == name {
+			return n, true
+		}
+	}
+
+	return docker.Network{}, false
+}
+
+func (j *RunJob) buildHostConfig() *docker.HostConfig {
+	c := &docker.HostConfig{
+		Memory:      j.Memory,
+		MemorySwap:  j.MemorySwap,
+		CPUShares:   j.CPUShares,
+		CPUQuota:    j.CPUQuota,
+		CPUSetCPUs:  j.CPUSet,
+		DNS:         j.DNS,
+		DNSSearch:   j.DNSSearch,
+		ExtraHosts:  j.ExtraHosts,
+		Privileged:  j.Privileged,
+		CapAdd:      j.CapAdd,
+		CapDrop:     j.CapDrop,
+		SecurityOpt: j.SecurityOpt,
+		ShmSize:     j.ShmSize,
+	}
+
+	if networkModes[j.Network] {
+		c.NetworkMode = j.Network
+	}
+
+	return c
+}
+
+var (
+	volumeNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	volumeModes      = map[string]string{
+		"ro": "rw", "rw": "ro",
+		"z": "Z", "Z": "z",
+		"nocopy": "",
+		"shared": "", "rshared": "",
+		"slave": "", "rslave": "",
+		"private": "", "rprivate": "",
+	}
+)
+
+// validateVolumesFromSpec validates a volumes-from spec with the syntax
+// `container[:ro|rw]`
+func validateVolumesFromSpec(spec string) error {
+	parts := strings.Split(spec, ":")
+	if parts[0] == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "ro" && parts[1] != "rw") {
+		return fmt.Errorf("invalid volumes-from %q", spec)
+	}
+
+	return nil
+}
+
+// parseVolumeSpec validates a volume spec with the syntax
+// `[src:]dst[:ro|rw[,z|Z]]`, returning its source and destination. For
+// anonymous volumes the returned source is empty.
+func parseVolumeSpec(spec string) (src, dst string, err error) {
+	var mode string
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 1:
+		dst = parts[0]
+	case 2:
+		src, dst = parts[0], parts[1]
+	case 3:
+		src, dst, mode = parts[0], parts[1], parts[2]
+	default:
+		return "", "", fmt.Errorf("invalid volume %q: too many colons", spec)
+	}
+
+	if !path.IsAbs(dst) {
+		return "", "", fmt.Errorf("invalid volume %q: destination must be an absolute path", spec)
+	}
+
+	if src != "" && !path.IsAbs(src) && !volumeNameRegexp.MatchString(src) {
+		return "", "", fmt.Errorf("invalid volume %q: source must be an absolute path or a volume name", spec)
+	}
+
+	if src == "" && len(parts) > 1 {
+		return "", "", fmt.Errorf("invalid volume %q: empty source", spec)
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range strings.Split(mode, ",") {
+		if m == "" && mode == "" {
+			continue
+		}
+
+		conflict, ok := volumeModes[m]
+		if !ok {
+			return "", "", fmt.Errorf("invalid volume %q: unknown mode %q", spec, m)
+		}
+
+		if seen[m] || (conflict != "" && seen[conflict]) {
+			return "", "", fmt.Errorf("invalid volume %q: conflicting mode %q", spec, m)
+		}
+
+		seen[m] = true
+	}
+
+	return src, dst, nil
+}
+
+// parseDeviceSpec parses a device with the syntax
+// `host[:container][:permissions]`, by default the device has the same path in
+// the container and all the permissions.
+func parseDeviceSpec(spec string) (docker.Device, error) {
+	d := docker.Device{CgroupPermissions: "rwm"}
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 1:
+		d.PathOnHost = parts[0]
+	case 2:
+		d.PathOnHost = parts[0]
+		if isDevicePermissions(parts[1]) {
+			d.CgroupPermissions = parts[1]
+		} else {
+			d.PathInContainer = parts[1]
+		}
+	case 3:
+		d.PathOnHost, d.PathInContainer, d.CgroupPermissions = parts[0], parts[1], parts[2]
+	default:
+		return d, fmt.Errorf("invalid device %q: too many colons", spec)
+	}
+
+	if d.PathInContainer == "" {
+		d.PathInContainer = d.PathOnHost
+	}
+
+	if !path.IsAbs(d.PathOnHost) || !path.IsAbs(d.PathInContainer) {
+		return d, fmt.Errorf("invalid device %q: paths must be absolute", spec)
+	}
+
+	if !isDevicePermissions(d.CgroupPermissions) {
+		return d, fmt.Errorf("invalid device %q: unknown permissions %q", spec, d.CgroupPermissions)
+	}
+
+	return d, nil
+}
+
+func isDevicePermissions(p string) bool {
+	if p == "" || len(p) > 3 {
+		return false
+	}
+
+	for _, c := range p {
+		if !strings.ContainsRune("rwm", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseKeyValueSpecs parses the values of an option with the syntax
+// `key=value` into a map, nil if there are no values
+func parseKeyValueSpecs(option string, specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	m := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid %s %q: expected key=value", option, spec)
+		}
+
+		m[parts[0]] = parts[1]
+	}
+
+	return m, nil
+}
+
+// parseUlimitSpec parses an ulimit with the syntax `name=soft[:hard]`, the hard
+// limit is the soft one if it's not given, -1 means unlimited.
+func parseUlimitSpec(spec string) (docker.ULimit, error) {
+	u := docker.ULimit{}
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return u, fmt.Errorf("invalid ulimit %q: expected name=soft[:hard]", spec)
+	}
+
+	limits := strings.Split(parts[1], ":")
+	if len(limits) > 2 {
+		return u, fmt.Errorf("invalid ulimit %q: too many colons", spec)
+	}
+
+	var err error
+	u.Name = parts[0]
+	if u.Soft, err = strconv.ParseInt(limits[0], 10, 64); err != nil {
+		return u, fmt.Errorf("invalid ulimit %q: invalid soft limit %q", spec, limits[0])
+	}
+
+	u.Hard = u.Soft
+	if len(limits) == 2 {
+		if u.Hard, err = strconv.ParseInt(limits[1], 10, 64); err != nil {
+			return u, fmt.Errorf("invalid ulimit %q: invalid hard limit %q", spec, limits[1])
+		}
+	}
+
+	if u.Hard != -1 && (u.Soft == -1 || u.Soft > u.Hard) {
+		return u, fmt.Errorf("invalid ulimit %q: soft limit greater than hard limit", spec)
+	}
+
+	return u, nil
+}
+
+// parseTmpfsSpec parses a tmpfs mount with the syntax `path[:options]` into
+// the path in the container and the mount options.
+func parseTmpfsSpec(spec string) (dst, options string, err error) {
+	parts := strings.SplitN(spec, ":", 2)
+	dst = parts[0]
+	if len(parts) == 2 {
+		options = parts[1]
+	}
+
+	if !path.IsAbs(dst) {
+		return "", "", fmt.Errorf("invalid tmpfs %q: path must be absolute", spec)
+	}
+
+	return dst, options, nil
+}
+
+// parseGPUs parses the value of the gpus option, `all`, a number of GPUs or
+// `device=<id>[,<id>...]`, into a device request.
+func parseGPUs(gpus string) (docker.DeviceRequest, error) {
+	r := docker.DeviceRequest{Capabilities: [][]string{{"gpu"}}}
+	switch {
+	case gpus == "all":
+		r.Count = -1
+	case strings.HasPrefix(gpus, "device="):
+		r.DeviceIDs = strings.Split(strings.TrimPrefix(gpus, "device="), ",")
+	default:
+		count, err := strconv.Atoi(gpus)
+		if err != nil || count <= 0 {
+			return r, fmt.Errorf("invalid gpus %q", gpus)
+		}
+
+		r.Count = count
+	}
+
+	return r, nil
+}
+
+func (j *RunJob) hasInput() bool {
+	return j.Input != "" || j.InputFile != ""
+}
+
+// attachInput attaches the input of the job to the stdin of the container, it
+// must be called before the container is started. The returned function
+// detaches it, returning the error writing the input, if any.
+func (j *RunJob) attachInput(containerID string) (func() error, error) {
+	input, err := openInput(j.Input, j.InputFile)
+	if err != nil || input == nil {
+		return nil, err
+	}
+
+	success := make(chan struct{})
+	w, err := j.Client.AttachToContainerNonBlocking(docker.AttachToContainerOptions{
+		Container:   containerID,
+		InputStream: input,
+		Stdin:       true,
+		Stream:      true,
+		Success:     success,
+	})
+	if err != nil {
+		input.Close()
+		return nil, fmt.Errorf("error attaching to container: %s", err)
+	}
+
+	// waits for the connection, the input is written once it's established
+	<-success
+	success <- struct{}{}
+
+	return func() error {
+		defer input.Close()
+
+		w.Close()
+		return w.Wait()
+	}, nil
+}
+
 func (j *RunJob) startContainer(e *Execution, c *docker.Container) error {
 	return j.Client.StartContainer(c.ID, &docker.HostConfig{})
 }
@@ -122,46 +835,205 @@ func (j *RunJob) getContainer(id string) (*docker.Container, error) {
 const (
 	watchDuration      = time.Millisecond * 100
 	maxProcessDuration = time.Hour * 24
+	defaultStopGrace   = time.Second * 10
 )
 
-func (j *RunJob) watchContainer(containerID string) error {
-	var s docker.State
-	var r time.Duration
-	for {
-		time.Sleep(watchDuration)
-		r += watchDuration
+func (j *RunJob) watchContainer(e *Execution, containerID string) error {
+	maxRuntime := j.MaxRuntime
+	if maxRuntime == 0 {
+		maxRuntime = maxProcessDuration
+	}
 
-		if r > maxProcessDuration {
-			return ErrMaxTimeRunning
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), maxRuntime)
+	defer cancel()
 
-		c, err := j.Client.InspectContainer(containerID)
-		if err != nil {
-			return err
+	go func() {
+		select {
+		case <-e.Done():
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
 
-		if !c.State.Running {
-			s = c.State
-			break
-		}
+	exitCode, err := j.Client.WaitContainerWithContext(containerID, ctx)
+	if err != nil && ctx.Err() == nil {
+		// the wait request can fail, e.g. if the connection to the daemon is
+		// closed while waiting, on that case we fall back to polling.
+		exitCode, err = j.pollContainer(ctx, containerID)
+	}
+
+	switch {
+	case e.IsCanceled():
+		return ErrCanceledExecution
+	case ctx.Err() == context.DeadlineExceeded:
+		return ErrMaxTimeRunning
+	case err != nil:
+		return err
 	}
 
-	switch s.ExitCode {
+	switch exitCode {
 	case 0:
 		return nil
 	case -1:
 		return ErrUnexpected
 	default:
-		return fmt.Errorf("error non-zero exit code: %d", s.ExitCode)
+		return &ExitCodeError{ExitCode: exitCode}
 	}
 }
 
-func (j *RunJob) deleteContainer(containerID string) error {
-	if !j.Delete {
-		return nil
+// pollContainer inspects the container until it stops and returns its exit
+// code, or the error of the context if it is done first
+func (j *RunJob) pollContainer(ctx context.Context, containerID string) (int, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(watchDuration):
+		}
+
+		c, err := j.Client.InspectContainer(containerID)
+		if err != nil {
+			return 0, err
+		}
+
+		if !c.State.Running {
+			return c.State.ExitCode, nil
+		}
+	}
+}
+
+// inspectState sets the final state of the container in the execution
+func (j *RunJob) inspectState(ctx *Context, containerID string) {
+	c, err := j.Client.InspectContainer(containerID)
+	if err != nil {
+		ctx.Logger.Warningf("Error inspecting container %s: %s", containerID, err)
+		return
+	}
+
+	state := &ContainerState{
+		ExitCode:  c.State.ExitCode,
+		OOMKilled: c.State.OOMKilled,
+		Error:     c.State.Error,
 	}
 
-	return j.Client.RemoveContainer(docker.RemoveContainerOptions{
+	ctx.Execution.update(func() { ctx.Execution.Container = state })
+}
+
+func (j *RunJob) stopContainer(ctx *Context, containerID string) {
+	grace := j.StopGrace
+	if grace == 0 {
+		grace = defaultStopGrace
+	}
+
+	err := j.Client.StopContainer(containerID, uint(math.Ceil(grace.Seconds())))
+	if err != nil {
+		ctx.Logger.Errorf("Error stopping container %s: %s", containerID, err)
+	}
+}
+
+// followLogs writes the logs of the container since the given time to the
+// output of the execution while it runs. The returned function waits for the
+// logs once the container stops, they stop being followed after logsGrace if
+// it's still running, e.g. if it couldn't be stopped.
+func (j *RunJob) followLogs(e *Execution, containerID string, since time.Time) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- j.Client.Logs(docker.LogsOptions{
+			Context:      ctx,
+			Container:    containerID,
+			OutputStream: e.OutputStream,
+			ErrorStream:  e.ErrorStream,
+			Stdout:       true,
+			Stderr:       true,
+			Follow:       true,
+			Since:        since.Unix(),
+			Tail:         "all",
+			RawTerminal:  j.TTY,
+		})
+	}()
+
+	return func() error {
+		defer cancel()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(logsGrace):
+			cancel()
+			return <-done
+		}
+	}
+}
+
+// fetchLogs writes the logs of the container since the given time, the last
+// LogsTail lines, to the output of the execution
+func (j *RunJob) fetchLogs(e *Execution, containerID string, since time.Time) error {
+	tail := "all"
+	if j.LogsTail > 0 {
+		tail = strconv.Itoa(j.LogsTail)
+	}
+
+	return j.Client.Logs(docker.LogsOptions{
+		Container:    containerID,
+		OutputStream: e.OutputStream,
+		ErrorStream:  e.ErrorStream,
+		Stdout:       true,
+		Stderr:       true,
+		Since:        since.Unix(),
+		Tail:         tail,
+		RawTerminal:  j.TTY,
+	})
+}
+
+// removeImage removes the image of the job if AutoRemoveImage is set, the
+// errors, e.g. the image being used by other containers, are only logged.
+func (j *RunJob) removeImage(ctx *Context) {
+	if !j.AutoRemoveImage {
+		return
+	}
+
+	if err := j.Client.RemoveImage(j.Image); err != nil {
+		ctx.Logger.Warningf("Image %q cannot be removed: %s", j.Image, err)
+	}
+}
+
+// deleteContainer deletes the container according to the delete policy, the
+// containers of the failed executions are kept with DeleteOnSuccess. It
+// returns true if the container was deleted.
+func (j *RunJob) deleteContainer(containerID string, failed bool) (bool, error) {
+	if ok, err := shouldDelete(j.Delete, failed); !ok {
+		return false, err
+	}
+
+	err := j.Client.RemoveContainer(docker.RemoveContainerOptions{
 		ID: containerID,
 	})
+
+	return err == nil, err
+}
+
+// ValidateDelete returns an error if the delete policy is unknown
+func ValidateDelete(policy DeletePolicy) error {
+	_, err := shouldDelete(policy, false)
+	return err
+}
+
+// shouldDelete returns true if the resources of the execution have to be
+// deleted according to the given delete policy, failed is the result of the
+// execution, see Context.isFailure
+func shouldDelete(policy DeletePolicy, failed bool) (bool, error) {
+	if policy == "" {
+		return true, nil
+	}
+
+	if strings.EqualFold(string(policy), string(DeleteOnSuccess)) {
+		return !failed, nil
+	}
+
+	del, err := types.ParseBool(string(policy))
+	if err != nil {
+		return false, fmt.Errorf("unknown delete policy %q", policy)
+	}
+
+	return del, nil
 }
@@ -3,6 +3,14 @@ package core
 import (
 	"archive/tar"
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -38,7 +46,7 @@ func (s *SuiteRunJob) TestRun(c *C) {
 	job.Command = `echo -a "foo bar"`
 	job.User = "foo"
 	job.TTY = true
-	job.Delete = true
+	job.Delete = DeleteAlways
 	job.Network = "foo"
 
 	e := NewExecution()
@@ -59,9 +67,12 @@ func (s *SuiteRunJob) TestRun(c *C) {
 		wg.Done()
 	}()
 
-	err := job.Run(&Context{Execution: e})
+	err := job.Run(&Context{Execution: e, Logger: &TestLogger{}})
 	c.Assert(err, IsNil)
 	wg.Wait()
+	// the logs are followed while the container runs
+	c.Assert(string(e.Output()), Matches, "Container is running\n(?s).*What happened\\?.*")
+	c.Assert(e.Container, DeepEquals, &ContainerState{})
 
 	containers, err := s.client.ListContainers(docker.ListContainersOptions{
 		All: true,
@@ -70,6 +81,744 @@ func (s *SuiteRunJob) TestRun(c *C) {
 	c.Assert(containers, HasLen, 0)
 }
 
+func (s *SuiteRunJob) TestRunLogsTail(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = "echo foo"
+	job.TTY = true
+	job.Delete = DeleteAlways
+	job.LogsTail = 10
+
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+
+		containers, err := s.client.ListContainers(docker.ListContainersOptions{})
+		c.Assert(err, IsNil)
+		c.Assert(s.client.StopContainer(containers[0].ID, 0), IsNil)
+	}()
+
+	// the logs are fetched once the container finishes
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e, Logger: &TestLogger{}})
+	c.Assert(err, IsNil)
+	c.Assert(string(e.Output()), Matches, "Container is not running\n(?s).*")
+}
+
+func (s *SuiteRunJob) TestRunMaxRuntime(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `sleep 10`
+	job.Delete = DeleteAlways
+	job.MaxRuntime = time.Millisecond * 300
+
+	e := NewExecution()
+
+	err := job.Run(&Context{Execution: e, Logger: &TestLogger{}})
+	c.Assert(err, Equals, ErrMaxTimeRunning)
+
+	containers, err := s.client.ListContainers(docker.ListContainersOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(containers, HasLen, 0)
+}
+
+func (s *SuiteRunJob) TestRunStopSignal(c *C) {
+	var timeout string
+	s.server.SetHook(func(r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/stop") {
+			timeout = r.URL.Query().Get("t")
+		}
+	})
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Pull = PullNever
+	job.Delete = DeleteNever
+	job.StopSignal = "SIGINT"
+	job.StopGrace = time.Millisecond * 1500
+	job.MaxRuntime = time.Millisecond * 100
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, Equals, ErrMaxTimeRunning)
+	c.Assert(timeout, Equals, "2")
+
+	containers, err := s.client.ListContainers(docker.ListContainersOptions{All: true})
+	c.Assert(err, IsNil)
+	c.Assert(containers, HasLen, 1)
+
+	container, err := s.client.InspectContainer(containers[0].ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.Config.StopSignal, Equals, "SIGINT")
+}
+
+func (s *SuiteRunJob) TestRunAutoRemoveImage(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Pull = PullNever
+	job.Delete = DeleteAlways
+	job.AutoRemoveImage = true
+	job.MaxRuntime = time.Millisecond * 100
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, Equals, ErrMaxTimeRunning)
+
+	_, err = s.client.InspectImage(ImageFixture)
+	c.Assert(err, Equals, docker.ErrNoSuchImage)
+}
+
+func (s *SuiteRunJob) TestRunAutoRemoveImageKept(c *C) {
+	var removes int
+	s.server.SetHook(func(r *http.Request) {
+		if r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/images/") {
+			removes++
+		}
+	})
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Pull = PullNever
+	job.Delete = DeleteNever
+	job.AutoRemoveImage = true
+	job.MaxRuntime = time.Millisecond * 100
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, Equals, ErrMaxTimeRunning)
+	c.Assert(removes, Equals, 0)
+
+	_, err = s.client.InspectImage(ImageFixture)
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteRunJob) TestRunInput(c *C) {
+	input := make(chan string, 1)
+	s.server.CustomHandler("/containers/.*/attach", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Query().Get("stdin"), Equals, "1")
+
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		c.Assert(err, IsNil)
+		defer conn.Close()
+
+		b, _ := ioutil.ReadAll(conn)
+		input <- string(b)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Pull = PullNever
+	job.Input = "SELECT 1;\n"
+	job.MaxRuntime = time.Millisecond * 100
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, Equals, ErrMaxTimeRunning)
+	c.Assert(<-input, Equals, "SELECT 1;\n")
+}
+
+func (s *SuiteRunJob) TestBuildContainerInput(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.InputFile = "/etc/ofelia/backup.sql"
+
+	container, err := job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.Config.AttachStdin, Equals, true)
+	c.Assert(container.Config.OpenStdin, Equals, true)
+	c.Assert(container.Config.StdinOnce, Equals, true)
+
+	_, err = job.attachInput(container.ID)
+	c.Assert(err, ErrorMatches, "error reading input file: .*")
+}
+
+func (s *SuiteRunJob) TestDeleteContainer(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+
+	container, err := job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, IsNil)
+
+	job.Delete = DeleteNever
+	deleted, err := job.deleteContainer(container.ID, false)
+	c.Assert(err, IsNil)
+	c.Assert(deleted, Equals, false)
+
+	job.Delete = DeleteOnSuccess
+	deleted, err = job.deleteContainer(container.ID, true)
+	c.Assert(err, IsNil)
+	c.Assert(deleted, Equals, false)
+
+	job.Delete = "foo"
+	_, err = job.deleteContainer(container.ID, false)
+	c.Assert(err, ErrorMatches, `unknown delete policy "foo"`)
+
+	_, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+
+	job.Delete = DeleteOnSuccess
+	deleted, err = job.deleteContainer(container.ID, false)
+	c.Assert(err, IsNil)
+	c.Assert(deleted, Equals, true)
+
+	_, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, FitsTypeOf, &docker.NoSuchContainer{})
+}
+
+func (s *SuiteRunJob) TestShouldDelete(c *C) {
+	for policy, expected := range map[DeletePolicy]bool{
+		"": true, "true": true, "yes": true, "on": true, "1": true, "True": true,
+		"false": false, "no": false, "off": false, "0": false, "False": false,
+	} {
+		del, err := shouldDelete(policy, true)
+		c.Assert(err, IsNil, Commentf("%s", policy))
+		c.Assert(del, Equals, expected, Commentf("%s", policy))
+	}
+
+	del, err := shouldDelete("On-Success", true)
+	c.Assert(err, IsNil)
+	c.Assert(del, Equals, false)
+
+	_, err = shouldDelete("2", false)
+	c.Assert(err, ErrorMatches, `unknown delete policy "2"`)
+}
+
+func (s *SuiteRunJob) TestPullImagePolicy(c *C) {
+	var pulls int
+	s.server.SetHook(func(r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/images/create") {
+			pulls++
+		}
+	})
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+
+	job.Pull = PullNever
+	c.Assert(job.pullImage(&Context{Execution: NewExecution()}), IsNil)
+	c.Assert(pulls, Equals, 0)
+
+	job.Pull = PullIfNotPresent
+	c.Assert(job.pullImage(&Context{Execution: NewExecution()}), IsNil)
+	c.Assert(pulls, Equals, 0)
+
+	job.Pull = PullAlways
+	c.Assert(job.pullImage(&Context{Execution: NewExecution()}), IsNil)
+	c.Assert(pulls, Equals, 1)
+
+	job.Image = "missing-image"
+	job.Pull = PullIfNotPresent
+	c.Assert(job.pullImage(&Context{Execution: NewExecution()}), IsNil)
+	c.Assert(pulls, Equals, 2)
+
+	job.Pull = "foo"
+	c.Assert(job.pullImage(&Context{Execution: NewExecution()}), NotNil)
+}
+
+func (s *SuiteRunJob) TestPullImagePlatform(c *C) {
+	// the platform requires API 1.32, not routed by the fake server
+	var platforms []string
+	s.server.CustomHandler("/v1.32/images/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		platforms = append(platforms, r.URL.Query().Get("platform"))
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Platform = "linux/arm64"
+
+	job.Pull = PullAlways
+	c.Assert(job.pullImage(&Context{Execution: NewExecution()}), IsNil)
+	c.Assert(platforms, DeepEquals, []string{"linux/arm64"})
+
+	// the image of the fake server has no platform
+	job.Pull = PullIfNotPresent
+	c.Assert(job.pullImage(&Context{Execution: NewExecution()}), IsNil)
+	c.Assert(platforms, HasLen, 2)
+
+	img := &docker.Image{OS: "linux", Architecture: "arm64"}
+	c.Assert(job.matchesPlatform(img), Equals, true)
+
+	job.Platform = "linux/amd64"
+	c.Assert(job.matchesPlatform(img), Equals, false)
+
+	job.Platform = ""
+	c.Assert(job.matchesPlatform(img), Equals, true)
+}
+
+func (s *SuiteRunJob) TestPlatformImage(c *C) {
+	s.server.CustomHandler("/images/foo:v1/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(docker.Image{ID: "sha256:abc", OS: "linux", Architecture: "arm64"})
+	}))
+
+	job := &RunJob{Client: s.client}
+	image, err := job.platformImage("foo:v1")
+	c.Assert(err, IsNil)
+	c.Assert(image, Equals, "foo:v1")
+
+	job.Platform = "linux/arm64"
+	image, err = job.platformImage("foo:v1")
+	c.Assert(err, IsNil)
+	c.Assert(image, Equals, "sha256:abc")
+
+	job.Platform = "linux/amd64"
+	_, err = job.platformImage("foo:v1")
+	c.Assert(err, ErrorMatches, `image "foo:v1" is linux/arm64, not of the platform "linux/amd64"`)
+}
+
+func (s *SuiteRunJob) TestPullImageRegistryAuth(c *C) {
+	var auth docker.AuthConfiguration
+	s.server.SetHook(func(r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/images/create") {
+			js, _ := base64.URLEncoding.DecodeString(r.Header.Get("X-Registry-Auth"))
+			json.Unmarshal(js, &auth)
+		}
+	})
+
+	job := &RunJob{Client: s.client}
+	job.Image = "quay.io/srcd/rest:qux"
+	job.RegistryUsername = "foo"
+	job.RegistryPassword = "bar"
+	c.Assert(job.pullImage(&Context{Execution: NewExecution()}), IsNil)
+	c.Assert(auth.Username, Equals, "foo")
+	c.Assert(auth.Password, Equals, "bar")
+	c.Assert(auth.ServerAddress, Equals, "quay.io")
+
+	dir, err := ioutil.TempDir("", "auth")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(filename, []byte(`{"auths": {"quay.io": {"auth": "cXV4OmJheg=="}}}`), 0600)
+	c.Assert(err, IsNil)
+
+	job.RegistryUsername = ""
+	job.AuthFile = filename
+	c.Assert(job.pullImage(&Context{Execution: NewExecution()}), IsNil)
+	c.Assert(auth.Username, Equals, "qux")
+	c.Assert(auth.Password, Equals, "baz")
+
+	job.AuthFile = filepath.Join(dir, "missing.json")
+	c.Assert(job.pullImage(&Context{Execution: NewExecution()}), NotNil)
+}
+
+func (s *SuiteRunJob) TestBuildContainerEntrypoint(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = "-c 'echo foo'"
+	job.Entrypoint = "/bin/sh"
+	job.Workdir = "/tmp"
+
+	container, err := job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.Config.Entrypoint, DeepEquals, []string{"/bin/sh"})
+	c.Assert(container.Config.Cmd, DeepEquals, []string{"-c", "echo foo"})
+	c.Assert(container.Config.WorkingDir, Equals, "/tmp")
+}
+
+func (s *SuiteRunJob) TestBuildContainerVolumes(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Volume = []string{"/tmp:/data:ro", "cache:/cache", "/anonymous"}
+
+	container, err := job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.HostConfig.Binds, DeepEquals, []string{"/tmp:/data:ro", "cache:/cache"})
+	c.Assert(container.Config.Volumes, DeepEquals, map[string]struct{}{"/anonymous": {}})
+}
+
+func (s *SuiteRunJob) TestBuildContainerVolumesFrom(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.VolumesFrom = []string{"foo", "bar:ro"}
+
+	container, err := job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.HostConfig.VolumesFrom, DeepEquals, []string{"foo", "bar:ro"})
+
+	job.VolumesFrom = []string{"foo:rx"}
+	_, err = job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, ErrorMatches, `invalid volumes-from "foo:rx"`)
+}
+
+func (s *SuiteRunJob) TestBuildContainerLogsLabels(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.LogDriver = "syslog"
+	job.LogOpt = []string{"syslog-address=udp://127.0.0.1:514", "tag=backup"}
+	job.Labels = []string{"team=data", "cost-center=42"}
+
+	container, err := job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.HostConfig.LogConfig, DeepEquals, docker.LogConfig{
+		Type:   "syslog",
+		Config: map[string]string{"syslog-address": "udp://127.0.0.1:514", "tag": "backup"},
+	})
+	c.Assert(container.Config.Labels, DeepEquals, map[string]string{"team": "data", "cost-center": "42"})
+}
+
+func (s *SuiteRunJob) TestBuildContainerInvalidLabels(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Labels = []string{"team"}
+
+	_, err := job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, ErrorMatches, `invalid label "team": expected key=value`)
+
+	job.Labels = nil
+	job.LogOpt = []string{"=foo"}
+	_, err = job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, ErrorMatches, `invalid log-opt "=foo": expected key=value`)
+}
+
+func (s *SuiteRunJob) TestBuildContainerTemplate(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Name = "backup"
+	job.Image = ImageFixture
+	job.Command = `tar -czf /backup/{{.JobName}}-{{.Date "2006-01-02"}}.tgz /data`
+	job.Volume = []string{"/srv/{{.JobName}}:/backup"}
+	job.Templates = true
+
+	e := NewExecution()
+	e.Date = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	container, err := job.buildContainer(&Context{Job: job, Execution: e}, job.Image)
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.Config.Cmd, DeepEquals, []string{"tar", "-czf", "/backup/backup-2020-01-02.tgz", "/data"})
+	c.Assert(container.HostConfig.Binds, DeepEquals, []string{"/srv/backup:/backup"})
+	c.Assert(container.Config.Env, DeepEquals, []string{"OFELIA_EXECUTION_ID=" + e.ID})
+}
+
+func (s *SuiteRunJob) TestParseVolumeSpec(c *C) {
+	testcases := []struct {
+		Spec  string
+		Src   string
+		Dst   string
+		Valid bool
+	}{
+		{"/data", "", "/data", true},
+		{"/tmp:/data", "/tmp", "/data", true},
+		{"/tmp:/data:ro", "/tmp", "/data", true},
+		{"/tmp:/data:rw,Z", "/tmp", "/data", true},
+		{"my-volume:/data:ro,z,nocopy", "my-volume", "/data", true},
+		{"data", "", "", false},
+		{"/tmp:data", "", "", false},
+		{"./tmp:/data", "", "", false},
+		{":/data", "", "", false},
+		{"/tmp:/data:ro,rw", "", "", false},
+		{"/tmp:/data:z,Z", "", "", false},
+		{"/tmp:/data:foo", "", "", false},
+		{"/tmp:/data:ro:rw", "", "", false},
+	}
+
+	for _, t := range testcases {
+		src, dst, err := parseVolumeSpec(t.Spec)
+		if !t.Valid {
+			c.Assert(err, NotNil, Commentf("%s", t.Spec))
+			continue
+		}
+
+		c.Assert(err, IsNil, Commentf("%s", t.Spec))
+		c.Assert(src, Equals, t.Src)
+		c.Assert(dst, Equals, t.Dst)
+	}
+}
+
+func (s *SuiteRunJob) TestParseDeviceSpec(c *C) {
+	testcases := []struct {
+		Spec   string
+		Device docker.Device
+		Valid  bool
+	}{
+		{"/dev/sda", docker.Device{PathOnHost: "/dev/sda", PathInContainer: "/dev/sda", CgroupPermissions: "rwm"}, true},
+		{"/dev/sda:r", docker.Device{PathOnHost: "/dev/sda", PathInContainer: "/dev/sda", CgroupPermissions: "r"}, true},
+		{"/dev/sda:/dev/xvda", docker.Device{PathOnHost: "/dev/sda", PathInContainer: "/dev/xvda", CgroupPermissions: "rwm"}, true},
+		{"/dev/sda:/dev/xvda:rw", docker.Device{PathOnHost: "/dev/sda", PathInContainer: "/dev/xvda", CgroupPermissions: "rw"}, true},
+		{"sda", docker.Device{}, false},
+		{"/dev/sda:xvda", docker.Device{}, false},
+		{"/dev/sda:/dev/xvda:foo", docker.Device{}, false},
+		{"/dev/sda:/dev/xvda:r:w", docker.Device{}, false},
+	}
+
+	for _, t := range testcases {
+		d, err := parseDeviceSpec(t.Spec)
+		if !t.Valid {
+			c.Assert(err, NotNil, Commentf("%s", t.Spec))
+			continue
+		}
+
+		c.Assert(err, IsNil, Commentf("%s", t.Spec))
+		c.Assert(d, DeepEquals, t.Device)
+	}
+}
+
+func (s *SuiteRunJob) TestParseGPUs(c *C) {
+	r, err := parseGPUs("all")
+	c.Assert(err, IsNil)
+	c.Assert(r, DeepEquals, docker.DeviceRequest{Count: -1, Capabilities: [][]string{{"gpu"}}})
+
+	r, err = parseGPUs("2")
+	c.Assert(err, IsNil)
+	c.Assert(r.Count, Equals, 2)
+
+	r, err = parseGPUs("device=0,GPU-3a23c669")
+	c.Assert(err, IsNil)
+	c.Assert(r.DeviceIDs, DeepEquals, []string{"0", "GPU-3a23c669"})
+
+	_, err = parseGPUs("foo")
+	c.Assert(err, ErrorMatches, `invalid gpus "foo"`)
+}
+
+func (s *SuiteRunJob) TestBuildContainerDevices(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Device = []string{"/dev/fuse"}
+	job.GPUs = "all"
+
+	container, err := job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.HostConfig.Devices, HasLen, 1)
+	c.Assert(container.HostConfig.Devices[0].PathOnHost, Equals, "/dev/fuse")
+	c.Assert(container.HostConfig.DeviceRequests, HasLen, 1)
+	c.Assert(container.HostConfig.DeviceRequests[0].Count, Equals, -1)
+
+	job.Device = []string{"fuse"}
+	_, err = job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteRunJob) TestParseUlimitSpec(c *C) {
+	testcases := []struct {
+		Spec   string
+		Ulimit docker.ULimit
+		Valid  bool
+	}{
+		{"nofile=1024", docker.ULimit{Name: "nofile", Soft: 1024, Hard: 1024}, true},
+		{"nofile=1024:2048", docker.ULimit{Name: "nofile", Soft: 1024, Hard: 2048}, true},
+		{"memlock=-1:-1", docker.ULimit{Name: "memlock", Soft: -1, Hard: -1}, true},
+		{"nofile", docker.ULimit{}, false},
+		{"=1024", docker.ULimit{}, false},
+		{"nofile=foo", docker.ULimit{}, false},
+		{"nofile=1024:foo", docker.ULimit{}, false},
+		{"nofile=2048:1024", docker.ULimit{}, false},
+		{"nofile=1:2:3", docker.ULimit{}, false},
+	}
+
+	for _, t := range testcases {
+		u, err := parseUlimitSpec(t.Spec)
+		if !t.Valid {
+			c.Assert(err, NotNil, Commentf("%s", t.Spec))
+			continue
+		}
+
+		c.Assert(err, IsNil, Commentf("%s", t.Spec))
+		c.Assert(u, DeepEquals, t.Ulimit)
+	}
+}
+
+func (s *SuiteRunJob) TestParseTmpfsSpec(c *C) {
+	dst, options, err := parseTmpfsSpec("/tmp")
+	c.Assert(err, IsNil)
+	c.Assert(dst, Equals, "/tmp")
+	c.Assert(options, Equals, "")
+
+	dst, options, err = parseTmpfsSpec("/run:rw,size=64m")
+	c.Assert(err, IsNil)
+	c.Assert(dst, Equals, "/run")
+	c.Assert(options, Equals, "rw,size=64m")
+
+	_, _, err = parseTmpfsSpec("tmp:rw")
+	c.Assert(err, ErrorMatches, `invalid tmpfs "tmp:rw": path must be absolute`)
+}
+
+func (s *SuiteRunJob) TestBuildContainerResources(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Memory = 1024 * 1024 * 64
+	job.MemorySwap = 1024 * 1024 * 128
+	job.CPUShares = 512
+	job.CPUQuota = 50000
+	job.CPUSet = "0,1"
+	job.Ulimits = []string{"nofile=1024:2048"}
+	job.ShmSize = 1024 * 1024 * 256
+	job.Tmpfs = []string{"/tmp:size=64m", "/run"}
+
+	container, err := job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.HostConfig.Memory, Equals, int64(1024*1024*64))
+	c.Assert(container.HostConfig.MemorySwap, Equals, int64(1024*1024*128))
+	c.Assert(container.HostConfig.CPUShares, Equals, int64(512))
+	c.Assert(container.HostConfig.CPUQuota, Equals, int64(50000))
+	c.Assert(container.HostConfig.CPUSetCPUs, Equals, "0,1")
+	c.Assert(container.HostConfig.Ulimits, DeepEquals, []docker.ULimit{{Name: "nofile", Soft: 1024, Hard: 2048}})
+	c.Assert(container.HostConfig.ShmSize, Equals, int64(1024*1024*256))
+	c.Assert(container.HostConfig.Tmpfs, DeepEquals, map[string]string{"/tmp": "size=64m", "/run": ""})
+
+	job.Tmpfs = []string{"tmp"}
+	_, err = job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteRunJob) TestBuildContainerNetworking(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Network = "host"
+	job.Hostname = "foo"
+	job.DNS = []string{"8.8.8.8"}
+	job.DNSSearch = []string{"example.com"}
+	job.ExtraHosts = []string{"bar:10.0.0.1"}
+
+	container, err := job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.HostConfig.NetworkMode, Equals, "host")
+	c.Assert(container.HostConfig.DNS, DeepEquals, []string{"8.8.8.8"})
+	c.Assert(container.HostConfig.DNSSearch, DeepEquals, []string{"example.com"})
+	c.Assert(container.HostConfig.ExtraHosts, DeepEquals, []string{"bar:10.0.0.1"})
+}
+
+func (s *SuiteRunJob) TestBuildContainerSecurity(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Privileged = true
+	job.CapAdd = []string{"NET_ADMIN"}
+	job.CapDrop = []string{"MKNOD"}
+	job.SecurityOpt = []string{"apparmor=unconfined"}
+
+	container, err := job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.HostConfig.Privileged, Equals, true)
+	c.Assert(container.HostConfig.CapAdd, DeepEquals, []string{"NET_ADMIN"})
+	c.Assert(container.HostConfig.CapDrop, DeepEquals, []string{"MKNOD"})
+	c.Assert(container.HostConfig.SecurityOpt, DeepEquals, []string{"apparmor=unconfined"})
+}
+
+func (s *SuiteRunJob) TestBuildContainerNetworks(c *C) {
+	bar, err := s.client.CreateNetwork(docker.CreateNetworkOptions{Name: "bar", Driver: "bridge"})
+	c.Assert(err, IsNil)
+
+	var aliases [][]string
+	s.server.CustomHandler("/networks/.*/connect", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		var opts docker.NetworkConnectionOptions
+		json.Unmarshal(body, &opts)
+		aliases = append(aliases, opts.EndpointConfig.Aliases)
+
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Network = "foo, " + bar.ID
+	job.NetworkAlias = []string{"qux"}
+
+	container, err := job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, IsNil)
+	c.Assert(aliases, DeepEquals, [][]string{{"qux"}, {"qux"}})
+
+	for _, name := range []string{"foo", "bar"} {
+		network, err := s.client.NetworkInfo(name)
+		c.Assert(err, IsNil)
+		c.Assert(network.Containers, HasLen, 1)
+		_, ok := network.Containers[container.ID]
+		c.Assert(ok, Equals, true)
+	}
+}
+
+func (s *SuiteRunJob) TestBuildContainerNetworksPodman(c *C) {
+	bar, err := s.client.CreateNetwork(docker.CreateNetworkOptions{Name: "bar", Driver: "bridge"})
+	c.Assert(err, IsNil)
+
+	s.server.CustomHandler("/version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(podmanVersion)
+	}))
+
+	var opts docker.CreateContainerOptions
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		json.Unmarshal(body, &opts)
+
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	var connects int
+	s.server.CustomHandler("/networks/.*/connect", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connects++
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Network = "foo, " + bar.ID
+	job.NetworkAlias = []string{"qux"}
+
+	_, err = job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, IsNil)
+	c.Assert(connects, Equals, 0)
+	c.Assert(opts.NetworkingConfig.EndpointsConfig, HasLen, 2)
+	c.Assert(opts.NetworkingConfig.EndpointsConfig["foo"].Aliases, DeepEquals, []string{"qux"})
+	c.Assert(opts.NetworkingConfig.EndpointsConfig["bar"].Aliases, DeepEquals, []string{"qux"})
+}
+
+func (s *SuiteRunJob) TestBuildContainerNetworkNotFound(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Network = "fo"
+
+	_, err := job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, ErrorMatches, `network "fo" not found`)
+}
+
+func (s *SuiteRunJob) TestPollContainer(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+
+	container, err := job.buildContainer(&Context{Execution: NewExecution()}, job.Image)
+	c.Assert(err, IsNil)
+	c.Assert(job.startContainer(NewExecution(), container), IsNil)
+
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+		c.Assert(s.client.StopContainer(container.ID, 0), IsNil)
+	}()
+
+	exitCode, err := job.pollContainer(context.Background(), container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(exitCode, Equals, 0)
+
+	// the canceled and the timed out executions are told apart by the caller
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = job.pollContainer(ctx, container.ID)
+	c.Assert(err, Equals, context.Canceled)
+}
+
 func (s *SuiteRunJob) TestBuildPullImageOptionsBareImage(c *C) {
 	o, _ := buildPullOptions("foo")
 	c.Assert(o.Repository, Equals, "foo")
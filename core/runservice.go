@@ -1,9 +1,9 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types/swarm"
@@ -20,6 +20,28 @@ type RunServiceJob struct {
 	Delete  bool           `default:"true"`
 	Image   string
 	Network string
+	// Constraint are the placement constraints of the service, e.g.
+	// `node.role==worker`, similar to `docker service create --constraint`.
+	Constraint []string
+	// Secret and Config are the swarm secrets and configs mounted in the
+	// container, with the syntax `name[:target]`.
+	Secret []string
+	Config []string
+	// LimitMemory and ReserveMemory are in bytes, LimitCPU and ReserveCPU in
+	// number of CPUs, e.g. 0.5.
+	LimitMemory   int64   `mapstructure:"limit-memory"`
+	LimitCPU      float64 `mapstructure:"limit-cpu"`
+	ReserveMemory int64   `mapstructure:"reserve-memory"`
+	ReserveCPU    float64 `mapstructure:"reserve-cpu"`
+	// RestartCondition is one of `none`, `on-failure` or `any`, by default
+	// the task is never restarted.
+	RestartCondition   string        `mapstructure:"restart-condition"`
+	RestartMaxAttempts uint64        `mapstructure:"restart-max-attempts"`
+	RestartDelay       time.Duration `mapstructure:"restart-delay"`
+
+	// ImageVerification verifies the signature of the image before creating
+	// the service, if set.
+	ImageVerification `mapstructure:",squash"`
 }
 
 func NewRunServiceJob(c *docker.Client) *RunServiceJob {
@@ -27,11 +49,16 @@ func NewRunServiceJob(c *docker.Client) *RunServiceJob {
 }
 
 func (j *RunServiceJob) Run(ctx *Context) error {
-	if err := j.pullImage(); err != nil {
+	if err := j.pullImage(ctx); err != nil {
 		return err
 	}
 
-	svc, err := j.buildService()
+	image, err := j.verifyImage(ctx, j.Client, j.Image)
+	if err != nil {
+		return err
+	}
+
+	svc, err := j.buildService(ctx, image)
 
 	if err != nil {
 		return err
@@ -39,27 +66,58 @@ func (j *RunServiceJob) Run(ctx *Context) error {
 
 	ctx.Logger.Noticef("Created service %s for job %s\n", svc.ID, j.Name)
 
-	if err := j.watchContainer(ctx, svc.ID); err != nil {
-		return err
+	err = j.watchContainer(ctx, svc.ID)
+	if lerr := j.fetchLogs(ctx.Execution, svc.ID); lerr != nil {
+		ctx.Logger.Warningf("Error fetching logs of service %s: %s", svc.ID, lerr)
+	}
+
+	if derr := j.deleteService(ctx, svc.ID); derr != nil && err == nil {
+		err = derr
 	}
 
-	return j.deleteService(ctx, svc.ID)
+	return err
 }
 
-func (j *RunServiceJob) pullImage() error {
+func (j *RunServiceJob) pullImage(ctx *Context) error {
 	o, a := buildPullOptions(j.Image)
-	if err := j.Client.PullImage(o, a); err != nil {
+	err := ctx.Scheduler.pullImage(ctx, j.Client.Endpoint(), j.Image, o.Registry, func(c context.Context) error {
+		o.Context = c
+		return j.Client.PullImage(o, a)
+	})
+
+	if err != nil {
 		return fmt.Errorf("error pulling image %q: %s", j.Image, err)
 	}
 
 	return nil
 }
 
-func (j *RunServiceJob) buildService() (*swarm.Service, error) {
+// buildService creates the service running the given image, the image of the
+// job or its verified reference by digest.
+func (j *RunServiceJob) buildService(ctx *Context, image string) (*swarm.Service, error) {
+	createSvcOpts, err := j.buildServiceOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	createSvcOpts.ServiceSpec.TaskTemplate.ContainerSpec.Image = image
+
+	svc, err := j.Client.CreateService(createSvcOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return svc, err
+}
+
+func (j *RunServiceJob) buildServiceOptions(ctx *Context) (docker.CreateServiceOptions, error) {
+	command, err := ctx.RenderCommand(j.Command)
+	if err != nil {
+		return docker.CreateServiceOptions{}, err
+	}
 
 	//createOptions := types.ServiceCreateOptions{}
 
-	max := uint64(1)
 	createSvcOpts := docker.CreateServiceOptions{}
 
 	createSvcOpts.ServiceSpec.TaskTemplate.ContainerSpec =
@@ -67,12 +125,27 @@ func (j *RunServiceJob) buildService() (*swarm.Service, error) {
 			Image: j.Image,
 		}
 
-	// Make the service run once and not restart
-	createSvcOpts.ServiceSpec.TaskTemplate.RestartPolicy =
-		&swarm.RestartPolicy{
-			MaxAttempts: &max,
-			Condition:   swarm.RestartPolicyConditionNone,
+	createSvcOpts.ServiceSpec.TaskTemplate.RestartPolicy = j.buildRestartPolicy()
+	createSvcOpts.ServiceSpec.TaskTemplate.Resources = j.buildResources()
+
+	if len(j.Constraint) > 0 {
+		createSvcOpts.ServiceSpec.TaskTemplate.Placement = &swarm.Placement{
+			Constraints: j.Constraint,
 		}
+	}
+
+	secrets, err := j.buildSecrets()
+	if err != nil {
+		return createSvcOpts, err
+	}
+
+	configs, err := j.buildConfigs()
+	if err != nil {
+		return createSvcOpts, err
+	}
+
+	createSvcOpts.ServiceSpec.TaskTemplate.ContainerSpec.Secrets = secrets
+	createSvcOpts.ServiceSpec.TaskTemplate.ContainerSpec.Configs = configs
 
 	// For a service to interact with other services in a stack,
 	// we need to attach it to the same network
@@ -84,63 +157,178 @@ func (j *RunServiceJob) buildService() (*swarm.Service, error) {
 		}
 	}
 
-	if j.Command != "" {
-		createSvcOpts.ServiceSpec.TaskTemplate.ContainerSpec.Command = strings.Split(j.Command, " ")
+	if command != "" {
+		createSvcOpts.ServiceSpec.TaskTemplate.ContainerSpec.Command = strings.Split(command, " ")
 	}
 
-	svc, err := j.Client.CreateService(createSvcOpts)
-	if err != nil {
-		return nil, err
+	return createSvcOpts, nil
+}
+
+func (j *RunServiceJob) buildRestartPolicy() *swarm.RestartPolicy {
+	// by default the service runs once and is not restarted
+	max := uint64(1)
+	if j.RestartCondition == "" {
+		return &swarm.RestartPolicy{
+			MaxAttempts: &max,
+			Condition:   swarm.RestartPolicyConditionNone,
+		}
 	}
 
-	return svc, err
+	p := &swarm.RestartPolicy{
+		Condition: swarm.RestartPolicyCondition(j.RestartCondition),
+	}
+
+	if j.RestartMaxAttempts != 0 {
+		p.MaxAttempts = &j.RestartMaxAttempts
+	}
+
+	if j.RestartDelay != 0 {
+		p.Delay = &j.RestartDelay
+	}
+
+	return p
 }
 
-const (
+func (j *RunServiceJob) buildResources() *swarm.ResourceRequirements {
+	r := &swarm.ResourceRequirements{}
+	if j.LimitMemory != 0 || j.LimitCPU != 0 {
+		r.Limits = &swarm.Resources{
+			MemoryBytes: j.LimitMemory,
+			NanoCPUs:    int64(j.LimitCPU * 1e9),
+		}
+	}
 
-	// TODO are these const defined somewhere in the docker API?
-	swarmError   = -999
-	timeoutError = -998
-)
+	if j.ReserveMemory != 0 || j.ReserveCPU != 0 {
+		r.Reservations = &swarm.Resources{
+			MemoryBytes: j.ReserveMemory,
+			NanoCPUs:    int64(j.ReserveCPU * 1e9),
+		}
+	}
+
+	return r
+}
 
-var svcChecker = time.NewTicker(watchDuration)
+func (j *RunServiceJob) buildSecrets() ([]*swarm.SecretReference, error) {
+	var refs []*swarm.SecretReference
+	for _, spec := range j.Secret {
+		name, target := parseReferenceSpec(spec)
+		secrets, err := j.Client.ListSecrets(docker.ListSecretsOptions{
+			Filters: map[string][]string{"name": {name}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing secrets: %s", err)
+		}
 
-func (j *RunServiceJob) watchContainer(ctx *Context, svcID string) error {
-	exitCode := swarmError
+		var id string
+		for _, s := range secrets {
+			if s.Spec.Name == name {
+				id = s.ID
+			}
+		}
 
-	ctx.Logger.Noticef("Checking for service ID %s (%s) termination\n", svcID, j.Name)
+		if id == "" {
+			return nil, fmt.Errorf("secret %q not found", name)
+		}
 
-	svc, err := j.Client.InspectService(svcID)
-	if err != nil {
-		return fmt.Errorf("Failed to inspect service %s: %s", svcID, err.Error())
+		refs = append(refs, &swarm.SecretReference{
+			SecretID:   id,
+			SecretName: name,
+			File: &swarm.SecretReferenceFileTarget{
+				Name: target, UID: "0", GID: "0", Mode: 0444,
+			},
+		})
 	}
 
-	// On every tick, check if all the services have completed, or have error out
-	var wg sync.WaitGroup
-	wg.Add(1)
+	return refs, nil
+}
 
-	go func() {
-		defer wg.Done()
-		for _ = range svcChecker.C {
+func (j *RunServiceJob) buildConfigs() ([]*swarm.ConfigReference, error) {
+	var refs []*swarm.ConfigReference
+	for _, spec := range j.Config {
+		name, target := parseReferenceSpec(spec)
+		configs, err := j.Client.ListConfigs(docker.ListConfigsOptions{
+			Filters: map[string][]string{"name": {name}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing configs: %s", err)
+		}
 
-			if svc.CreatedAt.After(time.Now().Add(maxProcessDuration)) {
-				err = ErrMaxTimeRunning
-				return
+		var id string
+		for _, c := range configs {
+			if c.Spec.Name == name {
+				id = c.ID
 			}
+		}
 
-			taskExitCode, found := j.findtaskstatus(ctx, svc.ID)
+		if id == "" {
+			return nil, fmt.Errorf("config %q not found", name)
+		}
 
-			if found {
-				exitCode = taskExitCode
-				return
-			}
+		refs = append(refs, &swarm.ConfigReference{
+			ConfigID:   id,
+			ConfigName: name,
+			File: &swarm.ConfigReferenceFileTarget{
+				Name: target, UID: "0", GID: "0", Mode: 0444,
+			},
+		})
+	}
+
+	return refs, nil
+}
+
+// parseReferenceSpec parses a secret or config with the syntax
+// `name[:target]`, by default the target is the name.
+func parseReferenceSpec(spec string) (name, target string) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) == 1 {
+		return parts[0], parts[0]
+	}
+
+	return parts[0], parts[1]
+}
+
+// watchContainer waits for the task of the service to finish, the execution
+// fails with the exit code of the task if it isn't zero
+func (j *RunServiceJob) watchContainer(ctx *Context, svcID string) error {
+	ctx.Logger.Noticef("Checking for service ID %s (%s) termination\n", svcID, j.Name)
+
+	ticker := time.NewTicker(watchDuration)
+	defer ticker.Stop()
+
+	timeout := time.After(maxProcessDuration)
+	for {
+		select {
+		case <-ctx.Execution.Done():
+			return ErrCanceledExecution
+		case <-timeout:
+			return ErrMaxTimeRunning
+		case <-ticker.C:
+		}
+
+		exitCode, found := j.findtaskstatus(ctx, svcID)
+		if !found {
+			continue
 		}
-	}()
 
-	wg.Wait()
+		ctx.Logger.Noticef("Service ID %s (%s) has completed with exit code %d\n", svcID, j.Name, exitCode)
+		if exitCode != 0 {
+			return &ExitCodeError{ExitCode: exitCode}
+		}
 
-	ctx.Logger.Noticef("Service ID %s (%s) has completed with exit code %d\n", svcID, j.Name, exitCode)
-	return err
+		return nil
+	}
+}
+
+// fetchLogs writes the logs of the task of the service to the output of the
+// execution
+func (j *RunServiceJob) fetchLogs(e *Execution, svcID string) error {
+	return j.Client.GetServiceLogs(docker.LogsServiceOptions{
+		Service:      svcID,
+		OutputStream: e.OutputStream,
+		ErrorStream:  e.ErrorStream,
+		Stdout:       true,
+		Stderr:       true,
+	})
 }
 
 func (j *RunServiceJob) findtaskstatus(ctx *Context, taskID string) (int, bool) {
@@ -181,7 +369,10 @@ func (j *RunServiceJob) findtaskstatus(ctx *Context, taskID string) (int, bool)
 
 		if stop {
 
-			exitCode = task.Status.ContainerStatus.ExitCode
+			exitCode = 0
+			if task.Status.ContainerStatus != nil {
+				exitCode = task.Status.ContainerStatus.ExitCode
+			}
 
 			if exitCode == 0 && task.Status.State == swarm.TaskStateRejected {
 				exitCode = 255 // force non-zero exit for task rejected
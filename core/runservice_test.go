@@ -3,7 +3,9 @@ package core
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -92,6 +94,108 @@ func (s *SuiteRunServiceJob) TestRun(c *C) {
 	c.Assert(containers, HasLen, 0)
 }
 
+func (s *SuiteRunServiceJob) TestRunExitCode(c *C) {
+	s.server.CustomHandler("/tasks", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]swarm.Task{{Status: swarm.TaskStatus{
+			State:           swarm.TaskStateFailed,
+			ContainerStatus: &swarm.ContainerStatus{ExitCode: 3},
+		}}})
+	}))
+
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Delete = true
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, DeepEquals, &ExitCodeError{ExitCode: 3})
+
+	services, err := s.client.ListServices(docker.ListServicesOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 0)
+}
+
+func (s *SuiteRunServiceJob) TestFetchLogs(c *C) {
+	s.server.CustomHandler("/services/foo/logs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Query().Get("stdout"), Equals, "1")
+		c.Assert(r.URL.Query().Get("stderr"), Equals, "1")
+
+		w.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+		for _, frame := range []struct {
+			stream  byte
+			payload string
+		}{{1, "foo\n"}, {2, "bar\n"}} {
+			w.Write([]byte{frame.stream, 0, 0, 0, 0, 0, 0, byte(len(frame.payload))})
+			w.Write([]byte(frame.payload))
+		}
+	}))
+
+	job := &RunServiceJob{Client: s.client}
+	e := NewExecution()
+	c.Assert(job.fetchLogs(e, "foo"), IsNil)
+	c.Assert(string(e.Output()), Equals, "foo\n")
+	c.Assert(string(e.ErrorOutput()), Equals, "bar\n")
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceOptions(c *C) {
+	s.server.CustomHandler("/secrets", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]swarm.Secret{
+			{ID: "s1", Spec: swarm.SecretSpec{Annotations: swarm.Annotations{Name: "foo-bar"}}},
+			{ID: "s2", Spec: swarm.SecretSpec{Annotations: swarm.Annotations{Name: "foo"}}},
+		})
+	}))
+
+	s.server.CustomHandler("/configs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]swarm.Config{
+			{ID: "c1", Spec: swarm.ConfigSpec{Annotations: swarm.Annotations{Name: "bar"}}},
+		})
+	}))
+
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Constraint = []string{"node.role==worker"}
+	job.Secret = []string{"foo"}
+	job.Config = []string{"bar:/etc/bar.conf"}
+	job.LimitMemory = 1024
+	job.LimitCPU = 0.5
+	job.ReserveCPU = 0.25
+	job.RestartCondition = "on-failure"
+	job.RestartMaxAttempts = 3
+
+	opts, err := job.buildServiceOptions(&Context{Execution: NewExecution()})
+	c.Assert(err, IsNil)
+
+	t := opts.ServiceSpec.TaskTemplate
+	c.Assert(t.Placement.Constraints, DeepEquals, []string{"node.role==worker"})
+	c.Assert(t.ContainerSpec.Secrets, HasLen, 1)
+	c.Assert(t.ContainerSpec.Secrets[0].SecretID, Equals, "s2")
+	c.Assert(t.ContainerSpec.Secrets[0].File.Name, Equals, "foo")
+	c.Assert(t.ContainerSpec.Configs, HasLen, 1)
+	c.Assert(t.ContainerSpec.Configs[0].ConfigID, Equals, "c1")
+	c.Assert(t.ContainerSpec.Configs[0].File.Name, Equals, "/etc/bar.conf")
+	c.Assert(t.Resources.Limits, DeepEquals, &swarm.Resources{MemoryBytes: 1024, NanoCPUs: 5e8})
+	c.Assert(t.Resources.Reservations, DeepEquals, &swarm.Resources{NanoCPUs: 25e7})
+	c.Assert(t.RestartPolicy.Condition, Equals, swarm.RestartPolicyConditionOnFailure)
+	c.Assert(*t.RestartPolicy.MaxAttempts, Equals, uint64(3))
+
+	job.Secret = []string{"qux"}
+	_, err = job.buildServiceOptions(&Context{Execution: NewExecution()})
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceOptionsDefault(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+
+	opts, err := job.buildServiceOptions(&Context{Execution: NewExecution()})
+	c.Assert(err, IsNil)
+
+	t := opts.ServiceSpec.TaskTemplate
+	c.Assert(t.Placement, IsNil)
+	c.Assert(t.Resources, DeepEquals, &swarm.ResourceRequirements{})
+	c.Assert(t.RestartPolicy.Condition, Equals, swarm.RestartPolicyConditionNone)
+	c.Assert(*t.RestartPolicy.MaxAttempts, Equals, uint64(1))
+}
+
 func (s *SuiteRunServiceJob) TestBuildPullImageOptionsBareImage(c *C) {
 	o, _ := buildPullOptions("foo")
 	c.Assert(o.Repository, Equals, "foo")
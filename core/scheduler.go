@@ -1,10 +1,13 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"math/rand"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/robfig/cron"
 )
@@ -12,18 +15,85 @@ import (
 var (
 	ErrEmptyScheduler = errors.New("unable to start a empty scheduler.")
 	ErrEmptySchedule  = errors.New("unable to add a job with a empty schedule.")
+	ErrJobNotFound    = errors.New("unable to find a job with the given name.")
+)
+
+// RebootSchedule is the schedule of the jobs only run once, when the scheduler
+// starts
+const RebootSchedule = "@reboot"
+
+// ManualSchedule is the schedule of the jobs only run manually, with the HTTP
+// API or the jobs commands, or by their dependencies and triggers
+const ManualSchedule = "@manual"
+
+// CronSeconds and CronStandard are the formats of the cron expressions of five
+// fields, see ParseSchedule. CronSeconds, the default, reads them starting
+// with the seconds, like the previous versions, and CronStandard starting with
+// the minutes, like the standard cron.
+const (
+	CronSeconds  = "seconds"
+	CronStandard = "standard"
 )
 
 type Scheduler struct {
 	Jobs   []Job
 	Logger Logger
+	// History if set, persists the executions of the jobs, the stored history
+	// is loaded into the jobs when the scheduler starts.
+	History HistoryStore
+	// MaxOutputSize if set, is the maximum size in bytes of the output and the
+	// error output of the executions kept in memory, the full output is
+	// written to a file in OutputDir, see OutputBuffer.
+	MaxOutputSize int
+	OutputDir     string
+	// Redaction if set, masks the secrets in the output and the errors of the
+	// executions.
+	Redaction *Redaction
+	// Secrets resolves the env-secret options of the jobs, by default the
+	// docker secrets of /run/secrets and the Vault of VAULT_ADDR.
+	Secrets *Secrets
+	// MaxConcurrentJobs if set, is the maximum number of jobs running at the
+	// same time, the executions exceeding it wait for a free slot up to
+	// MaxQueueTime, without limit if zero, and are skipped after it.
+	MaxConcurrentJobs int
+	MaxQueueTime      time.Duration
+	// WatchdogTolerance if set, runs a watchdog reporting the scheduled jobs
+	// that didn't run in the given time after their scheduled time, see
+	// checkMissedRuns.
+	WatchdogTolerance time.Duration
+	// MaxParallelPulls if set, is the maximum number of images pulled at the
+	// same time from the same registry, the concurrent pulls of the same image
+	// are always done once.
+	MaxParallelPulls int
+	// VerifyCommand is the command running cosign verifying the images of the
+	// jobs, `cosign` by default, see ImageVerification. It's only set
+	// globally, so the labels of a container can't run any other command.
+	VerifyCommand string
+	// CronFormat is the format of the cron expressions of five fields of the
+	// schedules, CronSeconds by default, see ParseSchedule.
+	CronFormat string
 
 	middlewareContainer
+	paused    map[string]bool
+	watched   map[string]time.Time
+	added     map[Job]time.Time
+	started   time.Time
+	stop      chan struct{}
+	listeners map[Job][]*listener
+	slots     *slots
+	pulls     *pulls
 	cron      *cron.Cron
+	entries   map[Job]*entrySchedule
 	wg        sync.WaitGroup
+	mu        sync.Mutex
 	isRunning bool
 }
 
+func init() {
+	// the jitter must be different on every host
+	rand.Seed(time.Now().UnixNano())
+}
+
 func NewScheduler(l Logger) *Scheduler {
 	return &Scheduler{
 		Logger: l,
@@ -34,19 +104,415 @@ func NewScheduler(l Logger) *Scheduler {
 func (s *Scheduler) AddJob(j Job) error {
 	s.Logger.Noticef("New job registered %q - %q - %q", j.GetName(), j.GetCommand(), j.GetSchedule())
 
-	if j.GetSchedule() == "" {
+	if j.GetSchedule() == "" && len(j.GetDependsOn()) == 0 && j.GetTrigger() == "" && j.GetWatchPath() == "" {
 		return ErrEmptySchedule
 	}
 
-	err := s.cron.AddJob(j.GetSchedule(), &jobWrapper{s, j})
+	if IsFiveFieldSchedule(j.GetSchedule()) && s.CronFormat != CronStandard {
+		s.Logger.Warningf("Job %q: %s", j.GetName(), FiveFieldWarning(j.GetSchedule()))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the triggers are validated first, so an invalid job isn't scheduled
+	triggers, err := jobTriggers(j)
 	if err != nil {
 		return err
 	}
 
+	// jobs without schedule are only run by the jobs they depend on or by
+	// their triggers
+	if err := s.schedule(s.cron, j); err != nil {
+		return err
+	}
+
+	if len(triggers) != 0 && s.listeners == nil {
+		s.listeners = make(map[Job][]*listener)
+	}
+
+	for _, t := range triggers {
+		l := &listener{trigger: t}
+		s.listeners[j] = append(s.listeners[j], l)
+		if s.isRunning {
+			s.listen(j, l)
+		}
+	}
+
+	// the middlewares and the history are loaded on start, jobs added later
+	// need to load them
+	if s.isRunning {
+		j.Use(s.Middlewares()...)
+		s.loadHistory(j)
+	}
+
+	if s.added == nil {
+		s.added = make(map[Job]time.Time)
+	}
+
+	s.added[j] = time.Now()
 	s.Jobs = append(s.Jobs, j)
 	return nil
 }
 
+// RemoveJob removes the given job from the scheduler, the running executions
+// of the job are not affected.
+func (s *Scheduler) RemoveJob(j Job) error {
+	s.Logger.Noticef("Job deregistered %q", j.GetName())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, 0, len(s.Jobs))
+	for _, job := range s.Jobs {
+		if job != j {
+			jobs = append(jobs, job)
+		}
+	}
+
+	if len(jobs) == len(s.Jobs) {
+		return ErrJobNotFound
+	}
+
+	// the cron library doesn't support removing entries, so a new cron is
+	// built with the entries of the remaining jobs, keeping their next run
+	// times, see entrySchedule
+	c := cron.New()
+	for _, job := range jobs {
+		if e, ok := s.entries[job]; ok {
+			c.Schedule(e, &jobWrapper{s, job})
+		}
+	}
+
+	if s.isRunning {
+		s.cron.Stop()
+		c.Start()
+	}
+
+	for _, l := range s.listeners[j] {
+		l.close()
+	}
+
+	delete(s.listeners, j)
+	delete(s.entries, j)
+	delete(s.added, j)
+
+	s.cron = c
+	s.Jobs = jobs
+	return nil
+}
+
+// schedule adds the job to the given cron, if it has a schedule
+func (s *Scheduler) schedule(c *cron.Cron, j Job) error {
+	if j.GetSchedule() == "" || j.GetSchedule() == RebootSchedule || j.GetSchedule() == ManualSchedule {
+		return nil
+	}
+
+	schedule, err := ParseSchedule(j.GetSchedule(), s.CronFormat)
+	if err != nil {
+		return err
+	}
+
+	if s.entries == nil {
+		s.entries = make(map[Job]*entrySchedule)
+	}
+
+	e := &entrySchedule{Schedule: schedule}
+	s.entries[j] = e
+
+	c.Schedule(e, &jobWrapper{s, j})
+	return nil
+}
+
+// entrySchedule is the schedule of a job in the cron, it keeps the next run
+// time of the job, so the cron rebuilt when a job is removed doesn't reset the
+// timers of the rest, like the ones of `@every`. It's only used by the
+// goroutine of the running cron.
+type entrySchedule struct {
+	cron.Schedule
+	next time.Time
+}
+
+// Next returns the pending next run time if still after t, or the next one of
+// the schedule after t.
+func (e *entrySchedule) Next(t time.Time) time.Time {
+	if e.next.After(t) {
+		return e.next
+	}
+
+	e.next = e.Schedule.Next(t)
+	return e.next
+}
+
+// ParseSchedule parses the schedule of a job: a cron expression of six fields,
+// starting with the seconds, or of five fields, starting with the seconds too
+// unless the format is CronStandard, or a descriptor like `@hourly` or
+// `@every 90s`.
+func ParseSchedule(schedule, format string) (cron.Schedule, error) {
+	spec := strings.TrimSpace(schedule)
+	if format == CronStandard && IsFiveFieldSchedule(spec) {
+		spec = "0 " + spec
+	}
+
+	sch, err := cron.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %s", schedule, err)
+	}
+
+	return sch, nil
+}
+
+// GetJobs returns a copy of the jobs of the scheduler, safe to range over
+// while jobs are added or removed
+func (s *Scheduler) GetJobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, len(s.Jobs))
+	copy(jobs, s.Jobs)
+	return jobs
+}
+
+// GetJob returns the job with the given name, or nil if it doesn't exist
+func (s *Scheduler) GetJob(name string) Job {
+	for _, j := range s.GetJobs() {
+		if j.GetName() == name {
+			return j
+		}
+	}
+
+	return nil
+}
+
+// RunJob runs the job with the given name immediately, out of its schedule.
+// The job is executed asynchronously, the same way a scheduled execution is.
+func (s *Scheduler) RunJob(name string) error {
+	return s.RunJobWithParams(name, RunParams{})
+}
+
+// RunParams are the parameters of a manual run of a job, kept in its
+// execution. They're ignored by the jobs without command or environment, like
+// job-http.
+type RunParams struct {
+	// Args are added to the command of the job, quoted so every one of them
+	// is a single argument, see Context.RenderCommand.
+	Args []string
+	// Env are added to the environment variables of the job, as `NAME=value`,
+	// overriding them.
+	Env []string
+}
+
+// Validate returns an error if any of the environment variables isn't
+// `NAME=value` or isn't allowed by the allow-env option of the job, or if
+// there are arguments and the job doesn't set allow-args
+func (p RunParams) Validate(j Job) error {
+	if len(p.Args) != 0 && !j.GetAllowArgs() {
+		return fmt.Errorf("arguments not allowed by the job %q, see allow-args", j.GetName())
+	}
+
+	if err := ValidateEnv(p.Env); err != nil {
+		return err
+	}
+
+	allowed := j.GetAllowEnv()
+	for _, v := range p.Env {
+		if name := v[:strings.Index(v, "=")]; !contains(allowed, name) {
+			return fmt.Errorf("environment variable %q not allowed by the job %q, see allow-env", name, j.GetName())
+		}
+	}
+
+	return nil
+}
+
+// RunJobWithParams runs the job like RunJob, with the given parameters
+func (s *Scheduler) RunJobWithParams(name string, p RunParams) error {
+	j := s.GetJob(name)
+	if j == nil {
+		return ErrJobNotFound
+	}
+
+	if err := p.Validate(j); err != nil {
+		return err
+	}
+
+	s.spawn(func() { (&jobWrapper{s, j}).run(nil, p) })
+	return nil
+}
+
+// PauseJob pauses the job with the given name, its scheduled executions and
+// the ones triggered by other jobs are dropped until ResumeJob is called. The
+// job can still be run manually.
+func (s *Scheduler) PauseJob(name string) error {
+	return s.setPaused(name, true)
+}
+
+// ResumeJob resumes the job with the given name, paused by PauseJob
+func (s *Scheduler) ResumeJob(name string) error {
+	return s.setPaused(name, false)
+}
+
+func (s *Scheduler) setPaused(name string, paused bool) error {
+	if s.GetJob(name) == nil {
+		return ErrJobNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.paused == nil {
+		s.paused = make(map[string]bool)
+	}
+
+	if paused {
+		s.Logger.Noticef("Job paused %q", name)
+		s.paused[name] = true
+	} else if s.paused[name] {
+		s.Logger.Noticef("Job resumed %q", name)
+		delete(s.paused, name)
+	}
+
+	return nil
+}
+
+// IsPaused returns true if the job with the given name is paused
+func (s *Scheduler) IsPaused(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.paused[name]
+}
+
+// RunJobOnce runs the job with the given name synchronously, with the
+// middlewares of the scheduler, without starting the scheduler. The chained
+// jobs aren't run.
+func (s *Scheduler) RunJobOnce(name string) (*Execution, error) {
+	return s.RunJobOnceWithParams(name, RunParams{})
+}
+
+// RunJobOnceWithParams runs the job like RunJobOnce, with the given parameters
+func (s *Scheduler) RunJobOnceWithParams(name string, p RunParams) (*Execution, error) {
+	j := s.GetJob(name)
+	if j == nil {
+		return nil, ErrJobNotFound
+	}
+
+	if err := p.Validate(j); err != nil {
+		return nil, err
+	}
+
+	j.Use(s.Middlewares()...)
+
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	return (&jobWrapper{s, j}).execute(p).Execution, nil
+}
+
+// nextJobs returns the jobs to run after the given execution of a job, the
+// ones declared by the job and the ones depending on it
+func (s *Scheduler) nextJobs(j Job, e *Execution) []string {
+	names := j.NextJobs(e)
+	if e.Failed || e.Skipped {
+		return names
+	}
+
+	for _, job := range s.GetJobs() {
+		if contains(job.GetDependsOn(), j.GetName()) && !contains(names, job.GetName()) {
+			names = append(names, job.GetName())
+		}
+	}
+
+	return names
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NextRun returns the next time the given job is going to be executed, the
+// time is zero if the scheduler isn't running.
+func (s *Scheduler) NextRun(j Job) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.cron.Entries() {
+		if w, ok := e.Job.(*jobWrapper); ok && w.j == j {
+			return e.Next
+		}
+	}
+
+	return time.Time{}
+}
+
+// ValidateCronFormat returns an error if the format isn't CronSeconds or
+// CronStandard, empty is CronSeconds
+func ValidateCronFormat(format string) error {
+	switch format {
+	case "", CronSeconds, CronStandard:
+		return nil
+	default:
+		return fmt.Errorf("invalid cron-format %q: expected %q or %q", format, CronSeconds, CronStandard)
+	}
+}
+
+// IsFiveFieldSchedule returns true if the schedule is a cron expression of five
+// fields, whose meaning depends on the format, see ParseSchedule and
+// FiveFieldWarning.
+func IsFiveFieldSchedule(schedule string) bool {
+	spec := strings.TrimSpace(schedule)
+	return !strings.HasPrefix(spec, "@") && len(strings.Fields(spec)) == 5
+}
+
+// FiveFieldWarning returns the warning logged when loading a job with a
+// schedule of five fields read starting with the seconds, unlike the standard
+// cron
+func FiveFieldWarning(schedule string) string {
+	return fmt.Sprintf(
+		"the schedule %q of five fields starts with the seconds, unlike the standard cron, "+
+			"use %q to keep that meaning, or cron-format = %s to read it starting with the minutes",
+		schedule, strings.TrimSpace(schedule)+" *", CronStandard,
+	)
+}
+
+// NextRuns returns the next n run times after from of every job, by name. The
+// jobs without schedule, only run by the jobs they depend on, have none.
+func (s *Scheduler) NextRuns(from time.Time, n int) map[string][]time.Time {
+	jobs := s.GetJobs()
+	runs := make(map[string][]time.Time, len(jobs))
+	for _, j := range jobs {
+		runs[j.GetName()], _ = NextRuns(j.GetSchedule(), s.CronFormat, from, n)
+	}
+
+	return runs
+}
+
+// NextRuns returns the next n run times after from of the given schedule, see
+// ParseSchedule. The `@every` schedules are counted from the given time, and
+// the `@reboot` and `@manual` ones have none.
+func NextRuns(schedule, format string, from time.Time, n int) ([]time.Time, error) {
+	if schedule == "" || schedule == RebootSchedule || schedule == ManualSchedule {
+		return nil, nil
+	}
+
+	sch, err := ParseSchedule(schedule, format)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []time.Time
+	for next := sch.Next(from); !next.IsZero() && len(runs) < n; next = sch.Next(next) {
+		runs = append(runs, next)
+	}
+
+	return runs, nil
+}
+
 func (s *Scheduler) Start() error {
 	if len(s.Jobs) == 0 {
 		return ErrEmptyScheduler
@@ -54,50 +520,450 @@ func (s *Scheduler) Start() error {
 
 	s.Logger.Debugf("Starting scheduler with %d jobs", len(s.Jobs))
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.mergeMiddlewares()
+	for _, j := range s.Jobs {
+		s.loadHistory(j)
+	}
+
 	s.isRunning = true
+	s.started = time.Now()
 	s.cron.Start()
+	s.stop = make(chan struct{})
+	if s.WatchdogTolerance > 0 {
+		go s.watchdog(s.stop)
+	}
+
+	for j, listeners := range s.listeners {
+		for _, l := range listeners {
+			s.listen(j, l)
+		}
+	}
+
+	now := time.Now()
+	for _, j := range s.Jobs {
+		if j.GetRunOnStartup() || j.GetSchedule() == RebootSchedule {
+			s.Logger.Noticef("Running job %q on start", j.GetName())
+			s.spawnScheduled(j)
+			continue
+		}
+
+		if missed, ok := s.missedRun(j, now); ok {
+			s.Logger.Noticef("Catching up job %q, missed execution at %s", j.GetName(), missed.Format(time.RFC3339))
+			s.spawnScheduled(j)
+		}
+	}
+
 	return nil
 }
 
+// missedRun returns the latest scheduled time of the job missed since its last
+// execution, if it's within the catch-up window of the job.
+func (s *Scheduler) missedRun(j Job, now time.Time) (time.Time, bool) {
+	h := j.History()
+	if j.GetCatchUp() == 0 || j.GetSchedule() == "" || len(h) == 0 {
+		return time.Time{}, false
+	}
+
+	schedule, err := ParseSchedule(j.GetSchedule(), s.CronFormat)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	missed := schedule.Next(h[len(h)-1].Date)
+	if missed.After(now) {
+		return time.Time{}, false
+	}
+
+	for next := schedule.Next(missed); !next.After(now); next = schedule.Next(next) {
+		missed = next
+	}
+
+	if now.Sub(missed) > j.GetCatchUp() {
+		return time.Time{}, false
+	}
+
+	return missed, true
+}
+
+func (s *Scheduler) loadHistory(j Job) {
+	if s.History == nil {
+		return
+	}
+
+	h, err := s.History.Load(j.GetName())
+	if err != nil {
+		s.Logger.Errorf("Error loading history of job %q: %s", j.GetName(), err)
+		return
+	}
+
+	j.AddHistory(h...)
+}
+
 func (s *Scheduler) mergeMiddlewares() {
 	for _, j := range s.Jobs {
 		j.Use(s.Middlewares()...)
 	}
 }
 
+// Stop stops scheduling new executions and waits for the running ones.
 func (s *Scheduler) Stop() error {
+	s.stopCron()
 	s.wg.Wait()
+
+	return nil
+}
+
+// Shutdown stops scheduling new executions and waits for the running ones up
+// to the given timeout, zero means no timeout. If the timeout is reached and
+// cancel is true, the running executions are canceled, e.g. stopping the
+// containers of the job-run, and waited for the same timeout. Returns the
+// number of executions that didn't finish in time.
+func (s *Scheduler) Shutdown(timeout time.Duration, cancel bool) int {
+	s.stopCron()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	if timeout == 0 {
+		<-done
+		return 0
+	}
+
+	select {
+	case <-done:
+		return 0
+	case <-time.After(timeout):
+	}
+
+	running := s.runningExecutions()
+	if !cancel {
+		return len(running)
+	}
+
+	s.Logger.Warningf("Canceling %d running executions", len(running))
+	for _, e := range running {
+		e.Cancel()
+	}
+
+	select {
+	case <-done:
+		return 0
+	case <-time.After(timeout):
+	}
+
+	// only the executions ignoring the cancellation are still running
+	return len(s.runningExecutions())
+}
+
+func (s *Scheduler) stopCron() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.cron.Stop()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+
+	for _, listeners := range s.listeners {
+		for _, l := range listeners {
+			l.close()
+		}
+	}
+
 	s.isRunning = false
+}
 
-	return nil
+// listener listens a trigger of a job, until stop is closed
+type listener struct {
+	trigger Trigger
+	stop    chan struct{}
+}
+
+func (l *listener) close() {
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+}
+
+// listen runs the job on every event of the trigger, the scheduler must be
+// locked. The connections failing are retried after triggerRetryDelay.
+func (s *Scheduler) listen(j Job, l *listener) {
+	l.stop = make(chan struct{})
+
+	go func(t Trigger, stop chan struct{}) {
+		s.Logger.Noticef("Listening trigger of job %q at %s", j.GetName(), t)
+		for {
+			err := t.Listen(stop, func() <-chan struct{} {
+				done := make(chan struct{})
+				if s.IsPaused(j.GetName()) {
+					s.Logger.Debugf("Skipping paused job %q, triggered at %s", j.GetName(), t)
+					close(done)
+					return done
+				}
+
+				s.Logger.Debugf("Job %q triggered by %s", j.GetName(), t)
+				s.spawn(func() {
+					defer close(done)
+					(&jobWrapper{s, j}).run(nil, RunParams{})
+				})
+
+				return done
+			})
+
+			if err == nil {
+				return
+			}
+
+			s.Logger.Errorf("Error listening trigger of job %q: %s, retrying in %s", j.GetName(), err, triggerRetryDelay)
+			select {
+			case <-stop:
+				return
+			case <-time.After(triggerRetryDelay):
+			}
+		}
+	}(l.trigger, l.stop)
+}
+
+func (s *Scheduler) runningExecutions() []*Execution {
+	var running []*Execution
+	for _, j := range s.GetJobs() {
+		for _, e := range j.History() {
+			if e.Snapshot().IsRunning {
+				running = append(running, e)
+			}
+		}
+	}
+
+	return running
 }
 
 func (s *Scheduler) IsRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	return s.isRunning
 }
 
+// spawn runs fn in a new goroutine waited by Stop, added before it starts so
+// Stop can't miss it
+func (s *Scheduler) spawn(fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn()
+	}()
+}
+
+// spawnScheduled runs a scheduled execution of the job in a new goroutine
+// waited by Stop, the scheduler must be running and locked, e.g. by Start
+func (s *Scheduler) spawnScheduled(j Job) {
+	stop := s.stop
+	s.spawn(func() { (&jobWrapper{s, j}).runScheduled(stop) })
+}
+
+// track adds a scheduled execution to the ones waited by Stop, returning the
+// channel closed when the scheduler stops, or false if it isn't running. The
+// lock orders it with the Wait of Stop, called once isRunning is false.
+func (s *Scheduler) track() (<-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isRunning {
+		return nil, false
+	}
+
+	s.wg.Add(1)
+	return s.stop, true
+}
+
 type jobWrapper struct {
 	s *Scheduler
 	j Job
 }
 
+func (s *Scheduler) newExecution(j Job) *Execution {
+	e := NewExecution()
+	if s.MaxOutputSize > 0 {
+		prefix := j.GetName() + "-" + e.ID
+		e.OutputStream = NewOutputBuffer(s.MaxOutputSize, s.OutputDir, prefix+"-stdout")
+		e.ErrorStream = NewOutputBuffer(s.MaxOutputSize, s.OutputDir, prefix+"-stderr")
+	}
+
+	if s.Redaction != nil {
+		e.redactor = s.Redaction.Redactor(j)
+	}
+
+	e.followable()
+	return e
+}
+
+// acquireSlot waits for a free slot of MaxConcurrentJobs, the jobs with a
+// higher priority get it first. It returns the function releasing it, or
+// ErrSkippedExecution if there wasn't a free slot in MaxQueueTime.
+func (s *Scheduler) acquireSlot(ctx *Context) (func(), error) {
+	if s == nil || s.MaxConcurrentJobs <= 0 {
+		return func() {}, nil
+	}
+
+	s.mu.Lock()
+	if s.slots == nil {
+		s.slots = newSlots(s.MaxConcurrentJobs)
+	}
+
+	slots := s.slots
+	s.mu.Unlock()
+
+	w := slots.acquire(ctx.Job.GetPriority())
+	if w == nil {
+		return slots.release, nil
+	}
+
+	ctx.Log(fmt.Sprintf("Waiting, the maximum of %d concurrent jobs are running", s.MaxConcurrentJobs))
+
+	var timeout <-chan time.Time
+	if s.MaxQueueTime > 0 {
+		timeout = time.After(s.MaxQueueTime)
+	}
+
+	select {
+	case <-w.ready:
+		return slots.release, nil
+	case <-ctx.Execution.Done():
+		slots.cancel(w)
+		return nil, ErrCanceledExecution
+	case <-timeout:
+		slots.cancel(w)
+		ctx.Stop(ErrSkippedExecution)
+		ctx.Log(fmt.Sprintf("Skipped, no free slot of the concurrent jobs in %s", s.MaxQueueTime))
+		return nil, ErrSkippedExecution
+	}
+}
+
+// pullImage runs pull, pulling the image from the registry to the daemon with
+// the given endpoint, deduplicated with the concurrent pulls of the same image
+// to the same daemon and limited by MaxParallelPulls. The context of pull is
+// canceled with the execution. The time spent, waiting included, is added to
+// the PullDuration of the execution.
+func (s *Scheduler) pullImage(ctx *Context, daemon, image, registry string, pull func(context.Context) error) error {
+	start := time.Now()
+	defer func() {
+		ctx.Execution.update(func() { ctx.Execution.PullDuration += time.Since(start) })
+	}()
+
+	pulls := newPulls(0)
+	if s != nil {
+		s.mu.Lock()
+		if s.pulls == nil {
+			s.pulls = newPulls(s.MaxParallelPulls)
+		}
+
+		pulls = s.pulls
+		s.mu.Unlock()
+	}
+
+	if registry == "" {
+		registry = defaultRegistry
+	}
+
+	return pulls.do(ctx.Execution.Done(), daemon+" "+image, registry, pull)
+}
+
+// Run runs the scheduled executions, see runScheduled. The execution is
+// dropped if the scheduler isn't running.
 func (w *jobWrapper) Run() {
-	w.s.wg.Add(1)
+	stop, ok := w.s.track()
+	if !ok {
+		return
+	}
+
 	defer w.s.wg.Done()
+	w.runScheduled(stop)
+}
+
+// runScheduled runs the execution, delayed by a random jitter if the job has
+// one. The execution is dropped if the job is paused, or if the scheduler stops
+// during the delay, when stop is closed.
+func (w *jobWrapper) runScheduled(stop <-chan struct{}) {
+	if w.s.IsPaused(w.j.GetName()) {
+		w.s.Logger.Debugf("Skipping paused job %q", w.j.GetName())
+		return
+	}
+
+	if jitter := w.j.GetJitter(); jitter > 0 {
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Duration(rand.Int63n(int64(jitter)))):
+		}
+	}
+
+	w.run(nil, RunParams{})
+}
+
+// run runs the job and then the jobs triggered by its execution, chain are
+// the jobs that triggered this one, used to prevent cycles. The parameters are
+// only used by the execution of this job.
+func (w *jobWrapper) run(chain []string, p RunParams) {
+	ctx := w.execute(p)
+	e := ctx.Execution
+	chain = append(chain[:len(chain):len(chain)], w.j.GetName())
+	for _, name := range w.s.nextJobs(w.j, e) {
+		if contains(chain, name) {
+			ctx.Log(fmt.Sprintf("Skipping job %q, circular dependency", name))
+			continue
+		}
+
+		next := w.s.GetJob(name)
+		if next == nil {
+			ctx.Log(fmt.Sprintf("Unable to run job %q, not found", name))
+			continue
+		}
+
+		if w.s.IsPaused(name) {
+			ctx.Log(fmt.Sprintf("Skipping job %q, paused", name))
+			continue
+		}
+
+		ctx.Log(fmt.Sprintf("Running job %q", name))
+		(&jobWrapper{w.s, next}).run(chain, RunParams{})
+	}
+}
+
+func (w *jobWrapper) execute(p RunParams) *Context {
+	e := w.s.newExecution(w.j)
+	e.Args, e.Environment = p.Args, p.Env
 
-	e := NewExecution()
 	ctx := NewContext(w.s, w.j, e)
 
 	w.start(ctx)
 	err := ctx.Next()
 	w.stop(ctx, err)
+
+	return ctx
 }
 
 func (w *jobWrapper) start(ctx *Context) {
 	ctx.Start()
-	ctx.Log("Started - " + ctx.Job.GetCommand())
+
+	msg := "Started - " + ctx.Job.GetCommand()
+	if args := ctx.Execution.Args; len(args) != 0 {
+		msg += " with args " + quoteArgs(args)
+	}
+
+	// the values can be secrets, only the names are logged
+	if env := ctx.Execution.Environment; len(env) != 0 {
+		msg += " with env " + strings.Join(EnvNames(env), ", ")
+	}
+
+	ctx.Log(msg)
 }
 
 func (w *jobWrapper) stop(ctx *Context, err error) {
@@ -108,11 +974,7 @@ func (w *jobWrapper) stop(ctx *Context, err error) {
 		errText = ctx.Execution.Error.Error()
 	}
 
-	output, err := ioutil.ReadAll(ctx.Execution.OutputStream)
-	if err != nil {
-		ctx.Logger.Errorf("Couldn't read command output")
-	}
-
+	output := ctx.Execution.Output()
 	if len(output) > 0 {
 		ctx.Log("Output: " + string(output))
 	}
@@ -123,4 +985,10 @@ func (w *jobWrapper) stop(ctx *Context, err error) {
 	)
 
 	ctx.Log(msg)
+
+	if ctx.Scheduler.History != nil {
+		if err := ctx.Scheduler.History.Save(ctx.Job.GetName(), ctx.Execution); err != nil {
+			ctx.Logger.Errorf("Error saving history of job %q: %s", ctx.Job.GetName(), err)
+		}
+	}
 }
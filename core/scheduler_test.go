@@ -48,6 +48,601 @@ func (s *SuiteScheduler) TestStartStop(c *C) {
 	c.Assert(h[1].Date.IsZero(), Equals, false)
 }
 
+func (s *SuiteScheduler) TestRemoveJob(c *C) {
+	jobA, jobB := &TestJob{}, &TestJob{}
+	jobA.Schedule = "@every 1s"
+	jobB.Schedule = "@every 1s"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(jobA), IsNil)
+	c.Assert(sc.AddJob(jobB), IsNil)
+
+	sc.Start()
+	c.Assert(sc.RemoveJob(jobA), IsNil)
+	c.Assert(sc.RemoveJob(jobA), Equals, ErrJobNotFound)
+	c.Assert(sc.Jobs, HasLen, 1)
+
+	e := sc.cron.Entries()
+	c.Assert(e, HasLen, 1)
+	c.Assert(e[0].Job.(*jobWrapper).j, Equals, jobB)
+
+	time.Sleep(time.Millisecond * 1500)
+	sc.Stop()
+
+	c.Assert(jobA.History(), HasLen, 0)
+	c.Assert(len(jobB.History()) > 0, Equals, true)
+}
+
+func (s *SuiteScheduler) TestRemoveJobKeepsNextRuns(c *C) {
+	jobA, jobB := &TestJob{}, &TestJob{}
+	jobA.Schedule = "@every 1h"
+	jobB.Schedule = "@every 1h"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(jobA), IsNil)
+	c.Assert(sc.AddJob(jobB), IsNil)
+
+	sc.Start()
+	defer sc.Stop()
+
+	next := sc.NextRun(jobB)
+	c.Assert(next.IsZero(), Equals, false)
+
+	time.Sleep(time.Millisecond * 1100)
+	c.Assert(sc.RemoveJob(jobA), IsNil)
+	c.Assert(sc.NextRun(jobB), Equals, next)
+}
+
+func (s *SuiteScheduler) TestAddJobRunning(c *C) {
+	m := &TestMiddleware{}
+	jobA, jobB := &TestJob{}, &TestJob{}
+	jobA.Schedule = "@hourly"
+	jobB.Schedule = "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.Use(m)
+	c.Assert(sc.AddJob(jobA), IsNil)
+
+	sc.Start()
+	c.Assert(sc.AddJob(jobB), IsNil)
+	sc.Stop()
+
+	c.Assert(jobB.Middlewares(), HasLen, 1)
+}
+
+func (s *SuiteScheduler) TestRunJob(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	err := sc.AddJob(job)
+	c.Assert(err, IsNil)
+
+	c.Assert(sc.GetJob("foo"), Equals, job)
+	c.Assert(sc.GetJob("bar"), IsNil)
+	c.Assert(sc.RunJob("bar"), Equals, ErrJobNotFound)
+
+	err = sc.RunJob("foo")
+	c.Assert(err, IsNil)
+
+	sc.Stop()
+
+	c.Assert(job.Called(), Equals, 1)
+	c.Assert(job.History(), HasLen, 1)
+}
+
+func (s *SuiteScheduler) TestRunJobWithParams(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = ManualSchedule
+	job.AllowEnv = []string{"FOO"}
+	job.AllowArgs = true
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.cron.Entries(), HasLen, 0)
+
+	err := sc.RunJobWithParams("foo", RunParams{Env: []string{"FOO"}})
+	c.Assert(err, ErrorMatches, `invalid environment variable "FOO", expected NAME=value`)
+
+	err = sc.RunJobWithParams("foo", RunParams{Env: []string{"FOO=foo", "PATH=/tmp"}})
+	c.Assert(err, ErrorMatches, `environment variable "PATH" not allowed by the job "foo", see allow-env`)
+
+	err = sc.RunJobWithParams("foo", RunParams{Args: []string{"--dry-run"}, Env: []string{"FOO=foo=bar"}})
+	c.Assert(err, IsNil)
+
+	sc.Stop()
+
+	c.Assert(job.History(), HasLen, 1)
+	c.Assert(job.History()[0].Args, DeepEquals, []string{"--dry-run"})
+	c.Assert(job.History()[0].Environment, DeepEquals, []string{"FOO=foo=bar"})
+}
+
+func (s *SuiteScheduler) TestRunJobOnce(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+	job.OnSuccess = []string{"bar"}
+
+	bar := &TestJob{}
+	bar.Name = "bar"
+	bar.Schedule = "@hourly"
+
+	m := &TestMiddleware{Nested: true}
+	sc := NewScheduler(&TestLogger{})
+	sc.Use(m)
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.AddJob(bar), IsNil)
+
+	_, err := sc.RunJobOnce("qux")
+	c.Assert(err, Equals, ErrJobNotFound)
+
+	e, err := sc.RunJobOnce("foo")
+	c.Assert(err, IsNil)
+	c.Assert(e.IsRunning, Equals, false)
+	c.Assert(e.Failed, Equals, false)
+	c.Assert(job.Called(), Equals, 1)
+	c.Assert(bar.Called(), Equals, 0)
+	c.Assert(m.Called, Equals, 1)
+	c.Assert(sc.IsRunning(), Equals, false)
+}
+
+func (s *SuiteScheduler) TestHistory(c *C) {
+	stored := NewExecution()
+	store := &TestHistoryStore{
+		executions: map[string][]*Execution{"foo": {stored}},
+	}
+
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.History = store
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Start(), IsNil)
+	c.Assert(job.History(), DeepEquals, []*Execution{stored})
+
+	c.Assert(sc.RunJob("foo"), IsNil)
+	sc.Stop()
+
+	c.Assert(job.History(), HasLen, 2)
+	c.Assert(store.executions["foo"], HasLen, 2)
+}
+
+func (s *SuiteScheduler) TestParseSchedule(c *C) {
+	now := time.Date(2020, 1, 1, 12, 30, 0, 0, time.Local)
+
+	testcases := []struct {
+		Schedule string
+		Format   string
+		Next     time.Time
+	}{
+		{"0 1 * * *", "", time.Date(2020, 1, 1, 13, 1, 0, 0, time.Local)},
+		{"0 1 * * *", CronSeconds, time.Date(2020, 1, 1, 13, 1, 0, 0, time.Local)},
+		{"0 1 * * *", CronStandard, time.Date(2020, 1, 2, 1, 0, 0, 0, time.Local)},
+		{"0,20,40 * * * *", CronStandard, time.Date(2020, 1, 1, 12, 40, 0, 0, time.Local)},
+		{"30 0 1 * * *", "", time.Date(2020, 1, 2, 1, 0, 30, 0, time.Local)},
+		{"30 0 1 * * *", CronStandard, time.Date(2020, 1, 2, 1, 0, 30, 0, time.Local)},
+		{"@hourly", CronStandard, time.Date(2020, 1, 1, 13, 0, 0, 0, time.Local)},
+		{"@every 90s", "", now.Add(time.Second * 90)},
+	}
+
+	for _, t := range testcases {
+		sch, err := ParseSchedule(t.Schedule, t.Format)
+		c.Assert(err, IsNil, Commentf("%s %s", t.Schedule, t.Format))
+		c.Assert(sch.Next(now), Equals, t.Next, Commentf("%s %s", t.Schedule, t.Format))
+	}
+
+	_, err := ParseSchedule("0 25 * * *", CronStandard)
+	c.Assert(err, ErrorMatches, `invalid schedule "0 25 \* \* \*": .*`)
+
+	_, err = ParseSchedule("* * * *", "")
+	c.Assert(err, NotNil)
+
+	_, err = ParseSchedule("@foo", "")
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteScheduler) TestValidateCronFormat(c *C) {
+	c.Assert(ValidateCronFormat(""), IsNil)
+	c.Assert(ValidateCronFormat(CronSeconds), IsNil)
+	c.Assert(ValidateCronFormat(CronStandard), IsNil)
+	c.Assert(ValidateCronFormat("foo"), ErrorMatches, `invalid cron-format "foo": .*`)
+}
+
+func (s *SuiteScheduler) TestIsFiveFieldSchedule(c *C) {
+	c.Assert(IsFiveFieldSchedule(" 0 1 * * *"), Equals, true)
+	c.Assert(IsFiveFieldSchedule("30 0 1 * * *"), Equals, false)
+	c.Assert(IsFiveFieldSchedule("@every 1 2 3 4"), Equals, false)
+
+	// the suggested schedule keeps the previous meaning
+	c.Assert(FiveFieldWarning("0 1 * * *"), Matches, `.* use "0 1 \* \* \* \*" to keep that meaning, .*`)
+	sch, err := ParseSchedule("0 1 * * * *", CronStandard)
+	c.Assert(err, IsNil)
+
+	now := time.Date(2020, 1, 1, 12, 30, 0, 0, time.Local)
+	c.Assert(sch.Next(now), Equals, time.Date(2020, 1, 1, 13, 1, 0, 0, time.Local))
+}
+
+func (s *SuiteScheduler) TestAddJobInvalidSchedule(c *C) {
+	job := &TestJob{}
+	job.Schedule = "0 0 25 * * *"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), ErrorMatches, "invalid schedule .*")
+	c.Assert(sc.Jobs, HasLen, 0)
+}
+
+func (s *SuiteScheduler) TestNextRuns(c *C) {
+	now := time.Date(2020, 1, 1, 12, 30, 0, 0, time.Local)
+
+	foo := &TestJob{}
+	foo.Name = "foo"
+	foo.Schedule = "0 0 */6 * * *"
+
+	bar := &TestJob{}
+	bar.Name = "bar"
+	bar.DependsOn = []string{"foo"}
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(foo), IsNil)
+	c.Assert(sc.AddJob(bar), IsNil)
+
+	c.Assert(sc.NextRuns(now, 3), DeepEquals, map[string][]time.Time{
+		"foo": {
+			time.Date(2020, 1, 1, 18, 0, 0, 0, time.Local),
+			time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local),
+			time.Date(2020, 1, 2, 6, 0, 0, 0, time.Local),
+		},
+		"bar": nil,
+	})
+
+	runs, err := NextRuns(ManualSchedule, "", now, 3)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, 0)
+
+	_, err = NextRuns("0 0 25 * * *", "", now, 3)
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteScheduler) TestMissedRun(c *C) {
+	now := time.Date(2020, 1, 1, 12, 30, 0, 0, time.Local)
+	last := NewExecution()
+	last.Date = now.Add(-time.Hour * 2)
+
+	job := &TestJob{}
+	job.Schedule = "0 0 * * * *"
+	job.CatchUp = time.Hour
+	job.AddHistory(last)
+
+	sc := NewScheduler(&TestLogger{})
+	missed, ok := sc.missedRun(job, now)
+	c.Assert(ok, Equals, true)
+	c.Assert(missed, DeepEquals, time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local))
+
+	// later than the catch-up window
+	job.CatchUp = time.Minute * 20
+	_, ok = sc.missedRun(job, now)
+	c.Assert(ok, Equals, false)
+
+	// not missed
+	job.CatchUp = time.Hour
+	last.Date = now.Add(-time.Minute * 10)
+	_, ok = sc.missedRun(job, now)
+	c.Assert(ok, Equals, false)
+
+	// disabled
+	last.Date = now.Add(-time.Hour * 2)
+	job.CatchUp = 0
+	_, ok = sc.missedRun(job, now)
+	c.Assert(ok, Equals, false)
+}
+
+func (s *SuiteScheduler) TestStartCatchUp(c *C) {
+	stored := NewExecution()
+	stored.Date = time.Now().Add(-time.Hour * 2)
+	store := &TestHistoryStore{
+		executions: map[string][]*Execution{"foo": {stored}, "bar": {stored}},
+	}
+
+	foo := &TestJob{}
+	foo.Name = "foo"
+	foo.Schedule = "@every 1h"
+	foo.CatchUp = time.Hour * 2
+
+	bar := &TestJob{}
+	bar.Name = "bar"
+	bar.Schedule = "@every 1h"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.History = store
+	c.Assert(sc.AddJob(foo), IsNil)
+	c.Assert(sc.AddJob(bar), IsNil)
+	c.Assert(sc.Start(), IsNil)
+
+	sc.Stop()
+
+	c.Assert(foo.Called(), Equals, 1)
+	c.Assert(bar.Called(), Equals, 0)
+}
+
+func (s *SuiteScheduler) TestStartRunOnStartup(c *C) {
+	foo := &TestJob{}
+	foo.Name = "foo"
+	foo.Schedule = "@every 1h"
+	foo.RunOnStartup = true
+
+	bar := &TestJob{}
+	bar.Name = "bar"
+	bar.Schedule = RebootSchedule
+
+	qux := &TestJob{}
+	qux.Name = "qux"
+	qux.Schedule = "@every 1h"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(foo), IsNil)
+	c.Assert(sc.AddJob(bar), IsNil)
+	c.Assert(sc.AddJob(qux), IsNil)
+	c.Assert(sc.Start(), IsNil)
+
+	sc.Stop()
+
+	c.Assert(foo.Called(), Equals, 1)
+	c.Assert(bar.Called(), Equals, 1)
+	c.Assert(qux.Called(), Equals, 0)
+	c.Assert(sc.NextRun(bar).IsZero(), Equals, true)
+
+	runs, err := NextRuns(RebootSchedule, "", time.Now(), 3)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, 0)
+}
+
+func (s *SuiteScheduler) TestJitter(c *C) {
+	job := &TestJob{}
+	job.Schedule = "@hourly"
+	job.Jitter = time.Millisecond * 50
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+
+	// dropped, the scheduler isn't running
+	(&jobWrapper{sc, job}).Run()
+	c.Assert(job.Called(), Equals, 0)
+
+	c.Assert(sc.Start(), IsNil)
+	(&jobWrapper{sc, job}).Run()
+	c.Assert(job.Called(), Equals, 1)
+	sc.Stop()
+}
+
+func (s *SuiteScheduler) TestDependencies(c *C) {
+	jobA := &TestJob{}
+	jobA.Name = "a"
+	jobA.Schedule = "@hourly"
+	jobA.OnSuccess = []string{"c"}
+
+	jobB := &TestJob{}
+	jobB.Name = "b"
+	jobB.DependsOn = []string{"a"}
+
+	jobC := &TestJob{}
+	jobC.Name = "c"
+	jobC.OnSuccess = []string{"a"}
+	jobC.DependsOn = []string{"b"}
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(jobA), IsNil)
+	c.Assert(sc.AddJob(jobB), IsNil)
+	c.Assert(sc.AddJob(jobC), IsNil)
+	c.Assert(sc.cron.Entries(), HasLen, 1)
+
+	c.Assert(sc.RunJob("a"), IsNil)
+	sc.Stop()
+
+	// c runs after a and after b, the cycle back to a is skipped
+	c.Assert(jobA.Called(), Equals, 1)
+	c.Assert(jobB.Called(), Equals, 1)
+	c.Assert(jobC.Called(), Equals, 2)
+}
+
+func (s *SuiteScheduler) TestDependenciesFailed(c *C) {
+	jobA := &TestFailingJob{Fails: 1}
+	jobA.Name = "a"
+	jobA.Schedule = "@hourly"
+	jobA.OnFailure = []string{"c"}
+
+	jobB := &TestJob{}
+	jobB.Name = "b"
+	jobB.DependsOn = []string{"a"}
+
+	jobC := &TestJob{}
+	jobC.Name = "c"
+	jobC.Schedule = "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(jobA), IsNil)
+	c.Assert(sc.AddJob(jobB), IsNil)
+	c.Assert(sc.AddJob(jobC), IsNil)
+
+	c.Assert(sc.RunJob("a"), IsNil)
+	sc.Stop()
+
+	c.Assert(jobB.Called(), Equals, 0)
+	c.Assert(jobC.Called(), Equals, 1)
+}
+
+func (s *SuiteScheduler) TestPauseJob(c *C) {
+	jobA := &TestJob{}
+	jobA.Name = "a"
+	jobA.Schedule = "@hourly"
+	jobA.OnSuccess = []string{"b"}
+
+	jobB := &TestJob{}
+	jobB.Name = "b"
+	jobB.Schedule = "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(jobA), IsNil)
+	c.Assert(sc.AddJob(jobB), IsNil)
+	c.Assert(sc.Start(), IsNil)
+	defer sc.Stop()
+
+	c.Assert(sc.PauseJob("b"), IsNil)
+	c.Assert(sc.IsPaused("b"), Equals, true)
+	c.Assert(sc.PauseJob("qux"), Equals, ErrJobNotFound)
+
+	// the scheduled and the triggered executions are dropped, not the manual
+	(&jobWrapper{sc, jobB}).Run()
+	(&jobWrapper{sc, jobA}).Run()
+	c.Assert(jobA.Called(), Equals, 1)
+	c.Assert(jobB.Called(), Equals, 0)
+
+	c.Assert(sc.RunJob("b"), IsNil)
+	time.Sleep(time.Millisecond * 100)
+	c.Assert(jobB.Called(), Equals, 1)
+
+	c.Assert(sc.ResumeJob("b"), IsNil)
+	c.Assert(sc.IsPaused("b"), Equals, false)
+	(&jobWrapper{sc, jobB}).Run()
+	c.Assert(jobB.Called(), Equals, 2)
+}
+
+func (s *SuiteScheduler) TestShutdown(c *C) {
+	job := &LocalJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+	job.Command = "sleep 10"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Start(), IsNil)
+	c.Assert(sc.RunJob("foo"), IsNil)
+	time.Sleep(time.Millisecond * 100)
+
+	start := time.Now()
+	c.Assert(sc.Shutdown(time.Millisecond*100, true), Equals, 0)
+	c.Assert(time.Since(start) < time.Second, Equals, true)
+	c.Assert(sc.IsRunning(), Equals, false)
+	c.Assert(job.History()[0].Error, Equals, ErrCanceledExecution)
+}
+
+func (s *SuiteScheduler) TestShutdownIgnoringCancel(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Start(), IsNil)
+	c.Assert(sc.RunJob("foo"), IsNil)
+
+	// the job ignores the cancellation, it's still running after the timeout
+	c.Assert(sc.Shutdown(time.Millisecond*100, true), Equals, 1)
+	sc.Stop()
+}
+
+func (s *SuiteScheduler) TestShutdownFinished(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Start(), IsNil)
+	c.Assert(sc.RunJob("foo"), IsNil)
+	time.Sleep(time.Millisecond * 100)
+
+	c.Assert(sc.Shutdown(time.Second, false), Equals, 0)
+	c.Assert(job.Called(), Equals, 1)
+}
+
+func (s *SuiteScheduler) TestMaxConcurrentJobs(c *C) {
+	jobA, jobB := &TestJob{}, &TestJob{}
+	jobA.Name, jobB.Name = "foo", "bar"
+	jobA.Schedule, jobB.Schedule = "@hourly", "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.MaxConcurrentJobs = 1
+	c.Assert(sc.AddJob(jobA), IsNil)
+	c.Assert(sc.AddJob(jobB), IsNil)
+	c.Assert(sc.Start(), IsNil)
+
+	c.Assert(sc.RunJob("foo"), IsNil)
+	time.Sleep(time.Millisecond * 100)
+	c.Assert(sc.RunJob("bar"), IsNil)
+	time.Sleep(time.Millisecond * 200)
+	c.Assert(jobA.Called(), Equals, 1)
+	c.Assert(jobB.Called(), Equals, 0)
+
+	time.Sleep(time.Millisecond * 500)
+	c.Assert(jobB.Called(), Equals, 1)
+
+	sc.Stop()
+}
+
+func (s *SuiteScheduler) TestMaxQueueTime(c *C) {
+	jobA, jobB := &TestJob{}, &TestJob{}
+	jobA.Name, jobB.Name = "foo", "bar"
+	jobA.Schedule, jobB.Schedule = "@hourly", "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.MaxConcurrentJobs = 1
+	sc.MaxQueueTime = time.Millisecond * 100
+	c.Assert(sc.AddJob(jobA), IsNil)
+	c.Assert(sc.AddJob(jobB), IsNil)
+	c.Assert(sc.Start(), IsNil)
+
+	c.Assert(sc.RunJob("foo"), IsNil)
+	time.Sleep(time.Millisecond * 100)
+	c.Assert(sc.RunJob("bar"), IsNil)
+	sc.Stop()
+
+	c.Assert(jobA.Called(), Equals, 1)
+	c.Assert(jobB.Called(), Equals, 0)
+	c.Assert(jobB.History(), HasLen, 1)
+	c.Assert(jobB.History()[0].Skipped, Equals, true)
+}
+
+func (s *SuiteScheduler) TestMaxConcurrentJobsPriority(c *C) {
+	jobA, jobB, jobC := &TestJob{}, &TestJob{}, &TestJob{}
+	jobA.Name, jobB.Name, jobC.Name = "foo", "bar", "baz"
+	jobA.Schedule, jobB.Schedule, jobC.Schedule = "@hourly", "@hourly", "@hourly"
+	jobC.Priority = 10
+
+	sc := NewScheduler(&TestLogger{})
+	sc.MaxConcurrentJobs = 1
+	c.Assert(sc.AddJob(jobA), IsNil)
+	c.Assert(sc.AddJob(jobB), IsNil)
+	c.Assert(sc.AddJob(jobC), IsNil)
+	c.Assert(sc.Start(), IsNil)
+
+	c.Assert(sc.RunJob("foo"), IsNil)
+	time.Sleep(time.Millisecond * 100)
+	c.Assert(sc.RunJob("bar"), IsNil)
+	c.Assert(sc.RunJob("baz"), IsNil)
+	time.Sleep(time.Millisecond * 600)
+	c.Assert(jobC.Called(), Equals, 1)
+	c.Assert(jobB.Called(), Equals, 0)
+
+	sc.Stop()
+}
+
+type TestHistoryStore struct {
+	executions map[string][]*Execution
+}
+
+func (s *TestHistoryStore) Save(job string, e *Execution) error {
+	s.executions[job] = append(s.executions[job], e)
+	return nil
+}
+
+func (s *TestHistoryStore) Load(job string) ([]*Execution, error) {
+	return s.executions[job], nil
+}
+
 func (s *SuiteScheduler) TestMergeMiddlewaresSame(c *C) {
 	mA, mB, mC := &TestMiddleware{}, &TestMiddleware{}, &TestMiddleware{}
 
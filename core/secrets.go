@@ -0,0 +1,138 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSecretsDir = "/run/secrets"
+	vaultPrefix       = "vault:"
+	vaultTimeout      = time.Second * 30
+)
+
+// Secrets resolves the secrets of the env-secret options of the jobs, read on
+// every execution so they aren't stored in the config. A secret is the name of
+// a file in Dir, by default `/run/secrets` where docker mounts its secrets, or
+// `vault:path#key`, the key of a HashiCorp Vault secret read from VaultAddress
+// with VaultToken, by default VAULT_ADDR and VAULT_TOKEN.
+type Secrets struct {
+	Dir          string
+	VaultAddress string
+	VaultToken   string
+}
+
+// Resolve returns the value of the given secret, a nil Secrets uses the
+// defaults.
+func (s *Secrets) Resolve(secret string) (string, error) {
+	if s == nil {
+		s = &Secrets{}
+	}
+
+	var value string
+	var err error
+	if strings.HasPrefix(secret, vaultPrefix) {
+		value, err = s.readVault(strings.TrimPrefix(secret, vaultPrefix))
+	} else {
+		value, err = s.readFile(secret)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error reading secret %q: %s", secret, err)
+	}
+
+	return value, nil
+}
+
+// readFile returns the content of the file of Dir, without the trailing new
+// line, the absolute paths and the ones out of Dir aren't allowed
+func (s *Secrets) readFile(name string) (string, error) {
+	path := filepath.Clean(name)
+	if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("the file must be in the secrets directory")
+	}
+
+	dir := s.Dir
+	if dir == "" {
+		dir = defaultSecretsDir
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, path))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// readVault returns the key of a secret of the KV secrets engine, version 1
+// or 2, e.g. `secret/data/db#password`
+func (s *Secrets) readVault(secret string) (string, error) {
+	i := strings.LastIndex(secret, "#")
+	if i == -1 {
+		return "", fmt.Errorf("expected vault:path#key")
+	}
+
+	path, key := strings.Trim(secret[:i], "/"), secret[i+1:]
+
+	address := s.VaultAddress
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+
+	token := s.VaultToken
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	if address == "" {
+		return "", fmt.Errorf("vault-address or VAULT_ADDR is required")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(address, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("X-Vault-Token", token)
+	resp, err := (&http.Client{Timeout: vaultTimeout}).Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %q from vault", resp.Status)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("error decoding vault response: %s", err)
+	}
+
+	// the version 2 of the KV engine nests the secret with its metadata
+	data := body.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok && data["metadata"] != nil {
+		data = nested
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("key %q not found", key)
+	}
+
+	if v, ok := value.(string); ok {
+		return v, nil
+	}
+
+	return fmt.Sprint(value), nil
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteSecrets struct{}
+
+var _ = Suite(&SuiteSecrets{})
+
+func (s *SuiteSecrets) TestResolveFile(c *C) {
+	dir := c.MkDir()
+	file := filepath.Join(dir, "foo")
+	c.Assert(ioutil.WriteFile(file, []byte("bar\n"), 0600), IsNil)
+
+	secrets := &Secrets{Dir: dir}
+	v, err := secrets.Resolve("foo")
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, "bar")
+
+	v, err = secrets.Resolve("./bar/../foo")
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, "bar")
+
+	_, err = secrets.Resolve(file)
+	c.Assert(err, ErrorMatches, `error reading secret ".*": the file must be in the secrets directory`)
+
+	_, err = secrets.Resolve("../" + filepath.Base(dir) + "/foo")
+	c.Assert(err, ErrorMatches, `error reading secret ".*": the file must be in the secrets directory`)
+
+	_, err = secrets.Resolve("qux")
+	c.Assert(err, ErrorMatches, `error reading secret "qux": .*`)
+}
+
+func (s *SuiteSecrets) TestResolveVault(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("X-Vault-Token"), Equals, "token")
+
+		switch r.URL.Path {
+		case "/v1/secret/data/db":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     map[string]interface{}{"password": "foo"},
+					"metadata": map[string]interface{}{"version": 3},
+				},
+			})
+		case "/v1/kv/db":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"password": "bar", "port": 5432},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	defer ts.Close()
+
+	secrets := &Secrets{VaultAddress: ts.URL + "/", VaultToken: "token"}
+	v, err := secrets.Resolve("vault:secret/data/db#password")
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, "foo")
+
+	v, err = secrets.Resolve("vault:/kv/db#password")
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, "bar")
+
+	v, err = secrets.Resolve("vault:kv/db#port")
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, "5432")
+
+	_, err = secrets.Resolve("vault:kv/db#user")
+	c.Assert(err, ErrorMatches, `error reading secret "vault:kv/db#user": key "user" not found`)
+
+	_, err = secrets.Resolve("vault:kv/missing#user")
+	c.Assert(err, ErrorMatches, `.*unexpected status "404 Not Found" from vault`)
+
+	_, err = secrets.Resolve("vault:kv/db")
+	c.Assert(err, ErrorMatches, `.*expected vault:path#key`)
+}
+
+func (s *SuiteSecrets) TestResolveVaultWithoutAddress(c *C) {
+	if addr, ok := os.LookupEnv("VAULT_ADDR"); ok {
+		os.Unsetenv("VAULT_ADDR")
+		defer os.Setenv("VAULT_ADDR", addr)
+	}
+
+	_, err := (&Secrets{}).Resolve("vault:kv/db#password")
+	c.Assert(err, ErrorMatches, `.*vault-address or VAULT_ADDR is required`)
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/fsouza/go-dockerclient"
+)
+
+// ServiceExecJob executes the command in the running tasks of a swarm service,
+// similar to an ExecJob. The Docker API can only exec in the containers of
+// its own node, so only the tasks running in the node of the daemon ofelia is
+// connected to are used, if none runs there the execution fails, or is
+// skipped with SkipOtherNodes. Running ofelia as a global service with
+// SkipOtherNodes executes the command in the tasks of every node.
+type ServiceExecJob struct {
+	BareJob `mapstructure:",squash"`
+	Client  *docker.Client `json:"-"`
+	Service string
+	// AllTasks executes the command in all the tasks of the node, by default
+	// only in the first one.
+	AllTasks bool `mapstructure:"all-tasks"`
+	// SkipOtherNodes skips the execution when the tasks of the service run
+	// in other nodes only, instead of failing.
+	SkipOtherNodes bool   `mapstructure:"skip-other-nodes"`
+	User           string `default:"root"`
+	TTY            bool   `default:"false"`
+	// Environment and Workdir are set on the command, similar to
+	// `docker exec --env --workdir`.
+	Environment []string
+	Workdir     string
+	// EnvSecret are added to the environment as `NAME=secret`, read on every
+	// execution from a file of /run/secrets or from Vault, see Secrets.
+	EnvSecret []string `mapstructure:"env-secret"`
+}
+
+func NewServiceExecJob(c *docker.Client) *ServiceExecJob {
+	return &ServiceExecJob{Client: c}
+}
+
+// GetEnvironment returns the environment of the job
+func (j *ServiceExecJob) GetEnvironment() []string {
+	return j.Environment
+}
+
+func (j *ServiceExecJob) Run(ctx *Context) error {
+	containers, others, err := j.getContainers()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(containers) != 0:
+	case others == 0:
+		return fmt.Errorf("service %q has no running tasks", j.Service)
+	case j.SkipOtherNodes:
+		ctx.Logger.Noticef("No running tasks of service %q in this node, skipping", j.Service)
+		return ErrSkippedExecution
+	default:
+		return fmt.Errorf("the %d running tasks of service %q are in other nodes, the command can only be executed in the node of the docker daemon, see skip-other-nodes", others, j.Service)
+	}
+
+	exec := &ExecJob{
+		Client:      j.Client,
+		User:        j.User,
+		TTY:         j.TTY,
+		Environment: j.Environment,
+		EnvSecret:   j.EnvSecret,
+		Workdir:     j.Workdir,
+	}
+	exec.Command = j.Command
+
+	var failed error
+	for _, container := range containers {
+		if err := exec.runOnContainer(ctx, container); err != nil {
+			if len(containers) == 1 {
+				return err
+			}
+
+			ctx.Logger.Errorf("Error executing in container %s: %s", container, err)
+			failed = fmt.Errorf("error executing in container %s: %s", container, err)
+		}
+	}
+
+	return failed
+}
+
+// getContainers returns the containers of the running tasks of the service in
+// the node of the daemon, and the number of running tasks in other nodes
+func (j *ServiceExecJob) getContainers() ([]string, int, error) {
+	info, err := j.Client.Info()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error inspecting docker: %s", err)
+	}
+
+	if info.Swarm.NodeID == "" {
+		return nil, 0, fmt.Errorf("docker isn't part of a swarm")
+	}
+
+	tasks, err := j.Client.ListTasks(docker.ListTasksOptions{
+		Filters: map[string][]string{"service": {j.Service}},
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing tasks of service %q: %s", j.Service, err)
+	}
+
+	var ids []string
+	var others int
+	for _, t := range tasks {
+		switch {
+		case t.Status.State != swarm.TaskStateRunning:
+		case t.NodeID != info.Swarm.NodeID:
+			others++
+		case t.Status.ContainerStatus == nil:
+		case j.AllTasks || len(ids) == 0:
+			ids = append(ids, t.Status.ContainerStatus.ContainerID)
+		}
+	}
+
+	return ids, others, nil
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/docker/docker/api/types/swarm"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/fsouza/go-dockerclient/testing"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteServiceExecJob struct {
+	server *testing.DockerServer
+	client *docker.Client
+	// otherNode moves the tasks to another node
+	otherNode bool
+}
+
+var _ = Suite(&SuiteServiceExecJob{})
+
+func (s *SuiteServiceExecJob) SetUpTest(c *C) {
+	var err error
+	s.otherNode = false
+	s.server, err = testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, IsNil)
+
+	// the environment of the execs requires the API 1.25
+	s.server.CustomHandler("/version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"ApiVersion": "1.35"})
+	}))
+
+	s.client, err = docker.NewClient(s.server.URL())
+	c.Assert(err, IsNil)
+	s.client.SkipServerVersionCheck = false
+
+	_, err = s.client.InitSwarm(docker.InitSwarmOptions{})
+	c.Assert(err, IsNil)
+
+	// the tasks of the fake server are never running
+	s.server.CustomHandler("/tasks", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		s.server.DefaultHandler().ServeHTTP(rec, r)
+
+		var tasks []*swarm.Task
+		json.Unmarshal(rec.Body.Bytes(), &tasks)
+		for _, t := range tasks {
+			t.Status.State = swarm.TaskStateRunning
+			if s.otherNode {
+				t.NodeID = "other"
+			}
+		}
+
+		json.NewEncoder(w).Encode(tasks)
+	}))
+}
+
+func (s *SuiteServiceExecJob) TestRun(c *C) {
+	s.createService(c, "web", 2)
+
+	var executed int
+	s.server.CustomHandler("/containers/.*/exec", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		executed++
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &ServiceExecJob{Client: s.client}
+	job.Service = "web"
+	job.Command = `echo -a "foo bar"`
+	job.User = "foo"
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, IsNil)
+	c.Assert(executed, Equals, 1)
+
+	job.AllTasks = true
+	err = job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, IsNil)
+	c.Assert(executed, Equals, 3)
+}
+
+func (s *SuiteServiceExecJob) TestRunNoTasks(c *C) {
+	s.createService(c, "web", 1)
+
+	job := &ServiceExecJob{Client: s.client}
+	job.Service = "foo"
+	job.Command = "true"
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, ErrorMatches, `service "foo" has no running tasks`)
+
+	job.SkipOtherNodes = true
+	err = job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, ErrorMatches, `service "foo" has no running tasks`)
+}
+
+func (s *SuiteServiceExecJob) TestRunOtherNodes(c *C) {
+	s.createService(c, "web", 2)
+	s.otherNode = true
+
+	job := &ServiceExecJob{Client: s.client}
+	job.Service = "web"
+	job.Command = "true"
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, ErrorMatches, `the 2 running tasks of service "web" are in other nodes, .* see skip-other-nodes`)
+
+	job.SkipOtherNodes = true
+	err = job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, Equals, ErrSkippedExecution)
+}
+
+func (s *SuiteServiceExecJob) createService(c *C, name string, replicas uint64) {
+	_, err := s.client.CreateService(docker.CreateServiceOptions{
+		ServiceSpec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{Name: name},
+			TaskTemplate: swarm.TaskSpec{
+				ContainerSpec: &swarm.ContainerSpec{Image: "busybox"},
+			},
+			Mode: swarm.ServiceMode{
+				Replicated: &swarm.ReplicatedService{Replicas: &replicas},
+			},
+		},
+	})
+	c.Assert(err, IsNil)
+}
@@ -0,0 +1,78 @@
+package core
+
+import "sync"
+
+// slots limits the jobs running at the same time, the waiting executions get
+// the free slots by priority, and in order of arrival on the same priority.
+type slots struct {
+	mu      sync.Mutex
+	free    int
+	waiting []*slotWaiter
+}
+
+// slotWaiter is an execution waiting for a slot, ready is closed once it gets
+// one
+type slotWaiter struct {
+	priority int
+	ready    chan struct{}
+}
+
+func newSlots(n int) *slots {
+	return &slots{free: n}
+}
+
+// acquire takes a free slot, returning nil, or queues the execution if there
+// are none, returning the waiter that gets ready once it gets one
+func (s *slots) acquire(priority int) *slotWaiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.free > 0 {
+		s.free--
+		return nil
+	}
+
+	w := &slotWaiter{priority: priority, ready: make(chan struct{})}
+	s.waiting = append(s.waiting, w)
+	return w
+}
+
+// release frees a slot, giving it to the waiting execution with the highest
+// priority, if any
+func (s *slots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.waiting) == 0 {
+		s.free++
+		return
+	}
+
+	// the waiting executions are in order of arrival
+	next := 0
+	for i, w := range s.waiting {
+		if w.priority > s.waiting[next].priority {
+			next = i
+		}
+	}
+
+	w := s.waiting[next]
+	s.waiting = append(s.waiting[:next], s.waiting[next+1:]...)
+	close(w.ready)
+}
+
+// cancel removes the waiter from the queue, or releases its slot if it
+// already got one
+func (s *slots) cancel(w *slotWaiter) {
+	s.mu.Lock()
+	for i, x := range s.waiting {
+		if x == w {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			s.mu.Unlock()
+			return
+		}
+	}
+
+	s.mu.Unlock()
+	s.release()
+}
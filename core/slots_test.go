@@ -0,0 +1,68 @@
+package core
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type SuiteSlots struct{}
+
+var _ = Suite(&SuiteSlots{})
+
+func (s *SuiteSlots) TestAcquireRelease(c *C) {
+	sl := newSlots(2)
+	c.Assert(sl.acquire(0), IsNil)
+	c.Assert(sl.acquire(0), IsNil)
+
+	w := sl.acquire(0)
+	c.Assert(w, NotNil)
+	c.Assert(isReady(w), Equals, false)
+
+	sl.release()
+	c.Assert(isReady(w), Equals, true)
+
+	sl.release()
+	sl.release()
+	c.Assert(sl.free, Equals, 2)
+}
+
+func (s *SuiteSlots) TestPriority(c *C) {
+	sl := newSlots(1)
+	c.Assert(sl.acquire(0), IsNil)
+
+	low, first, second := sl.acquire(-1), sl.acquire(10), sl.acquire(10)
+
+	sl.release()
+	c.Assert(isReady(first), Equals, true)
+	c.Assert(isReady(second), Equals, false)
+
+	sl.release()
+	c.Assert(isReady(second), Equals, true)
+	c.Assert(isReady(low), Equals, false)
+
+	sl.release()
+	c.Assert(isReady(low), Equals, true)
+}
+
+func (s *SuiteSlots) TestCancel(c *C) {
+	sl := newSlots(1)
+	c.Assert(sl.acquire(0), IsNil)
+
+	a, b := sl.acquire(0), sl.acquire(0)
+	sl.cancel(a)
+	sl.release()
+	c.Assert(isReady(a), Equals, false)
+	c.Assert(isReady(b), Equals, true)
+
+	// canceling a waiter that already got a slot releases it
+	sl.cancel(b)
+	c.Assert(sl.free, Equals, 1)
+}
+
+func isReady(w *slotWaiter) bool {
+	select {
+	case <-w.ready:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const sshDialTimeout = time.Second * 30
+
+// SSHJob executes the command on a remote host over SSH, the output of the
+// command is the output of the execution. The host is authenticated with the
+// known hosts file, and the user with a private key and the SSH agent of
+// ofelia, if any.
+type SSHJob struct {
+	BareJob `mapstructure:",squash"`
+	// Host is the remote host, as `host` or `host:port`.
+	Host string
+	User string `default:"root"`
+	// KeyFile is the path of the private key, decrypted with KeyPassphrase if
+	// it's encrypted.
+	KeyFile       string `mapstructure:"key-file"`
+	KeyPassphrase string `mapstructure:"key-passphrase"`
+	// KnownHosts is the path of the known hosts file, by default
+	// `~/.ssh/known_hosts`. IgnoreHostKey disables the verification of the
+	// host key.
+	KnownHosts    string `mapstructure:"known-hosts"`
+	IgnoreHostKey bool   `mapstructure:"ignore-host-key"`
+	// Timeout is the maximum time the command is allowed to run, after that
+	// the connection is closed and the execution fails with ErrMaxTimeRunning.
+	Timeout time.Duration
+}
+
+func NewSSHJob() *SSHJob {
+	return &SSHJob{}
+}
+
+func (j *SSHJob) Run(ctx *Context) error {
+	command, err := ctx.RenderCommand(j.Command)
+	if err != nil {
+		return err
+	}
+
+	config, agentConn, err := j.buildConfig()
+	if err != nil {
+		return err
+	}
+
+	if agentConn != nil {
+		defer agentConn.Close()
+	}
+
+	client, err := ssh.Dial("tcp", j.address(), config)
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %s", j.Host, err)
+	}
+
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("error opening session: %s", err)
+	}
+
+	defer session.Close()
+	session.Stdout = ctx.Execution.OutputStream
+	session.Stderr = ctx.Execution.ErrorStream
+
+	if err := session.Start(command); err != nil {
+		return fmt.Errorf("error starting command: %s", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	timeout := j.Timeout
+	if timeout == 0 {
+		timeout = maxProcessDuration
+	}
+
+	select {
+	case err := <-done:
+		if e, ok := err.(*ssh.ExitError); ok {
+			return &ExitCodeError{ExitCode: e.ExitStatus()}
+		}
+
+		return err
+	case <-ctx.Execution.Done():
+		err = ErrCanceledExecution
+	case <-time.After(timeout):
+		err = ErrMaxTimeRunning
+	}
+
+	// closing the connection stops the command on most servers
+	client.Close()
+	<-done
+	return err
+}
+
+func (j *SSHJob) address() string {
+	if _, _, err := net.SplitHostPort(j.Host); err == nil {
+		return j.Host
+	}
+
+	return net.JoinHostPort(j.Host, "22")
+}
+
+// buildConfig returns the config of the client and the connection to the SSH
+// agent, if any, that must be closed once the execution finishes
+func (j *SSHJob) buildConfig() (*ssh.ClientConfig, net.Conn, error) {
+	var auth []ssh.AuthMethod
+	if j.KeyFile != "" {
+		signer, err := j.readKey()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	var agentConn net.Conn
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		var err error
+		agentConn, err = net.Dial("unix", sock)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error connecting to ssh agent: %s", err)
+		}
+
+		auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+	}
+
+	if len(auth) == 0 {
+		return nil, nil, fmt.Errorf("key-file or an ssh agent is required")
+	}
+
+	hostKey := ssh.InsecureIgnoreHostKey()
+	if !j.IgnoreHostKey {
+		file := j.KnownHosts
+		if file == "" {
+			file = filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
+		}
+
+		var err error
+		hostKey, err = knownhosts.New(file)
+		if err != nil {
+			if agentConn != nil {
+				agentConn.Close()
+			}
+
+			return nil, nil, fmt.Errorf("error reading known hosts: %s", err)
+		}
+	}
+
+	return &ssh.ClientConfig{
+		User:            j.User,
+		Auth:            auth,
+		HostKeyCallback: hostKey,
+		Timeout:         sshDialTimeout,
+	}, agentConn, nil
+}
+
+func (j *SSHJob) readKey() (ssh.Signer, error) {
+	key, err := ioutil.ReadFile(j.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key: %s", err)
+	}
+
+	var signer ssh.Signer
+	if j.KeyPassphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(j.KeyPassphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(key)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing key %q: %s", j.KeyFile, err)
+	}
+
+	return signer, nil
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteSSHJob struct {
+	listener net.Listener
+	keyFile  string
+	known    string
+	command  string
+}
+
+var _ = Suite(&SuiteSSHJob{})
+
+func (s *SuiteSSHJob) SetUpTest(c *C) {
+	os.Unsetenv("SSH_AUTH_SOCK")
+	dir := c.MkDir()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	der, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, IsNil)
+	s.keyFile = filepath.Join(dir, "id_ecdsa")
+	err = ioutil.WriteFile(s.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	c.Assert(err, IsNil)
+
+	user, err := ssh.NewPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	hostKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	host, err := ssh.NewSignerFromKey(hostKey)
+	c.Assert(err, IsNil)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(m ssh.ConnMetadata, k ssh.PublicKey) (*ssh.Permissions, error) {
+			if m.User() != "foo" || string(k.Marshal()) != string(user.Marshal()) {
+				return nil, ssh.ErrNoAuth
+			}
+
+			return nil, nil
+		},
+	}
+	config.AddHostKey(host)
+
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	go s.serve(s.listener, config)
+
+	s.known = filepath.Join(dir, "known_hosts")
+	line := "[127.0.0.1]:" + s.port() + " " + string(ssh.MarshalAuthorizedKey(host.PublicKey()))
+	err = ioutil.WriteFile(s.known, []byte(line), 0600)
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteSSHJob) TearDownTest(c *C) {
+	s.listener.Close()
+}
+
+func (s *SuiteSSHJob) port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+// serve accepts sessions executing the commands `fail` and `sleep`, any other
+// command is echoed
+func (s *SuiteSSHJob) serve(l net.Listener, config *ssh.ServerConfig) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		_, chans, reqs, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			continue
+		}
+
+		go ssh.DiscardRequests(reqs)
+		for nc := range chans {
+			ch, reqs, _ := nc.Accept()
+			go func() {
+				for r := range reqs {
+					var payload struct{ Command string }
+					ssh.Unmarshal(r.Payload, &payload)
+					s.command = payload.Command
+					r.Reply(r.Type == "exec", nil)
+
+					var code uint32
+					switch payload.Command {
+					case "fail":
+						ch.Stderr().Write([]byte("failed\n"))
+						code = 3
+					case "sleep":
+						time.Sleep(time.Second)
+					default:
+						ch.Write([]byte(payload.Command + "\n"))
+					}
+
+					status := struct{ Code uint32 }{code}
+					ch.SendRequest("exit-status", false, ssh.Marshal(&status))
+					ch.Close()
+				}
+			}()
+		}
+	}
+}
+
+func (s *SuiteSSHJob) buildJob(command string) *SSHJob {
+	job := &SSHJob{}
+	job.Host = "127.0.0.1:" + s.port()
+	job.User = "foo"
+	job.KeyFile = s.keyFile
+	job.KnownHosts = s.known
+	job.Command = command
+
+	return job
+}
+
+func (s *SuiteSSHJob) TestRun(c *C) {
+	e := NewExecution()
+	err := s.buildJob("echo foo bar").Run(&Context{Execution: e})
+	c.Assert(err, IsNil)
+	c.Assert(s.command, Equals, "echo foo bar")
+	c.Assert(string(e.Output()), Equals, "echo foo bar\n")
+}
+
+func (s *SuiteSSHJob) TestRunExitCode(c *C) {
+	e := NewExecution()
+	err := s.buildJob("fail").Run(&Context{Execution: e})
+	c.Assert(err, DeepEquals, &ExitCodeError{ExitCode: 3})
+	c.Assert(string(e.ErrorOutput()), Equals, "failed\n")
+}
+
+func (s *SuiteSSHJob) TestRunTimeout(c *C) {
+	job := s.buildJob("sleep")
+	job.Timeout = time.Millisecond * 100
+
+	err := job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, Equals, ErrMaxTimeRunning)
+}
+
+func (s *SuiteSSHJob) TestRunUnknownHost(c *C) {
+	err := ioutil.WriteFile(s.known, nil, 0600)
+	c.Assert(err, IsNil)
+
+	err = s.buildJob("echo").Run(&Context{Execution: NewExecution()})
+	c.Assert(err, ErrorMatches, "error connecting to .*: ssh: handshake failed: knownhosts: key is unknown")
+}
+
+func (s *SuiteSSHJob) TestRunWithoutAuth(c *C) {
+	job := s.buildJob("echo")
+	job.KeyFile = ""
+
+	err := job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, ErrorMatches, "key-file or an ssh agent is required")
+}
+
+func (s *SuiteSSHJob) TestAddress(c *C) {
+	c.Assert((&SSHJob{Host: "foo"}).address(), Equals, "foo:22")
+	c.Assert((&SSHJob{Host: "foo:2222"}).address(), Equals, "foo:2222")
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateData is the data available in the templates of the command, the
+// environment and the volumes of the jobs, e.g. `{{.JobName}}` or
+// `{{.Date "2006-01-02"}}`.
+type TemplateData struct {
+	JobName     string
+	ExecutionID string
+
+	date time.Time
+}
+
+// Date returns the date the execution started, formatted with the given Go
+// layout
+func (d *TemplateData) Date(layout string) string {
+	return d.date.Format(layout)
+}
+
+// Render executes s as a template with the data of the execution, s is
+// returned as is if the job doesn't enable the templates, see
+// BareJob.Templates, or if it doesn't contain any action.
+func (c *Context) Render(s string) (string, error) {
+	if c.Job == nil || !c.Job.GetTemplates() || !strings.Contains(s, "{{") {
+		return s, nil
+	}
+
+	t, err := template.New("").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid template %q: %s", s, err)
+	}
+
+	data := &TemplateData{JobName: c.Job.GetName(), ExecutionID: c.Execution.ID, date: c.Execution.Date}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("error rendering template %q: %s", s, err)
+	}
+
+	return b.String(), nil
+}
+
+// RenderCommand renders the command of the job, see Render, followed by the
+// arguments of the execution, quoted
+func (c *Context) RenderCommand(command string) (string, error) {
+	command, err := c.Render(command)
+	if err != nil || len(c.Execution.Args) == 0 {
+		return command, err
+	}
+
+	return strings.TrimSpace(command + " " + quoteArgs(c.Execution.Args)), nil
+}
+
+// quoteArgs joins the arguments quoted between double quotes, escaping the
+// characters expanded by the shells, so they're parsed as the same arguments
+// by the jobs splitting the commands and by the shells.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,@+%") == "" {
+			quoted[i] = arg
+			continue
+		}
+
+		var b strings.Builder
+		b.WriteByte('"')
+		for _, r := range arg {
+			if strings.ContainsRune("\\\"$`", r) {
+				b.WriteByte('\\')
+			}
+
+			b.WriteRune(r)
+		}
+
+		b.WriteByte('"')
+		quoted[i] = b.String()
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// RenderAll renders every string of ss, see Render
+func (c *Context) RenderAll(ss []string) ([]string, error) {
+	if len(ss) == 0 {
+		return ss, nil
+	}
+
+	out := make([]string, len(ss))
+	for i, s := range ss {
+		var err error
+		if out[i], err = c.Render(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"time"
+
+	"github.com/gobs/args"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteTemplate struct{}
+
+var _ = Suite(&SuiteTemplate{})
+
+func (s *SuiteTemplate) buildContext() *Context {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Templates = true
+
+	e := NewExecution()
+	e.ID = "bar"
+	e.Date = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	return &Context{Job: job, Execution: e}
+}
+
+func (s *SuiteTemplate) TestRender(c *C) {
+	out, err := s.buildContext().Render(`backup-{{.JobName}}-{{.ExecutionID}}-{{.Date "2006-01-02"}}.tgz`)
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, "backup-foo-bar-2020-01-02.tgz")
+}
+
+func (s *SuiteTemplate) TestRenderWithoutActions(c *C) {
+	out, err := s.buildContext().Render("echo {foo}")
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, "echo {foo}")
+}
+
+func (s *SuiteTemplate) TestRenderDisabled(c *C) {
+	ctx := s.buildContext()
+	ctx.Job.(*TestJob).Templates = false
+
+	out, err := ctx.Render(`docker ps --format '{{.Names}}'`)
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, `docker ps --format '{{.Names}}'`)
+}
+
+func (s *SuiteTemplate) TestRenderEscaped(c *C) {
+	out, err := s.buildContext().Render(`docker ps --format '{{"{{"}}.Names}}'`)
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, "docker ps --format '{{.Names}}'")
+}
+
+func (s *SuiteTemplate) TestRenderInvalid(c *C) {
+	_, err := s.buildContext().Render("{{.JobName")
+	c.Assert(err, ErrorMatches, `invalid template "{{.JobName": .*`)
+
+	_, err = s.buildContext().Render("{{.Foo}}")
+	c.Assert(err, ErrorMatches, `error rendering template "{{.Foo}}": .*`)
+}
+
+func (s *SuiteTemplate) TestRenderAll(c *C) {
+	out, err := s.buildContext().RenderAll([]string{"FOO={{.JobName}}", "BAR=bar"})
+	c.Assert(err, IsNil)
+	c.Assert(out, DeepEquals, []string{"FOO=foo", "BAR=bar"})
+
+	out, err = s.buildContext().RenderAll(nil)
+	c.Assert(err, IsNil)
+	c.Assert(out, IsNil)
+}
+
+func (s *SuiteTemplate) TestRenderCommand(c *C) {
+	ctx := s.buildContext()
+	ctx.Execution.Args = []string{"--since=2020-01-01", "a b", `it's "$HOME"`, ""}
+
+	out, err := ctx.RenderCommand("backup {{.JobName}}")
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, `backup foo --since=2020-01-01 "a b" "it's \"\$HOME\"" ""`)
+	c.Assert(args.GetArgs(out), DeepEquals, []string{"backup", "foo", "--since=2020-01-01", "a b", `it's "$HOME"`, ""})
+
+	out, err = ctx.RenderCommand("")
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, `--since=2020-01-01 "a b" "it's \"\$HOME\"" ""`)
+}
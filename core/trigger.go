@@ -0,0 +1,481 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcuadros/ofelia/internal/resp"
+)
+
+const (
+	triggerTimeout = time.Second * 10
+	// triggerRetryDelay is the time waited before connecting again when the
+	// connection of a trigger fails
+	triggerRetryDelay = time.Second * 5
+)
+
+// triggerPingInterval is the interval of the pings sent by the NATS and Redis
+// triggers, the connection is retried if they aren't answered
+var triggerPingInterval = time.Minute
+
+// Trigger is a source of events requesting executions of a job, in addition
+// to its schedule, like the messages of a NATS subject or the files created in
+// a directory, see WatchTrigger.
+type Trigger interface {
+	// Listen connects to the source and calls fire for every event received,
+	// it blocks until stop is closed, returning nil, or the connection fails.
+	// fire returns a channel closed once the execution requested finishes,
+	// waited by the triggers acknowledging the events after the run.
+	Listen(stop <-chan struct{}, fire func() <-chan struct{}) error
+	// String returns the URL or path of the trigger, without the credentials
+	String() string
+}
+
+// ParseTrigger parses the URL of a trigger, one of:
+//   - `nats|tls://[user:password@|token@]host[:port]/subject[?queue=group]`
+//   - `redis[s]://[[user]:password@]host[:port]/channel`
+//   - `amqp[s]://[user:password@]host[:port]/queue[?vhost=vhost&prefetch=n]`
+func ParseTrigger(rawurl string) (Trigger, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimPrefix(u.Path, "/")
+	if name == "" {
+		return nil, fmt.Errorf("invalid trigger %q: missing subject, channel or queue", rawurl)
+	}
+
+	switch u.Scheme {
+	case "nats", "tls":
+		return newNATSTrigger(u, name), nil
+	case "redis", "rediss":
+		return newRedisTrigger(u, name), nil
+	case "amqp", "amqps":
+		t, err := newAMQPTrigger(u, name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trigger %q: %s", rawurl, err)
+		}
+
+		return t, nil
+	default:
+		return nil, fmt.Errorf("invalid trigger %q: unknown scheme %q", rawurl, u.Scheme)
+	}
+}
+
+// jobTriggers returns the triggers of the job: the message queue of its
+// trigger and the files of its watch path
+func jobTriggers(j Job) ([]Trigger, error) {
+	var triggers []Trigger
+	if j.GetTrigger() != "" {
+		t, err := ParseTrigger(j.GetTrigger())
+		if err != nil {
+			return nil, err
+		}
+
+		triggers = append(triggers, t)
+	}
+
+	if j.GetWatchPath() != "" {
+		t := NewWatchTrigger(j.GetWatchPath(), j.GetWatchDebounce())
+		t.Existing = j.GetWatchExisting()
+		triggers = append(triggers, t)
+	}
+
+	return triggers, nil
+}
+
+// triggerConn is the connection of a trigger, closed when the trigger is
+// stopped to unblock the reads.
+type triggerConn struct {
+	net.Conn
+	r    *bufio.Reader
+	done chan struct{}
+	// mu serializes the writes of the trigger and its keepalives
+	mu sync.Mutex
+	// timeout is the time waited for every read, none while zero
+	timeout time.Duration
+}
+
+// dialTrigger connects to addr, with TLS if secure, the connection is closed
+// when stop is closed.
+func dialTrigger(addr string, secure bool, stop <-chan struct{}) (*triggerConn, error) {
+	d := &net.Dialer{Timeout: triggerTimeout}
+
+	var conn net.Conn
+	var err error
+	if secure {
+		host, _, _ := net.SplitHostPort(addr)
+		conn, err = tls.DialWithDialer(d, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = d.Dial("tcp", addr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := &triggerConn{Conn: conn, r: bufio.NewReader(conn), done: make(chan struct{})}
+	go func() {
+		select {
+		case <-stop:
+			conn.Close()
+		case <-c.done:
+		}
+	}()
+
+	// the handshake must be done in time, the messages are waited forever
+	conn.SetDeadline(time.Now().Add(triggerTimeout))
+	return c, nil
+}
+
+func (c *triggerConn) Close() error {
+	close(c.done)
+	return c.Conn.Close()
+}
+
+// send writes p, serialized with the keepalives
+func (c *triggerConn) send(p []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.Write(p)
+	return err
+}
+
+// keepalive sends ping every half interval until the connection is closed, the
+// reads fail if nothing, not even the reply to a ping, is received in two
+// intervals. It replaces the deadline of the handshake.
+func (c *triggerConn) keepalive(interval time.Duration, ping []byte) {
+	c.SetDeadline(time.Time{})
+	c.timeout = interval * 2
+
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-ticker.C:
+				if err := c.send(ping); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// waitRead sets the deadline of the next read, if the keepalive started
+func (c *triggerConn) waitRead() {
+	if c.timeout != 0 {
+		c.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+}
+
+// startTLS upgrades the connection to TLS, verifying the certificate of host
+func (c *triggerConn) startTLS(host string) error {
+	conn := tls.Client(c.Conn, &tls.Config{ServerName: host})
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+
+	c.Conn, c.r = conn, bufio.NewReader(conn)
+	return nil
+}
+
+// coalesce returns a function requesting an execution for every message, only
+// one runs at a time: the messages received meanwhile request a single one,
+// started once it finishes. The NATS and Redis triggers use it, since their
+// messages can't be left pending in the server like the messages of AMQP.
+func coalesce(stop <-chan struct{}, fire func() <-chan struct{}) func() {
+	var mu sync.Mutex
+	var running, pending bool
+
+	run := func() {
+		for {
+			<-fire()
+
+			mu.Lock()
+			select {
+			case <-stop:
+				pending = false
+			default:
+			}
+
+			if !pending {
+				running = false
+				mu.Unlock()
+				return
+			}
+
+			pending = false
+			mu.Unlock()
+		}
+	}
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if running {
+			pending = true
+			return
+		}
+
+		running = true
+		go run()
+	}
+}
+
+// stopped returns err, or nil if the trigger was stopped
+func stopped(stop <-chan struct{}, err error) error {
+	select {
+	case <-stop:
+		return nil
+	default:
+		return err
+	}
+}
+
+// hostPort returns the address of the URL, with the default port if missing
+func hostPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// natsTrigger subscribes to a subject of a NATS server, with the core
+// protocol, the messages are received once per queue group. The connection is
+// upgraded to TLS with the `tls` scheme or if the server requires it.
+type natsTrigger struct {
+	addr     string
+	tls      bool
+	subject  string
+	queue    string
+	user     string
+	password string
+	token    string
+}
+
+func newNATSTrigger(u *url.URL, subject string) *natsTrigger {
+	t := &natsTrigger{
+		addr:    hostPort(u, "4222"),
+		tls:     u.Scheme == "tls",
+		subject: subject,
+		queue:   u.Query().Get("queue"),
+	}
+
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			t.user, t.password = u.User.Username(), password
+		} else {
+			t.token = u.User.Username()
+		}
+	}
+
+	return t
+}
+
+func (t *natsTrigger) String() string {
+	scheme := "nats"
+	if t.tls {
+		scheme = "tls"
+	}
+
+	s := scheme + "://" + t.addr + "/" + t.subject
+	if t.queue != "" {
+		s += "?queue=" + url.QueryEscape(t.queue)
+	}
+
+	return s
+}
+
+func (t *natsTrigger) Listen(stop <-chan struct{}, fire func() <-chan struct{}) error {
+	c, err := dialTrigger(t.addr, false, stop)
+	if err != nil {
+		return stopped(stop, err)
+	}
+
+	defer c.Close()
+	return stopped(stop, t.listen(c, fire))
+}
+
+func (t *natsTrigger) listen(c *triggerConn, fireFunc func() <-chan struct{}) error {
+	info, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(info, "INFO ") {
+		return fmt.Errorf("nats: unexpected greeting %q", strings.TrimSpace(info))
+	}
+
+	var server struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+
+	if err := json.Unmarshal([]byte(info[5:]), &server); err != nil {
+		return fmt.Errorf("nats: invalid greeting: %s", err)
+	}
+
+	if t.tls || server.TLSRequired {
+		host, _, _ := net.SplitHostPort(t.addr)
+		if err := c.startTLS(host); err != nil {
+			return fmt.Errorf("nats: %s", err)
+		}
+	}
+
+	connect, _ := json.Marshal(map[string]interface{}{
+		"verbose":    false,
+		"pedantic":   false,
+		"name":       "ofelia",
+		"user":       t.user,
+		"pass":       t.password,
+		"auth_token": t.token,
+	})
+
+	sub := "SUB " + t.subject
+	if t.queue != "" {
+		sub += " " + t.queue
+	}
+
+	// the PONG confirms the subscription, the errors are sent before it
+	if err := c.send([]byte(fmt.Sprintf("CONNECT %s\r\n%s 1\r\nPING\r\n", connect, sub))); err != nil {
+		return err
+	}
+
+	fire := coalesce(c.done, fireFunc)
+	subscribed := false
+	for {
+		c.waitRead()
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		line = strings.TrimSuffix(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "MSG "):
+			fields := strings.Fields(line)
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return fmt.Errorf("nats: invalid message %q", line)
+			}
+
+			if _, err := io.ReadFull(c.r, make([]byte, size+2)); err != nil {
+				return err
+			}
+
+			fire()
+		case line == "PING":
+			if err := c.send([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case line == "PONG" && !subscribed:
+			subscribed = true
+			c.keepalive(triggerPingInterval, []byte("PING\r\n"))
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("nats: " + strings.Trim(strings.TrimSpace(line[4:]), "'"))
+		}
+	}
+}
+
+// redisTrigger subscribes to a channel of Redis
+type redisTrigger struct {
+	addr     string
+	tls      bool
+	channel  string
+	user     string
+	password string
+}
+
+func newRedisTrigger(u *url.URL, channel string) *redisTrigger {
+	t := &redisTrigger{
+		addr:    hostPort(u, "6379"),
+		tls:     u.Scheme == "rediss",
+		channel: channel,
+	}
+
+	if u.User != nil {
+		t.password, _ = u.User.Password()
+		if t.password != "" {
+			t.user = u.User.Username()
+		}
+	}
+
+	return t
+}
+
+func (t *redisTrigger) String() string {
+	scheme := "redis"
+	if t.tls {
+		scheme = "rediss"
+	}
+
+	return scheme + "://" + t.addr + "/" + t.channel
+}
+
+func (t *redisTrigger) Listen(stop <-chan struct{}, fire func() <-chan struct{}) error {
+	c, err := dialTrigger(t.addr, t.tls, stop)
+	if err != nil {
+		return stopped(stop, err)
+	}
+
+	defer c.Close()
+	return stopped(stop, t.listen(c, fire))
+}
+
+func (t *redisTrigger) listen(c *triggerConn, fireFunc func() <-chan struct{}) error {
+	if t.password != "" {
+		if err := resp.Write(c, resp.Auth(t.user, t.password)...); err != nil {
+			return err
+		}
+
+		if _, err := resp.Read(c.r); err != nil {
+			return err
+		}
+	}
+
+	if err := resp.Write(c, "SUBSCRIBE", t.channel); err != nil {
+		return err
+	}
+
+	var ping bytes.Buffer
+	resp.Write(&ping, "PING")
+
+	fire := coalesce(c.done, fireFunc)
+	for {
+		c.waitRead()
+		reply, err := resp.Read(c.r)
+		if err != nil {
+			return err
+		}
+
+		msg, ok := reply.([]interface{})
+		if !ok || len(msg) == 0 {
+			return fmt.Errorf("redis: unexpected reply %v", reply)
+		}
+
+		// the replies to the pings, "pong", are ignored
+		switch msg[0] {
+		case "subscribe":
+			c.keepalive(triggerPingInterval, ping.Bytes())
+		case "message":
+			fire()
+		}
+	}
+}
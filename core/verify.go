@@ -0,0 +1,143 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/gobs/args"
+)
+
+// ImageVerification contains the options verifying with cosign the signature
+// of the image of the jobs running a container, before running it. The image
+// is verified with the public key VerifyKey, or keyless with the identity and
+// the OIDC issuer of the certificate of the signature. The execution fails if
+// the image isn't signed or the signature isn't valid. The command running
+// cosign is the one of the scheduler, see Scheduler.VerifyCommand.
+type ImageVerification struct {
+	// VerifyKey is the public key, as a file, URL or KMS URI accepted by
+	// `cosign verify --key`.
+	VerifyKey        string `mapstructure:"verify-key"`
+	VerifyIdentity   string `mapstructure:"verify-identity"`
+	VerifyOIDCIssuer string `mapstructure:"verify-oidc-issuer"`
+}
+
+// Validate returns an error if the options don't set either the key or both
+// the identity and the OIDC issuer, or none of them
+func (v *ImageVerification) Validate() error {
+	switch {
+	case !v.enabled():
+		return nil
+	case v.VerifyKey != "" && (v.VerifyIdentity != "" || v.VerifyOIDCIssuer != ""):
+		return errors.New("verify-key can't be combined with verify-identity and verify-oidc-issuer")
+	case v.VerifyKey == "" && (v.VerifyIdentity == "" || v.VerifyOIDCIssuer == ""):
+		return errors.New("verify-identity and verify-oidc-issuer are required to verify keyless signatures")
+	default:
+		return nil
+	}
+}
+
+func (v *ImageVerification) enabled() bool {
+	return v.VerifyKey != "" || v.VerifyIdentity != "" || v.VerifyOIDCIssuer != ""
+}
+
+// verifyImage verifies the signature of the image by its digest, returning the
+// reference by digest of the verified image, `repository@sha256:...`, so the
+// verified image is run even if the tag is pulled again meanwhile. The image
+// is returned as is if the verification isn't enabled.
+func (v *ImageVerification) verifyImage(ctx *Context, c *docker.Client, image string) (string, error) {
+	if !v.enabled() {
+		return image, nil
+	}
+
+	ref, err := imageDigest(c, image)
+	if err != nil {
+		return "", err
+	}
+
+	var command string
+	if ctx.Scheduler != nil {
+		command = ctx.Scheduler.VerifyCommand
+	}
+
+	cmd := v.buildArgs(command, ref)
+	bin, err := exec.LookPath(cmd[0])
+	if err != nil {
+		return "", err
+	}
+
+	var output bytes.Buffer
+	err = runCommand(ctx, &exec.Cmd{
+		Path:   bin,
+		Args:   cmd,
+		Stdout: &output,
+		Stderr: &output,
+	})
+
+	switch {
+	case err == ErrCanceledExecution:
+		return "", err
+	case err != nil:
+		return "", fmt.Errorf("error verifying the signature of image %q: %s", image, lastLine(output.String(), err))
+	}
+
+	return ref, nil
+}
+
+// buildArgs returns the arguments of the command verifying the reference, the
+// options must be valid, see Validate
+func (v *ImageVerification) buildArgs(command, ref string) []string {
+	if command == "" {
+		command = "cosign"
+	}
+
+	cmd := append(args.GetArgs(command), "verify")
+	if v.VerifyKey != "" {
+		cmd = append(cmd, "--key", v.VerifyKey)
+	} else {
+		cmd = append(cmd,
+			"--certificate-identity", v.VerifyIdentity,
+			"--certificate-oidc-issuer", v.VerifyOIDCIssuer,
+		)
+	}
+
+	return append(cmd, ref)
+}
+
+// imageDigest returns the reference by digest of the local image, the image
+// must have been pulled from a registry
+func imageDigest(c *docker.Client, image string) (string, error) {
+	img, err := c.InspectImage(image)
+	if err != nil {
+		return "", fmt.Errorf("error inspecting image %q: %s", image, err)
+	}
+
+	if len(img.RepoDigests) == 0 {
+		return "", fmt.Errorf("image %q has no digest, it wasn't pulled from a registry", image)
+	}
+
+	// the digest of the repository of the image if pushed to several
+	o, _ := buildPullOptions(image)
+	digest := img.RepoDigests[0]
+	for _, d := range img.RepoDigests {
+		if strings.HasPrefix(d, o.Repository+"@") {
+			digest = d
+		}
+	}
+
+	return o.Repository + digest[strings.Index(digest, "@"):], nil
+}
+
+// lastLine returns the last line of the output of a failed command, usually
+// the error, or err if there is no output
+func lastLine(output string, err error) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if line := lines[len(lines)-1]; line != "" {
+		return line
+	}
+
+	return err.Error()
+}
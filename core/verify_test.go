@@ -0,0 +1,148 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/fsouza/go-dockerclient/testing"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteVerify struct {
+	server *testing.DockerServer
+	client *docker.Client
+	dir    string
+}
+
+var _ = Suite(&SuiteVerify{})
+
+func (s *SuiteVerify) SetUpTest(c *C) {
+	var err error
+	s.server, err = testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, IsNil)
+
+	s.client, err = docker.NewClient(s.server.URL())
+	c.Assert(err, IsNil)
+
+	s.dir, err = ioutil.TempDir("", "verify")
+	c.Assert(err, IsNil)
+
+	s.server.CustomHandler("/images/quay.io/foo/bar:v1/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(docker.Image{
+			ID:          "sha256:qux",
+			RepoDigests: []string{"mirror.io/bar@sha256:baz", "quay.io/foo/bar@sha256:abc"},
+		})
+	}))
+}
+
+func (s *SuiteVerify) TearDownTest(c *C) {
+	os.RemoveAll(s.dir)
+}
+
+// writeCosign writes a fake cosign writing its arguments to a file and
+// exiting with the given script
+func (s *SuiteVerify) writeCosign(c *C, script string) string {
+	bin := filepath.Join(s.dir, "cosign")
+	content := "#!/bin/sh\necho \"$@\" > " + filepath.Join(s.dir, "args") + "\n" + script + "\n"
+	c.Assert(ioutil.WriteFile(bin, []byte(content), 0755), IsNil)
+	return bin
+}
+
+// buildContext returns the context of an execution of a scheduler verifying
+// the images with a fake cosign, see writeCosign
+func (s *SuiteVerify) buildContext(c *C, script string) *Context {
+	sh := NewScheduler(&TestLogger{})
+	sh.VerifyCommand = s.writeCosign(c, script)
+	return &Context{Scheduler: sh, Execution: NewExecution()}
+}
+
+func (s *SuiteVerify) readArgs(c *C) string {
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, "args"))
+	c.Assert(err, IsNil)
+	return strings.TrimSpace(string(content))
+}
+
+func (s *SuiteVerify) TestVerifyImage(c *C) {
+	v := &ImageVerification{VerifyKey: "cosign.pub"}
+	ref, err := v.verifyImage(s.buildContext(c, "exit 0"), s.client, "quay.io/foo/bar:v1")
+	c.Assert(err, IsNil)
+	c.Assert(ref, Equals, "quay.io/foo/bar@sha256:abc")
+	c.Assert(s.readArgs(c), Equals, "verify --key cosign.pub quay.io/foo/bar@sha256:abc")
+}
+
+func (s *SuiteVerify) TestVerifyImageKeyless(c *C) {
+	v := &ImageVerification{
+		VerifyIdentity:   "https://github.com/foo/bar/.github/workflows/release.yml@refs/heads/main",
+		VerifyOIDCIssuer: "https://token.actions.githubusercontent.com",
+	}
+
+	_, err := v.verifyImage(s.buildContext(c, "exit 0"), s.client, "quay.io/foo/bar:v1")
+	c.Assert(err, IsNil)
+	c.Assert(s.readArgs(c), Equals, "verify"+
+		" --certificate-identity https://github.com/foo/bar/.github/workflows/release.yml@refs/heads/main"+
+		" --certificate-oidc-issuer https://token.actions.githubusercontent.com"+
+		" quay.io/foo/bar@sha256:abc",
+	)
+}
+
+func (s *SuiteVerify) TestVerifyImageInvalidSignature(c *C) {
+	v := &ImageVerification{VerifyKey: "cosign.pub"}
+	ctx := s.buildContext(c, "echo 'Verification for quay.io/foo/bar --' >&2\necho 'Error: no matching signatures' >&2\nexit 1")
+
+	_, err := v.verifyImage(ctx, s.client, "quay.io/foo/bar:v1")
+	c.Assert(err, ErrorMatches, `error verifying the signature of image "quay.io/foo/bar:v1": Error: no matching signatures`)
+}
+
+func (s *SuiteVerify) TestVerifyImageWithoutDigest(c *C) {
+	s.buildImage(c)
+
+	v := &ImageVerification{VerifyKey: "cosign.pub"}
+	_, err := v.verifyImage(s.buildContext(c, "exit 0"), s.client, ImageFixture)
+	c.Assert(err, ErrorMatches, `image "test-image" has no digest, it wasn't pulled from a registry`)
+}
+
+func (s *SuiteVerify) TestVerifyImageDisabled(c *C) {
+	v := &ImageVerification{}
+	ref, err := v.verifyImage(&Context{Execution: NewExecution()}, nil, "foo:latest")
+	c.Assert(err, IsNil)
+	c.Assert(ref, Equals, "foo:latest")
+}
+
+func (s *SuiteVerify) TestValidate(c *C) {
+	c.Assert((&ImageVerification{}).Validate(), IsNil)
+	c.Assert((&ImageVerification{VerifyKey: "cosign.pub"}).Validate(), IsNil)
+	c.Assert((&ImageVerification{VerifyIdentity: "foo", VerifyOIDCIssuer: "bar"}).Validate(), IsNil)
+
+	err := (&ImageVerification{VerifyIdentity: "foo"}).Validate()
+	c.Assert(err, ErrorMatches, "verify-identity and verify-oidc-issuer are required .*")
+
+	err = (&ImageVerification{VerifyKey: "cosign.pub", VerifyOIDCIssuer: "foo"}).Validate()
+	c.Assert(err, ErrorMatches, "verify-key can't be combined .*")
+}
+
+func (s *SuiteVerify) TestBuildArgsDefaultCommand(c *C) {
+	v := &ImageVerification{VerifyKey: "cosign.pub"}
+	c.Assert(v.buildArgs("", "foo@sha256:abc"), DeepEquals, []string{"cosign", "verify", "--key", "cosign.pub", "foo@sha256:abc"})
+}
+
+func (s *SuiteVerify) buildImage(c *C) {
+	inputbuf := bytes.NewBuffer(nil)
+	tr := tar.NewWriter(inputbuf)
+	tr.WriteHeader(&tar.Header{Name: "Dockerfile"})
+	tr.Write([]byte("FROM base\n"))
+	tr.Close()
+
+	err := s.client.BuildImage(docker.BuildImageOptions{
+		Name:         ImageFixture,
+		InputStream:  inputbuf,
+		OutputStream: bytes.NewBuffer(nil),
+	})
+	c.Assert(err, IsNil)
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWatchDebounce = time.Second * 5
+	watchPollInterval    = time.Second
+)
+
+// WatchTrigger runs a job when files are created or modified in a directory,
+// or in the files matching a glob pattern. The files are polled, so it works
+// with the bind mounts and network filesystems lacking change notifications.
+// The files removed don't run the job, neither the files existing when the
+// trigger starts unless Existing, since their changes are unknown.
+type WatchTrigger struct {
+	// Path is the directory watched, its subdirectories aren't, or a glob
+	// pattern like `/srv/incoming/*.csv`
+	Path string
+	// Debounce is the time the files must be unchanged before running the
+	// job, so files still being written don't run it, by default 5s.
+	Debounce time.Duration
+	// Existing runs the job for the files existing when the trigger starts,
+	// e.g. the ones created while ofelia was down, once the debounce time
+	// passed. The job must tolerate the files already processed.
+	Existing bool
+
+	interval time.Duration
+}
+
+// NewWatchTrigger returns a WatchTrigger of the given path, with the default
+// debounce if zero
+func NewWatchTrigger(path string, debounce time.Duration) *WatchTrigger {
+	if debounce == 0 {
+		debounce = defaultWatchDebounce
+	}
+
+	return &WatchTrigger{Path: path, Debounce: debounce, interval: watchPollInterval}
+}
+
+func (t *WatchTrigger) String() string {
+	return t.Path
+}
+
+// Listen polls the files and calls fire once they changed and remained
+// unchanged for the debounce time
+func (t *WatchTrigger) Listen(stop <-chan struct{}, fire func() <-chan struct{}) error {
+	files, err := t.scan()
+	if err != nil {
+		return err
+	}
+
+	var changed time.Time
+	if t.Existing && len(files) != 0 {
+		changed = time.Now()
+	}
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(t.interval):
+		}
+
+		current, err := t.scan()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if modified(files, current) {
+			changed = now
+		}
+
+		files = current
+		if !changed.IsZero() && now.Sub(changed) >= t.Debounce {
+			changed = time.Time{}
+			fire()
+		}
+	}
+}
+
+// watchedFile is the state of a file compared to detect its changes
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// scan returns the state of the watched files, by path
+func (t *WatchTrigger) scan() (map[string]watchedFile, error) {
+	paths, err := t.paths()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]watchedFile, len(paths))
+	for _, path := range paths {
+		// the files removed since they were listed are ignored
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		files[path] = watchedFile{size: info.Size(), modTime: info.ModTime()}
+	}
+
+	return files, nil
+}
+
+func (t *WatchTrigger) paths() ([]string, error) {
+	if strings.ContainsAny(t.Path, "*?[") {
+		paths, err := filepath.Glob(t.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid watch path %q: %s", t.Path, err)
+		}
+
+		return paths, nil
+	}
+
+	names, err := readDirNames(t.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(t.Path, name)
+	}
+
+	return paths, nil
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
+
+// modified returns true if any file of current was created or modified since
+// the previous scan
+func modified(previous, current map[string]watchedFile) bool {
+	for path, f := range current {
+		if p, ok := previous[path]; !ok || !p.modTime.Equal(f.modTime) || p.size != f.size {
+			return true
+		}
+	}
+
+	return false
+}
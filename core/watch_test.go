@@ -0,0 +1,108 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteWatch struct{}
+
+var _ = Suite(&SuiteWatch{})
+
+// watch listens the trigger running the given steps, and returns the number
+// of times it fired
+func watch(c *C, t *WatchTrigger, steps ...func()) int {
+	t.interval = time.Millisecond * 10
+
+	stop := make(chan struct{})
+	fired := make(chan bool, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- t.Listen(stop, func() <-chan struct{} {
+			fired <- true
+			return finished()
+		})
+	}()
+
+	for _, step := range steps {
+		time.Sleep(time.Millisecond * 50)
+		step()
+	}
+
+	time.Sleep(t.Debounce + time.Millisecond*100)
+	close(stop)
+	c.Assert(<-done, IsNil)
+	return len(fired)
+}
+
+func (s *SuiteWatch) TestListen(c *C) {
+	dir := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "existing"), []byte("foo"), 0644), IsNil)
+
+	t := NewWatchTrigger(dir, time.Millisecond*100)
+	n := watch(c, t,
+		func() { ioutil.WriteFile(filepath.Join(dir, "a.csv"), []byte("foo"), 0644) },
+		func() { ioutil.WriteFile(filepath.Join(dir, "a.csv"), []byte("foobar"), 0644) },
+		func() { ioutil.WriteFile(filepath.Join(dir, "b.csv"), []byte("foo"), 0644) },
+	)
+
+	// the burst of changes runs the job once
+	c.Assert(n, Equals, 1)
+}
+
+func (s *SuiteWatch) TestListenExisting(c *C) {
+	dir := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "existing"), []byte("foo"), 0644), IsNil)
+
+	t := NewWatchTrigger(dir, time.Millisecond*50)
+	c.Assert(watch(c, t), Equals, 0)
+
+	t.Existing = true
+	c.Assert(watch(c, t), Equals, 1)
+
+	// without files there is nothing to run
+	t = NewWatchTrigger(c.MkDir(), time.Millisecond*50)
+	t.Existing = true
+	c.Assert(watch(c, t), Equals, 0)
+}
+
+func (s *SuiteWatch) TestListenRemoved(c *C) {
+	dir := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "a.csv"), []byte("foo"), 0644), IsNil)
+
+	t := NewWatchTrigger(dir, time.Millisecond*50)
+	c.Assert(watch(c, t, func() { os.Remove(filepath.Join(dir, "a.csv")) }), Equals, 0)
+}
+
+func (s *SuiteWatch) TestListenGlob(c *C) {
+	dir := c.MkDir()
+
+	t := NewWatchTrigger(filepath.Join(dir, "*.csv"), time.Millisecond*50)
+	c.Assert(watch(c, t, func() { ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("foo"), 0644) }), Equals, 0)
+	c.Assert(watch(c, t, func() { ioutil.WriteFile(filepath.Join(dir, "a.csv"), []byte("foo"), 0644) }), Equals, 1)
+}
+
+func (s *SuiteWatch) TestListenNotFound(c *C) {
+	t := NewWatchTrigger(filepath.Join(c.MkDir(), "missing"), 0)
+	c.Assert(t.Debounce, Equals, defaultWatchDebounce)
+	c.Assert(t.Listen(make(chan struct{}), finished), NotNil)
+}
+
+func (s *SuiteWatch) TestSchedulerWatchPath(c *C) {
+	dir := c.MkDir()
+
+	job := &TestJob{}
+	job.WatchPath = dir
+	job.WatchDebounce = time.Millisecond * 100
+	job.WatchExisting = true
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.listeners[job], HasLen, 1)
+	c.Assert(sc.listeners[job][0].trigger.String(), Equals, dir)
+	c.Assert(sc.listeners[job][0].trigger.(*WatchTrigger).Existing, Equals, true)
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// watchdogInterval is the time between the checks of the watchdog
+var watchdogInterval = time.Minute
+
+// MissedExecutionError is the error of the executions reported by the
+// watchdog when a job didn't run at its scheduled time
+type MissedExecutionError struct {
+	Expected time.Time
+}
+
+func (e *MissedExecutionError) Error() string {
+	return fmt.Sprintf("job did not run, expected at %s", e.Expected.Format(time.RFC3339))
+}
+
+// watchdog checks every watchdogInterval that the scheduled jobs ran, until
+// stop is closed, see checkMissedRuns.
+func (s *Scheduler) watchdog(stop <-chan struct{}) {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			s.checkMissedRuns(now)
+		}
+	}
+}
+
+// checkMissedRuns reports the jobs that didn't run at their scheduled time,
+// within their jitter and the WatchdogTolerance, as a failed execution passed
+// to the report middlewares, so a wedged scheduler or a paused docker daemon
+// is noticed. The paused jobs aren't expected to run.
+func (s *Scheduler) checkMissedRuns(now time.Time) {
+	s.mu.Lock()
+	jobs := make([]Job, len(s.Jobs))
+	copy(jobs, s.Jobs)
+	started := s.started
+	s.mu.Unlock()
+
+	for _, j := range jobs {
+		if s.IsPaused(j.GetName()) {
+			s.setWatched(j, now)
+			continue
+		}
+
+		expected, ok := s.expectedRun(j, started)
+		if !ok || now.Before(expected.Add(j.GetJitter()+s.WatchdogTolerance)) {
+			continue
+		}
+
+		s.setWatched(j, now)
+		s.reportMissedRun(j, expected)
+	}
+}
+
+// expectedRun returns the first scheduled time of the job after its last
+// execution, or after the start of the scheduler, the time the job was added
+// or the last check of the watchdog finding it paused or missed, if later.
+func (s *Scheduler) expectedRun(j Job, started time.Time) (time.Time, bool) {
+	if j.GetSchedule() == "" || j.GetSchedule() == RebootSchedule || j.GetSchedule() == ManualSchedule {
+		return time.Time{}, false
+	}
+
+	schedule, err := ParseSchedule(j.GetSchedule(), s.CronFormat)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	last := started
+	if h := j.History(); len(h) != 0 && h[len(h)-1].Date.After(last) {
+		last = h[len(h)-1].Date
+	}
+
+	s.mu.Lock()
+	watched, added := s.watched[j.GetName()], s.added[j]
+	s.mu.Unlock()
+	for _, t := range []time.Time{watched, added} {
+		if t.After(last) {
+			last = t
+		}
+	}
+
+	next := schedule.Next(last)
+	return next, !next.IsZero()
+}
+
+func (s *Scheduler) setWatched(j Job, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.watched == nil {
+		s.watched = make(map[string]time.Time)
+	}
+
+	s.watched[j.GetName()] = t
+}
+
+// reportMissedRun runs the report middlewares of the job with a failed
+// execution, the job isn't run and the execution isn't added to its history,
+// since it never ran.
+func (s *Scheduler) reportMissedRun(j Job, expected time.Time) {
+	ctx := NewContext(s, j, s.newExecution(j))
+	ctx.Execution.Start()
+	ctx.Stop(&MissedExecutionError{Expected: expected})
+	ctx.Log(fmt.Sprintf("Did not run, expected at %s", expected.Format(time.RFC3339)))
+	ctx.Next()
+}
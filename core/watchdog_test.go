@@ -0,0 +1,161 @@
+package core
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteWatchdog struct{}
+
+var _ = Suite(&SuiteWatchdog{})
+
+// missedMiddleware records the executions reported to it
+type missedMiddleware struct {
+	executions []*Execution
+}
+
+func (m *missedMiddleware) ContinueOnStop() bool {
+	return true
+}
+
+func (m *missedMiddleware) Run(ctx *Context) error {
+	m.executions = append(m.executions, ctx.Execution)
+	return nil
+}
+
+func (s *SuiteWatchdog) TestCheckMissedRuns(c *C) {
+	m := &missedMiddleware{}
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@every 1m"
+	job.Use(m)
+
+	store := &TestHistoryStore{executions: make(map[string][]*Execution)}
+	sc := NewScheduler(&TestLogger{})
+	sc.History = store
+	sc.WatchdogTolerance = time.Minute
+	c.Assert(sc.AddJob(job), IsNil)
+
+	now := time.Now()
+	sc.started = now.Add(-time.Minute * 3)
+	sc.added[job] = sc.started
+	sc.checkMissedRuns(now.Add(-time.Minute - time.Second))
+	c.Assert(m.executions, HasLen, 0)
+
+	sc.checkMissedRuns(now)
+	c.Assert(m.executions, HasLen, 1)
+	c.Assert(job.Called(), Equals, 0)
+
+	// the missed execution isn't part of the history, it never ran
+	c.Assert(job.History(), HasLen, 0)
+	c.Assert(store.executions["foo"], HasLen, 0)
+
+	e := m.executions[0]
+	c.Assert(e.Failed, Equals, true)
+	c.Assert(e.Error.Error(), Equals, "job did not run, expected at "+sc.started.Add(time.Minute).Format(time.RFC3339))
+
+	// reported once, the next run is expected after the report
+	sc.checkMissedRuns(now.Add(time.Minute))
+	c.Assert(m.executions, HasLen, 1)
+}
+
+func (s *SuiteWatchdog) TestCheckMissedRunsAddedJob(c *C) {
+	m := &missedMiddleware{}
+	job := &TestJob{}
+	job.Schedule = "@every 1m"
+	job.Use(m)
+
+	sc := NewScheduler(&TestLogger{})
+	sc.WatchdogTolerance = time.Minute
+	now := time.Now()
+	sc.started = now.Add(-time.Hour)
+
+	// the job added while running is expected from the time it was added
+	c.Assert(sc.AddJob(job), IsNil)
+	sc.checkMissedRuns(now.Add(time.Second * 90))
+	c.Assert(m.executions, HasLen, 0)
+
+	sc.checkMissedRuns(now.Add(time.Minute * 3))
+	c.Assert(m.executions, HasLen, 1)
+}
+
+func (s *SuiteWatchdog) TestCheckMissedRunsRecentExecution(c *C) {
+	job := &TestJob{}
+	job.Schedule = "@every 1m"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+
+	now := time.Now()
+	sc.started = now.Add(-time.Hour)
+	sc.added[job] = sc.started
+
+	e := NewExecution()
+	e.Date = now.Add(-time.Second * 30)
+	job.AddHistory(e)
+
+	sc.checkMissedRuns(now)
+	c.Assert(job.History(), HasLen, 1)
+}
+
+func (s *SuiteWatchdog) TestCheckMissedRunsPaused(c *C) {
+	m := &missedMiddleware{}
+	job := &TestJob{}
+	job.Use(m)
+	job.Name = "foo"
+	job.Schedule = "@every 1m"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+
+	now := time.Now()
+	sc.started = now.Add(-time.Hour)
+	sc.added[job] = sc.started
+	c.Assert(sc.PauseJob("foo"), IsNil)
+	sc.checkMissedRuns(now)
+	c.Assert(m.executions, HasLen, 0)
+
+	// the job is expected from the last check it was paused
+	c.Assert(sc.ResumeJob("foo"), IsNil)
+	sc.checkMissedRuns(now.Add(time.Second * 30))
+	c.Assert(m.executions, HasLen, 0)
+
+	sc.checkMissedRuns(now.Add(time.Minute * 2))
+	c.Assert(m.executions, HasLen, 1)
+}
+
+func (s *SuiteWatchdog) TestCheckMissedRunsWithoutSchedule(c *C) {
+	manual := &TestJob{}
+	manual.Schedule = ManualSchedule
+
+	reboot := &TestJob{}
+	reboot.Schedule = RebootSchedule
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(manual), IsNil)
+	c.Assert(sc.AddJob(reboot), IsNil)
+
+	sc.checkMissedRuns(time.Now().Add(time.Hour))
+	c.Assert(manual.History(), HasLen, 0)
+	c.Assert(reboot.History(), HasLen, 0)
+}
+
+func (s *SuiteWatchdog) TestStartWatchdog(c *C) {
+	defer func(interval time.Duration) { watchdogInterval = interval }(watchdogInterval)
+	watchdogInterval = time.Millisecond * 50
+
+	job := &TestJob{}
+	job.Schedule = "0 0 1 1 *"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.WatchdogTolerance = time.Hour
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Start(), IsNil)
+	c.Assert(sc.stop, NotNil)
+
+	time.Sleep(time.Millisecond * 120)
+	c.Assert(sc.Stop(), IsNil)
+	c.Assert(sc.stop, IsNil)
+	c.Assert(job.History(), HasLen, 0)
+}
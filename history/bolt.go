@@ -0,0 +1,194 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	openTimeout = time.Second * 5
+	// maxOutputSize is the maximum size of the stored output and error output
+	// of every execution, only the tail is kept.
+	maxOutputSize = 64 * 1024
+)
+
+// BoltStore is a core.HistoryStore backed by a BoltDB file, the executions of
+// every job are stored in its own bucket sorted by date.
+type BoltStore struct {
+	// Retention is the time the executions are kept, older executions are
+	// deleted when a new one is saved. Zero means forever.
+	Retention time.Duration
+
+	db *bolt.DB
+}
+
+// NewBoltStore opens, or creates, the BoltDB file at the given path.
+func NewBoltStore(path string, retention time.Duration) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoltStore{Retention: retention, db: db}, nil
+}
+
+// Save stores the execution and deletes the ones older than the retention.
+func (s *BoltStore) Save(job string, e *core.Execution) error {
+	value, err := json.Marshal(newRecord(e))
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(job))
+		if err != nil {
+			return err
+		}
+
+		if err := b.Put(executionKey(e.Date, e.ID), value); err != nil {
+			return err
+		}
+
+		return s.prune(b)
+	})
+}
+
+func (s *BoltStore) prune(b *bolt.Bucket) error {
+	if s.Retention == 0 {
+		return nil
+	}
+
+	limit := executionKey(time.Now().Add(-s.Retention), "")
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k, limit) < 0; k, _ = c.Next() {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Load returns the stored executions of the job within the retention.
+func (s *BoltStore) Load(job string) ([]*core.Execution, error) {
+	var h []*core.Execution
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(job))
+		if b == nil {
+			return nil
+		}
+
+		var limit time.Time
+		if s.Retention != 0 {
+			limit = time.Now().Add(-s.Retention)
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var r record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+
+			if r.Date.Before(limit) {
+				return nil
+			}
+
+			h = append(h, r.execution())
+			return nil
+		})
+	})
+
+	return h, err
+}
+
+// Close closes the BoltDB file.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// executionKey returns a key sorted by date, the ID avoids collisions
+func executionKey(date time.Time, id string) []byte {
+	k := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(k, uint64(date.UnixNano()))
+	return append(k, id...)
+}
+
+type record struct {
+	ID           string
+	Date         time.Time
+	Duration     time.Duration
+	PullDuration time.Duration
+	Failed       bool
+	Skipped      bool
+	Warning      bool
+	Slow         bool
+	Error        string
+	ExitCode     int
+	Container    *core.ContainerState
+	Args         []string
+	// EnvNames are the names of the environment variables of the
+	// execution, the values can be secrets
+	EnvNames    []string
+	Output      []byte
+	ErrorOutput []byte
+}
+
+func newRecord(e *core.Execution) *record {
+	r := &record{
+		ID:           e.ID,
+		Date:         e.Date,
+		Duration:     e.Duration,
+		PullDuration: e.PullDuration,
+		Failed:       e.Failed,
+		Skipped:      e.Skipped,
+		Warning:      e.Warning,
+		Slow:         e.Slow,
+		Container:    e.Container,
+		Args:         e.Args,
+		EnvNames:     core.EnvNames(e.Environment),
+		Output:       []byte(core.TailOutput(e.Output(), maxOutputSize)),
+		ErrorOutput:  []byte(core.TailOutput(e.ErrorOutput(), maxOutputSize)),
+	}
+
+	if e.Error != nil {
+		r.Error = e.Error.Error()
+	}
+
+	if err, ok := e.Error.(*core.ExitCodeError); ok {
+		r.ExitCode = err.ExitCode
+	}
+
+	return r
+}
+
+func (r *record) execution() *core.Execution {
+	e := core.NewExecution()
+	e.ID = r.ID
+	e.Date = r.Date
+	e.Duration = r.Duration
+	e.PullDuration = r.PullDuration
+	e.Failed = r.Failed
+	e.Skipped = r.Skipped
+	e.Warning = r.Warning
+	e.Slow = r.Slow
+	e.Container = r.Container
+	e.Args = r.Args
+	e.Environment = r.EnvNames
+	e.OutputStream.Write(r.Output)
+	e.ErrorStream.Write(r.ErrorOutput)
+
+	switch {
+	case r.ExitCode != 0:
+		e.Error = &core.ExitCodeError{ExitCode: r.ExitCode}
+	case r.Error != "":
+		e.Error = errors.New(r.Error)
+	}
+
+	return e
+}
@@ -0,0 +1,95 @@
+package history
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type SuiteBoltStore struct {
+	dir string
+}
+
+var _ = Suite(&SuiteBoltStore{})
+
+func (s *SuiteBoltStore) SetUpTest(c *C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "ofelia")
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteBoltStore) TearDownTest(c *C) {
+	os.RemoveAll(s.dir)
+}
+
+func (s *SuiteBoltStore) TestSaveLoad(c *C) {
+	file := filepath.Join(s.dir, "history.db")
+	store, err := NewBoltStore(file, 0)
+	c.Assert(err, IsNil)
+
+	e := s.execution(time.Now().Add(-time.Minute), nil)
+	e.OutputStream.Write([]byte("foo"))
+	e.Environment = []string{"TOKEN=s3cr3t"}
+	c.Assert(store.Save("foo", e), IsNil)
+	c.Assert(store.Save("foo", s.execution(time.Now(), &core.ExitCodeError{ExitCode: 2})), IsNil)
+	c.Assert(store.Save("bar", s.execution(time.Now(), errors.New("bar"))), IsNil)
+	c.Assert(store.Close(), IsNil)
+
+	store, err = NewBoltStore(file, 0)
+	c.Assert(err, IsNil)
+	defer store.Close()
+
+	h, err := store.Load("foo")
+	c.Assert(err, IsNil)
+	c.Assert(h, HasLen, 2)
+	c.Assert(h[0].ID, Equals, e.ID)
+	c.Assert(h[0].Date.Equal(e.Date), Equals, true)
+	c.Assert(h[0].Duration, Equals, e.Duration)
+	c.Assert(string(h[0].Output()), Equals, "foo")
+	c.Assert(h[0].Environment, DeepEquals, []string{"TOKEN"})
+	c.Assert(h[1].Failed, Equals, true)
+	c.Assert(h[1].Error, DeepEquals, &core.ExitCodeError{ExitCode: 2})
+
+	h, err = store.Load("bar")
+	c.Assert(err, IsNil)
+	c.Assert(h, HasLen, 1)
+	c.Assert(h[0].Error.Error(), Equals, "bar")
+
+	h, err = store.Load("qux")
+	c.Assert(err, IsNil)
+	c.Assert(h, HasLen, 0)
+}
+
+func (s *SuiteBoltStore) TestRetention(c *C) {
+	store, err := NewBoltStore(filepath.Join(s.dir, "history.db"), time.Hour)
+	c.Assert(err, IsNil)
+	defer store.Close()
+
+	c.Assert(store.Save("foo", s.execution(time.Now().Add(-2*time.Hour), nil)), IsNil)
+	c.Assert(store.Save("foo", s.execution(time.Now(), nil)), IsNil)
+
+	h, err := store.Load("foo")
+	c.Assert(err, IsNil)
+	c.Assert(h, HasLen, 1)
+
+	store.Retention = 0
+	h, err = store.Load("foo")
+	c.Assert(err, IsNil)
+	c.Assert(h, HasLen, 1)
+}
+
+func (s *SuiteBoltStore) execution(date time.Time, err error) *core.Execution {
+	e := core.NewExecution()
+	e.Start()
+	e.Stop(err)
+	e.Date = date
+	return e
+}
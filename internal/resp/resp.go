@@ -0,0 +1,84 @@
+// Package resp implements the protocol of Redis, shared by the Redis triggers
+// of the jobs and the Redis clients of the middlewares.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Write writes a command of Redis with the given arguments
+func Write(w io.Writer, args ...string) error {
+	cmd := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		cmd += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	_, err := io.WriteString(w, cmd)
+	return err
+}
+
+// Read reads a reply of Redis: a string, an int64, a slice of replies, nil for
+// the nil replies or an error for the error replies.
+func Read(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New("redis: " + line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = Read(r); err != nil {
+				return nil, err
+			}
+		}
+
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// Auth returns the arguments of the AUTH command for the given credentials,
+// with the user only when set, the servers before Redis 6 don't accept it.
+func Auth(user, password string) []string {
+	if user == "" {
+		return []string{"AUTH", password}
+	}
+
+	return []string{"AUTH", user, password}
+}
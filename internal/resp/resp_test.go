@@ -0,0 +1,45 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type SuiteRESP struct{}
+
+var _ = Suite(&SuiteRESP{})
+
+func (s *SuiteRESP) TestWrite(c *C) {
+	var buf bytes.Buffer
+	c.Assert(Write(&buf, "SET", "foo", ""), IsNil)
+	c.Assert(buf.String(), Equals, "*3\r\n$3\r\nSET\r\n$3\r\nfoo\r\n$0\r\n\r\n")
+}
+
+func (s *SuiteRESP) TestRead(c *C) {
+	r := bufio.NewReader(strings.NewReader(
+		"+OK\r\n:42\r\n$-1\r\n*2\r\n$4\r\npong\r\n$0\r\n\r\n-ERR unknown\r\n?\r\n",
+	))
+
+	for _, expected := range []interface{}{"OK", int64(42), nil, []interface{}{"pong", ""}} {
+		reply, err := Read(r)
+		c.Assert(err, IsNil)
+		c.Assert(reply, DeepEquals, expected)
+	}
+
+	_, err := Read(r)
+	c.Assert(err, ErrorMatches, "redis: ERR unknown")
+
+	_, err = Read(r)
+	c.Assert(err, ErrorMatches, `redis: unexpected reply "\?"`)
+}
+
+func (s *SuiteRESP) TestAuth(c *C) {
+	c.Assert(Auth("", "secret"), DeepEquals, []string{"AUTH", "secret"})
+	c.Assert(Auth("ofelia", "secret"), DeepEquals, []string{"AUTH", "ofelia", "secret"})
+}
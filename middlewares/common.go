@@ -1,6 +1,71 @@
 package middlewares
 
-import "reflect"
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+// Notification policies of the report middlewares, set with the notify-on
+// options
+const (
+	NotifyAlways      = "always"
+	NotifyError       = "error"
+	NotifyStateChange = "state-change"
+)
+
+// ValidateNotifyOn returns an error if any notify-on option of the config, a
+// struct or a pointer to it, has an unknown notification policy. The embedded
+// configs are validated too.
+func ValidateNotifyOn(c interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(c))
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		switch {
+		case f.Anonymous && f.Type.Kind() == reflect.Struct:
+			if err := ValidateNotifyOn(v.Field(i).Interface()); err != nil {
+				return err
+			}
+		case strings.HasSuffix(f.Name, "NotifyOn") && f.Type.Kind() == reflect.String:
+			switch p := v.Field(i).String(); p {
+			case "", NotifyAlways, NotifyError, NotifyStateChange:
+			default:
+				name := strings.SplitN(f.Tag.Get("mapstructure"), ",", 2)[0]
+				return fmt.Errorf("invalid %s %q: expected %s, %s or %s", name, p, NotifyAlways, NotifyError, NotifyStateChange)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Validate returns an error if the config, a struct or a pointer to it, isn't
+// valid: its notify-on options, see ValidateNotifyOn, and the embedded configs
+// with a Validate method, e.g. SaveConfig.
+func Validate(c interface{}) error {
+	if err := ValidateNotifyOn(c); err != nil {
+		return err
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(c))
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if !v.Type().Field(i).Anonymous || f.Kind() != reflect.Struct || !f.CanAddr() {
+			continue
+		}
+
+		if c, ok := f.Addr().Interface().(interface{ Validate() error }); ok {
+			if err := c.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
 
 func IsEmpty(i interface{}) bool {
 	t := reflect.TypeOf(i).Elem()
@@ -8,3 +73,179 @@ func IsEmpty(i interface{}) bool {
 
 	return reflect.DeepEqual(i, e)
 }
+
+// shouldNotify returns true if the execution has to be reported according to
+// the notification policy, onlyOnError is equivalent to NotifyError and is only
+// used if the policy is empty. With NotifyStateChange the failed executions
+// are reported if the previous one succeeded, and the successful ones if the
+// previous one failed, the skipped executions are ignored. NotifyError also
+// reports the successful executions flagged as slow by max-duration-warning.
+func shouldNotify(ctx *core.Context, notifyOn string, onlyOnError bool) bool {
+	if notifyOn == "" && onlyOnError {
+		notifyOn = NotifyError
+	}
+
+	e := ctx.Execution
+	switch notifyOn {
+	case NotifyError:
+		return e.Failed || e.Slow
+	case NotifyStateChange:
+		if e.Skipped {
+			return false
+		}
+
+		prev := previousExecution(ctx)
+		if prev == nil {
+			return e.Failed
+		}
+
+		return prev.Failed != e.Failed
+	default:
+		return true
+	}
+}
+
+// shouldAlert returns true if the execution has to be reported by the alerting
+// middlewares, like shouldNotify. If the job has alert-after-failures, the
+// failed executions are only reported when they are the given consecutive
+// failure, and the successful ones when they recover from it or the policy is
+// NotifyAlways. The rest of the middlewares, e.g. the ones storing the
+// executions, ignore alert-after-failures.
+func shouldAlert(ctx *core.Context, notifyOn string, onlyOnError bool) bool {
+	e := ctx.Execution
+	n := ctx.Job.GetAlertAfterFailures()
+	if n == 0 || e.Skipped {
+		return shouldNotify(ctx, notifyOn, onlyOnError)
+	}
+
+	if notifyOn == "" && onlyOnError {
+		notifyOn = NotifyError
+	}
+
+	if e.Failed {
+		return previousFailures(ctx)+1 == n
+	}
+
+	return isRecovery(ctx) || (e.Slow && notifyOn == NotifyError) ||
+		(notifyOn != NotifyError && notifyOn != NotifyStateChange)
+}
+
+// previousExecution returns the last finished and not skipped execution of the
+// job started before the current one
+func previousExecution(ctx *core.Context) *core.Execution {
+	h := ctx.Job.History()
+
+	var found bool
+	for i := len(h) - 1; i >= 0; i-- {
+		switch {
+		case h[i] == ctx.Execution:
+			found = true
+		case found && !h[i].IsRunning && !h[i].Skipped:
+			return h[i]
+		}
+	}
+
+	return nil
+}
+
+// Actions of the incident middlewares, PagerDuty and Opsgenie
+const (
+	incidentTrigger = "trigger"
+	incidentResolve = "resolve"
+)
+
+// incidentAction returns incidentTrigger if the execution failed, and
+// incidentResolve if it succeeded after a failure, otherwise it's empty. If the
+// job has alert-after-failures, the incident is only triggered from the given
+// consecutive failure on, and resolved after it.
+func incidentAction(ctx *core.Context) string {
+	n := ctx.Job.GetAlertAfterFailures()
+	if n < 1 {
+		n = 1
+	}
+
+	e := ctx.Execution
+	switch {
+	case e.Skipped:
+		return ""
+	case e.Failed && previousFailures(ctx)+1 >= n:
+		return incidentTrigger
+	case !e.Failed && previousFailures(ctx) >= n:
+		return incidentResolve
+	default:
+		return ""
+	}
+}
+
+// incidentKey returns the key deduplicating the incidents of the job
+func incidentKey(j core.Job) string {
+	return "ofelia-" + j.GetName()
+}
+
+// previousFailures returns the number of consecutive failed executions of the
+// job finished before the current one, the skipped executions are ignored
+func previousFailures(ctx *core.Context) int {
+	h := ctx.Job.History()
+
+	var found bool
+	var failures int
+	for i := len(h) - 1; i >= 0; i-- {
+		switch {
+		case h[i] == ctx.Execution:
+			found = true
+		case !found || h[i].IsRunning || h[i].Skipped:
+			continue
+		case !h[i].Failed:
+			return failures
+		default:
+			failures++
+		}
+	}
+
+	return failures
+}
+
+// isRecovery returns true if the execution succeeded after, at least, the
+// alert-after-failures consecutive failures of the job
+func isRecovery(ctx *core.Context) bool {
+	n := ctx.Job.GetAlertAfterFailures()
+	e := ctx.Execution
+	return n > 0 && !e.Failed && !e.Skipped && previousFailures(ctx) >= n
+}
+
+// statusLabel returns the label of the status of the execution, `recovered`
+// if it's the recovery of a job, see isRecovery.
+func statusLabel(ctx *core.Context) string {
+	if isRecovery(ctx) {
+		return "recovered"
+	}
+
+	return executionLabel(ctx.Execution)
+}
+
+// exitCodeText returns the exit code of a failed execution followed by the
+// reason reported by docker, if any, e.g. `137 (killed by OOM)`. It returns
+// false if the execution didn't fail with an exit code.
+func exitCodeText(e *core.Execution) (string, bool) {
+	err, ok := e.Error.(*core.ExitCodeError)
+	if !ok {
+		return "", false
+	}
+
+	text := strconv.Itoa(err.ExitCode)
+	if reason := e.Container.Reason(); reason != "" {
+		text += " (" + reason + ")"
+	}
+
+	return text, true
+}
+
+// outputLines returns the lines of the last n bytes of the output
+func outputLines(output []byte, n int) []string {
+	text := strings.TrimRight(core.TailOutput(output, n), "\n")
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(text, "\n")
+}
@@ -27,6 +27,132 @@ func (s *SuiteCommon) TestIsEmpty(c *C) {
 	c.Assert(IsEmpty(config), Equals, false)
 }
 
+func (s *SuiteCommon) TestValidateNotifyOn(c *C) {
+	c.Assert(ValidateNotifyOn(&SlackConfig{SlackNotifyOn: NotifyStateChange}), IsNil)
+	c.Assert(ValidateNotifyOn(&SlackConfig{}), IsNil)
+
+	err := ValidateNotifyOn(&SlackConfig{SlackNotifyOn: "errors"})
+	c.Assert(err, ErrorMatches, `invalid slack-notify-on "errors": expected always, error or state-change`)
+
+	err = ValidateNotifyOn(struct{ MailConfig }{MailConfig{MailNotifyOn: "never"}})
+	c.Assert(err, ErrorMatches, `invalid mail-notify-on "never": .*`)
+}
+
+func (s *SuiteCommon) TestValidate(c *C) {
+	type config struct {
+		SlackConfig
+		SaveConfig
+	}
+
+	c.Assert(Validate(&config{SaveConfig: SaveConfig{SavePath: "{{.Job}}.log"}}), IsNil)
+
+	err := Validate(&config{SaveConfig: SaveConfig{SavePath: "{{.Job"}})
+	c.Assert(err, ErrorMatches, `invalid save-path "\{\{.Job": .*`)
+
+	err = Validate(&config{SlackConfig: SlackConfig{SlackNotifyOn: "errors"}})
+	c.Assert(err, ErrorMatches, `invalid slack-notify-on "errors": .*`)
+}
+
+func (s *SuiteCommon) TestShouldNotify(c *C) {
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	c.Assert(shouldNotify(s.ctx, "", false), Equals, true)
+	c.Assert(shouldNotify(s.ctx, "", true), Equals, false)
+	c.Assert(shouldNotify(s.ctx, NotifyAlways, true), Equals, true)
+	c.Assert(shouldNotify(s.ctx, NotifyError, false), Equals, false)
+	c.Assert(shouldNotify(s.ctx, NotifyStateChange, false), Equals, false)
+
+	s.ctx.Execution.Failed = true
+	c.Assert(shouldNotify(s.ctx, NotifyError, false), Equals, true)
+	c.Assert(shouldNotify(s.ctx, NotifyStateChange, false), Equals, true)
+}
+
+func (s *SuiteCommon) TestShouldNotifySlow(c *C) {
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+	s.ctx.Execution.Slow = true
+
+	c.Assert(shouldNotify(s.ctx, "", true), Equals, true)
+	c.Assert(shouldNotify(s.ctx, NotifyStateChange, false), Equals, false)
+	c.Assert(statusLabel(s.ctx), Equals, "slow")
+
+	s.job.AlertAfterFailures = 2
+	c.Assert(shouldAlert(s.ctx, NotifyError, false), Equals, true)
+	c.Assert(shouldAlert(s.ctx, NotifyStateChange, false), Equals, false)
+}
+
+func (s *SuiteCommon) TestShouldNotifyStateChange(c *C) {
+	run := func(failed, skipped bool) *core.Context {
+		ctx := core.NewContext(s.ctx.Scheduler, s.job, core.NewExecution())
+		ctx.Start()
+		ctx.Stop(nil)
+		ctx.Execution.Failed = failed
+		ctx.Execution.Skipped = skipped
+		return ctx
+	}
+
+	c.Assert(shouldNotify(run(false, false), NotifyStateChange, false), Equals, false)
+	c.Assert(shouldNotify(run(true, false), NotifyStateChange, false), Equals, true)
+	c.Assert(shouldNotify(run(true, false), NotifyStateChange, false), Equals, false)
+	c.Assert(shouldNotify(run(false, true), NotifyStateChange, false), Equals, false)
+	c.Assert(shouldNotify(run(false, false), NotifyStateChange, false), Equals, true)
+}
+
+func (s *SuiteCommon) TestShouldNotifyAlertAfterFailures(c *C) {
+	s.job.AlertAfterFailures = 2
+	run := func(failed, skipped bool) *core.Context {
+		ctx := core.NewContext(s.ctx.Scheduler, s.job, core.NewExecution())
+		ctx.Start()
+		ctx.Stop(nil)
+		ctx.Execution.Failed = failed
+		ctx.Execution.Skipped = skipped
+		return ctx
+	}
+
+	c.Assert(shouldAlert(run(false, false), NotifyError, false), Equals, false)
+	c.Assert(shouldAlert(run(true, false), NotifyError, false), Equals, false)
+	c.Assert(shouldAlert(run(false, true), NotifyError, false), Equals, false)
+	c.Assert(shouldAlert(run(true, false), NotifyError, false), Equals, true)
+	c.Assert(shouldAlert(run(true, false), NotifyError, false), Equals, false)
+
+	ctx := run(false, false)
+	c.Assert(shouldAlert(ctx, NotifyError, false), Equals, true)
+	c.Assert(statusLabel(ctx), Equals, "recovered")
+
+	ctx = run(false, false)
+	c.Assert(shouldAlert(ctx, NotifyStateChange, false), Equals, false)
+	c.Assert(shouldAlert(ctx, NotifyAlways, false), Equals, true)
+	c.Assert(statusLabel(ctx), Equals, "successful")
+
+	c.Assert(shouldAlert(run(true, false), NotifyAlways, false), Equals, false)
+	c.Assert(shouldAlert(run(false, false), NotifyAlways, false), Equals, true)
+
+	// the middlewares not alerting report every failure
+	c.Assert(shouldNotify(run(true, false), NotifyError, false), Equals, true)
+}
+
+func (s *SuiteCommon) TestExitCodeText(c *C) {
+	e := core.NewExecution()
+	_, ok := exitCodeText(e)
+	c.Assert(ok, Equals, false)
+
+	e.Error = &core.ExitCodeError{ExitCode: 2}
+	text, ok := exitCodeText(e)
+	c.Assert(ok, Equals, true)
+	c.Assert(text, Equals, "2")
+
+	e.Error = &core.ExitCodeError{ExitCode: 137}
+	e.Container = &core.ContainerState{ExitCode: 137, OOMKilled: true}
+	text, _ = exitCodeText(e)
+	c.Assert(text, Equals, "137 (killed by OOM)")
+
+	e.Error = &core.ExitCodeError{ExitCode: 127}
+	e.Container = &core.ContainerState{ExitCode: 127, Error: "exec: \"foo\": executable file not found"}
+	text, _ = exitCodeText(e)
+	c.Assert(text, Equals, `127 (exec: "foo": executable file not found)`)
+}
+
 type BaseSuite struct {
 	ctx *core.Context
 	job *TestJob
@@ -0,0 +1,137 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+var (
+	discordOutputSize = 1000
+	discordTimeout    = time.Second * 10
+)
+
+// DiscordConfig configuration for the Discord middleware
+type DiscordConfig struct {
+	DiscordWebhook     string `mapstructure:"discord-webhook"`
+	DiscordOnlyOnError bool   `mapstructure:"discord-only-on-error"`
+	DiscordNotifyOn    string `mapstructure:"discord-notify-on"`
+}
+
+// NewDiscord returns a Discord middleware if the given configuration is not
+// empty
+func NewDiscord(c *DiscordConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Discord{*c}
+	}
+
+	return m
+}
+
+// Discord middleware posts a message to a Discord webhook after every
+// execution of a job
+type Discord struct {
+	DiscordConfig
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *Discord) ContinueOnStop() bool {
+	return true
+}
+
+// Run sends a message to the Discord channel
+func (m *Discord) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if shouldAlert(ctx, m.DiscordNotifyOn, m.DiscordOnlyOnError) {
+		if err := m.pushMessage(ctx); err != nil {
+			ctx.Logger.Errorf("Discord error calling %q: %q", m.DiscordWebhook, err)
+		}
+	}
+
+	return err
+}
+
+func (m *Discord) pushMessage(ctx *core.Context) error {
+	content, err := json.Marshal(m.buildMessage(ctx))
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: discordTimeout}
+	r, err := client.Post(m.DiscordWebhook, "application/json", bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return fmt.Errorf("non-2xx status code %d", r.StatusCode)
+	}
+
+	return nil
+}
+
+func (m *Discord) buildMessage(ctx *core.Context) *discordMessage {
+	e := ctx.Execution
+	embed := discordEmbed{
+		Title:       fmt.Sprintf("Execution %s", statusLabel(ctx)),
+		Description: fmt.Sprintf("Command `%s`", ctx.Job.GetCommand()),
+		Color:       0x7CD197,
+		Fields: []discordField{
+			{Name: "Job", Value: ctx.Job.GetName(), Inline: true},
+			{Name: "Duration", Value: e.Duration.String(), Inline: true},
+			{Name: "Execution", Value: e.ID, Inline: true},
+		},
+	}
+
+	switch {
+	case e.Failed:
+		embed.Color = 0xF35A00
+		if code, ok := exitCodeText(e); ok {
+			embed.Fields = append(embed.Fields, discordField{
+				Name: "Exit code", Value: code, Inline: true,
+			})
+		}
+
+		embed.Fields = append(embed.Fields, discordField{Name: "Error", Value: e.Error.Error()})
+		if output := failureOutput(e); len(output) > 0 {
+			embed.Fields = append(embed.Fields, discordField{
+				Name: "Output", Value: fmt.Sprintf("```%s```", core.TailOutput(output, discordOutputSize)),
+			})
+		}
+	case e.Skipped, e.Slow:
+		embed.Color = 0xFFA500
+	}
+
+	return &discordMessage{
+		Username:  slackUsername,
+		AvatarURL: slackAvatarURL,
+		Embeds:    []discordEmbed{embed},
+	}
+}
+
+type discordMessage struct {
+	Username  string         `json:"username"`
+	AvatarURL string         `json:"avatar_url"`
+	Embeds    []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
@@ -0,0 +1,74 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/mcuadros/ofelia/core"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteDiscord struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteDiscord{})
+
+func (s *SuiteDiscord) TestNewDiscordEmpty(c *C) {
+	c.Assert(NewDiscord(&DiscordConfig{}), IsNil)
+}
+
+func (s *SuiteDiscord) TestRunSuccess(c *C) {
+	var m discordMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&m)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	c.Assert(NewDiscord(&DiscordConfig{DiscordWebhook: ts.URL}).Run(s.ctx), IsNil)
+	c.Assert(m.Embeds, HasLen, 1)
+	c.Assert(m.Embeds[0].Title, Equals, "Execution successful")
+	c.Assert(m.Embeds[0].Color, Equals, 0x7CD197)
+	c.Assert(m.Embeds[0].Fields[0], DeepEquals, discordField{Name: "Job", Value: "foo", Inline: true})
+}
+
+func (s *SuiteDiscord) TestRunFailed(c *C) {
+	var m discordMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&m)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte("bar"))
+	s.ctx.Stop(&core.ExitCodeError{ExitCode: 2})
+
+	c.Assert(NewDiscord(&DiscordConfig{DiscordWebhook: ts.URL}).Run(s.ctx), IsNil)
+	c.Assert(m.Embeds[0].Color, Equals, 0xF35A00)
+	c.Assert(m.Embeds[0].Fields[2], DeepEquals, discordField{Name: "Execution", Value: s.ctx.Execution.ID, Inline: true})
+	c.Assert(m.Embeds[0].Fields[3], DeepEquals, discordField{Name: "Exit code", Value: "2", Inline: true})
+	c.Assert(m.Embeds[0].Fields[5], DeepEquals, discordField{Name: "Output", Value: "```bar```"})
+}
+
+func (s *SuiteDiscord) TestRunSuccessOnError(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(true, Equals, false)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewDiscord(&DiscordConfig{DiscordWebhook: ts.URL, DiscordOnlyOnError: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
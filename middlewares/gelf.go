@@ -0,0 +1,196 @@
+package middlewares
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+var (
+	gelfOutputSize = 32000
+	gelfTimeout    = time.Second * 10
+	// gelfChunkSize is the size of the UDP chunks of the messages, with the
+	// header of 12 bytes, small enough for the usual MTUs
+	gelfChunkSize = 1420
+	// gelfMaxChunks is the maximum number of chunks of a message
+	gelfMaxChunks = 128
+)
+
+// GELFConfig configuration for the GELF middleware
+type GELFConfig struct {
+	// GELFAddress is the GELF input of Graylog, as `udp://host:port` or
+	// `tcp://host:port`
+	GELFAddress     string `mapstructure:"gelf-address"`
+	GELFOnlyOnError bool   `mapstructure:"gelf-only-on-error"`
+	GELFNotifyOn    string `mapstructure:"gelf-notify-on"`
+}
+
+// NewGELF returns a GELF middleware if the given configuration is not empty
+func NewGELF(c *GELFConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &GELF{*c}
+	}
+
+	return m
+}
+
+// GELF middleware sends a GELF message, with the output and the metadata of
+// the execution, to Graylog, or any other GELF input, after every execution
+// of a job
+type GELF struct {
+	GELFConfig
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *GELF) ContinueOnStop() bool {
+	return true
+}
+
+// Run sends the message to the GELF input
+func (m *GELF) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if shouldNotify(ctx, m.GELFNotifyOn, m.GELFOnlyOnError) {
+		if err := m.send(ctx); err != nil {
+			ctx.Logger.Errorf("GELF error sending to %q: %q", m.GELFAddress, err)
+		}
+	}
+
+	return err
+}
+
+func (m *GELF) send(ctx *core.Context) error {
+	u, err := url.Parse(m.GELFAddress)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "udp" && u.Scheme != "tcp" {
+		return fmt.Errorf("invalid gelf-address %q", m.GELFAddress)
+	}
+
+	msg, err := json.Marshal(m.buildMessage(ctx))
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout(u.Scheme, u.Host, gelfTimeout)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(gelfTimeout))
+
+	// the TCP messages are delimited by a null byte, the UDP ones are
+	// compressed and chunked if needed
+	if u.Scheme == "tcp" {
+		_, err = conn.Write(append(msg, 0))
+		return err
+	}
+
+	chunks, err := gelfChunks(msg)
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		if _, err := conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *GELF) buildMessage(ctx *core.Context) map[string]interface{} {
+	e := ctx.Execution
+	hostname, _ := os.Hostname()
+	msg := map[string]interface{}{
+		"version": "1.1",
+		"host":    hostname,
+		"short_message": fmt.Sprintf(
+			"Job %q execution %s %s in %s", ctx.Job.GetName(), e.ID, statusLabel(ctx), e.Duration,
+		),
+		"timestamp":     float64(e.Date.UnixNano()) / float64(time.Second),
+		"level":         int(syslog.LOG_INFO),
+		"_job":          ctx.Job.GetName(),
+		"_execution_id": e.ID,
+		"_status":       statusLabel(ctx),
+		"_duration":     e.Duration.Seconds(),
+		"_command":      ctx.Job.GetCommand(),
+	}
+
+	if output := e.Output(); len(output) != 0 {
+		msg["full_message"] = core.TailOutput(output, gelfOutputSize)
+	}
+
+	if output := e.ErrorOutput(); len(output) != 0 {
+		msg["_error_output"] = core.TailOutput(output, gelfOutputSize)
+	}
+
+	switch {
+	case e.Failed:
+		msg["level"] = int(syslog.LOG_ERR)
+		msg["_error"] = e.Error.Error()
+		if code, ok := exitCodeText(e); ok {
+			msg["_exit_code"] = code
+		}
+	case e.Skipped, e.Warning, e.Slow:
+		msg["level"] = int(syslog.LOG_WARNING)
+	}
+
+	return msg
+}
+
+// gelfChunks returns the UDP datagrams of the message, compressed with gzip
+// and split in chunks if it doesn't fit in a single one
+func gelfChunks(msg []byte) ([][]byte, error) {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	gz.Write(msg)
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	data := b.Bytes()
+	if len(data) <= gelfChunkSize {
+		return [][]byte{data}, nil
+	}
+
+	size := gelfChunkSize - 12
+	count := (len(data) + size - 1) / size
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("message too big, %d bytes compressed", len(data))
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, count)
+	for i := range chunks {
+		end := (i + 1) * size
+		if end > len(data) {
+			end = len(data)
+		}
+
+		chunk := append([]byte{0x1e, 0x0f}, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunks[i] = append(chunk, data[i*size:end]...)
+	}
+
+	return chunks, nil
+}
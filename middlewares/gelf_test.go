@@ -0,0 +1,140 @@
+package middlewares
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteGELF struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteGELF{})
+
+func (s *SuiteGELF) TestNewGELFEmpty(c *C) {
+	c.Assert(NewGELF(&GELFConfig{}), IsNil)
+}
+
+func (s *SuiteGELF) TestRunUDP(c *C) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte("bar"))
+	s.ctx.Execution.ErrorStream.Write([]byte("baz"))
+	s.ctx.Stop(&core.ExitCodeError{ExitCode: 2})
+
+	m := NewGELF(&GELFConfig{GELFAddress: fmt.Sprintf("udp://%s", conn.LocalAddr())})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	conn.SetDeadline(time.Now().Add(time.Second * 5))
+	buf := make([]byte, 65536)
+	size, _, err := conn.ReadFrom(buf)
+	c.Assert(err, IsNil)
+
+	gz, err := gzip.NewReader(bytes.NewReader(buf[:size]))
+	c.Assert(err, IsNil)
+
+	var msg map[string]interface{}
+	c.Assert(json.NewDecoder(gz).Decode(&msg), IsNil)
+	c.Assert(msg["version"], Equals, "1.1")
+	c.Assert(msg["short_message"], Matches, `Job "foo" execution \S+ failed in .*`)
+	c.Assert(msg["full_message"], Equals, "bar")
+	c.Assert(msg["level"], Equals, float64(3))
+	c.Assert(msg["_job"], Equals, "foo")
+	c.Assert(msg["_execution_id"], Equals, s.ctx.Execution.ID)
+	c.Assert(msg["_status"], Equals, "failed")
+	c.Assert(msg["_exit_code"], Equals, "2")
+	c.Assert(msg["_error_output"], Equals, "baz")
+}
+
+func (s *SuiteGELF) TestRunTCP(c *C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer l.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+		content, _ := ioutil.ReadAll(conn)
+		received <- content
+	}()
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewGELF(&GELFConfig{GELFAddress: fmt.Sprintf("tcp://%s", l.Addr())})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	content := <-received
+	c.Assert(content[len(content)-1], Equals, byte(0))
+
+	var msg map[string]interface{}
+	c.Assert(json.Unmarshal(content[:len(content)-1], &msg), IsNil)
+	c.Assert(msg["_status"], Equals, "successful")
+	c.Assert(msg["level"], Equals, float64(6))
+	c.Assert(msg["full_message"], IsNil)
+}
+
+func (s *SuiteGELF) TestBuildMessageSlow(c *C) {
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+	s.ctx.Execution.Slow = true
+
+	msg := (&GELF{}).buildMessage(s.ctx)
+	c.Assert(msg["level"], Equals, 4)
+}
+
+func (s *SuiteGELF) TestChunks(c *C) {
+	// random enough to not be compressed below a chunk
+	var b strings.Builder
+	for i := 0; b.Len() < 10000; i++ {
+		fmt.Fprintf(&b, "%x", i*7919)
+	}
+
+	chunks, err := gelfChunks([]byte(b.String()))
+	c.Assert(err, IsNil)
+	c.Assert(len(chunks) > 1, Equals, true)
+
+	var data []byte
+	for i, chunk := range chunks {
+		c.Assert(len(chunk) <= gelfChunkSize, Equals, true)
+		c.Assert(chunk[:2], DeepEquals, []byte{0x1e, 0x0f})
+		c.Assert(chunk[2:10], DeepEquals, chunks[0][2:10])
+		c.Assert(int(chunk[10]), Equals, i)
+		c.Assert(int(chunk[11]), Equals, len(chunks))
+		data = append(data, chunk[12:]...)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+
+	msg, err := ioutil.ReadAll(gz)
+	c.Assert(err, IsNil)
+	c.Assert(string(msg), Equals, b.String())
+}
+
+func (s *SuiteGELF) TestRunInvalidAddress(c *C) {
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := &GELF{GELFConfig{GELFAddress: "http://graylog"}}
+	c.Assert(m.send(s.ctx), ErrorMatches, `invalid gelf-address "http://graylog"`)
+}
@@ -0,0 +1,137 @@
+package middlewares
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+var (
+	lockDefaultTTL    = time.Second * 30
+	lockDefaultPrefix = "ofelia:lock:"
+)
+
+// lockRenewScript extends the expiration of the lock if it's still owned by
+// the execution
+const lockRenewScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+
+// LockConfig configuration for the Lock middleware
+type LockConfig struct {
+	// LockRedisURL is the Redis server holding the locks, with the syntax
+	// `redis[s]://[:password@]host[:port][/db]`
+	LockRedisURL string `mapstructure:"lock-redis-url"`
+	// LockTTL is the time the lock is kept after the execution finishes, it
+	// must be longer than the clock skew between the instances and shorter
+	// than the interval between executions. 30s by default.
+	LockTTL    time.Duration `mapstructure:"lock-ttl"`
+	LockPrefix string        `mapstructure:"lock-prefix"`
+}
+
+// NewLock returns a Lock middleware if the given configuration is not empty
+func NewLock(c *LockConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Lock{*c}
+	}
+
+	return m
+}
+
+// Lock middleware acquires a lock in Redis before every execution, so only one
+// of the ofelia instances sharing the same jobs runs each execution. The
+// executions that can't acquire the lock are skipped.
+type Lock struct {
+	LockConfig
+}
+
+// ContinueOnStop Lock is only called if the process is still running
+func (m *Lock) ContinueOnStop() bool {
+	return false
+}
+
+// Run acquires the lock of the job and keeps it while the execution runs, the
+// lock expires after the TTL once the execution finishes.
+func (m *Lock) Run(ctx *core.Context) error {
+	c, err := newRedisClient(m.LockRedisURL)
+	if err != nil {
+		ctx.Stop(err)
+		return ctx.Next()
+	}
+
+	key := m.prefix() + ctx.Job.GetName()
+	token := ctx.Execution.ID
+	ok, err := m.acquire(c, key, token)
+	switch {
+	case err != nil:
+		ctx.Stop(fmt.Errorf("error acquiring lock %q: %s", key, err))
+		return ctx.Next()
+	case !ok:
+		ctx.Stop(core.ErrSkippedExecution)
+		ctx.Log("Skipped, the execution is locked by another instance")
+		return ctx.Next()
+	}
+
+	done := make(chan struct{})
+	go m.keepAlive(ctx, c, key, token, done)
+	defer func() {
+		close(done)
+		if err := m.renew(c, key, token); err != nil {
+			ctx.Logger.Errorf("Lock error renewing %q: %q", key, err)
+		}
+	}()
+
+	return ctx.Next()
+}
+
+func (m *Lock) acquire(c *redisClient, key, token string) (bool, error) {
+	r, err := c.do("SET", key, token, "NX", "PX", m.ttlMillis())
+	if err != nil {
+		return false, err
+	}
+
+	return r == "OK", nil
+}
+
+// keepAlive renews the lock until done is closed
+func (m *Lock) keepAlive(ctx *core.Context, c *redisClient, key, token string, done chan struct{}) {
+	ticker := time.NewTicker(m.ttl() / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := m.renew(c, key, token); err != nil {
+				ctx.Logger.Errorf("Lock error renewing %q: %q", key, err)
+			}
+		}
+	}
+}
+
+func (m *Lock) renew(c *redisClient, key, token string) error {
+	_, err := c.do("EVAL", lockRenewScript, "1", key, token, m.ttlMillis())
+	return err
+}
+
+func (m *Lock) ttl() time.Duration {
+	if m.LockTTL == 0 {
+		return lockDefaultTTL
+	}
+
+	return m.LockTTL
+}
+
+func (m *Lock) ttlMillis() string {
+	return strconv.FormatInt(int64(m.ttl()/time.Millisecond), 10)
+}
+
+func (m *Lock) prefix() string {
+	if m.LockPrefix == "" {
+		return lockDefaultPrefix
+	}
+
+	return m.LockPrefix
+}
@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteLock struct {
+	BaseSuite
+	server *testRedisServer
+}
+
+var _ = Suite(&SuiteLock{})
+
+func (s *SuiteLock) SetUpTest(c *C) {
+	s.BaseSuite.SetUpTest(c)
+	s.server = newTestRedisServer(c, "")
+}
+
+func (s *SuiteLock) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *SuiteLock) TestNewLockEmpty(c *C) {
+	c.Assert(NewLock(&LockConfig{}), IsNil)
+}
+
+func (s *SuiteLock) TestRun(c *C) {
+	s.job.Name = "foo"
+	s.ctx.Start()
+
+	m := NewLock(&LockConfig{LockRedisURL: "redis://" + s.server.Addr().String(), LockTTL: time.Minute})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(s.ctx.Execution.Skipped, Equals, false)
+
+	ttl := s.server.ttl("ofelia:lock:foo")
+	c.Assert(ttl > 50*time.Second && ttl <= time.Minute, Equals, true)
+
+	// another instance
+	s.BaseSuite.SetUpTest(c)
+	s.job.Name = "foo"
+	s.ctx.Start()
+
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(s.ctx.Execution.Skipped, Equals, true)
+}
+
+func (s *SuiteLock) TestKeepAlive(c *C) {
+	m := &Lock{LockConfig{LockTTL: time.Millisecond * 300}}
+	r, err := newRedisClient("redis://" + s.server.Addr().String())
+	c.Assert(err, IsNil)
+
+	ok, err := m.acquire(r, "foo", "bar")
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+
+	done := make(chan struct{})
+	go m.keepAlive(s.ctx, r, "foo", "bar", done)
+	time.Sleep(time.Millisecond * 500)
+	close(done)
+
+	ok, err = m.acquire(r, "foo", "qux")
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+func (s *SuiteLock) TestRunError(c *C) {
+	s.ctx.Start()
+
+	m := NewLock(&LockConfig{LockRedisURL: "redis://127.0.0.1:1"})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(s.ctx.Execution.Failed, Equals, true)
+	c.Assert(s.ctx.Execution.Error, ErrorMatches, `error acquiring lock "ofelia:lock:": .*`)
+	c.Assert(s.ctx.Execution.Error, Not(Equals), core.ErrSkippedExecution)
+}
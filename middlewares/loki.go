@@ -0,0 +1,185 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+var (
+	lokiOutputSize = 32000
+	lokiTimeout    = time.Second * 10
+)
+
+// LokiConfig configuration for the Loki middleware
+type LokiConfig struct {
+	// LokiURL is the URL of the push API, e.g.
+	// `http://loki:3100/loki/api/v1/push`
+	LokiURL string `mapstructure:"loki-url"`
+	// LokiLabels are the labels added to the ones of the streams, as
+	// `name=value`
+	LokiLabels []string `mapstructure:"loki-labels"`
+	// LokiTenantID is sent as X-Scope-OrgID to a multi-tenant Loki
+	LokiTenantID    string `mapstructure:"loki-tenant-id"`
+	LokiUsername    string `mapstructure:"loki-username"`
+	LokiPassword    string `mapstructure:"loki-password"`
+	LokiOnlyOnError bool   `mapstructure:"loki-only-on-error"`
+	LokiNotifyOn    string `mapstructure:"loki-notify-on"`
+}
+
+// NewLoki returns a Loki middleware if the given configuration is not empty
+func NewLoki(c *LokiConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Loki{*c}
+	}
+
+	return m
+}
+
+// Loki middleware pushes a summary of every execution of a job, followed by
+// the lines of its output, to Loki, in a stream labeled with the job, the
+// status of the execution and the host
+type Loki struct {
+	LokiConfig
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *Loki) ContinueOnStop() bool {
+	return true
+}
+
+// Run pushes the execution to Loki
+func (m *Loki) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if shouldNotify(ctx, m.LokiNotifyOn, m.LokiOnlyOnError) {
+		if err := m.push(ctx); err != nil {
+			ctx.Logger.Errorf("Loki error calling %q: %q", m.LokiURL, err)
+		}
+	}
+
+	return err
+}
+
+func (m *Loki) push(ctx *core.Context) error {
+	p, err := m.buildPush(ctx)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", m.LokiURL, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if m.LokiTenantID != "" {
+		req.Header.Set("X-Scope-OrgID", m.LokiTenantID)
+	}
+
+	if m.LokiUsername != "" || m.LokiPassword != "" {
+		req.SetBasicAuth(m.LokiUsername, m.LokiPassword)
+	}
+
+	client := &http.Client{Timeout: lokiTimeout}
+	r, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return fmt.Errorf("non-2xx status code %d", r.StatusCode)
+	}
+
+	return nil
+}
+
+// buildPush returns the streams of the execution: the summary, as logfmt, and
+// the lines of the output, the last lokiOutputSize bytes of it, in a stream
+// per output. The lines get the date of the execution, one nanosecond apart
+// to keep their order.
+func (m *Loki) buildPush(ctx *core.Context) (*lokiPush, error) {
+	e := ctx.Execution
+	hostname, _ := os.Hostname()
+	labels := map[string]string{
+		"job":    ctx.Job.GetName(),
+		"status": statusLabel(ctx),
+		"host":   hostname,
+	}
+
+	for _, label := range m.LokiLabels {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid loki-labels %q, expected name=value", label)
+		}
+
+		labels[parts[0]] = parts[1]
+	}
+
+	summary := fmt.Sprintf("execution_id=%s status=%s duration=%s command=%s",
+		e.ID, statusLabel(ctx), e.Duration, strconv.Quote(ctx.Job.GetCommand()),
+	)
+
+	if e.Failed {
+		if code, ok := exitCodeText(e); ok {
+			summary += " exit_code=" + strconv.Quote(code)
+		}
+
+		summary += " error=" + strconv.Quote(e.Error.Error())
+	}
+
+	date := e.Date.UnixNano()
+	p := &lokiPush{}
+	for _, output := range []struct {
+		stream string
+		lines  []string
+	}{
+		{"summary", []string{summary}},
+		{"stdout", outputLines(e.Output(), lokiOutputSize)},
+		{"stderr", outputLines(e.ErrorOutput(), lokiOutputSize)},
+	} {
+		if len(output.lines) == 0 {
+			continue
+		}
+
+		s := lokiStream{Stream: map[string]string{}}
+		for k, v := range labels {
+			s.Stream[k] = v
+		}
+
+		s.Stream["stream"] = output.stream
+		for _, line := range output.lines {
+			s.Values = append(s.Values, [2]string{strconv.FormatInt(date, 10), line})
+			date++
+		}
+
+		p.Streams = append(p.Streams, s)
+	}
+
+	return p, nil
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	// Values are the timestamps, in nanoseconds, and the lines
+	Values [][2]string `json:"values"`
+}
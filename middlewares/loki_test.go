@@ -0,0 +1,92 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/mcuadros/ofelia/core"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteLoki struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteLoki{})
+
+func (s *SuiteLoki) TestNewLokiEmpty(c *C) {
+	c.Assert(NewLoki(&LokiConfig{}), IsNil)
+}
+
+func (s *SuiteLoki) TestRun(c *C) {
+	var p lokiPush
+	var r *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r = req
+		json.NewDecoder(req.Body).Decode(&p)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.job.Command = "echo foo"
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte("bar\nbaz\n"))
+	s.ctx.Stop(&core.ExitCodeError{ExitCode: 2})
+
+	m := NewLoki(&LokiConfig{
+		LokiURL:      ts.URL,
+		LokiLabels:   []string{"env=prod"},
+		LokiTenantID: "ops",
+		LokiUsername: "user",
+		LokiPassword: "pass",
+	})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	c.Assert(r.Header.Get("X-Scope-OrgID"), Equals, "ops")
+	user, pass, _ := r.BasicAuth()
+	c.Assert(user+":"+pass, Equals, "user:pass")
+
+	c.Assert(p.Streams, HasLen, 2)
+	summary, stdout := p.Streams[0], p.Streams[1]
+	c.Assert(summary.Stream["job"], Equals, "foo")
+	c.Assert(summary.Stream["status"], Equals, "failed")
+	c.Assert(summary.Stream["env"], Equals, "prod")
+	c.Assert(summary.Stream["stream"], Equals, "summary")
+	c.Assert(summary.Values, HasLen, 1)
+	c.Assert(summary.Values[0][1], Matches, `execution_id=\S+ status=failed duration=\S+ command="echo foo" exit_code="2" error=".*"`)
+
+	c.Assert(stdout.Stream["stream"], Equals, "stdout")
+	c.Assert(stdout.Values, HasLen, 2)
+	c.Assert(stdout.Values[0][1], Equals, "bar")
+	c.Assert(stdout.Values[1][1], Equals, "baz")
+
+	date := s.ctx.Execution.Date.UnixNano()
+	c.Assert(summary.Values[0][0], Equals, strconv.FormatInt(date, 10))
+	c.Assert(stdout.Values[1][0], Equals, strconv.FormatInt(date+2, 10))
+}
+
+func (s *SuiteLoki) TestRunInvalidLabels(c *C) {
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := &Loki{LokiConfig{LokiURL: "http://loki", LokiLabels: []string{"env"}}}
+	c.Assert(m.push(s.ctx), ErrorMatches, `invalid loki-labels "env", expected name=value`)
+}
+
+func (s *SuiteLoki) TestRunError(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := &Loki{LokiConfig{LokiURL: ts.URL}}
+	c.Assert(m.push(s.ctx), ErrorMatches, "non-2xx status code 400")
+}
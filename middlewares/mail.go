@@ -2,10 +2,13 @@ package middlewares
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"net/smtp"
 	"os"
 	"strings"
 
@@ -16,13 +19,23 @@ import (
 
 // MailConfig configuration for the Mail middleware
 type MailConfig struct {
-	SMTPHost        string `gcfg:"smtp-host" mapstructure:"smtp-host"`
-	SMTPPort        int    `gcfg:"smtp-port" mapstructure:"smtp-port"`
-	SMTPUser        string `gcfg:"smtp-user" mapstructure:"smtp-user"`
-	SMTPPassword    string `gcfg:"smtp-password" mapstructure:"smtp-password"`
-	EmailTo         string `gcfg:"email-to" mapstructure:"email-to"`
-	EmailFrom       string `gcfg:"email-from" mapstructure:"email-from"`
-	MailOnlyOnError bool   `gcfg:"mail-only-on-error" mapstructure:"mail-only-on-error"`
+	SMTPHost     string `mapstructure:"smtp-host"`
+	SMTPPort     int    `mapstructure:"smtp-port"`
+	SMTPUser     string `mapstructure:"smtp-user"`
+	SMTPPassword string `mapstructure:"smtp-password"`
+	// SMTPAuth is the authentication mechanism: plain, login or cram-md5, by
+	// default the best one offered by the server is used.
+	SMTPAuth string `mapstructure:"smtp-auth"`
+	// SMTPTLS is tls for implicit TLS or starttls to upgrade the connection
+	// when the server offers it, by default implicit TLS is used on port 465.
+	SMTPTLS             string `mapstructure:"smtp-tls"`
+	SMTPTLSSkipVerify   bool   `mapstructure:"smtp-tls-skip-verify"`
+	EmailTo             string `mapstructure:"email-to"`
+	EmailFrom           string `mapstructure:"email-from"`
+	MailOnlyOnError     bool   `mapstructure:"mail-only-on-error"`
+	MailNotifyOn        string `mapstructure:"mail-notify-on"`
+	MailSubjectTemplate string `mapstructure:"mail-subject-template"`
+	MailBodyTemplate    string `mapstructure:"mail-body-template"`
 }
 
 // NewMail returns a Mail middleware if the given configuration is not empty
@@ -51,7 +64,7 @@ func (m *Mail) Run(ctx *core.Context) error {
 	err := ctx.Next()
 	ctx.Stop(err)
 
-	if ctx.Execution.Failed || !m.MailOnlyOnError {
+	if shouldAlert(ctx, m.MailNotifyOn, m.MailOnlyOnError) {
 		err := m.sendMail(ctx)
 		if err != nil {
 			ctx.Logger.Errorf("Mail error: %q", err)
@@ -62,20 +75,35 @@ func (m *Mail) Run(ctx *core.Context) error {
 }
 
 func (m *Mail) sendMail(ctx *core.Context) error {
+	d, err := m.dialer()
+	if err != nil {
+		return err
+	}
+
+	subject, err := m.subject(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := m.body(ctx)
+	if err != nil {
+		return err
+	}
+
 	msg := gomail.NewMessage()
 	msg.SetHeader("From", m.from())
-	msg.SetHeader("To", strings.Split(m.EmailTo, ",")...)
-	msg.SetHeader("Subject", m.subject(ctx))
-	msg.SetBody("text/html", m.body(ctx))
+	msg.SetHeader("To", m.to()...)
+	msg.SetHeader("Subject", subject)
+	msg.SetBody("text/html", body)
 
 	base := fmt.Sprintf("%s_%s", ctx.Job.GetName(), ctx.Execution.ID)
 	msg.Attach(base+".stdout.log", gomail.SetCopyFunc(func(w io.Writer) error {
-		_, err := io.Copy(w, ctx.Execution.OutputStream)
+		_, err := w.Write(ctx.Execution.Output())
 		return err
 	}))
 
 	msg.Attach(base+".stderr.log", gomail.SetCopyFunc(func(w io.Writer) error {
-		_, err := io.Copy(w, ctx.Execution.ErrorStream)
+		_, err := w.Write(ctx.Execution.ErrorOutput())
 		return err
 	}))
 
@@ -89,7 +117,6 @@ func (m *Mail) sendMail(ctx *core.Context) error {
 		return err
 	}))
 
-	d := gomail.NewPlainDialer(m.SMTPHost, m.SMTPPort, m.SMTPUser, m.SMTPPassword)
 	if err := d.DialAndSend(msg); err != nil {
 		return err
 	}
@@ -97,6 +124,49 @@ func (m *Mail) sendMail(ctx *core.Context) error {
 	return nil
 }
 
+func (m *Mail) dialer() (*gomail.Dialer, error) {
+	d := gomail.NewDialer(m.SMTPHost, m.SMTPPort, m.SMTPUser, m.SMTPPassword)
+	d.TLSConfig = &tls.Config{
+		ServerName:         m.SMTPHost,
+		InsecureSkipVerify: m.SMTPTLSSkipVerify,
+	}
+
+	switch strings.ToLower(m.SMTPTLS) {
+	case "":
+	case "tls":
+		d.SSL = true
+	case "starttls":
+		d.SSL = false
+	default:
+		return nil, fmt.Errorf("invalid smtp-tls %q", m.SMTPTLS)
+	}
+
+	switch strings.ToLower(m.SMTPAuth) {
+	case "":
+	case "plain":
+		d.Auth = smtp.PlainAuth("", m.SMTPUser, m.SMTPPassword, m.SMTPHost)
+	case "login":
+		d.Auth = &loginAuth{username: m.SMTPUser, password: m.SMTPPassword}
+	case "cram-md5":
+		d.Auth = smtp.CRAMMD5Auth(m.SMTPUser, m.SMTPPassword)
+	default:
+		return nil, fmt.Errorf("invalid smtp-auth %q", m.SMTPAuth)
+	}
+
+	return d, nil
+}
+
+func (m *Mail) to() []string {
+	var to []string
+	for _, addr := range strings.Split(m.EmailTo, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+
+	return to
+}
+
 func (m *Mail) from() string {
 	if strings.Index(m.EmailFrom, "%") == -1 {
 		return m.EmailFrom
@@ -106,26 +176,43 @@ func (m *Mail) from() string {
 	return fmt.Sprintf(m.EmailFrom, hostname)
 }
 
-func (m *Mail) subject(ctx *core.Context) string {
-	buf := bytes.NewBuffer(nil)
-	mailSubjectTemplate.Execute(buf, ctx)
+func (m *Mail) subject(ctx *core.Context) (string, error) {
+	return executeTemplate(mailSubjectTemplate, m.MailSubjectTemplate, ctx)
+}
 
-	return buf.String()
+func (m *Mail) body(ctx *core.Context) (string, error) {
+	return executeTemplate(mailBodyTemplate, m.MailBodyTemplate, ctx)
 }
 
-func (m *Mail) body(ctx *core.Context) string {
+// executeTemplate executes the given custom template, if any, otherwise the
+// default one.
+func executeTemplate(def *template.Template, custom string, ctx *core.Context) (string, error) {
+	t := def
+	if custom != "" {
+		var err error
+		t, err = template.New(def.Name()).Funcs(mailTemplateFuncs).Parse(custom)
+		if err != nil {
+			return "", fmt.Errorf("error parsing %s template: %s", def.Name(), err)
+		}
+	}
+
 	buf := bytes.NewBuffer(nil)
-	mailBodyTemplate.Execute(buf, ctx)
+	if err := t.Execute(buf, ctx); err != nil {
+		return "", fmt.Errorf("error executing %s template: %s", def.Name(), err)
+	}
 
-	return buf.String()
+	return buf.String(), nil
 }
 
 var mailBodyTemplate, mailSubjectTemplate *template.Template
 
+var mailTemplateFuncs = map[string]interface{}{
+	"status": executionLabel,
+	"label":  statusLabel,
+}
+
 func init() {
-	f := map[string]interface{}{
-		"status": executionLabel,
-	}
+	f := mailTemplateFuncs
 
 	mailBodyTemplate = template.New("mail-body")
 	mailSubjectTemplate = template.New("mail-subject")
@@ -135,22 +222,54 @@ func init() {
 	template.Must(mailBodyTemplate.Parse(`
 		<p>
 			Job ​<b>{{.Job.GetName}}</b>,
-			Execution <b>{{status .Execution}}</b> in ​<b>{{.Execution.Duration}}</b>​,
+			Execution <b>{{label .}}</b> in ​<b>{{.Execution.Duration}}</b>​,
+			ID ​<code>{{.Execution.ID}}</code>​,
 			command: ​<pre>{{.Job.GetCommand}}</pre>​
 		</p>
   `))
 
 	template.Must(mailSubjectTemplate.Parse(
-		"[Execution {{status .Execution}}] Job {{.Job.GetName}} finished in {{.Execution.Duration}}",
+		"[Execution {{label .}}] Job {{.Job.GetName}} finished in {{.Execution.Duration}}",
 	))
 }
 
+// loginAuth implements the LOGIN authentication mechanism, not provided by
+// net/smtp.
+type loginAuth struct {
+	username, password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("unencrypted connection")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge: %s", fromServer)
+	}
+}
+
 func executionLabel(e *core.Execution) string {
 	status := "successful"
 	if e.Skipped {
 		status = "skipped"
 	} else if e.Failed {
 		status = "failed"
+	} else if e.Slow {
+		status = "slow"
 	}
 
 	return status
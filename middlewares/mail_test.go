@@ -2,6 +2,7 @@ package middlewares
 
 import (
 	"net"
+	"net/smtp"
 	"strconv"
 	"strings"
 	"sync"
@@ -77,3 +78,115 @@ func (s *MailSuite) TestRunSuccess(c *C) {
 
 	wg.Wait()
 }
+
+func (s *MailSuite) TestRunTemplateRecipients(c *C) {
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewMail(&MailConfig{
+		SMTPHost:            s.smtpdHost,
+		SMTPPort:            s.smtpdPort,
+		EmailTo:             "foo@foo.com, bar@bar.com",
+		EmailFrom:           "qux@qux.com",
+		MailSubjectTemplate: "[ACME] {{.Job.GetName}} {{status .Execution}}",
+	})
+
+	var wg sync.WaitGroup
+	e := &testEnvelope{done: wg.Done}
+	s.smtpd.OnNewMail = func(_ smtpd.Connection, from smtpd.MailAddress) (smtpd.Envelope, error) {
+		return e, nil
+	}
+
+	wg.Add(1)
+	go func() {
+		c.Assert(m.Run(s.ctx), IsNil)
+	}()
+
+	wg.Wait()
+	c.Assert(e.rcpts, DeepEquals, []string{"foo@foo.com", "bar@bar.com"})
+	c.Assert(e.data, Matches, "(?s).*Subject: \\[ACME\\] foo successful.*")
+}
+
+func (s *MailSuite) TestTemplateInvalid(c *C) {
+	m := &Mail{MailConfig{MailBodyTemplate: "{{.Foo"}}
+	_, err := m.body(s.ctx)
+	c.Assert(err, ErrorMatches, "error parsing mail-body template: .*")
+
+	m = &Mail{MailConfig{MailBodyTemplate: "{{.Foo}}"}}
+	_, err = m.body(s.ctx)
+	c.Assert(err, ErrorMatches, "error executing mail-body template: .*")
+}
+
+func (s *MailSuite) TestDialer(c *C) {
+	m := &Mail{MailConfig{SMTPHost: "foo", SMTPPort: 465, SMTPUser: "bar", SMTPPassword: "qux"}}
+	d, err := m.dialer()
+	c.Assert(err, IsNil)
+	c.Assert(d.SSL, Equals, true)
+	c.Assert(d.Auth, IsNil)
+
+	m.SMTPTLS = "starttls"
+	m.SMTPTLSSkipVerify = true
+	m.SMTPAuth = "login"
+	d, err = m.dialer()
+	c.Assert(err, IsNil)
+	c.Assert(d.SSL, Equals, false)
+	c.Assert(d.TLSConfig.InsecureSkipVerify, Equals, true)
+	c.Assert(d.Auth, FitsTypeOf, &loginAuth{})
+
+	m.SMTPAuth = "foo"
+	_, err = m.dialer()
+	c.Assert(err, ErrorMatches, `invalid smtp-auth "foo"`)
+
+	m.SMTPAuth = ""
+	m.SMTPTLS = "foo"
+	_, err = m.dialer()
+	c.Assert(err, ErrorMatches, `invalid smtp-tls "foo"`)
+}
+
+func (s *MailSuite) TestLoginAuth(c *C) {
+	a := &loginAuth{username: "foo", password: "bar"}
+
+	_, _, err := a.Start(&smtp.ServerInfo{})
+	c.Assert(err, NotNil)
+
+	proto, _, err := a.Start(&smtp.ServerInfo{TLS: true})
+	c.Assert(err, IsNil)
+	c.Assert(proto, Equals, "LOGIN")
+
+	resp, err := a.Next([]byte("Username:"), true)
+	c.Assert(err, IsNil)
+	c.Assert(string(resp), Equals, "foo")
+
+	resp, err = a.Next([]byte("Password:"), true)
+	c.Assert(err, IsNil)
+	c.Assert(string(resp), Equals, "bar")
+
+	_, err = a.Next([]byte("foo"), true)
+	c.Assert(err, NotNil)
+}
+
+type testEnvelope struct {
+	rcpts []string
+	data  string
+	done  func()
+}
+
+func (e *testEnvelope) AddRecipient(rcpt smtpd.MailAddress) error {
+	e.rcpts = append(e.rcpts, rcpt.Email())
+	return nil
+}
+
+func (e *testEnvelope) BeginData() error {
+	return nil
+}
+
+func (e *testEnvelope) Write(line []byte) error {
+	e.data += string(line)
+	return nil
+}
+
+func (e *testEnvelope) Close() error {
+	e.done()
+	return nil
+}
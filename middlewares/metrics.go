@@ -0,0 +1,257 @@
+package middlewares
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+const defaultStatsdPrefix = "ofelia"
+
+// MetricsConfig configuration for the Metrics middleware
+type MetricsConfig struct {
+	// MetricsTextfile is the file where the metrics of the jobs are written in
+	// the format of the textfile collector of node_exporter, e.g.
+	// `/var/lib/node_exporter/textfile/ofelia.prom`.
+	MetricsTextfile string `mapstructure:"metrics-textfile"`
+	// StatsdAddress is the `host:port` of the StatsD server receiving the
+	// metrics of every execution over UDP, prefixed with StatsdPrefix, `ofelia`
+	// by default. StatsdTags sends the job as a DogStatsD tag instead of as
+	// part of the name of the metrics.
+	StatsdAddress string `mapstructure:"statsd-address"`
+	StatsdPrefix  string `mapstructure:"statsd-prefix"`
+	StatsdTags    bool   `mapstructure:"statsd-tags"`
+}
+
+// NewMetrics returns a Metrics middleware if the given configuration is not
+// empty
+func NewMetrics(c *MetricsConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Metrics{*c}
+	}
+
+	return m
+}
+
+// Metrics middleware exports the result of the executions, to a textfile of
+// node_exporter and to a StatsD server, for the users without a Prometheus
+// scraping the daemon.
+type Metrics struct {
+	MetricsConfig
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *Metrics) ContinueOnStop() bool {
+	return true
+}
+
+// Run runs the execution and exports its result
+func (m *Metrics) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if m.MetricsTextfile != "" {
+		if err := updateTextfile(m.MetricsTextfile, ctx); err != nil {
+			ctx.Logger.Errorf("Metrics error writing %q: %s", m.MetricsTextfile, err)
+		}
+	}
+
+	if m.StatsdAddress != "" {
+		if err := m.sendStatsd(ctx); err != nil {
+			ctx.Logger.Errorf("Metrics error sending to %q: %s", m.StatsdAddress, err)
+		}
+	}
+
+	return err
+}
+
+// executionStatus returns the status of a finished execution: success, failed
+// or skipped
+func executionStatus(e *core.Execution) string {
+	switch {
+	case e.Skipped:
+		return "skipped"
+	case e.Failed:
+		return "failed"
+	default:
+		return "success"
+	}
+}
+
+// jobMetrics are the metrics of a job written to a textfile
+type jobMetrics struct {
+	lastRun     time.Time
+	lastSuccess time.Time
+	duration    time.Duration
+	// pullDuration is the time pulling the image of the last execution, zero
+	// if it didn't pull any
+	pullDuration time.Duration
+	failed       bool
+	slow         bool
+	runs         map[string]int
+}
+
+// textfiles are the metrics of the jobs by textfile, shared by the middlewares
+// of all the jobs writing to the same file
+var textfiles = struct {
+	sync.Mutex
+	jobs map[string]map[string]*jobMetrics
+}{jobs: make(map[string]map[string]*jobMetrics)}
+
+// updateTextfile updates the metrics of the job with the execution and
+// rewrites the textfile, the file is replaced atomically so node_exporter
+// never reads a partial file
+func updateTextfile(path string, ctx *core.Context) error {
+	textfiles.Lock()
+	defer textfiles.Unlock()
+
+	jobs, ok := textfiles.jobs[path]
+	if !ok {
+		jobs = make(map[string]*jobMetrics)
+		textfiles.jobs[path] = jobs
+	}
+
+	name := ctx.Job.GetName()
+	j, ok := jobs[name]
+	if !ok {
+		j = &jobMetrics{runs: make(map[string]int)}
+		jobs[name] = j
+	}
+
+	e := ctx.Execution
+	status := executionStatus(e)
+	j.runs[status]++
+	if status != "skipped" {
+		j.lastRun, j.duration, j.failed, j.slow = e.Date, e.Duration, e.Failed, e.Slow
+		j.pullDuration = e.PullDuration
+		if !e.Failed {
+			j.lastSuccess = e.Date
+		}
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, renderTextfile(jobs), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+var textfileEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// renderTextfile returns the metrics of the jobs in the Prometheus text format
+func renderTextfile(jobs map[string]*jobMetrics) []byte {
+	names := make([]string, 0, len(jobs))
+	for name := range jobs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	gauge := func(metric, help string, value func(*jobMetrics) (float64, bool)) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", metric, help, metric)
+		for _, name := range names {
+			if v, ok := value(jobs[name]); ok {
+				fmt.Fprintf(&b, "%s{job=\"%s\"} %g\n", metric, textfileEscaper.Replace(name), v)
+			}
+		}
+	}
+
+	gauge("ofelia_job_last_run_timestamp_seconds", "Start time of the last execution of the job.", func(j *jobMetrics) (float64, bool) {
+		return float64(j.lastRun.Unix()), !j.lastRun.IsZero()
+	})
+	gauge("ofelia_job_last_success_timestamp_seconds", "Start time of the last successful execution of the job.", func(j *jobMetrics) (float64, bool) {
+		return float64(j.lastSuccess.Unix()), !j.lastSuccess.IsZero()
+	})
+	gauge("ofelia_job_last_duration_seconds", "Duration of the last execution of the job.", func(j *jobMetrics) (float64, bool) {
+		return j.duration.Seconds(), !j.lastRun.IsZero()
+	})
+	gauge("ofelia_job_last_pull_duration_seconds", "Time pulling the image of the last execution of the job.", func(j *jobMetrics) (float64, bool) {
+		return j.pullDuration.Seconds(), j.pullDuration != 0
+	})
+	gauge("ofelia_job_last_failed", "Whether the last execution of the job failed.", func(j *jobMetrics) (float64, bool) {
+		if j.failed {
+			return 1, !j.lastRun.IsZero()
+		}
+
+		return 0, !j.lastRun.IsZero()
+	})
+
+	gauge("ofelia_job_last_slow", "Whether the last execution of the job took longer than its max-duration-warning.", func(j *jobMetrics) (float64, bool) {
+		if j.slow {
+			return 1, !j.lastRun.IsZero()
+		}
+
+		return 0, !j.lastRun.IsZero()
+	})
+
+	b.WriteString("# HELP ofelia_job_runs_total Executions of the job by status since the daemon started.\n")
+	b.WriteString("# TYPE ofelia_job_runs_total counter\n")
+	for _, name := range names {
+		for _, status := range []string{"success", "failed", "skipped"} {
+			fmt.Fprintf(&b, "ofelia_job_runs_total{job=\"%s\",status=\"%s\"} %d\n", textfileEscaper.Replace(name), status, jobs[name].runs[status])
+		}
+	}
+
+	return b.Bytes()
+}
+
+var statsdInvalidChars = regexp.MustCompile(`[^\w-]+`)
+
+// sendStatsd sends the status and the duration of the execution, and the time
+// pulling the image if any
+func (m *Metrics) sendStatsd(ctx *core.Context) error {
+	prefix := m.StatsdPrefix
+	if prefix == "" {
+		prefix = defaultStatsdPrefix
+	}
+
+	e := ctx.Execution
+	job := statsdInvalidChars.ReplaceAllString(ctx.Job.GetName(), "_")
+	name, tags := prefix+"."+job, ""
+	if m.StatsdTags {
+		name, tags = prefix+".job", "|#job:"+job
+	}
+
+	failed, slow := 0, 0
+	if e.Failed {
+		failed = 1
+	}
+
+	if e.Slow {
+		slow = 1
+	}
+
+	lines := []string{fmt.Sprintf("%s.runs.%s:1|c%s", name, executionStatus(e), tags)}
+	if !e.Skipped {
+		lines = append(lines,
+			fmt.Sprintf("%s.duration:%d|ms%s", name, e.Duration.Nanoseconds()/int64(time.Millisecond), tags),
+			fmt.Sprintf("%s.failed:%d|g%s", name, failed, tags),
+			fmt.Sprintf("%s.slow:%d|g%s", name, slow, tags),
+		)
+
+		if e.PullDuration != 0 {
+			lines = append(lines, fmt.Sprintf("%s.pull:%d|ms%s", name, e.PullDuration.Nanoseconds()/int64(time.Millisecond), tags))
+		}
+	}
+
+	conn, err := net.Dial("udp", m.StatsdAddress)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+	_, err = conn.Write([]byte(strings.Join(lines, "\n")))
+	return err
+}
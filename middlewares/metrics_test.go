@@ -0,0 +1,120 @@
+package middlewares
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteMetrics struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteMetrics{})
+
+func (s *SuiteMetrics) TestNewMetricsEmpty(c *C) {
+	c.Assert(NewMetrics(&MetricsConfig{}), IsNil)
+}
+
+func (s *SuiteMetrics) TestRunTextfile(c *C) {
+	file := filepath.Join(c.MkDir(), "ofelia.prom")
+	s.job.Name = `foo "bar"`
+
+	s.ctx.Start()
+	s.ctx.Execution.Date = time.Unix(1600000000, 0)
+	s.ctx.Stop(errors.New("foo"))
+
+	m := NewMetrics(&MetricsConfig{MetricsTextfile: file})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	content, err := ioutil.ReadFile(file)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Matches, `(?s).*ofelia_job_last_run_timestamp_seconds\{job="foo \\"bar\\""\} 1\.6e\+09\n.*`)
+	c.Assert(string(content), Matches, `(?s).*ofelia_job_last_failed\{job="foo \\"bar\\""\} 1\n.*`)
+	c.Assert(string(content), Matches, `(?s).*ofelia_job_runs_total\{job="foo \\"bar\\"",status="failed"\} 1\n.*`)
+	c.Assert(strings.Contains(string(content), "ofelia_job_last_success_timestamp_seconds{"), Equals, false)
+}
+
+func (s *SuiteMetrics) TestRenderTextfile(c *C) {
+	jobs := map[string]*jobMetrics{
+		"foo": {
+			lastRun:      time.Unix(20, 0),
+			lastSuccess:  time.Unix(20, 0),
+			duration:     time.Millisecond * 1500,
+			pullDuration: time.Millisecond * 250,
+			slow:         true,
+			runs:         map[string]int{"success": 2, "skipped": 1},
+		},
+	}
+
+	c.Assert(string(renderTextfile(jobs)), Equals, ``+
+		"# HELP ofelia_job_last_run_timestamp_seconds Start time of the last execution of the job.\n"+
+		"# TYPE ofelia_job_last_run_timestamp_seconds gauge\n"+
+		"ofelia_job_last_run_timestamp_seconds{job=\"foo\"} 20\n"+
+		"# HELP ofelia_job_last_success_timestamp_seconds Start time of the last successful execution of the job.\n"+
+		"# TYPE ofelia_job_last_success_timestamp_seconds gauge\n"+
+		"ofelia_job_last_success_timestamp_seconds{job=\"foo\"} 20\n"+
+		"# HELP ofelia_job_last_duration_seconds Duration of the last execution of the job.\n"+
+		"# TYPE ofelia_job_last_duration_seconds gauge\n"+
+		"ofelia_job_last_duration_seconds{job=\"foo\"} 1.5\n"+
+		"# HELP ofelia_job_last_pull_duration_seconds Time pulling the image of the last execution of the job.\n"+
+		"# TYPE ofelia_job_last_pull_duration_seconds gauge\n"+
+		"ofelia_job_last_pull_duration_seconds{job=\"foo\"} 0.25\n"+
+		"# HELP ofelia_job_last_failed Whether the last execution of the job failed.\n"+
+		"# TYPE ofelia_job_last_failed gauge\n"+
+		"ofelia_job_last_failed{job=\"foo\"} 0\n"+
+		"# HELP ofelia_job_last_slow Whether the last execution of the job took longer than its max-duration-warning.\n"+
+		"# TYPE ofelia_job_last_slow gauge\n"+
+		"ofelia_job_last_slow{job=\"foo\"} 1\n"+
+		"# HELP ofelia_job_runs_total Executions of the job by status since the daemon started.\n"+
+		"# TYPE ofelia_job_runs_total counter\n"+
+		"ofelia_job_runs_total{job=\"foo\",status=\"success\"} 2\n"+
+		"ofelia_job_runs_total{job=\"foo\",status=\"failed\"} 0\n"+
+		"ofelia_job_runs_total{job=\"foo\",status=\"skipped\"} 1\n",
+	)
+}
+
+func (s *SuiteMetrics) TestRunStatsd(c *C) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	s.job.Name = "foo.bar"
+	s.ctx.Start()
+	s.ctx.Execution.PullDuration = time.Millisecond * 1200
+	s.ctx.Stop(nil)
+
+	m := NewMetrics(&MetricsConfig{StatsdAddress: conn.LocalAddr().String()})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	c.Assert(readPacket(c, conn), Matches, "ofelia.foo_bar.runs.success:1\\|c\nofelia.foo_bar.duration:\\d+\\|ms\nofelia.foo_bar.failed:0\\|g\nofelia.foo_bar.slow:0\\|g\nofelia.foo_bar.pull:1200\\|ms")
+}
+
+func (s *SuiteMetrics) TestRunStatsdTags(c *C) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(errors.New("foo"))
+
+	m := NewMetrics(&MetricsConfig{StatsdAddress: conn.LocalAddr().String(), StatsdPrefix: "cron", StatsdTags: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	c.Assert(readPacket(c, conn), Matches, "cron.job.runs.failed:1\\|c\\|#job:foo\ncron.job.duration:\\d+\\|ms\\|#job:foo\ncron.job.failed:1\\|g\\|#job:foo\ncron.job.slow:0\\|g\\|#job:foo")
+}
+
+func readPacket(c *C, conn net.PacketConn) string {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	b := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(b)
+	c.Assert(err, IsNil)
+
+	return string(b[:n])
+}
@@ -0,0 +1,136 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+var (
+	opsgenieURL        = "https://api.opsgenie.com"
+	opsgenieOutputSize = 1000
+	opsgenieTimeout    = time.Second * 10
+)
+
+// OpsgenieConfig configuration for the Opsgenie middleware
+type OpsgenieConfig struct {
+	OpsgenieAPIKey string `mapstructure:"opsgenie-api-key"`
+	// OpsgeniePriority is the priority of the alerts, from `P1` to `P5`, by
+	// default the one of the API, `P3`.
+	OpsgeniePriority string `mapstructure:"opsgenie-priority"`
+	// OpsgenieURL replaces the URL of the API, e.g. with the one of the EU
+	// instance, `https://api.eu.opsgenie.com`.
+	OpsgenieURL string `mapstructure:"opsgenie-url"`
+}
+
+// NewOpsgenie returns an Opsgenie middleware if the given configuration is not
+// empty
+func NewOpsgenie(c *OpsgenieConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Opsgenie{*c}
+	}
+
+	return m
+}
+
+// Opsgenie middleware creates an alert when a job fails and closes it when the
+// job succeeds again, the alerts of a job share the same alias.
+type Opsgenie struct {
+	OpsgenieConfig
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *Opsgenie) ContinueOnStop() bool {
+	return true
+}
+
+// Run creates or closes the alert of the job, see incidentAction
+func (m *Opsgenie) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	var sendErr error
+	switch incidentAction(ctx) {
+	case incidentTrigger:
+		sendErr = m.post(ctx, "/v2/alerts", m.buildAlert(ctx))
+	case incidentResolve:
+		path := "/v2/alerts/" + url.PathEscape(incidentKey(ctx.Job)) + "/close?identifierType=alias"
+		sendErr = m.post(ctx, path, map[string]string{"source": "ofelia"})
+	}
+
+	if sendErr != nil {
+		ctx.Logger.Errorf("Opsgenie error calling %q: %q", m.url(), sendErr)
+	}
+
+	return err
+}
+
+func (m *Opsgenie) url() string {
+	if m.OpsgenieURL == "" {
+		return opsgenieURL
+	}
+
+	return strings.TrimSuffix(m.OpsgenieURL, "/")
+}
+
+func (m *Opsgenie) post(ctx *core.Context, path string, body interface{}) error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.url()+path, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+m.OpsgenieAPIKey)
+
+	client := &http.Client{Timeout: opsgenieTimeout}
+	r, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return fmt.Errorf("non-2xx status code %d", r.StatusCode)
+	}
+
+	return nil
+}
+
+func (m *Opsgenie) buildAlert(ctx *core.Context) *opsgenieAlert {
+	e := ctx.Execution
+	return &opsgenieAlert{
+		Message:     fmt.Sprintf("Job %s failed", ctx.Job.GetName()),
+		Alias:       incidentKey(ctx.Job),
+		Description: core.TailOutput(failureOutput(e), opsgenieOutputSize),
+		Source:      "ofelia",
+		Priority:    m.OpsgeniePriority,
+		Details: map[string]string{
+			"job":       ctx.Job.GetName(),
+			"command":   ctx.Job.GetCommand(),
+			"execution": e.ID,
+			"duration":  e.Duration.String(),
+			"error":     e.Error.Error(),
+		},
+	}
+}
+
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Source      string            `json:"source"`
+	Priority    string            `json:"priority,omitempty"`
+	Details     map[string]string `json:"details"`
+}
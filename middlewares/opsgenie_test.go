@@ -0,0 +1,60 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/mcuadros/ofelia/core"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteOpsgenie struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteOpsgenie{})
+
+func (s *SuiteOpsgenie) TestNewOpsgenieEmpty(c *C) {
+	c.Assert(NewOpsgenie(&OpsgenieConfig{}), IsNil)
+}
+
+func (s *SuiteOpsgenie) TestRun(c *C) {
+	var paths []string
+	var alert opsgenieAlert
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Authorization"), Equals, "GenieKey qux")
+		paths = append(paths, r.URL.RequestURI())
+		if r.URL.Path == "/v2/alerts" {
+			json.NewDecoder(r.Body).Decode(&alert)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	m := NewOpsgenie(&OpsgenieConfig{OpsgenieAPIKey: "qux", OpsgeniePriority: "P2", OpsgenieURL: ts.URL + "/"})
+	run := func(err error) {
+		ctx := core.NewContext(s.ctx.Scheduler, s.job, core.NewExecution())
+		ctx.Start()
+		ctx.Execution.OutputStream.Write([]byte("bar"))
+		ctx.Stop(err)
+		c.Assert(m.Run(ctx), IsNil)
+	}
+
+	run(nil)
+	c.Assert(paths, HasLen, 0)
+
+	run(&core.ExitCodeError{ExitCode: 2})
+	c.Assert(paths, DeepEquals, []string{"/v2/alerts"})
+	c.Assert(alert.Message, Equals, "Job foo failed")
+	c.Assert(alert.Alias, Equals, "ofelia-foo")
+	c.Assert(alert.Description, Equals, "bar")
+	c.Assert(alert.Priority, Equals, "P2")
+	c.Assert(alert.Details["error"], Equals, "error non-zero exit code: 2")
+
+	run(nil)
+	c.Assert(paths[1], Equals, "/v2/alerts/ofelia-foo/close?identifierType=alias")
+}
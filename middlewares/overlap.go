@@ -1,10 +1,29 @@
 package middlewares
 
-import "github.com/mcuadros/ofelia/core"
+import (
+	"strings"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+// Overlap policies, defining what happens when a job is scheduled while a
+// previous execution is still running
+const (
+	// OverlapAllow runs the new execution along the running ones
+	OverlapAllow = "allow"
+	// OverlapForbid skips the new execution
+	OverlapForbid = "forbid"
+	// OverlapReplace cancels the running executions before starting the new one
+	OverlapReplace = "replace"
+)
+
+const overlapWaitDuration = time.Millisecond * 100
 
 // OverlapConfig configuration for the Overlap middleware
 type OverlapConfig struct {
-	NoOverlap bool `gcfg:"no-overlap" mapstructure:"no-overlap"`
+	NoOverlap bool   `mapstructure:"no-overlap"`
+	Overlap   string `mapstructure:"overlap"`
 }
 
 // NewOverlap returns a Overlap middleware if the given configuration is not empty
@@ -18,7 +37,7 @@ func NewOverlap(c *OverlapConfig) core.Middleware {
 }
 
 // Overlap when this middleware is enabled avoid to overlap executions from a
-// specific job
+// specific job, skipping the new execution or replacing the running one
 type Overlap struct {
 	OverlapConfig
 }
@@ -28,11 +47,41 @@ func (m *Overlap) ContinueOnStop() bool {
 	return false
 }
 
-// Run stops the execution if the another execution is already running
+// Run stops or replaces the execution if the another execution is already
+// running, depending on the configured policy
 func (m *Overlap) Run(ctx *core.Context) error {
-	if m.NoOverlap && ctx.Job.Running() > 1 {
-		ctx.Stop(core.ErrSkippedExecution)
+	if ctx.Job.Running() > 1 {
+		switch m.policy() {
+		case OverlapForbid:
+			ctx.Stop(core.ErrSkippedExecution)
+			ctx.Log("Skipped, a previous execution is still running")
+		case OverlapReplace:
+			ctx.Log("Replacing the previous executions still running")
+			m.cancelRunning(ctx)
+		}
 	}
 
 	return ctx.Next()
 }
+
+func (m *Overlap) policy() string {
+	if m.NoOverlap {
+		return OverlapForbid
+	}
+
+	return strings.ToLower(m.Overlap)
+}
+
+// cancelRunning cancels any other running execution of the job, and waits
+// until they are finished
+func (m *Overlap) cancelRunning(ctx *core.Context) {
+	for _, e := range ctx.Job.History() {
+		if e != ctx.Execution && e.IsRunning {
+			e.Cancel()
+		}
+	}
+
+	for ctx.Job.Running() > 1 {
+		time.Sleep(overlapWaitDuration)
+	}
+}
@@ -1,6 +1,10 @@
 package middlewares
 
-import . "gopkg.in/check.v1"
+import (
+	"github.com/mcuadros/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
 
 type SuiteOverlap struct {
 	BaseSuite
@@ -27,3 +31,46 @@ func (s *SuiteOverlap) TestRunOverlap(c *C) {
 	c.Assert(s.ctx.Execution.IsRunning, Equals, false)
 	c.Assert(s.ctx.Execution.Skipped, Equals, true)
 }
+
+func (s *SuiteOverlap) TestRunOverlapForbid(c *C) {
+	s.ctx.Execution.Start()
+	s.ctx.Job.NotifyStart()
+	s.ctx.Job.NotifyStart()
+
+	m := NewOverlap(&OverlapConfig{Overlap: OverlapForbid})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(s.ctx.Execution.IsRunning, Equals, false)
+	c.Assert(s.ctx.Execution.Skipped, Equals, true)
+}
+
+func (s *SuiteOverlap) TestRunOverlapAllow(c *C) {
+	s.ctx.Execution.Start()
+	s.ctx.Job.NotifyStart()
+	s.ctx.Job.NotifyStart()
+
+	m := NewOverlap(&OverlapConfig{Overlap: OverlapAllow})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(s.ctx.Execution.Skipped, Equals, false)
+}
+
+func (s *SuiteOverlap) TestRunOverlapReplace(c *C) {
+	running := core.NewExecution()
+	running.Start()
+	s.ctx.Job.AddHistory(running)
+	s.ctx.Job.NotifyStart()
+
+	go func() {
+		<-running.Done()
+		running.Stop(core.ErrCanceledExecution)
+		s.ctx.Job.NotifyStop()
+	}()
+
+	s.ctx.Start()
+
+	m := NewOverlap(&OverlapConfig{Overlap: OverlapReplace})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(running.IsCanceled(), Equals, true)
+	c.Assert(running.Failed, Equals, true)
+	c.Assert(s.ctx.Execution.IsCanceled(), Equals, false)
+	c.Assert(s.ctx.Execution.Skipped, Equals, false)
+}
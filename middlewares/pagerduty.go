@@ -0,0 +1,151 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+var (
+	pagerDutyURL        = "https://events.pagerduty.com/v2/enqueue"
+	pagerDutyOutputSize = 1000
+	pagerDutyTimeout    = time.Second * 10
+)
+
+// PagerDutyConfig configuration for the PagerDuty middleware
+type PagerDutyConfig struct {
+	// PagerDutyRoutingKey is the integration key of an Events API v2
+	// integration of the service.
+	PagerDutyRoutingKey string `mapstructure:"pagerduty-routing-key"`
+	// PagerDutySeverity is the severity of the incidents, `critical`,
+	// `error`, `warning` or `info`, by default `error`.
+	PagerDutySeverity string `mapstructure:"pagerduty-severity"`
+	// PagerDutyURL replaces the URL of the Events API, e.g. with the one of the
+	// EU service region, `https://events.eu.pagerduty.com/v2/enqueue`.
+	PagerDutyURL string `mapstructure:"pagerduty-url"`
+}
+
+// NewPagerDuty returns a PagerDuty middleware if the given configuration is
+// not empty
+func NewPagerDuty(c *PagerDutyConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &PagerDuty{*c}
+	}
+
+	return m
+}
+
+// PagerDuty middleware triggers an incident when a job fails and resolves it
+// when the job succeeds again, the events of a job share the same dedup key.
+type PagerDuty struct {
+	PagerDutyConfig
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *PagerDuty) ContinueOnStop() bool {
+	return true
+}
+
+// Run triggers or resolves the incident of the job, see incidentAction
+func (m *PagerDuty) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	action := incidentAction(ctx)
+	if action == "" {
+		return err
+	}
+
+	if err := m.sendEvent(ctx, action); err != nil {
+		ctx.Logger.Errorf("PagerDuty error sending %s event: %q", action, err)
+	}
+
+	return err
+}
+
+func (m *PagerDuty) sendEvent(ctx *core.Context, action string) error {
+	content, err := json.Marshal(m.buildEvent(ctx, action))
+	if err != nil {
+		return err
+	}
+
+	url := m.PagerDutyURL
+	if url == "" {
+		url = pagerDutyURL
+	}
+
+	client := &http.Client{Timeout: pagerDutyTimeout}
+	r, err := client.Post(url, "application/json", bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return fmt.Errorf("non-2xx status code %d", r.StatusCode)
+	}
+
+	return nil
+}
+
+func (m *PagerDuty) buildEvent(ctx *core.Context, action string) *pagerDutyEvent {
+	ev := &pagerDutyEvent{
+		RoutingKey:  m.PagerDutyRoutingKey,
+		EventAction: action,
+		DedupKey:    incidentKey(ctx.Job),
+	}
+
+	if action != incidentTrigger {
+		return ev
+	}
+
+	e := ctx.Execution
+	severity := m.PagerDutySeverity
+	if severity == "" {
+		severity = "error"
+	}
+
+	source, _ := os.Hostname()
+	ev.Payload = &pagerDutyPayload{
+		Summary:  fmt.Sprintf("Job %s failed: %s", ctx.Job.GetName(), e.Error),
+		Source:   source,
+		Severity: severity,
+		Details: map[string]interface{}{
+			"job":       ctx.Job.GetName(),
+			"command":   ctx.Job.GetCommand(),
+			"execution": e.ID,
+			"duration":  e.Duration.String(),
+			"output":    core.TailOutput(failureOutput(e), pagerDutyOutputSize),
+		},
+	}
+
+	if err, ok := e.Error.(*core.ExitCodeError); ok {
+		ev.Payload.Details["exit_code"] = err.ExitCode
+	}
+
+	if reason := e.Container.Reason(); reason != "" {
+		ev.Payload.Details["reason"] = reason
+	}
+
+	return ev
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary  string                 `json:"summary"`
+	Source   string                 `json:"source"`
+	Severity string                 `json:"severity"`
+	Details  map[string]interface{} `json:"custom_details"`
+}
@@ -0,0 +1,89 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/mcuadros/ofelia/core"
+	. "gopkg.in/check.v1"
+)
+
+type SuitePagerDuty struct {
+	BaseSuite
+	server *httptest.Server
+	events []*pagerDutyEvent
+}
+
+var _ = Suite(&SuitePagerDuty{})
+
+func (s *SuitePagerDuty) SetUpTest(c *C) {
+	s.BaseSuite.SetUpTest(c)
+	s.job.Name = "foo"
+	s.events = nil
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ev := &pagerDutyEvent{}
+		c.Assert(json.NewDecoder(r.Body).Decode(ev), IsNil)
+		s.events = append(s.events, ev)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+}
+
+func (s *SuitePagerDuty) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *SuitePagerDuty) run(c *C, err error) {
+	ctx := core.NewContext(s.ctx.Scheduler, s.job, core.NewExecution())
+	ctx.Start()
+	ctx.Execution.ErrorStream.Write([]byte("bar"))
+	ctx.Stop(err)
+
+	m := NewPagerDuty(&PagerDutyConfig{PagerDutyRoutingKey: "qux", PagerDutyURL: s.server.URL})
+	c.Assert(m.Run(ctx), IsNil)
+}
+
+func (s *SuitePagerDuty) TestNewPagerDutyEmpty(c *C) {
+	c.Assert(NewPagerDuty(&PagerDutyConfig{}), IsNil)
+}
+
+func (s *SuitePagerDuty) TestRun(c *C) {
+	s.run(c, nil)
+	c.Assert(s.events, HasLen, 0)
+
+	failed := &core.ExitCodeError{ExitCode: 2}
+	s.run(c, failed)
+	c.Assert(s.events, HasLen, 1)
+	c.Assert(s.events[0].RoutingKey, Equals, "qux")
+	c.Assert(s.events[0].EventAction, Equals, incidentTrigger)
+	c.Assert(s.events[0].DedupKey, Equals, "ofelia-foo")
+	c.Assert(s.events[0].Payload.Severity, Equals, "error")
+	c.Assert(s.events[0].Payload.Summary, Equals, "Job foo failed: error non-zero exit code: 2")
+	c.Assert(s.events[0].Payload.Details["output"], Equals, "bar")
+	c.Assert(s.events[0].Payload.Details["exit_code"], Equals, float64(2))
+
+	s.run(c, nil)
+	c.Assert(s.events, HasLen, 2)
+	c.Assert(s.events[1].EventAction, Equals, incidentResolve)
+	c.Assert(s.events[1].DedupKey, Equals, "ofelia-foo")
+	c.Assert(s.events[1].Payload, IsNil)
+
+	s.run(c, nil)
+	c.Assert(s.events, HasLen, 2)
+}
+
+func (s *SuitePagerDuty) TestRunAlertAfterFailures(c *C) {
+	s.job.AlertAfterFailures = 2
+	failed := &core.ExitCodeError{ExitCode: 2}
+	s.run(c, failed)
+	c.Assert(s.events, HasLen, 0)
+
+	s.run(c, failed)
+	s.run(c, failed)
+	c.Assert(s.events, HasLen, 2)
+	c.Assert(s.events[1].EventAction, Equals, incidentTrigger)
+
+	s.run(c, nil)
+	c.Assert(s.events, HasLen, 3)
+	c.Assert(s.events[2].EventAction, Equals, incidentResolve)
+}
@@ -0,0 +1,100 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+var (
+	pingOutputSize = 10000
+	pingTimeout    = time.Second * 10
+)
+
+// PingConfig configuration for the Ping middleware
+type PingConfig struct {
+	// PingURL is the base URL of the pings: `<url>/start` is pinged when the
+	// execution starts, `<url>` when it succeeds and `<url>/fail` when it
+	// fails, as expected by healthchecks.io.
+	PingURL string `mapstructure:"ping-url"`
+	// PingStartURL, PingSuccessURL and PingFailureURL replace the URLs built
+	// from PingURL, e.g. for Cronitor.
+	PingStartURL   string `mapstructure:"ping-start-url"`
+	PingSuccessURL string `mapstructure:"ping-success-url"`
+	PingFailureURL string `mapstructure:"ping-failure-url"`
+}
+
+// NewPing returns a Ping middleware if the given configuration is not empty
+func NewPing(c *PingConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Ping{*c}
+	}
+
+	return m
+}
+
+// Ping middleware pings an URL when an execution starts and when it finishes,
+// so a monitoring service can alert when a job fails or doesn't run.
+type Ping struct {
+	PingConfig
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *Ping) ContinueOnStop() bool {
+	return true
+}
+
+// Run pings the start URL, runs the execution and then pings the success or
+// failure URL, with the tail of the output as body. The skipped executions
+// aren't pinged.
+func (m *Ping) Run(ctx *core.Context) error {
+	if !ctx.Execution.Skipped {
+		m.ping(ctx, m.url(m.PingStartURL, "/start"), nil)
+	}
+
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	e := ctx.Execution
+	switch {
+	case e.Skipped:
+	case e.Failed:
+		m.ping(ctx, m.url(m.PingFailureURL, "/fail"), failureOutput(e))
+	default:
+		m.ping(ctx, m.url(m.PingSuccessURL, ""), e.Output())
+	}
+
+	return err
+}
+
+// url returns the given URL or, if empty, the base URL with the suffix
+func (m *Ping) url(url, suffix string) string {
+	if url != "" || m.PingURL == "" {
+		return url
+	}
+
+	return strings.TrimSuffix(m.PingURL, "/") + suffix
+}
+
+func (m *Ping) ping(ctx *core.Context, url string, output []byte) {
+	if url == "" {
+		return
+	}
+
+	client := &http.Client{Timeout: pingTimeout}
+	r, err := client.Post(url, "text/plain", strings.NewReader(core.TailOutput(output, pingOutputSize)))
+	if err == nil {
+		r.Body.Close()
+		if r.StatusCode < 200 || r.StatusCode >= 300 {
+			err = fmt.Errorf("non-2xx status code %d", r.StatusCode)
+		}
+	}
+
+	if err != nil {
+		ctx.Logger.Errorf("Ping error calling %q: %q", url, err)
+	}
+}
@@ -0,0 +1,72 @@
+package middlewares
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuitePing struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuitePing{})
+
+func (s *SuitePing) TestNewPingEmpty(c *C) {
+	c.Assert(NewPing(&PingConfig{}), IsNil)
+}
+
+func (s *SuitePing) TestRun(c *C) {
+	var pings []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		pings = append(pings, r.URL.Path+" "+string(body))
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte("foo"))
+
+	m := NewPing(&PingConfig{PingURL: ts.URL + "/uuid/"})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(pings, DeepEquals, []string{"/uuid/start ", "/uuid foo"})
+}
+
+func (s *SuitePing) TestRunFailed(c *C) {
+	var pings []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pings = append(pings, r.URL.String())
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(errors.New("foo"))
+
+	m := NewPing(&PingConfig{
+		PingStartURL:   ts.URL + "/p/monitor?state=run",
+		PingFailureURL: ts.URL + "/p/monitor?state=fail",
+	})
+
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(pings, DeepEquals, []string{"/p/monitor?state=run", "/p/monitor?state=fail"})
+}
+
+func (s *SuitePing) TestRunSkipped(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(true, Equals, false)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Execution.Stop(nil)
+	s.ctx.Execution.Skipped = true
+
+	m := NewPing(&PingConfig{PingURL: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
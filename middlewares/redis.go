@@ -0,0 +1,109 @@
+package middlewares
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcuadros/ofelia/internal/resp"
+)
+
+const redisTimeout = time.Second * 5
+
+// redisClient is a minimal Redis client, every command opens a new connection
+type redisClient struct {
+	addr     string
+	user     string
+	password string
+	db       int
+	tls      bool
+}
+
+// newRedisClient parses an URL with the syntax
+// `redis[s]://[[user]:password@]host[:port][/db]`, the user is an ACL user of
+// Redis 6 or later
+func newRedisClient(rawurl string) (*redisClient, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &redisClient{addr: u.Host}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		c.tls = true
+	default:
+		return nil, fmt.Errorf("invalid redis URL %q: unknown scheme %q", rawurl, u.Scheme)
+	}
+
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+
+	if u.User != nil {
+		c.password, _ = u.User.Password()
+		if c.password != "" {
+			c.user = u.User.Username()
+		}
+	}
+
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis URL %q: invalid database %q", rawurl, db)
+		}
+	}
+
+	return c, nil
+}
+
+// do runs the command and returns its reply: a string, an int64, nil for the
+// nil replies or an error for the error replies.
+func (c *redisClient) do(args ...string) (interface{}, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	r := bufio.NewReader(conn)
+
+	if c.password != "" {
+		if _, err := c.send(conn, r, resp.Auth(c.user, c.password)...); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.db != 0 {
+		if _, err := c.send(conn, r, "SELECT", strconv.Itoa(c.db)); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.send(conn, r, args...)
+}
+
+func (c *redisClient) dial() (net.Conn, error) {
+	d := &net.Dialer{Timeout: redisTimeout}
+	if c.tls {
+		host, _, _ := net.SplitHostPort(c.addr)
+		return tls.DialWithDialer(d, "tcp", c.addr, &tls.Config{ServerName: host})
+	}
+
+	return d.Dial("tcp", c.addr)
+}
+
+func (c *redisClient) send(w io.Writer, r *bufio.Reader, args ...string) (interface{}, error) {
+	if err := resp.Write(w, args...); err != nil {
+		return nil, err
+	}
+
+	return resp.Read(r)
+}
@@ -0,0 +1,150 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+var (
+	s3DefaultRegion = "us-east-1"
+	s3Timeout       = time.Second * 30
+)
+
+// S3Config configuration for the S3 middleware
+type S3Config struct {
+	S3Bucket string `mapstructure:"s3-bucket"`
+	// S3Endpoint is the URL of an S3-compatible service, by default the AWS
+	// endpoint of the region. The objects are addressed in path-style.
+	S3Endpoint    string `mapstructure:"s3-endpoint"`
+	S3Region      string `mapstructure:"s3-region"`
+	S3Prefix      string `mapstructure:"s3-prefix"`
+	S3AccessKey   string `mapstructure:"s3-access-key"`
+	S3SecretKey   string `mapstructure:"s3-secret-key"`
+	S3OnlyOnError bool   `mapstructure:"s3-only-on-error"`
+	S3NotifyOn    string `mapstructure:"s3-notify-on"`
+}
+
+// NewS3 returns a S3 middleware if the given configuration is not empty
+func NewS3(c *S3Config) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &S3{*c}
+	}
+
+	return m
+}
+
+// S3 middleware uploads a JSON report, including the outputs, of every
+// execution to an S3-compatible bucket
+type S3 struct {
+	S3Config
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *S3) ContinueOnStop() bool {
+	return true
+}
+
+// Run uploads the result of the execution to the bucket
+func (m *S3) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if shouldNotify(ctx, m.S3NotifyOn, m.S3OnlyOnError) {
+		if err := m.upload(ctx); err != nil {
+			ctx.Logger.Errorf("S3 error uploading to %q: %q", m.S3Bucket, err)
+		}
+	}
+
+	return err
+}
+
+func (m *S3) upload(ctx *core.Context) error {
+	content, err := json.Marshal(newExecutionReport(ctx))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, m.objectURL(ctx), bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if err := m.signRequest(req, content, time.Now()); err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: s3Timeout}
+	r, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(r.Body)
+		return fmt.Errorf("non-2xx status code %d: %s", r.StatusCode, body)
+	}
+
+	return nil
+}
+
+// objectURL returns the path-style URL of the report, the key is
+// `<prefix>/<job>/<date>_<execution>.json`
+func (m *S3) objectURL(ctx *core.Context) string {
+	key := path.Join(m.S3Prefix, ctx.Job.GetName(), fmt.Sprintf(
+		"%s_%s.json",
+		ctx.Execution.Date.UTC().Format("20060102_150405"), ctx.Execution.ID,
+	))
+
+	u := &url.URL{Path: "/" + path.Join(m.S3Bucket, key)}
+	return strings.TrimSuffix(m.endpoint(), "/") + u.EscapedPath()
+}
+
+func (m *S3) endpoint() string {
+	if m.S3Endpoint != "" {
+		return m.S3Endpoint
+	}
+
+	return fmt.Sprintf("https://s3.%s.amazonaws.com", m.region())
+}
+
+func (m *S3) region() string {
+	if m.S3Region == "" {
+		return s3DefaultRegion
+	}
+
+	return m.S3Region
+}
+
+// signRequest signs the request with AWS Signature Version 4, with the
+// credentials of the config or the ones found as the AWS jobs do, see
+// core.LoadAWSCredentials. The requests are anonymous without credentials.
+func (m *S3) signRequest(req *http.Request, content []byte, now time.Time) error {
+	req.Header.Set("X-Amz-Content-Sha256", hashHex(content))
+
+	creds, err := core.LoadAWSCredentials(m.S3AccessKey, m.S3SecretKey)
+	if err != nil {
+		return err
+	}
+
+	core.SignAWSRequest(req, creds, m.region(), "s3", content, now)
+	return nil
+}
+
+func hashHex(content []byte) string {
+	h := sha256.Sum256(content)
+	return hex.EncodeToString(h[:])
+}
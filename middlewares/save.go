@@ -1,27 +1,91 @@
 package middlewares
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
 
 	"github.com/mcuadros/ofelia/core"
 )
 
+const (
+	saveFormatFiles = "files"
+	saveFormatJSONL = "jsonl"
+)
+
 // SaveConfig configuration for the Save middleware
 type SaveConfig struct {
-	SaveFolder      string `gcfg:"save-folder" mapstructure:"save-folder"`
-	SaveOnlyOnError bool   `gcfg:"save-only-on-error" mapstructure:"save-only-on-error"`
+	SaveFolder      string `mapstructure:"save-folder"`
+	SaveOnlyOnError bool   `mapstructure:"save-only-on-error"`
+	SaveNotifyOn    string `mapstructure:"save-notify-on"`
+	// SaveFormat is files, the default, to write the outputs and a JSON report
+	// of every execution to its own files, or jsonl to append a JSON line per
+	// execution to a file per job.
+	SaveFormat string `mapstructure:"save-format"`
+	// SavePath is a template of the file the executions are appended to,
+	// relative to SaveFolder, e.g. `{{.Job}}/{{.Date}}.log`, see savePathData.
+	// In files format the outputs are appended as text, in jsonl format the
+	// JSON lines.
+	SavePath string `mapstructure:"save-path"`
+	// SaveMaxSize, in bytes, and SaveMaxAge rotate the JSON lines file of a
+	// job when it's bigger or its first execution is older.
+	SaveMaxSize int64         `mapstructure:"save-max-size"`
+	SaveMaxAge  time.Duration `mapstructure:"save-max-age"`
+	// SaveCompress gzips the files written once: the outputs and the report of
+	// every execution in files format and the rotated files in jsonl format.
+	// The files appended to, the ones of SavePath in files format and the
+	// current ones in jsonl format, aren't compressed.
+	SaveCompress bool `mapstructure:"save-compress"`
+	// SaveRetention is the time the saved files are kept, zero means forever.
+	// Only the files of the layout of the format and SavePath are deleted.
+	SaveRetention time.Duration `mapstructure:"save-retention"`
+}
+
+// Validate returns an error if the format is unknown or the template of
+// SavePath can't be parsed
+func (c *SaveConfig) Validate() error {
+	switch c.SaveFormat {
+	case "", saveFormatFiles, saveFormatJSONL:
+	default:
+		return fmt.Errorf("invalid save-format %q: expected %s or %s", c.SaveFormat, saveFormatFiles, saveFormatJSONL)
+	}
+
+	_, err := c.parsePath()
+	return err
+}
+
+func (c *SaveConfig) parsePath() (*template.Template, error) {
+	if c.SavePath == "" {
+		return nil, nil
+	}
+
+	t, err := template.New("save-path").Parse(c.SavePath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid save-path %q: %s", c.SavePath, err)
+	}
+
+	return t, nil
 }
 
-// NewSave returns a Save middleware if the given configuration is not empty
+// NewSave returns a Save middleware if the given configuration is not empty,
+// the template of SavePath is parsed once, see SaveConfig.Validate
 func NewSave(c *SaveConfig) core.Middleware {
 	var m core.Middleware
 	if !IsEmpty(c) {
-		m = &Save{*c}
+		s := &Save{SaveConfig: *c}
+		s.path, s.pathErr = c.parsePath()
+		s.layout = s.savedFiles()
+		m = s
 	}
 
 	return m
@@ -31,6 +95,14 @@ func NewSave(c *SaveConfig) core.Middleware {
 // every execution of the process
 type Save struct {
 	SaveConfig
+
+	path    *template.Template
+	pathErr error
+	// layout matches the paths, relative to SaveFolder, of the saved files
+	layout []*regexp.Regexp
+
+	// mu serializes the appends and rotations of the JSON lines files
+	mu sync.Mutex
 }
 
 // ContinueOnStop return allways true, we want always report the final status
@@ -43,7 +115,7 @@ func (m *Save) Run(ctx *core.Context) error {
 	err := ctx.Next()
 	ctx.Stop(err)
 
-	if ctx.Execution.Failed || !m.SaveOnlyOnError {
+	if shouldNotify(ctx, m.SaveNotifyOn, m.SaveOnlyOnError) {
 		err := m.saveToDisk(ctx)
 		if err != nil {
 			ctx.Logger.Errorf("Save error: %q", err)
@@ -54,18 +126,40 @@ func (m *Save) Run(ctx *core.Context) error {
 }
 
 func (m *Save) saveToDisk(ctx *core.Context) error {
+	var err error
+	switch m.SaveFormat {
+	case "", saveFormatFiles:
+		if m.SavePath != "" {
+			err = m.saveLogToDisk(ctx)
+		} else {
+			err = m.saveFilesToDisk(ctx)
+		}
+	case saveFormatJSONL:
+		err = m.saveLineToDisk(ctx)
+	default:
+		err = fmt.Errorf("invalid save-format %q", m.SaveFormat)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return m.prune()
+}
+
+func (m *Save) saveFilesToDisk(ctx *core.Context) error {
 	root := filepath.Join(m.SaveFolder, fmt.Sprintf(
 		"%s_%s",
 		ctx.Execution.Date.Format("20060102_150405"), ctx.Job.GetName(),
 	))
 
 	e := ctx.Execution
-	err := m.saveReaderToDisk(e.ErrorStream, fmt.Sprintf("%s.stderr.log", root))
+	err := m.saveReaderToDisk(bytes.NewReader(e.ErrorOutput()), fmt.Sprintf("%s.stderr.log", root))
 	if err != nil {
 		return err
 	}
 
-	err = m.saveReaderToDisk(e.OutputStream, fmt.Sprintf("%s.stdout.log", root))
+	err = m.saveReaderToDisk(bytes.NewReader(e.Output()), fmt.Sprintf("%s.stdout.log", root))
 	if err != nil {
 		return err
 	}
@@ -84,19 +178,338 @@ func (m *Save) saveContextToDisk(ctx *core.Context, filename string) error {
 		"Execution": ctx.Execution,
 	}, "", "  ")
 
-	return m.saveReaderToDisk(bytes.NewBuffer(js), filename)
+	// the job includes its environment
+	return m.saveReaderToDisk(bytes.NewBuffer(ctx.Execution.Redact(js)), filename)
 }
 
 func (m *Save) saveReaderToDisk(r io.Reader, filename string) error {
+	if m.SaveCompress {
+		filename += ".gz"
+	}
+
 	f, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
 
 	defer f.Close()
-	if _, err := io.Copy(f, r); err != nil {
+
+	var w io.Writer = f
+	if m.SaveCompress {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// executionReport is the JSON report of an execution, including its outputs
+type executionReport struct {
+	Job         string
+	Command     string
+	ID          string
+	Date        time.Time
+	Duration    time.Duration
+	Failed      bool
+	Skipped     bool
+	Error       string `json:",omitempty"`
+	Output      string
+	ErrorOutput string
+}
+
+func newExecutionReport(ctx *core.Context) *executionReport {
+	e := ctx.Execution
+	r := &executionReport{
+		Job:         ctx.Job.GetName(),
+		Command:     ctx.Job.GetCommand(),
+		ID:          e.ID,
+		Date:        e.Date,
+		Duration:    e.Duration,
+		Failed:      e.Failed,
+		Skipped:     e.Skipped,
+		Output:      string(e.Output()),
+		ErrorOutput: string(e.ErrorOutput()),
+	}
+
+	if e.Error != nil {
+		r.Error = e.Error.Error()
+	}
+
+	return r
+}
+
+func (m *Save) saveLineToDisk(ctx *core.Context) error {
+	js, err := json.Marshal(newExecutionReport(ctx))
+	if err != nil {
+		return err
+	}
+
+	filename := filepath.Join(m.SaveFolder, fmt.Sprintf("%s.jsonl", ctx.Job.GetName()))
+	if m.SavePath != "" {
+		if filename, err = m.savePath(ctx); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.rotate(filename); err != nil {
+		return err
+	}
+
+	return appendToFile(filename, append(js, '\n'))
+}
+
+// saveLogToDisk appends the outputs of the execution, preceded by a line
+// with its date, its id and its status, to the file of SavePath
+func (m *Save) saveLogToDisk(ctx *core.Context) error {
+	filename, err := m.savePath(ctx)
+	if err != nil {
+		return err
+	}
+
+	e := ctx.Execution
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "=== %s %s %s: %s in %s",
+		e.Date.Format("2006-01-02 15:04:05"), ctx.Job.GetName(), e.ID,
+		executionLabel(e), e.Duration,
+	)
+
+	if e.Error != nil && !e.Skipped {
+		fmt.Fprintf(&b, " (%s)", e.Error)
+	}
+
+	b.WriteString("\n")
+	writeLogOutput(&b, e.Output())
+	if stderr := e.ErrorOutput(); len(stderr) != 0 {
+		b.WriteString("--- stderr\n")
+		writeLogOutput(&b, stderr)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return appendToFile(filename, b.Bytes())
+}
+
+// writeLogOutput writes the output ending with a new line
+func writeLogOutput(b *bytes.Buffer, output []byte) {
+	b.Write(output)
+	if len(output) != 0 && output[len(output)-1] != '\n' {
+		b.WriteByte('\n')
+	}
+}
+
+// savePathData is the data of the template of SavePath
+type savePathData struct {
+	// Job is the name of the job
+	Job string
+	// ID is the id of the execution
+	ID string
+	// Date and Time are the date, as 2006-01-02, and the time, as 150405,
+	// the execution started
+	Date string
+	Time string
+}
+
+// savePath renders the template of SavePath for the execution, the path is
+// relative to SaveFolder
+func (m *Save) savePath(ctx *core.Context) (string, error) {
+	if m.pathErr != nil {
+		return "", m.pathErr
+	}
+
+	e := ctx.Execution
+	data := &savePathData{
+		Job:  ctx.Job.GetName(),
+		ID:   e.ID,
+		Date: e.Date.Format("2006-01-02"),
+		Time: e.Date.Format("150405"),
+	}
+
+	var b strings.Builder
+	if err := m.path.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("error rendering save-path %q: %s", m.SavePath, err)
+	}
+
+	return filepath.Join(m.SaveFolder, b.String()), nil
+}
+
+// appendToFile appends data to the given file, creating it and its directory
+// if they don't exist
+func appendToFile(filename string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	_, err = f.Write(data)
+	return err
+}
+
+// rotate renames the given file, adding the current date to the name, if it
+// exceeds the maximum size or age.
+func (m *Save) rotate(filename string) error {
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	expired, err := m.isExpired(filename)
+	if err != nil {
+		return err
+	}
+
+	if !expired && (m.SaveMaxSize == 0 || info.Size() < m.SaveMaxSize) {
+		return nil
+	}
+
+	rotated := fmt.Sprintf("%s.%s.jsonl",
+		strings.TrimSuffix(filename, ".jsonl"), time.Now().Format("20060102_150405.000"),
+	)
+
+	if err := os.Rename(filename, rotated); err != nil {
+		return err
+	}
+
+	if !m.SaveCompress {
+		return nil
+	}
+
+	f, err := os.Open(rotated)
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(rotated)
+	defer f.Close()
+	return m.saveReaderToDisk(f, rotated)
+}
+
+// isExpired returns true if the first execution of the JSON lines file is
+// older than the maximum age.
+func (m *Save) isExpired(filename string) (bool, error) {
+	if m.SaveMaxAge == 0 {
+		return false, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+
+	defer f.Close()
+	js, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	var line executionReport
+	if err := json.Unmarshal(js, &line); err != nil {
+		return false, nil
+	}
+
+	return time.Since(line.Date) > m.SaveMaxAge, nil
+}
+
+// prune deletes the saved files older than the retention, including the ones
+// of the subdirectories created by SavePath. Only the files of the layout of
+// the format and SavePath are deleted, see savedFiles.
+func (m *Save) prune() error {
+	if m.SaveRetention == 0 {
+		return nil
+	}
+
+	limit := time.Now().Add(-m.SaveRetention)
+	return filepath.Walk(m.SaveFolder, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if f.IsDir() || !f.ModTime().Before(limit) || !m.isSavedFile(path) {
+			return nil
+		}
+
+		return os.Remove(path)
+	})
+}
+
+func (m *Save) isSavedFile(path string) bool {
+	rel, err := filepath.Rel(m.SaveFolder, path)
+	if err != nil {
+		return false
+	}
+
+	rel = filepath.ToSlash(rel)
+	for _, re := range m.layout {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// savePathPatterns are the patterns of the fields of savePathData, rendered
+// as placeholders to turn the template of SavePath into a pattern
+var savePathPatterns = map[string]string{
+	"\x00job\x00":  `[^/]+`,
+	"\x00id\x00":   `[0-9A-Z]+`,
+	"\x00date\x00": `\d{4}-\d{2}-\d{2}`,
+	"\x00time\x00": `\d{6}`,
+}
+
+// savedFiles returns the patterns of the paths, relative to SaveFolder, of the
+// files written by the middleware: the ones of the default layout of the
+// format, or the ones rendered by the template of SavePath, with the rotated
+// and compressed files. A template that can't be rendered as a pattern has no
+// files, so nothing is pruned.
+func (m *Save) savedFiles() []*regexp.Regexp {
+	const (
+		gz      = `(\.gz)?`
+		rotated = `\.\d{8}_\d{6}\.\d{3}\.jsonl` + gz
+	)
+
+	if m.path == nil {
+		if m.SaveFormat == saveFormatJSONL {
+			return []*regexp.Regexp{regexp.MustCompile(`^[^/]+(\.jsonl|` + rotated + `)$`)}
+		}
+
+		return []*regexp.Regexp{regexp.MustCompile(`^\d{8}_\d{6}_[^/]+\.(stdout\.log|stderr\.log|json)` + gz + `$`)}
+	}
+
+	var b strings.Builder
+	data := &savePathData{Job: "\x00job\x00", ID: "\x00id\x00", Date: "\x00date\x00", Time: "\x00time\x00"}
+	if err := m.path.Execute(&b, data); err != nil {
+		return nil
+	}
+
+	file := regexp.QuoteMeta(filepath.ToSlash(filepath.Clean(b.String())))
+	for placeholder, pattern := range savePathPatterns {
+		file = strings.Replace(file, placeholder, pattern, -1)
+	}
+
+	// the fields transformed by the template match any name
+	file = regexp.MustCompile(`\x00[a-z]*\x00?|[a-z]*\x00`).ReplaceAllLiteralString(file, `[^/]*`)
+	layout := []*regexp.Regexp{regexp.MustCompile("^" + file + "$")}
+	if m.SaveFormat == saveFormatJSONL {
+		file = strings.TrimSuffix(file, regexp.QuoteMeta(".jsonl"))
+		layout = append(layout, regexp.MustCompile("^"+file+rotated+"$"))
+	}
+
+	return layout
+}
@@ -1,6 +1,9 @@
 package middlewares
 
 import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -58,3 +61,276 @@ func (s *SuiteSave) TestRunSuccessOnError(c *C) {
 	_, err = os.Stat(filepath.Join(dir, "00010101_000000_foo.json"))
 	c.Assert(err, Not(IsNil))
 }
+
+func (s *SuiteSave) TestRunCompress(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "save")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte("bar"))
+	s.ctx.Stop(nil)
+
+	s.job.Name = "foo"
+	s.ctx.Execution.Date = time.Time{}
+
+	m := NewSave(&SaveConfig{SaveFolder: dir, SaveCompress: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	f, err := os.Open(filepath.Join(dir, "00010101_000000_foo.stdout.log.gz"))
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	c.Assert(err, IsNil)
+
+	output, err := ioutil.ReadAll(gz)
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, "bar")
+}
+
+func (s *SuiteSave) TestRunJSONL(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "save")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	m := NewSave(&SaveConfig{SaveFolder: dir, SaveFormat: "jsonl"})
+	for i := 0; i < 2; i++ {
+		s.SetUpTest(c)
+		s.job.Name = "foo"
+		s.ctx.Start()
+		s.ctx.Execution.OutputStream.Write([]byte("bar"))
+		s.ctx.Stop(nil)
+		c.Assert(m.Run(s.ctx), IsNil)
+	}
+
+	lines := s.readLines(c, filepath.Join(dir, "foo.jsonl"))
+	c.Assert(lines, HasLen, 2)
+	c.Assert(lines[0].Job, Equals, "foo")
+	c.Assert(lines[0].Output, Equals, "bar")
+}
+
+func (s *SuiteSave) TestRunJSONLRotate(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "save")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	m := NewSave(&SaveConfig{
+		SaveFolder:   dir,
+		SaveFormat:   "jsonl",
+		SaveMaxSize:  1,
+		SaveCompress: true,
+	})
+
+	for i := 0; i < 2; i++ {
+		s.SetUpTest(c)
+		s.job.Name = "foo"
+		s.ctx.Start()
+		s.ctx.Stop(nil)
+		c.Assert(m.Run(s.ctx), IsNil)
+	}
+
+	c.Assert(s.readLines(c, filepath.Join(dir, "foo.jsonl")), HasLen, 1)
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "foo.*.jsonl.gz"))
+	c.Assert(err, IsNil)
+	c.Assert(rotated, HasLen, 1)
+}
+
+func (s *SuiteSave) TestRunJSONLMaxAge(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "save")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	m := NewSave(&SaveConfig{SaveFolder: dir, SaveFormat: "jsonl", SaveMaxAge: time.Hour})
+	for _, date := range []time.Time{time.Now().Add(-2 * time.Hour), time.Now(), time.Now()} {
+		s.SetUpTest(c)
+		s.job.Name = "foo"
+		s.ctx.Start()
+		s.ctx.Stop(nil)
+		s.ctx.Execution.Date = date
+		c.Assert(m.Run(s.ctx), IsNil)
+	}
+
+	c.Assert(s.readLines(c, filepath.Join(dir, "foo.jsonl")), HasLen, 2)
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "foo.*.jsonl"))
+	c.Assert(err, IsNil)
+	c.Assert(rotated, HasLen, 1)
+}
+
+func (s *SuiteSave) TestRunPath(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "save")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	m := NewSave(&SaveConfig{SaveFolder: dir, SavePath: "{{.Job}}/{{.Date}}.log"})
+	for _, output := range []string{"bar", "baz\n"} {
+		s.SetUpTest(c)
+		s.job.Name = "foo"
+		s.ctx.Start()
+		s.ctx.Execution.OutputStream.Write([]byte(output))
+		s.ctx.Execution.ErrorStream.Write([]byte("qux"))
+		s.ctx.Stop(nil)
+		s.ctx.Execution.Date = time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+		s.ctx.Execution.Duration = time.Second
+		c.Assert(m.Run(s.ctx), IsNil)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "foo", "2020-05-01.log"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Matches, ""+
+		"=== 2020-05-01 10:00:00 foo [0-9A-Z]+: successful in 1s\n"+
+		"bar\n--- stderr\nqux\n"+
+		"=== 2020-05-01 10:00:00 foo [0-9A-Z]+: successful in 1s\n"+
+		"baz\n--- stderr\nqux\n",
+	)
+}
+
+func (s *SuiteSave) TestRunPathJSONL(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "save")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+	s.ctx.Execution.Date = time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	m := NewSave(&SaveConfig{SaveFolder: dir, SaveFormat: "jsonl", SavePath: "{{.Job}}/{{.Date}}.jsonl"})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	lines := s.readLines(c, filepath.Join(dir, "foo", "2020-05-01.jsonl"))
+	c.Assert(lines, HasLen, 1)
+	c.Assert(lines[0].Job, Equals, "foo")
+}
+
+func (s *SuiteSave) TestRunInvalidPath(c *C) {
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	config := &SaveConfig{SavePath: "{{.Job"}
+	c.Assert(config.Validate(), ErrorMatches, `invalid save-path "\{\{.Job": .*`)
+
+	m := NewSave(config).(*Save)
+	c.Assert(m.saveToDisk(s.ctx), ErrorMatches, `invalid save-path "\{\{.Job": .*`)
+
+	m = NewSave(&SaveConfig{SavePath: "{{.Foo}}"}).(*Save)
+	c.Assert(m.saveToDisk(s.ctx), ErrorMatches, `error rendering save-path "\{\{.Foo\}\}": .*`)
+}
+
+// writeOldFiles creates the given files, relative to dir, modified two hours
+// ago
+func (s *SuiteSave) writeOldFiles(c *C, dir string, names ...string) {
+	for _, name := range names {
+		name = filepath.Join(dir, name)
+		c.Assert(os.MkdirAll(filepath.Dir(name), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(name, nil, 0644), IsNil)
+		date := time.Now().Add(-2 * time.Hour)
+		c.Assert(os.Chtimes(name, date, date), IsNil)
+	}
+}
+
+// assertPruned asserts which of the given files, relative to dir, were deleted
+func (s *SuiteSave) assertPruned(c *C, dir string, files map[string]bool) {
+	for name, pruned := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		c.Assert(os.IsNotExist(err), Equals, pruned, Commentf("%s", name))
+	}
+}
+
+func (s *SuiteSave) TestRunRetention(c *C) {
+	dir := c.MkDir()
+	files := map[string]bool{
+		"20000101_000000_foo.json":          true,
+		"20000101_000000_foo.stdout.log.gz": true,
+		"foo/2000-01-01.log":                false,
+		"other.log":                         false,
+		"other.txt":                         false,
+	}
+
+	for name := range files {
+		s.writeOldFiles(c, dir, name)
+	}
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewSave(&SaveConfig{SaveFolder: dir, SaveRetention: time.Hour})
+	c.Assert(m.Run(s.ctx), IsNil)
+	s.assertPruned(c, dir, files)
+}
+
+func (s *SuiteSave) TestRunRetentionPath(c *C) {
+	dir := c.MkDir()
+	files := map[string]bool{
+		"foo/2000-01-01":                           true,
+		"bar/2000-01-01":                           true,
+		"foo/2000-01-01.txt":                       false,
+		"20000101_000000_foo.json":                 false,
+		"foo/bar/2000-01-01":                       false,
+		"foo/2000-01-01.20000101_000000.000.jsonl": false,
+	}
+
+	for name := range files {
+		s.writeOldFiles(c, dir, name)
+	}
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	// the files without extension of the template are pruned too
+	m := NewSave(&SaveConfig{SaveFolder: dir, SavePath: "{{.Job}}/{{.Date}}", SaveRetention: time.Hour})
+	c.Assert(m.Run(s.ctx), IsNil)
+	s.assertPruned(c, dir, files)
+}
+
+func (s *SuiteSave) TestRunRetentionPathJSONL(c *C) {
+	dir := c.MkDir()
+	files := map[string]bool{
+		"foo/2000-01-01.jsonl":                        true,
+		"foo/2000-01-01.20000101_000000.000.jsonl.gz": true,
+		"foo/2000-01-01.log":                          false,
+		"foo.jsonl":                                   false,
+	}
+
+	for name := range files {
+		s.writeOldFiles(c, dir, name)
+	}
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewSave(&SaveConfig{
+		SaveFolder: dir, SaveFormat: "jsonl", SavePath: "{{.Job}}/{{.Date}}.jsonl", SaveRetention: time.Hour,
+	})
+	c.Assert(m.Run(s.ctx), IsNil)
+	s.assertPruned(c, dir, files)
+}
+
+func (s *SuiteSave) TestRunInvalidFormat(c *C) {
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	config := &SaveConfig{SaveFormat: "foo"}
+	c.Assert(config.Validate(), ErrorMatches, `invalid save-format "foo": expected files or jsonl`)
+
+	m := NewSave(config).(*Save)
+	c.Assert(m.saveToDisk(s.ctx), ErrorMatches, `invalid save-format "foo"`)
+}
+
+func (s *SuiteSave) readLines(c *C, filename string) []*executionReport {
+	f, err := os.Open(filename)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	var lines []*executionReport
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var l executionReport
+		c.Assert(json.Unmarshal(scanner.Bytes(), &l), IsNil)
+		lines = append(lines, &l)
+	}
+
+	return lines
+}
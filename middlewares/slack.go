@@ -1,10 +1,12 @@
 package middlewares
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sync"
 
 	"github.com/mcuadros/ofelia/core"
 )
@@ -13,19 +15,27 @@ var (
 	slackUsername   = "Ofelia"
 	slackAvatarURL  = "https://raw.githubusercontent.com/mcuadros/ofelia/master/static/avatar.png"
 	slackPayloadVar = "payload"
+	slackAPIURL     = "https://slack.com/api/chat.postMessage"
+	slackOutputSize = 1000
 )
 
 // SlackConfig configuration for the Slack middleware
 type SlackConfig struct {
-	SlackWebhook     string `gcfg:"slack-webhook" mapstructure:"slack-webhook"`
-	SlackOnlyOnError bool   `gcfg:"slack-only-on-error" mapstructure:"slack-only-on-error"`
+	SlackWebhook     string `mapstructure:"slack-webhook"`
+	SlackOnlyOnError bool   `mapstructure:"slack-only-on-error"`
+	SlackNotifyOn    string `mapstructure:"slack-notify-on"`
+	// SlackToken and SlackChannel are used to post the messages with the Slack
+	// Web API instead of a webhook, this allows to thread the messages of the
+	// consecutive failures of a job.
+	SlackToken   string `mapstructure:"slack-token"`
+	SlackChannel string `mapstructure:"slack-channel"`
 }
 
 // NewSlack returns a Slack middleware if the given configuration is not empty
 func NewSlack(c *SlackConfig) core.Middleware {
 	var m core.Middleware
 	if !IsEmpty(c) {
-		m = &Slack{*c}
+		m = &Slack{SlackConfig: *c, threads: make(map[string]string)}
 	}
 
 	return m
@@ -34,6 +44,11 @@ func NewSlack(c *SlackConfig) core.Middleware {
 // Slack middleware calls to a Slack input-hook after every execution of a job
 type Slack struct {
 	SlackConfig
+
+	mu sync.Mutex
+	// threads contains the timestamp of the message starting the thread of
+	// every failing job, by job name
+	threads map[string]string
 }
 
 // ContinueOnStop return allways true, we want alloways report the final status
@@ -47,7 +62,8 @@ func (m *Slack) Run(ctx *core.Context) error {
 	err := ctx.Next()
 	ctx.Stop(err)
 
-	if ctx.Execution.Failed || !m.SlackOnlyOnError {
+	// the recovery of a failing job is notified in its thread
+	if shouldAlert(ctx, m.SlackNotifyOn, m.SlackOnlyOnError) || m.thread(ctx.Job.GetName()) != "" {
 		m.pushMessage(ctx)
 	}
 
@@ -55,8 +71,14 @@ func (m *Slack) Run(ctx *core.Context) error {
 }
 
 func (m *Slack) pushMessage(ctx *core.Context) {
+	msg := m.buildMessage(ctx)
+	if m.SlackToken != "" {
+		m.postMessage(ctx, msg)
+		return
+	}
+
 	values := make(url.Values, 0)
-	content, _ := json.Marshal(m.buildMessage(ctx))
+	content, _ := json.Marshal(msg)
 	values.Add(slackPayloadVar, string(content))
 
 	r, err := http.PostForm(m.SlackWebhook, values)
@@ -67,6 +89,55 @@ func (m *Slack) pushMessage(ctx *core.Context) {
 	}
 }
 
+// postMessage posts the message using the Slack Web API, the failures of a job
+// are posted in the thread started by its first failure, until it succeeds.
+func (m *Slack) postMessage(ctx *core.Context, msg *slackMessage) {
+	name := ctx.Job.GetName()
+	msg.Channel = m.SlackChannel
+	msg.ThreadTS = m.thread(name)
+
+	content, _ := json.Marshal(msg)
+	req, err := http.NewRequest(http.MethodPost, slackAPIURL, bytes.NewReader(content))
+	if err != nil {
+		ctx.Logger.Errorf("Slack error building request: %q", err)
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+m.SlackToken)
+
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ctx.Logger.Errorf("Slack error calling %q error: %q", slackAPIURL, err)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var resp slackResponse
+	if err := json.NewDecoder(r.Body).Decode(&resp); err != nil || !resp.OK {
+		ctx.Logger.Errorf("Slack error posting message to %q: %q", m.SlackChannel, resp.Error)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case ctx.Execution.Failed && msg.ThreadTS == "":
+		m.threads[name] = resp.TS
+	case !ctx.Execution.Failed && !ctx.Execution.Skipped:
+		delete(m.threads, name)
+	}
+}
+
+func (m *Slack) thread(job string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.threads[job]
+}
+
 func (m *Slack) buildMessage(ctx *core.Context) *slackMessage {
 	msg := &slackMessage{
 		Username: slackUsername,
@@ -78,28 +149,67 @@ func (m *Slack) buildMessage(ctx *core.Context) *slackMessage {
 		ctx.Job.GetName(), ctx.Execution.Duration, ctx.Job.GetCommand(),
 	)
 
+	fields := []slackField{
+		{Title: "Job", Value: ctx.Job.GetName(), Short: true},
+		{Title: "Duration", Value: ctx.Execution.Duration.String(), Short: true},
+		{Title: "Execution", Value: ctx.Execution.ID, Short: true},
+	}
+
 	if ctx.Execution.Failed {
+		if code, ok := exitCodeText(ctx.Execution); ok {
+			fields = append(fields, slackField{
+				Title: "Exit code", Value: code, Short: true,
+			})
+		}
+
+		if output := failureOutput(ctx.Execution); len(output) > 0 {
+			fields = append(fields, slackField{
+				Title: "Output", Value: fmt.Sprintf("```%s```", core.TailOutput(output, slackOutputSize)),
+			})
+		}
+
 		msg.Attachments = append(msg.Attachments, slackAttachment{
-			Title: "Execution failed",
-			Text:  ctx.Execution.Error.Error(),
-			Color: "#F35A00",
+			Title:  "Execution failed",
+			Text:   ctx.Execution.Error.Error(),
+			Color:  "#F35A00",
+			Fields: fields,
 		})
 	} else if ctx.Execution.Skipped {
 		msg.Attachments = append(msg.Attachments, slackAttachment{
-			Title: "Execution skipped",
-			Color: "#FFA500",
+			Title:  "Execution skipped",
+			Color:  "#FFA500",
+			Fields: fields,
 		})
 	} else {
+		color := "#7CD197"
+		if ctx.Execution.Slow {
+			color = "#FFA500"
+		}
+
 		msg.Attachments = append(msg.Attachments, slackAttachment{
-			Title: "Execution successful",
-			Color: "#7CD197",
+			Title:  fmt.Sprintf("Execution %s", statusLabel(ctx)),
+			Color:  color,
+			Fields: fields,
 		})
 	}
 
 	return msg
 }
 
+// failureOutput returns the error output of the execution, or the output if
+// the error output is empty
+func failureOutput(e *core.Execution) []byte {
+	output := e.ErrorOutput()
+	if len(output) == 0 {
+		output = e.Output()
+	}
+
+	return output
+}
+
 type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	ThreadTS    string            `json:"thread_ts,omitempty"`
 	Text        string            `json:"text"`
 	Username    string            `json:"username"`
 	Attachments []slackAttachment `json:"attachments"`
@@ -107,7 +217,20 @@ type slackMessage struct {
 }
 
 type slackAttachment struct {
-	Color string `json:"color,omitempty"`
-	Title string `json:"title,omitempty"`
-	Text  string `json:"text"`
+	Color  string       `json:"color,omitempty"`
+	Title  string       `json:"title,omitempty"`
+	Text   string       `json:"text"`
+	Fields []slackField `json:"fields,omitempty"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	TS    string `json:"ts"`
 }
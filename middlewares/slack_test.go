@@ -5,6 +5,9 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+
+	"github.com/mcuadros/ofelia/core"
 
 	. "gopkg.in/check.v1"
 )
@@ -64,3 +67,55 @@ func (s *SuiteSlack) TestRunSuccessOnError(c *C) {
 	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL, SlackOnlyOnError: true})
 	c.Assert(m.Run(s.ctx), IsNil)
 }
+
+func (s *SuiteSlack) TestRunFailedFields(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m slackMessage
+		json.Unmarshal([]byte(r.FormValue(slackPayloadVar)), &m)
+
+		fields := m.Attachments[0].Fields
+		c.Assert(fields, HasLen, 5)
+		c.Assert(fields[2], DeepEquals, slackField{Title: "Execution", Value: s.ctx.Execution.ID, Short: true})
+		c.Assert(fields[3], DeepEquals, slackField{Title: "Exit code", Value: "2", Short: true})
+		c.Assert(fields[4].Value, Equals, "```foo```")
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Execution.ErrorStream.Write([]byte("foo"))
+	s.ctx.Stop(&core.ExitCodeError{ExitCode: 2})
+
+	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
+
+func (s *SuiteSlack) TestRunThreads(c *C) {
+	var threads []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Authorization"), Equals, "Bearer foo")
+
+		var m slackMessage
+		json.NewDecoder(r.Body).Decode(&m)
+		c.Assert(m.Channel, Equals, "#bar")
+
+		threads = append(threads, m.ThreadTS)
+		json.NewEncoder(w).Encode(slackResponse{OK: true, TS: strconv.Itoa(len(threads))})
+	}))
+
+	defer ts.Close()
+	defer func(url string) { slackAPIURL = url }(slackAPIURL)
+	slackAPIURL = ts.URL
+
+	m := NewSlack(&SlackConfig{SlackToken: "foo", SlackChannel: "#bar", SlackOnlyOnError: true})
+	for _, err := range []error{errors.New("foo"), errors.New("foo"), nil, nil, errors.New("foo")} {
+		s.SetUpTest(c)
+		s.ctx.Start()
+		s.ctx.Stop(err)
+		c.Assert(m.Run(s.ctx), IsNil)
+	}
+
+	// the second failure and the recovery are threaded, the second success
+	// isn't notified and the last failure starts a new thread
+	c.Assert(threads, DeepEquals, []string{"", "1", "1", ""})
+}
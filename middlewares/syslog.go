@@ -0,0 +1,309 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/syslog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+var (
+	syslogOutputSize = 10000
+	syslogTimeout    = time.Second * 10
+	// journaldSocket is the socket of the native protocol of the journal
+	journaldSocket = "/run/systemd/journal/socket"
+)
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern": syslog.LOG_KERN, "user": syslog.LOG_USER, "mail": syslog.LOG_MAIL,
+	"daemon": syslog.LOG_DAEMON, "auth": syslog.LOG_AUTH, "syslog": syslog.LOG_SYSLOG,
+	"lpr": syslog.LOG_LPR, "news": syslog.LOG_NEWS, "uucp": syslog.LOG_UUCP,
+	"cron": syslog.LOG_CRON, "authpriv": syslog.LOG_AUTHPRIV, "ftp": syslog.LOG_FTP,
+	"local0": syslog.LOG_LOCAL0, "local1": syslog.LOG_LOCAL1, "local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3, "local4": syslog.LOG_LOCAL4, "local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6, "local7": syslog.LOG_LOCAL7,
+}
+
+// SyslogConfig configuration for the Syslog middleware
+type SyslogConfig struct {
+	// SyslogAddress is the syslog server, as `udp://host:port`,
+	// `tcp://host:port` or `unix:///dev/log`, or `journald` to write to the
+	// systemd journal, `journald:///path` for another socket.
+	SyslogAddress string `mapstructure:"syslog-address"`
+	// SyslogFacility is cron by default and SyslogTag, the identifier of
+	// the messages, ofelia
+	SyslogFacility    string `mapstructure:"syslog-facility"`
+	SyslogTag         string `mapstructure:"syslog-tag"`
+	SyslogOnlyOnError bool   `mapstructure:"syslog-only-on-error"`
+	SyslogNotifyOn    string `mapstructure:"syslog-notify-on"`
+}
+
+// Validate returns an error if the address or the facility is invalid
+func (c *SyslogConfig) Validate() error {
+	if IsEmpty(c) {
+		return nil
+	}
+
+	if _, err := c.priority(); err != nil {
+		return err
+	}
+
+	_, _, err := c.parseAddress()
+	return err
+}
+
+// NewSyslog returns a Syslog middleware if the given configuration is not
+// empty
+func NewSyslog(c *SyslogConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Syslog{*c}
+	}
+
+	return m
+}
+
+// Syslog middleware writes a summary of every execution of a job, followed by
+// the lines of its output, to syslog or to the systemd journal, the journal
+// gets the job, the execution and its status as structured fields too.
+type Syslog struct {
+	SyslogConfig
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *Syslog) ContinueOnStop() bool {
+	return true
+}
+
+// Run writes the execution to syslog
+func (m *Syslog) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if shouldNotify(ctx, m.SyslogNotifyOn, m.SyslogOnlyOnError) {
+		if err := m.send(ctx); err != nil {
+			ctx.Logger.Errorf("Syslog error writing to %q: %q", m.SyslogAddress, err)
+		}
+	}
+
+	return err
+}
+
+// syslogEntry is a message with its structured fields
+type syslogEntry struct {
+	severity syslog.Priority
+	message  string
+	fields   [][2]string
+}
+
+func (m *Syslog) send(ctx *core.Context) error {
+	facility, err := m.priority()
+	if err != nil {
+		return err
+	}
+
+	network, addr, err := m.parseAddress()
+	if err != nil {
+		return err
+	}
+
+	entries := m.buildEntries(ctx)
+	if network == "journald" {
+		return m.sendJournal(facility, addr, entries)
+	}
+
+	w, err := m.dial(facility, network, addr)
+	if err != nil {
+		return err
+	}
+
+	defer w.Close()
+	for _, entry := range entries {
+		if err := writeSyslog(w, entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeSyslog writes the message with the severity of the entry, log/syslog
+// terminates the messages of the stream connections with a new line
+func writeSyslog(w *syslog.Writer, entry *syslogEntry) error {
+	switch entry.severity {
+	case syslog.LOG_ERR:
+		return w.Err(entry.message)
+	case syslog.LOG_WARNING:
+		return w.Warning(entry.message)
+	default:
+		return w.Info(entry.message)
+	}
+}
+
+// sendJournal writes the entries to the journal with its native protocol,
+// not supported by log/syslog
+func (m *Syslog) sendJournal(facility syslog.Priority, addr string, entries []*syslogEntry) error {
+	conn, err := net.DialTimeout("unixgram", addr, syslogTimeout)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(syslogTimeout))
+
+	for _, entry := range entries {
+		if _, err := conn.Write(m.formatJournal(facility, entry)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// priority returns the facility of the messages, cron by default
+func (c *SyslogConfig) priority() (syslog.Priority, error) {
+	if c.SyslogFacility == "" {
+		return syslog.LOG_CRON, nil
+	}
+
+	facility, ok := syslogFacilities[c.SyslogFacility]
+	if !ok {
+		return 0, fmt.Errorf("invalid syslog-facility %q", c.SyslogFacility)
+	}
+
+	return facility, nil
+}
+
+func (m *Syslog) tag() string {
+	if m.SyslogTag == "" {
+		return "ofelia"
+	}
+
+	return m.SyslogTag
+}
+
+// parseAddress returns the network of the address: udp, tcp, unix or
+// journald, and the address to connect to
+func (c *SyslogConfig) parseAddress() (string, string, error) {
+	if c.SyslogAddress == "journald" {
+		return "journald", journaldSocket, nil
+	}
+
+	u, err := url.Parse(c.SyslogAddress)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid syslog-address %q: %s", c.SyslogAddress, err)
+	}
+
+	switch {
+	case (u.Scheme == "udp" || u.Scheme == "tcp") && u.Host != "":
+		return u.Scheme, u.Host, nil
+	case (u.Scheme == "unix" || u.Scheme == "journald") && u.Path != "":
+		return u.Scheme, u.Path, nil
+	default:
+		return "", "", fmt.Errorf("invalid syslog-address %q", c.SyslogAddress)
+	}
+}
+
+func (m *Syslog) dial(facility syslog.Priority, network, addr string) (*syslog.Writer, error) {
+	if network != "unix" {
+		return syslog.Dial(network, addr, facility, m.tag())
+	}
+
+	// the local sockets are usually datagram sockets, but not always
+	w, err := syslog.Dial("unixgram", addr, facility, m.tag())
+	if err != nil {
+		w, err = syslog.Dial("unix", addr, facility, m.tag())
+	}
+
+	return w, err
+}
+
+// buildEntries returns the summary of the execution followed by a message
+// per line of its output, the last syslogOutputSize bytes of it
+func (m *Syslog) buildEntries(ctx *core.Context) []*syslogEntry {
+	e := ctx.Execution
+	fields := [][2]string{
+		{"job", ctx.Job.GetName()},
+		{"execution_id", e.ID},
+	}
+
+	summary := &syslogEntry{
+		severity: syslog.LOG_INFO,
+		message: fmt.Sprintf(
+			"Job %q execution %s %s in %s", ctx.Job.GetName(), e.ID, statusLabel(ctx), e.Duration,
+		),
+		fields: append(fields, [][2]string{
+			{"status", statusLabel(ctx)},
+			{"duration", e.Duration.String()},
+			{"command", ctx.Job.GetCommand()},
+		}...),
+	}
+
+	switch {
+	case e.Failed:
+		summary.severity = syslog.LOG_ERR
+		summary.message += ": " + e.Error.Error()
+		if code, ok := exitCodeText(e); ok {
+			summary.fields = append(summary.fields, [2]string{"exit_code", code})
+		}
+	case e.Skipped, e.Warning, e.Slow:
+		summary.severity = syslog.LOG_WARNING
+	}
+
+	entries := []*syslogEntry{summary}
+	for _, output := range []struct {
+		stream   string
+		severity syslog.Priority
+		data     []byte
+	}{
+		{"stdout", syslog.LOG_INFO, e.Output()},
+		{"stderr", syslog.LOG_WARNING, e.ErrorOutput()},
+	} {
+		for _, line := range outputLines(output.data, syslogOutputSize) {
+			entries = append(entries, &syslogEntry{
+				severity: output.severity,
+				message:  line,
+				fields:   append(fields[:2:2], [2]string{"stream", output.stream}),
+			})
+		}
+	}
+
+	return entries
+}
+
+// formatJournal returns the message in the native protocol of the journal,
+// the fields are prefixed by OFELIA_ and uppercased
+func (m *Syslog) formatJournal(facility syslog.Priority, entry *syslogEntry) []byte {
+	fields := [][2]string{
+		{"MESSAGE", entry.message},
+		{"PRIORITY", strconv.Itoa(int(entry.severity))},
+		{"SYSLOG_FACILITY", strconv.Itoa(int(facility >> 3))},
+		{"SYSLOG_IDENTIFIER", m.tag()},
+	}
+
+	for _, f := range entry.fields {
+		fields = append(fields, [2]string{"OFELIA_" + strings.ToUpper(f[0]), f[1]})
+	}
+
+	var b bytes.Buffer
+	for _, f := range fields {
+		if !strings.Contains(f[1], "\n") {
+			b.WriteString(f[0] + "=" + f[1] + "\n")
+			continue
+		}
+
+		// the values with new lines are preceded by their size
+		b.WriteString(f[0] + "\n")
+		binary.Write(&b, binary.LittleEndian, uint64(len(f[1])))
+		b.WriteString(f[1] + "\n")
+	}
+
+	return b.Bytes()
+}
@@ -0,0 +1,212 @@
+package middlewares
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log/syslog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteSyslog struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteSyslog{})
+
+func (s *SuiteSyslog) TestNewSyslogEmpty(c *C) {
+	c.Assert(NewSyslog(&SyslogConfig{}), IsNil)
+}
+
+// readPackets reads the given number of datagrams of conn
+func (s *SuiteSyslog) readPackets(c *C, conn net.PacketConn, n int) []string {
+	conn.SetDeadline(time.Now().Add(time.Second * 5))
+
+	var packets []string
+	buf := make([]byte, 65536)
+	for i := 0; i < n; i++ {
+		size, _, err := conn.ReadFrom(buf)
+		c.Assert(err, IsNil)
+		packets = append(packets, string(buf[:size]))
+	}
+
+	return packets
+}
+
+func (s *SuiteSyslog) TestRunUDP(c *C) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	s.job.Name = "foo"
+	s.job.Command = `echo "foo"`
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte("bar\nbaz\n"))
+	s.ctx.Stop(&core.ExitCodeError{ExitCode: 2})
+
+	m := NewSyslog(&SyslogConfig{SyslogAddress: fmt.Sprintf("udp://%s", conn.LocalAddr())})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	id := s.ctx.Execution.ID
+	packets := s.readPackets(c, conn, 3)
+	c.Assert(packets[0], Matches, fmt.Sprintf(
+		`<75>\S+ \S+ ofelia\[\d+\]: Job "foo" execution %s failed in \S+: .*\n`, id,
+	))
+	c.Assert(packets[1], Matches, `<78>\S+ \S+ ofelia\[\d+\]: bar\n`)
+	c.Assert(packets[2], Matches, `<78>\S+ \S+ ofelia\[\d+\]: baz\n`)
+}
+
+// readStream returns the content written to the listener by the first
+// connection accepted
+func (s *SuiteSyslog) readStream(l net.Listener) <-chan string {
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+		content, _ := ioutil.ReadAll(conn)
+		received <- string(content)
+	}()
+
+	return received
+}
+
+func (s *SuiteSyslog) TestRunTCP(c *C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer l.Close()
+
+	received := s.readStream(l)
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewSyslog(&SyslogConfig{
+		SyslogAddress:  fmt.Sprintf("tcp://%s", l.Addr()),
+		SyslogFacility: "local0",
+		SyslogTag:      "cron",
+	})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	c.Assert(<-received, Matches, `<134>\S+ \S+ cron\[\d+\]: Job "foo" execution \S+ successful in \S+\n`)
+}
+
+func (s *SuiteSyslog) TestRunUnixStream(c *C) {
+	socket := filepath.Join(c.MkDir(), "log")
+	l, err := net.Listen("unix", socket)
+	c.Assert(err, IsNil)
+	defer l.Close()
+
+	received := s.readStream(l)
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte("bar\nbaz"))
+	s.ctx.Stop(nil)
+
+	m := NewSyslog(&SyslogConfig{SyslogAddress: "unix://" + socket})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	// every message is terminated by a new line, in the local format without
+	// the hostname
+	lines := strings.SplitAfter(<-received, "\n")
+	c.Assert(lines, HasLen, 4)
+	c.Assert(lines[0], Matches, `<78>\w+ +\d+ [\d:]+ ofelia\[\d+\]: Job "foo" execution \S+ successful in \S+\n`)
+	c.Assert(lines[1], Matches, `<78>.*: bar\n`)
+	c.Assert(lines[2], Matches, `<78>.*: baz\n`)
+	c.Assert(lines[3], Equals, "")
+}
+
+func (s *SuiteSyslog) TestRunJournald(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "syslog")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "journal.socket")
+	conn, err := net.ListenPacket("unixgram", socket)
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Execution.ErrorStream.Write([]byte("bar"))
+	s.ctx.Stop(nil)
+
+	m := NewSyslog(&SyslogConfig{SyslogAddress: "journald://" + socket})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	packets := s.readPackets(c, conn, 2)
+	c.Assert(packets[0], Matches, `MESSAGE=Job "foo" execution \S+ successful in \S+
+PRIORITY=6
+SYSLOG_FACILITY=9
+SYSLOG_IDENTIFIER=ofelia
+OFELIA_JOB=foo
+OFELIA_EXECUTION_ID=\S+
+OFELIA_STATUS=successful
+(.|\n)*`)
+	c.Assert(packets[1], Matches, `MESSAGE=bar
+PRIORITY=4
+(.|\n)*OFELIA_STREAM=stderr
+`)
+}
+
+func (s *SuiteSyslog) TestBuildEntriesSlow(c *C) {
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+	s.ctx.Execution.Slow = true
+
+	entries := (&Syslog{}).buildEntries(s.ctx)
+	c.Assert(entries[0].severity, Equals, syslog.LOG_WARNING)
+}
+
+func (s *SuiteSyslog) TestFormatJournalMultiline(c *C) {
+	m := &Syslog{}
+	msg := m.formatJournal(syslog.LOG_CRON, &syslogEntry{severity: syslog.LOG_ERR, message: "foo\nbar"})
+
+	r := bufio.NewReader(strings.NewReader(string(msg)))
+	line, _ := r.ReadString('\n')
+	c.Assert(line, Equals, "MESSAGE\n")
+
+	size := make([]byte, 8)
+	r.Read(size)
+	c.Assert(size, DeepEquals, []byte{7, 0, 0, 0, 0, 0, 0, 0})
+
+	value, _ := r.ReadString('\n')
+	c.Assert(value, Equals, "foo\n")
+	value, _ = r.ReadString('\n')
+	c.Assert(value, Equals, "bar\n")
+}
+
+func (s *SuiteSyslog) TestRunInvalidConfig(c *C) {
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := &Syslog{SyslogConfig{SyslogAddress: "foo://bar"}}
+	c.Assert(m.send(s.ctx), ErrorMatches, `invalid syslog-address "foo://bar"`)
+
+	m = &Syslog{SyslogConfig{SyslogAddress: "udp://127.0.0.1:514", SyslogFacility: "foo"}}
+	c.Assert(m.send(s.ctx), ErrorMatches, `invalid syslog-facility "foo"`)
+}
+
+func (s *SuiteSyslog) TestValidate(c *C) {
+	c.Assert((&SyslogConfig{}).Validate(), IsNil)
+	c.Assert((&SyslogConfig{SyslogAddress: "journald"}).Validate(), IsNil)
+	c.Assert((&SyslogConfig{SyslogAddress: "unix:///dev/log", SyslogFacility: "local0"}).Validate(), IsNil)
+
+	err := (&SyslogConfig{SyslogAddress: "udp://"}).Validate()
+	c.Assert(err, ErrorMatches, `invalid syslog-address "udp://"`)
+
+	err = (&SyslogConfig{SyslogAddress: "journald", SyslogFacility: "foo"}).Validate()
+	c.Assert(err, ErrorMatches, `invalid syslog-facility "foo"`)
+}
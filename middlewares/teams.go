@@ -0,0 +1,139 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+var (
+	teamsOutputSize = 1000
+	teamsTimeout    = time.Second * 10
+)
+
+// TeamsConfig configuration for the Microsoft Teams middleware
+type TeamsConfig struct {
+	TeamsWebhook     string `mapstructure:"teams-webhook"`
+	TeamsOnlyOnError bool   `mapstructure:"teams-only-on-error"`
+	TeamsNotifyOn    string `mapstructure:"teams-notify-on"`
+}
+
+// NewTeams returns a Teams middleware if the given configuration is not empty
+func NewTeams(c *TeamsConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Teams{*c}
+	}
+
+	return m
+}
+
+// Teams middleware posts a MessageCard to a Microsoft Teams incoming webhook
+// after every execution of a job
+type Teams struct {
+	TeamsConfig
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *Teams) ContinueOnStop() bool {
+	return true
+}
+
+// Run sends a message to the Teams channel
+func (m *Teams) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if shouldAlert(ctx, m.TeamsNotifyOn, m.TeamsOnlyOnError) {
+		if err := m.pushMessage(ctx); err != nil {
+			ctx.Logger.Errorf("Teams error calling %q: %q", m.TeamsWebhook, err)
+		}
+	}
+
+	return err
+}
+
+func (m *Teams) pushMessage(ctx *core.Context) error {
+	content, err := json.Marshal(m.buildMessage(ctx))
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: teamsTimeout}
+	r, err := client.Post(m.TeamsWebhook, "application/json", bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return fmt.Errorf("non-2xx status code %d", r.StatusCode)
+	}
+
+	return nil
+}
+
+func (m *Teams) buildMessage(ctx *core.Context) *teamsMessage {
+	e := ctx.Execution
+	status := statusLabel(ctx)
+	section := teamsSection{
+		ActivityTitle: fmt.Sprintf("Command `%s`", ctx.Job.GetCommand()),
+		Facts: []teamsFact{
+			{Name: "Job", Value: ctx.Job.GetName()},
+			{Name: "Duration", Value: e.Duration.String()},
+			{Name: "Execution", Value: e.ID},
+		},
+	}
+
+	color := "7CD197"
+	switch {
+	case e.Failed:
+		color = "F35A00"
+		section.Facts = append(section.Facts, teamsFact{Name: "Error", Value: e.Error.Error()})
+		if code, ok := exitCodeText(e); ok {
+			section.Facts = append(section.Facts, teamsFact{
+				Name: "Exit code", Value: code,
+			})
+		}
+
+		if output := failureOutput(e); len(output) > 0 {
+			section.Text = fmt.Sprintf("<pre>%s</pre>", core.TailOutput(output, teamsOutputSize))
+		}
+	case e.Skipped, e.Slow:
+		color = "FFA500"
+	}
+
+	title := fmt.Sprintf("Execution %s of job %s", status, ctx.Job.GetName())
+	return &teamsMessage{
+		Type:       "MessageCard",
+		Context:    "http://schema.org/extensions",
+		ThemeColor: color,
+		Summary:    title,
+		Title:      title,
+		Sections:   []teamsSection{section},
+	}
+}
+
+type teamsMessage struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	ThemeColor string         `json:"themeColor"`
+	Summary    string         `json:"summary"`
+	Title      string         `json:"title"`
+	Sections   []teamsSection `json:"sections"`
+}
+
+type teamsSection struct {
+	ActivityTitle string      `json:"activityTitle"`
+	Facts         []teamsFact `json:"facts"`
+	Text          string      `json:"text,omitempty"`
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
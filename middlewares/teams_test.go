@@ -0,0 +1,73 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/mcuadros/ofelia/core"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteTeams struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteTeams{})
+
+func (s *SuiteTeams) TestNewTeamsEmpty(c *C) {
+	c.Assert(NewTeams(&TeamsConfig{}), IsNil)
+}
+
+func (s *SuiteTeams) TestRunSuccess(c *C) {
+	var m teamsMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&m)
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	c.Assert(NewTeams(&TeamsConfig{TeamsWebhook: ts.URL}).Run(s.ctx), IsNil)
+	c.Assert(m.Type, Equals, "MessageCard")
+	c.Assert(m.Title, Equals, "Execution successful of job foo")
+	c.Assert(m.ThemeColor, Equals, "7CD197")
+	c.Assert(m.Sections[0].Facts, HasLen, 3)
+	c.Assert(m.Sections[0].Facts[2], DeepEquals, teamsFact{Name: "Execution", Value: s.ctx.Execution.ID})
+}
+
+func (s *SuiteTeams) TestRunFailed(c *C) {
+	var m teamsMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&m)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Execution.ErrorStream.Write([]byte("bar"))
+	s.ctx.Stop(&core.ExitCodeError{ExitCode: 2})
+
+	c.Assert(NewTeams(&TeamsConfig{TeamsWebhook: ts.URL}).Run(s.ctx), IsNil)
+	c.Assert(m.ThemeColor, Equals, "F35A00")
+	c.Assert(m.Sections[0].Facts[3], DeepEquals, teamsFact{Name: "Error", Value: "error non-zero exit code: 2"})
+	c.Assert(m.Sections[0].Facts[4], DeepEquals, teamsFact{Name: "Exit code", Value: "2"})
+	c.Assert(m.Sections[0].Text, Equals, "<pre>bar</pre>")
+}
+
+func (s *SuiteTeams) TestRunSuccessOnError(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(true, Equals, false)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewTeams(&TeamsConfig{TeamsWebhook: ts.URL, TeamsOnlyOnError: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
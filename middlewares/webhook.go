@@ -0,0 +1,169 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+var (
+	webhookSignatureHeader = "X-Ofelia-Signature"
+	webhookOutputSize      = 4096
+	webhookTimeout         = time.Second * 10
+)
+
+// WebhookConfig configuration for the Webhook middleware
+type WebhookConfig struct {
+	WebhookURL    string `mapstructure:"webhook-url"`
+	WebhookMethod string `mapstructure:"webhook-method"`
+	// WebhookHeader are the extra headers of the request, as `Name: value`
+	WebhookHeader []string `mapstructure:"webhook-header"`
+	// WebhookSecret is the key used to sign the payload with HMAC-SHA256, the
+	// signature is sent in the X-Ofelia-Signature header as `sha256=<hex>`
+	WebhookSecret      string `mapstructure:"webhook-secret"`
+	WebhookOnlyOnError bool   `mapstructure:"webhook-only-on-error"`
+	WebhookNotifyOn    string `mapstructure:"webhook-notify-on"`
+}
+
+// NewWebhook returns a Webhook middleware if the given configuration is not
+// empty
+func NewWebhook(c *WebhookConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Webhook{*c}
+	}
+
+	return m
+}
+
+// Webhook middleware sends a JSON payload to an URL after every execution of
+// a job
+type Webhook struct {
+	WebhookConfig
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *Webhook) ContinueOnStop() bool {
+	return true
+}
+
+// Run sends the result of the execution to the webhook
+func (m *Webhook) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if shouldAlert(ctx, m.WebhookNotifyOn, m.WebhookOnlyOnError) {
+		if err := m.pushMessage(ctx); err != nil {
+			ctx.Logger.Errorf("Webhook error calling %q: %q", m.WebhookURL, err)
+		}
+	}
+
+	return err
+}
+
+func (m *Webhook) pushMessage(ctx *core.Context) error {
+	content, err := json.Marshal(m.buildPayload(ctx))
+	if err != nil {
+		return err
+	}
+
+	method := m.WebhookMethod
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(method), m.WebhookURL, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for _, h := range m.WebhookHeader {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid header %q", h)
+		}
+
+		req.Header.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	if m.WebhookSecret != "" {
+		req.Header.Set(webhookSignatureHeader, "sha256="+sign(content, m.WebhookSecret))
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	r, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return fmt.Errorf("non-2xx status code %d", r.StatusCode)
+	}
+
+	return nil
+}
+
+func (m *Webhook) buildPayload(ctx *core.Context) *webhookPayload {
+	e := ctx.Execution
+	p := &webhookPayload{
+		Job:         ctx.Job.GetName(),
+		Command:     ctx.Job.GetCommand(),
+		Execution:   e.ID,
+		Date:        e.Date,
+		Duration:    e.Duration.Seconds(),
+		Output:      core.TailOutput(e.Output(), webhookOutputSize),
+		ErrorOutput: core.TailOutput(e.ErrorOutput(), webhookOutputSize),
+	}
+
+	switch {
+	case e.Failed:
+		p.Status = "failed"
+		p.Error = e.Error.Error()
+		if err, ok := e.Error.(*core.ExitCodeError); ok {
+			p.ExitCode = &err.ExitCode
+		}
+
+		p.Reason = e.Container.Reason()
+	case e.Skipped:
+		p.Status = "skipped"
+	default:
+		p.Status = "successful"
+		p.Recovered = isRecovery(ctx)
+		p.Slow = e.Slow
+	}
+
+	return p
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the content
+func sign(content []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type webhookPayload struct {
+	Job         string    `json:"job"`
+	Command     string    `json:"command"`
+	Execution   string    `json:"execution"`
+	Status      string    `json:"status"`
+	Recovered   bool      `json:"recovered,omitempty"`
+	Slow        bool      `json:"slow,omitempty"`
+	Date        time.Time `json:"date"`
+	Duration    float64   `json:"duration"`
+	Error       string    `json:"error,omitempty"`
+	ExitCode    *int      `json:"exit_code,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Output      string    `json:"output"`
+	ErrorOutput string    `json:"error_output"`
+}
@@ -0,0 +1,96 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/mcuadros/ofelia/core"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteWebhook struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteWebhook{})
+
+func (s *SuiteWebhook) TestNewWebhookEmpty(c *C) {
+	c.Assert(NewWebhook(&WebhookConfig{}), IsNil)
+}
+
+func (s *SuiteWebhook) TestRunSuccess(c *C) {
+	var called bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		c.Assert(r.Method, Equals, http.MethodPost)
+		c.Assert(r.Header.Get("Content-Type"), Equals, "application/json")
+
+		var p webhookPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		c.Assert(p.Job, Equals, "foo")
+		c.Assert(p.Status, Equals, "successful")
+		c.Assert(p.Output, Equals, "bar")
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte("bar"))
+	s.ctx.Stop(nil)
+
+	m := NewWebhook(&WebhookConfig{WebhookURL: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(called, Equals, true)
+}
+
+func (s *SuiteWebhook) TestRunFailed(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, Equals, http.MethodPut)
+		c.Assert(r.Header.Get("Authorization"), Equals, "Bearer foo")
+
+		body, _ := ioutil.ReadAll(r.Body)
+		c.Assert(r.Header.Get(webhookSignatureHeader), Equals, "sha256="+sign(body, "secret"))
+
+		var p webhookPayload
+		json.Unmarshal(body, &p)
+		c.Assert(p.Status, Equals, "failed")
+		c.Assert(p.Error, Equals, "error non-zero exit code: 2")
+		c.Assert(*p.ExitCode, Equals, 2)
+		c.Assert(p.Reason, Equals, "killed by OOM")
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Execution.Container = &core.ContainerState{ExitCode: 2, OOMKilled: true}
+	s.ctx.Stop(&core.ExitCodeError{ExitCode: 2})
+
+	m := NewWebhook(&WebhookConfig{
+		WebhookURL:    ts.URL,
+		WebhookMethod: "put",
+		WebhookHeader: []string{"Authorization: Bearer foo"},
+		WebhookSecret: "secret",
+	})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
+
+func (s *SuiteWebhook) TestRunSuccessOnError(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(true, Equals, false)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewWebhook(&WebhookConfig{WebhookURL: ts.URL, WebhookOnlyOnError: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
+
+func (s *SuiteWebhook) TestSign(c *C) {
+	c.Assert(sign([]byte("foo"), "bar"), Equals, "147933218aaabc0b8b10a2b3a5c34684c8d94341bcf10a4736dc7270f7741851")
+}
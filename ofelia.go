@@ -6,6 +6,7 @@ import (
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mcuadros/ofelia/cli"
+	"github.com/mcuadros/ofelia/core"
 )
 
 var version string
@@ -15,6 +16,14 @@ func main() {
 	parser := flags.NewNamedParser("ofelia", flags.Default)
 	parser.AddCommand("daemon", "daemon process", "", &cli.DaemonCommand{})
 	parser.AddCommand("validate", "validates the config file", "", &cli.ValidateCommand{})
+	parser.AddCommand("run", "runs a job once", "", &cli.RunCommand{})
+	parser.AddCommand("next", "prints the next run times of the jobs", "", &cli.NextCommand{})
+
+	jobs, _ := parser.AddCommand("jobs", "manages the jobs of the running daemon", "", &struct{}{})
+	jobs.AddCommand("list", "lists the jobs", "", &cli.JobsListCommand{})
+	jobs.AddCommand("run", "runs a job immediately", "", &cli.JobsRunCommand{})
+	jobs.AddCommand("pause", "pauses or resumes a job", "", &cli.JobsPauseCommand{})
+	jobs.AddCommand("logs", "prints the output of the last execution of a job", "", &cli.JobsLogsCommand{})
 
 	if _, err := parser.Parse(); err != nil {
 		if _, ok := err.(*flags.Error); ok {
@@ -22,6 +31,10 @@ func main() {
 			fmt.Printf("\nBuild information\n  commit: %s\n  date:%s\n", version, build)
 		}
 
+		if err, ok := err.(*core.ExitCodeError); ok {
+			os.Exit(err.ExitCode)
+		}
+
 		os.Exit(1)
 	}
 }
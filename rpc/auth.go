@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/mcuadros/ofelia/web"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// methodScopes are the scopes required by the methods of the service, the
+// same as the ones of the matching requests of the HTTP API
+var methodScopes = map[string]web.Scope{
+	"/ofelia.Ofelia/ListJobs":   web.ScopeRead,
+	"/ofelia.Ofelia/StreamLogs": web.ScopeRead,
+	"/ofelia.Ofelia/RunJob":     web.ScopeTrigger,
+	"/ofelia.Ofelia/PauseJob":   web.ScopeAdmin,
+	"/ofelia.Ofelia/ResumeJob":  web.ScopeAdmin,
+}
+
+func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (s *Server) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+
+	return handler(srv, ss)
+}
+
+// authorize returns an error if the `authorization` metadata of the call,
+// a bearer token or basic auth credentials as the Authorization header of the
+// HTTP API, isn't valid or doesn't grant the scope required by the method.
+// The unknown methods require ScopeAdmin.
+func (s *Server) authorize(ctx context.Context, method string) error {
+	var h string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) != 0 {
+			h = v[0]
+		}
+	}
+
+	scope, ok := s.Auth.Authenticate(h)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	required, ok := methodScopes[method]
+	if !ok {
+		required = web.ScopeAdmin
+	}
+
+	if scope < required {
+		return status.Error(codes.PermissionDenied, "forbidden")
+	}
+
+	return nil
+}
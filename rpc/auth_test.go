@@ -0,0 +1,86 @@
+package rpc
+
+import (
+	"context"
+	"net"
+
+	"github.com/mcuadros/ofelia/core"
+	"github.com/mcuadros/ofelia/web"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteAuth struct {
+	server *Server
+	conn   *grpc.ClientConn
+	client OfeliaClient
+}
+
+var _ = Suite(&SuiteAuth{})
+
+func (s *SuiteAuth) SetUpTest(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+
+	sc := core.NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	s.server = NewServer(l.Addr().String(), sc)
+	s.server.Auth = web.Auth{Tokens: []web.Token{
+		{Value: "r34d", Scope: web.ScopeRead},
+		{Value: "tr1gg3r", Scope: web.ScopeTrigger},
+		{Value: "4dm1n", Scope: web.ScopeAdmin},
+	}}
+	go s.server.Serve(l)
+
+	s.conn, err = grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	c.Assert(err, IsNil)
+	s.client = NewOfeliaClient(s.conn)
+}
+
+func (s *SuiteAuth) TearDownTest(c *C) {
+	s.conn.Close()
+	c.Assert(s.server.Shutdown(context.Background()), IsNil)
+}
+
+func (s *SuiteAuth) TestUnauthenticated(c *C) {
+	_, err := s.client.ListJobs(context.Background(), &ListJobsRequest{})
+	c.Assert(status.Code(err), Equals, codes.Unauthenticated)
+
+	_, err = s.client.ListJobs(withToken("foo"), &ListJobsRequest{})
+	c.Assert(status.Code(err), Equals, codes.Unauthenticated)
+
+	stream, err := s.client.StreamLogs(context.Background(), &StreamLogsRequest{Name: "foo"})
+	c.Assert(err, IsNil)
+	_, err = stream.Recv()
+	c.Assert(status.Code(err), Equals, codes.Unauthenticated)
+}
+
+func (s *SuiteAuth) TestScopes(c *C) {
+	_, err := s.client.ListJobs(withToken("r34d"), &ListJobsRequest{})
+	c.Assert(err, IsNil)
+
+	_, err = s.client.RunJob(withToken("r34d"), &RunJobRequest{Name: "foo"})
+	c.Assert(status.Code(err), Equals, codes.PermissionDenied)
+
+	_, err = s.client.PauseJob(withToken("tr1gg3r"), &PauseJobRequest{Name: "foo"})
+	c.Assert(status.Code(err), Equals, codes.PermissionDenied)
+
+	_, err = s.client.PauseJob(withToken("4dm1n"), &PauseJobRequest{Name: "foo"})
+	c.Assert(err, IsNil)
+
+	_, err = s.client.RunJob(withToken("tr1gg3r"), &RunJobRequest{Name: "foo"})
+	c.Assert(err, IsNil)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
@@ -0,0 +1,234 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/mcuadros/ofelia/core"
+	"github.com/mcuadros/ofelia/web"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. ofelia.proto
+
+// Server is a gRPC server exposing the Ofelia service to control the jobs of a
+// scheduler programmatically
+type Server struct {
+	Addr      string
+	Scheduler *core.Scheduler
+	// Auth are the credentials required by the calls, with the same scopes
+	// as the HTTP API, sent as the `authorization` metadata, see authorize
+	Auth web.Auth
+	// TLSCert and TLSKey are the files of the certificate and its key, the
+	// server is served over TLS by Start if they're set
+	TLSCert string
+	TLSKey  string
+
+	server *grpc.Server
+}
+
+// NewServer returns a new Server listening on the given address
+func NewServer(addr string, s *core.Scheduler) *Server {
+	srv := &Server{
+		Addr:      addr,
+		Scheduler: s,
+	}
+
+	srv.server = grpc.NewServer(
+		grpc.UnaryInterceptor(srv.unaryInterceptor),
+		grpc.StreamInterceptor(srv.streamInterceptor),
+	)
+
+	RegisterOfeliaServer(srv.server, srv)
+	return srv
+}
+
+// Start starts listening on the server address, it blocks until the server is
+// shutdown
+func (s *Server) Start() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	if s.TLSCert != "" || s.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(s.TLSCert, s.TLSKey)
+		if err != nil {
+			l.Close()
+			return err
+		}
+
+		l = tls.NewListener(l, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"h2"},
+		})
+	}
+
+	return s.Serve(l)
+}
+
+// Serve serves the requests of the given listener, it blocks until the server
+// is shutdown
+func (s *Server) Serve(l net.Listener) error {
+	if err := s.server.Serve(l); err != grpc.ErrServerStopped {
+		return err
+	}
+
+	return nil
+}
+
+// Shutdown gracefully stops the server, the streams still open when the
+// context is done are closed
+func (s *Server) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
+
+// ListJobs implements OfeliaServer
+func (s *Server) ListJobs(ctx context.Context, in *ListJobsRequest) (*ListJobsResponse, error) {
+	all := s.Scheduler.GetJobs()
+	jobs := make([]*Job, 0, len(all))
+	for _, j := range all {
+		jobs = append(jobs, s.newJob(j))
+	}
+
+	return &ListJobsResponse{Jobs: jobs}, nil
+}
+
+// RunJob implements OfeliaServer
+func (s *Server) RunJob(ctx context.Context, in *RunJobRequest) (*Job, error) {
+	j, err := s.getJob(in.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	p := core.RunParams{Args: in.Args, Env: in.Env}
+	if err := p.Validate(j); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := s.Scheduler.RunJobWithParams(j.GetName(), p); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return s.newJob(j), nil
+}
+
+// PauseJob implements OfeliaServer
+func (s *Server) PauseJob(ctx context.Context, in *PauseJobRequest) (*Job, error) {
+	j, err := s.getJob(in.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Scheduler.PauseJob(j.GetName()); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return s.newJob(j), nil
+}
+
+// ResumeJob implements OfeliaServer
+func (s *Server) ResumeJob(ctx context.Context, in *ResumeJobRequest) (*Job, error) {
+	j, err := s.getJob(in.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Scheduler.ResumeJob(j.GetName()); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return s.newJob(j), nil
+}
+
+// StreamLogs implements OfeliaServer, the output of the execution is sent
+// first, followed by its error output, and then with follow, the chunks
+// written until it finishes, failing with ResourceExhausted if they aren't read
+// in time
+func (s *Server) StreamLogs(in *StreamLogsRequest, stream Ofelia_StreamLogsServer) error {
+	j, err := s.getJob(in.Name)
+	if err != nil {
+		return err
+	}
+
+	history := j.History()
+	if len(history) == 0 {
+		return status.Errorf(codes.FailedPrecondition, "job %q has no executions", in.Name)
+	}
+
+	e := history[len(history)-1]
+	output, errorOutput, chunks, stop := e.Follow()
+	defer stop()
+
+	for _, c := range []*LogChunk{
+		{ExecutionId: e.ID, Data: output},
+		{ExecutionId: e.ID, Stderr: true, Data: errorOutput},
+	} {
+		if len(c.Data) == 0 {
+			continue
+		}
+
+		if err := stream.Send(c); err != nil {
+			return err
+		}
+	}
+
+	// the channel is nil if the execution already finished
+	if !in.Follow || chunks == nil {
+		return nil
+	}
+
+	for {
+		select {
+		case c, ok := <-chunks:
+			if !ok {
+				return nil
+			}
+
+			if c.Dropped {
+				return status.Error(codes.ResourceExhausted, "the output wasn't read in time")
+			}
+
+			if err := stream.Send(&LogChunk{ExecutionId: e.ID, Stderr: c.Stderr, Data: c.Data}); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+func (s *Server) getJob(name string) (core.Job, error) {
+	j := s.Scheduler.GetJob(name)
+	if j == nil {
+		return nil, status.Error(codes.NotFound, core.ErrJobNotFound.Error())
+	}
+
+	return j, nil
+}
+
+func (s *Server) newJob(j core.Job) *Job {
+	return &Job{
+		Name:     j.GetName(),
+		Schedule: j.GetSchedule(),
+		Command:  j.GetCommand(),
+		Tags:     j.GetTags(),
+		Running:  j.Running(),
+		Paused:   s.Scheduler.IsPaused(j.GetName()),
+	}
+}
@@ -0,0 +1,166 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type SuiteServer struct {
+	scheduler *core.Scheduler
+	job       *TestJob
+	server    *Server
+	conn      *grpc.ClientConn
+	client    OfeliaClient
+}
+
+var _ = Suite(&SuiteServer{})
+
+func (s *SuiteServer) SetUpTest(c *C) {
+	s.job = &TestJob{}
+	s.job.Name = "foo"
+	s.job.Schedule = "@hourly"
+	s.job.Command = "echo foo"
+	s.job.Tags = core.Tags{"db"}
+
+	s.scheduler = core.NewScheduler(&TestLogger{})
+	c.Assert(s.scheduler.AddJob(s.job), IsNil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	s.server = NewServer(l.Addr().String(), s.scheduler)
+	go s.server.Serve(l)
+
+	s.conn, err = grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	c.Assert(err, IsNil)
+	s.client = NewOfeliaClient(s.conn)
+}
+
+func (s *SuiteServer) TearDownTest(c *C) {
+	s.conn.Close()
+	c.Assert(s.server.Shutdown(context.Background()), IsNil)
+}
+
+func (s *SuiteServer) TestListJobs(c *C) {
+	resp, err := s.client.ListJobs(context.Background(), &ListJobsRequest{})
+	c.Assert(err, IsNil)
+	c.Assert(resp.Jobs, DeepEquals, []*Job{{
+		Name:     "foo",
+		Schedule: "@hourly",
+		Command:  "echo foo",
+		Tags:     []string{"db"},
+	}})
+}
+
+func (s *SuiteServer) TestRunJobAndStreamLogs(c *C) {
+	job, err := s.client.RunJob(context.Background(), &RunJobRequest{Name: "foo"})
+	c.Assert(err, IsNil)
+	c.Assert(job.Name, Equals, "foo")
+
+	time.Sleep(time.Millisecond * 50)
+	stream, err := s.client.StreamLogs(context.Background(), &StreamLogsRequest{Name: "foo", Follow: true})
+	c.Assert(err, IsNil)
+
+	id := s.job.History()[0].ID
+	var chunks []*LogChunk
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+
+		c.Assert(err, IsNil)
+		chunks = append(chunks, chunk)
+	}
+
+	c.Assert(chunks, DeepEquals, []*LogChunk{
+		{ExecutionId: id, Data: []byte("foo\n")},
+		{ExecutionId: id, Stderr: true, Data: []byte("bar\n")},
+		{ExecutionId: id, Data: []byte("baz\n")},
+	})
+}
+
+func (s *SuiteServer) TestRunJobWithParams(c *C) {
+	s.job.AllowEnv = []string{"TARGET"}
+	s.job.AllowArgs = true
+
+	_, err := s.client.RunJob(context.Background(), &RunJobRequest{
+		Name: "foo",
+		Args: []string{"--force"},
+		Env:  []string{"TARGET=production"},
+	})
+	c.Assert(err, IsNil)
+
+	time.Sleep(time.Millisecond * 50)
+	e := s.job.History()[0]
+	c.Assert(e.Args, DeepEquals, []string{"--force"})
+	c.Assert(e.Environment, DeepEquals, []string{"TARGET=production"})
+
+	_, err = s.client.RunJob(context.Background(), &RunJobRequest{Name: "foo", Env: []string{"TARGET"}})
+	c.Assert(status.Code(err), Equals, codes.InvalidArgument)
+
+	_, err = s.client.RunJob(context.Background(), &RunJobRequest{Name: "foo", Env: []string{"PATH=/tmp"}})
+	c.Assert(status.Code(err), Equals, codes.InvalidArgument)
+}
+
+func (s *SuiteServer) TestStreamLogsWithoutExecutions(c *C) {
+	stream, err := s.client.StreamLogs(context.Background(), &StreamLogsRequest{Name: "foo"})
+	c.Assert(err, IsNil)
+
+	_, err = stream.Recv()
+	c.Assert(status.Code(err), Equals, codes.FailedPrecondition)
+}
+
+func (s *SuiteServer) TestPauseAndResumeJob(c *C) {
+	job, err := s.client.PauseJob(context.Background(), &PauseJobRequest{Name: "foo"})
+	c.Assert(err, IsNil)
+	c.Assert(job.Paused, Equals, true)
+	c.Assert(s.scheduler.IsPaused("foo"), Equals, true)
+
+	job, err = s.client.ResumeJob(context.Background(), &ResumeJobRequest{Name: "foo"})
+	c.Assert(err, IsNil)
+	c.Assert(job.Paused, Equals, false)
+	c.Assert(s.scheduler.IsPaused("foo"), Equals, false)
+}
+
+func (s *SuiteServer) TestJobNotFound(c *C) {
+	_, err := s.client.RunJob(context.Background(), &RunJobRequest{Name: "qux"})
+	c.Assert(status.Code(err), Equals, codes.NotFound)
+
+	_, err = s.client.PauseJob(context.Background(), &PauseJobRequest{Name: "qux"})
+	c.Assert(status.Code(err), Equals, codes.NotFound)
+}
+
+// TestJob writes to the output streams, waiting between the writes so the
+// execution can be followed
+type TestJob struct {
+	core.BareJob
+}
+
+func (j *TestJob) Run(ctx *core.Context) error {
+	ctx.Execution.OutputStream.Write([]byte("foo\n"))
+	ctx.Execution.ErrorStream.Write([]byte("bar\n"))
+	time.Sleep(time.Millisecond * 200)
+	ctx.Execution.OutputStream.Write([]byte("baz\n"))
+	return nil
+}
+
+type TestLogger struct{}
+
+func (*TestLogger) Criticalf(format string, args ...interface{}) {}
+func (*TestLogger) Debugf(format string, args ...interface{})    {}
+func (*TestLogger) Errorf(format string, args ...interface{})    {}
+func (*TestLogger) Noticef(format string, args ...interface{})   {}
+func (*TestLogger) Warningf(format string, args ...interface{})  {}
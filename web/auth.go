@@ -0,0 +1,134 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Scope is the access granted to a token, each scope grants the access of the
+// previous ones
+type Scope int
+
+const (
+	// ScopeRead allows to list the jobs and read their history and logs
+	ScopeRead Scope = iota + 1
+	// ScopeTrigger allows to run the jobs manually
+	ScopeTrigger
+	// ScopeAdmin allows to pause and resume the jobs
+	ScopeAdmin
+)
+
+var scopes = map[string]Scope{
+	"read":    ScopeRead,
+	"trigger": ScopeTrigger,
+	"admin":   ScopeAdmin,
+}
+
+// Token is a bearer token and the scope it grants
+type Token struct {
+	Value string
+	Scope Scope
+}
+
+// ParseToken parses a token as `scope:value`, where scope is `read`, `trigger`
+// or `admin`. The tokens without a scope are admin tokens, a token with an
+// unknown scope is rejected, so a typo doesn't grant the admin scope.
+func ParseToken(s string) (Token, error) {
+	i := strings.Index(s, ":")
+	if i == -1 {
+		return Token{Value: s, Scope: ScopeAdmin}, nil
+	}
+
+	scope, ok := scopes[s[:i]]
+	if !ok {
+		return Token{}, fmt.Errorf("invalid token scope %q: expected read, trigger or admin", s[:i])
+	}
+
+	return Token{Value: s[i+1:], Scope: scope}, nil
+}
+
+// Auth are the credentials required by the API and the dashboard, one of the
+// Tokens as a bearer token, or the Username and Password with basic auth. The
+// requests aren't authenticated if it's empty.
+type Auth struct {
+	Tokens   []Token
+	Username string
+	Password string
+}
+
+// IsEmpty returns true if no credentials are configured
+func (a *Auth) IsEmpty() bool {
+	return len(a.Tokens) == 0 && a.Username == ""
+}
+
+// authenticate returns the scope granted to the request and true if it has
+// valid credentials, see Authenticate
+func (a *Auth) authenticate(r *http.Request) (Scope, bool) {
+	return a.Authenticate(r.Header.Get("Authorization"))
+}
+
+// Authenticate returns the scope granted by the value of an Authorization
+// header, a bearer token or basic auth credentials, and true if they're valid.
+// The basic auth credentials grant ScopeAdmin, as does any value if no
+// credentials are configured.
+func (a *Auth) Authenticate(h string) (Scope, bool) {
+	if a.IsEmpty() {
+		return ScopeAdmin, true
+	}
+
+	if strings.HasPrefix(h, "Bearer ") {
+		token := strings.TrimPrefix(h, "Bearer ")
+		for _, t := range a.Tokens {
+			if equal(token, t.Value) {
+				return t.Scope, true
+			}
+		}
+
+		return 0, false
+	}
+
+	user, password, ok := parseBasicAuth(h)
+	if ok && a.Username != "" && equal(user, a.Username) && equal(password, a.Password) {
+		return ScopeAdmin, true
+	}
+
+	return 0, false
+}
+
+// parseBasicAuth parses the value of an Authorization header with basic auth
+// credentials, like http.Request.BasicAuth
+func parseBasicAuth(h string) (user, password string, ok bool) {
+	if !strings.HasPrefix(h, "Basic ") {
+		return "", "", false
+	}
+
+	c, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(h, "Basic "))
+	if err != nil {
+		return "", "", false
+	}
+
+	i := strings.Index(string(c), ":")
+	if i == -1 {
+		return "", "", false
+	}
+
+	return string(c[:i]), string(c[i+1:]), true
+}
+
+// challenge writes the unauthorized response, asking the browsers for the
+// basic auth credentials if they're configured
+func (a *Auth) challenge(w http.ResponseWriter) {
+	if a.Username != "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="ofelia", charset="UTF-8"`)
+	}
+
+	writeError(w, http.StatusUnauthorized, "unauthorized")
+}
+
+// equal compares the strings in constant time
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,105 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/mcuadros/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteAuth struct {
+	server *Server
+}
+
+var _ = Suite(&SuiteAuth{})
+
+func (s *SuiteAuth) SetUpTest(c *C) {
+	s.server = NewServer(":0", core.NewScheduler(&TestLogger{}))
+}
+
+func (s *SuiteAuth) TestNoAuth(c *C) {
+	c.Assert(s.server.Auth.IsEmpty(), Equals, true)
+	c.Assert(s.do(nil).Code, Equals, http.StatusOK)
+}
+
+func (s *SuiteAuth) TestTokens(c *C) {
+	s.server.Auth = Auth{Tokens: []Token{{Value: "foo", Scope: ScopeAdmin}, {Value: "bar", Scope: ScopeAdmin}}}
+
+	w := s.do(nil)
+	c.Assert(w.Code, Equals, http.StatusUnauthorized)
+	c.Assert(w.Header().Get("WWW-Authenticate"), Equals, "")
+
+	c.Assert(s.do(func(r *http.Request) { r.Header.Set("Authorization", "Bearer bar") }).Code, Equals, http.StatusOK)
+	c.Assert(s.do(func(r *http.Request) { r.Header.Set("Authorization", "Bearer qux") }).Code, Equals, http.StatusUnauthorized)
+	c.Assert(s.do(func(r *http.Request) { r.SetBasicAuth("foo", "foo") }).Code, Equals, http.StatusUnauthorized)
+}
+
+func (s *SuiteAuth) TestParseToken(c *C) {
+	for s, expected := range map[string]Token{
+		"read:foo":      {Value: "foo", Scope: ScopeRead},
+		"trigger:foo":   {Value: "foo", Scope: ScopeTrigger},
+		"admin:foo:bar": {Value: "foo:bar", Scope: ScopeAdmin},
+		"foo":           {Value: "foo", Scope: ScopeAdmin},
+	} {
+		t, err := ParseToken(s)
+		c.Assert(err, IsNil)
+		c.Assert(t, DeepEquals, expected)
+	}
+
+	_, err := ParseToken("reader:foo")
+	c.Assert(err, ErrorMatches, `invalid token scope "reader": expected read, trigger or admin`)
+}
+
+func (s *SuiteAuth) TestScopes(c *C) {
+	c.Assert(s.server.Scheduler.AddJob(&TestJob{BareJob: core.BareJob{Name: "foo", Schedule: "@hourly"}}), IsNil)
+	s.server.Auth = Auth{Tokens: []Token{
+		{Value: "foo", Scope: ScopeRead},
+		{Value: "bar", Scope: ScopeTrigger},
+		{Value: "baz", Scope: ScopeAdmin},
+	}}
+
+	for _, t := range []struct {
+		method, url string
+		codes       map[string]int
+	}{
+		{"GET", "/api/jobs", map[string]int{"foo": 200, "bar": 200, "baz": 200}},
+		{"GET", "/api/jobs/foo/history", map[string]int{"foo": 200, "bar": 200, "baz": 200}},
+		{"POST", "/api/jobs/foo/run", map[string]int{"foo": 403, "bar": 202, "baz": 202}},
+		{"POST", "/api/jobs/foo/pause", map[string]int{"foo": 403, "bar": 403, "baz": 200}},
+		{"POST", "/api/jobs/foo/resume", map[string]int{"foo": 403, "bar": 403, "baz": 200}},
+	} {
+		for token, code := range t.codes {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(t.method, t.url, nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+
+			s.server.ServeHTTP(w, r)
+			c.Assert(w.Code, Equals, code, Commentf("%s %s with %s", t.method, t.url, token))
+		}
+	}
+}
+
+func (s *SuiteAuth) TestBasicAuth(c *C) {
+	s.server.Auth = Auth{Username: "foo", Password: "bar"}
+
+	w := s.do(nil)
+	c.Assert(w.Code, Equals, http.StatusUnauthorized)
+	c.Assert(w.Header().Get("WWW-Authenticate"), Equals, `Basic realm="ofelia", charset="UTF-8"`)
+
+	c.Assert(s.do(func(r *http.Request) { r.SetBasicAuth("foo", "bar") }).Code, Equals, http.StatusOK)
+	c.Assert(s.do(func(r *http.Request) { r.SetBasicAuth("foo", "qux") }).Code, Equals, http.StatusUnauthorized)
+	c.Assert(s.do(func(r *http.Request) { r.Header.Set("Authorization", "Bearer bar") }).Code, Equals, http.StatusUnauthorized)
+}
+
+func (s *SuiteAuth) do(auth func(*http.Request)) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/jobs", nil)
+	if auth != nil {
+		auth(r)
+	}
+
+	s.server.ServeHTTP(w, r)
+	return w
+}
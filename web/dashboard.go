@@ -0,0 +1,124 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+// outputTailSize is the maximum size of the output shown at the dashboard and
+// returned by the API
+const outputTailSize = 2048
+
+type dashboardJob struct {
+	Job     core.Job
+	NextRun time.Time
+	Last    *core.Execution
+	Output  string
+}
+
+// handleDashboard handles `GET /`, rendering a HTML page with the status of
+// every job
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	all := s.Scheduler.GetJobs()
+	jobs := make([]*dashboardJob, 0, len(all))
+	for _, j := range all {
+		dj := &dashboardJob{Job: j, NextRun: s.Scheduler.NextRun(j)}
+		if h := j.History(); len(h) > 0 {
+			dj.Last = h[len(h)-1].Snapshot()
+			dj.Output = core.TailOutput(dj.Last.Output(), outputTailSize)
+		}
+
+		jobs = append(jobs, dj)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, jobs); err != nil {
+		s.Scheduler.Logger.Errorf("Error rendering dashboard: %s", err)
+	}
+}
+
+func executionStatus(e *core.Execution) string {
+	switch {
+	case e.IsRunning:
+		return "running"
+	case e.Skipped:
+		return "skipped"
+	case e.Failed:
+		return "failed"
+	default:
+		return "successful"
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Format("2006-01-02 15:04:05")
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"status": executionStatus,
+	"time":   formatTime,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta http-equiv="refresh" content="10">
+	<title>Ofelia</title>
+	<style>
+		body { font-family: sans-serif; margin: 2em; color: #333; }
+		table { border-collapse: collapse; width: 100%; }
+		th, td { text-align: left; padding: .5em; border-bottom: 1px solid #ddd; vertical-align: top; }
+		pre { margin: 0; max-height: 10em; overflow: auto; background: #f6f6f6; padding: .5em; }
+		.successful { color: #2e7d32; }
+		.failed { color: #c62828; }
+		.skipped { color: #ef6c00; }
+		.running { color: #1565c0; }
+	</style>
+</head>
+<body>
+	<h1>Ofelia</h1>
+	<table>
+		<tr>
+			<th>Job</th>
+			<th>Schedule</th>
+			<th>Next run</th>
+			<th>Last run</th>
+			<th>Result</th>
+			<th>Output</th>
+		</tr>
+		{{range .}}
+		<tr>
+			<td><b>{{.Job.GetName}}</b><br><code>{{.Job.GetCommand}}</code></td>
+			<td><code>{{.Job.GetSchedule}}</code></td>
+			<td>{{time .NextRun}}</td>
+			{{if .Last}}
+			<td>{{time .Last.Date}}<br>{{.Last.Duration}}</td>
+			<td class="{{status .Last}}">{{status .Last}}{{if .Last.Error}}<br>{{.Last.Error}}{{end}}</td>
+			<td>{{if .Output}}<pre>{{.Output}}</pre>{{end}}</td>
+			{{else}}
+			<td>-</td>
+			<td>-</td>
+			<td></td>
+			{{end}}
+		</tr>
+		{{end}}
+	</table>
+</body>
+</html>
+`))
@@ -0,0 +1,24 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SuiteServer) TestDashboard(c *C) {
+	w := s.do("GET", "/")
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(strings.Contains(w.Body.String(), "foo"), Equals, true)
+
+	c.Assert(s.scheduler.RunJob("foo"), IsNil)
+	s.scheduler.Stop()
+
+	w = s.do("GET", "/")
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(strings.Contains(w.Body.String(), "foo output"), Equals, true)
+	c.Assert(strings.Contains(w.Body.String(), `class="successful"`), Equals, true)
+
+	c.Assert(s.do("GET", "/foo").Code, Equals, http.StatusNotFound)
+}
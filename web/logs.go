@@ -0,0 +1,99 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+// handleLogs streams the output of an execution of the job as server-sent
+// events, the last execution or the one of the `execution` query parameter.
+// The output written so far and then every chunk written until the execution
+// finishes are sent as `output` and `error_output` events, with the chunk
+// encoded as a JSON string, followed by an `end` event with the execution, or
+// by a `dropped` event if the client doesn't read them in time.
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request, j core.Job) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	e := findExecution(j.History(), r.URL.Query().Get("execution"))
+	if e == nil {
+		writeError(w, http.StatusNotFound, "execution not found")
+		return
+	}
+
+	output, errorOutput, chunks, stop := e.Follow()
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	writeChunk(w, core.OutputChunk{Data: output})
+	writeChunk(w, core.OutputChunk{Stderr: true, Data: errorOutput})
+	flusher.Flush()
+
+	// the channel is nil if the execution already finished
+	for chunks != nil {
+		select {
+		case c, ok := <-chunks:
+			if !ok {
+				chunks = nil
+				continue
+			}
+
+			if c.Dropped {
+				writeEvent(w, "dropped", "the output wasn't read in time")
+				flusher.Flush()
+				return
+			}
+
+			writeChunk(w, c)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	end := newExecutionResponse(e)
+	end.Output, end.ErrorOutput = "", ""
+	writeEvent(w, "end", end)
+	flusher.Flush()
+}
+
+// findExecution returns the execution with the given id, or the last one if
+// id is empty
+func findExecution(history []*core.Execution, id string) *core.Execution {
+	for i := len(history) - 1; i >= 0; i-- {
+		if id == "" || history[i].ID == id {
+			return history[i]
+		}
+	}
+
+	return nil
+}
+
+func writeChunk(w http.ResponseWriter, c core.OutputChunk) {
+	if len(c.Data) == 0 {
+		return
+	}
+
+	event := "output"
+	if c.Stderr {
+		event = "error_output"
+	}
+
+	writeEvent(w, event, string(c.Data))
+}
+
+// writeEvent writes a server-sent event with v encoded as JSON, in a single
+// line as required by the data field
+func writeEvent(w http.ResponseWriter, event string, v interface{}) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
@@ -0,0 +1,80 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteLogs struct {
+	scheduler *core.Scheduler
+	server    *Server
+}
+
+var _ = Suite(&SuiteLogs{})
+
+func (s *SuiteLogs) SetUpTest(c *C) {
+	job := &TestSlowJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+
+	s.scheduler = core.NewScheduler(&TestLogger{})
+	c.Assert(s.scheduler.AddJob(job), IsNil)
+
+	s.server = NewServer(":0", s.scheduler)
+}
+
+func (s *SuiteLogs) TestLogs(c *C) {
+	c.Assert(s.do("/api/jobs/foo/logs").Code, Equals, http.StatusNotFound)
+
+	c.Assert(s.scheduler.RunJob("foo"), IsNil)
+	time.Sleep(time.Millisecond * 50)
+
+	w := s.do("/api/jobs/foo/logs")
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), Equals, "text/event-stream")
+
+	id := s.scheduler.GetJob("foo").History()[0].ID
+	c.Assert(w.Body.String(), Matches, ""+
+		"event: output\ndata: \"foo\\\\n\"\n\n"+
+		"event: error_output\ndata: \"bar\\\\n\"\n\n"+
+		"event: output\ndata: \"baz\\\\n\"\n\n"+
+		"event: end\ndata: \\{\"id\":\""+id+"\",.*\"is_running\":false,\"failed\":false,.*\\}\n\n",
+	)
+
+	// the finished execution is sent at once
+	w = s.do("/api/jobs/foo/logs?execution=" + id)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.String(), Matches, ""+
+		"event: output\ndata: \"foo\\\\nbaz\\\\n\"\n\n"+
+		"event: error_output\ndata: \"bar\\\\n\"\n\n"+
+		"event: end\n.*\n\n",
+	)
+
+	c.Assert(s.do("/api/jobs/foo/logs?execution=qux").Code, Equals, http.StatusNotFound)
+}
+
+func (s *SuiteLogs) do(url string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.server.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+
+	return w
+}
+
+// TestSlowJob writes to the output streams, waiting between the writes so the
+// execution can be followed
+type TestSlowJob struct {
+	core.BareJob
+}
+
+func (j *TestSlowJob) Run(ctx *core.Context) error {
+	ctx.Execution.OutputStream.Write([]byte("foo\n"))
+	ctx.Execution.ErrorStream.Write([]byte("bar\n"))
+	time.Sleep(time.Millisecond * 200)
+	ctx.Execution.OutputStream.Write([]byte("baz\n"))
+	return nil
+}
@@ -0,0 +1,391 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+)
+
+const (
+	apiPrefix = "/api/jobs"
+	// defaultNextRuns and maxNextRuns are the default and maximum number of
+	// run times returned by `GET /api/jobs/{name}/next`
+	defaultNextRuns = 5
+	maxNextRuns     = 100
+)
+
+// Server is a HTTP server exposing an API and a dashboard to inspect the jobs
+// of a scheduler and run them manually
+type Server struct {
+	Addr      string
+	Scheduler *core.Scheduler
+	// Auth are the credentials required by the requests, if any
+	Auth Auth
+	// TLSCert and TLSKey are the files of the certificate and its key, the
+	// server is served over HTTPS if they're set
+	TLSCert string
+	TLSKey  string
+
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+// jobActions are the actions of `/api/jobs/{name}/{action}`, with the scope
+// required by their requests
+var jobActions = map[string]Scope{
+	"history": ScopeRead,
+	"next":    ScopeRead,
+	"logs":    ScopeRead,
+	"run":     ScopeTrigger,
+	"pause":   ScopeAdmin,
+	"resume":  ScopeAdmin,
+}
+
+// NewServer returns a new Server listening on the given address
+func NewServer(addr string, s *core.Scheduler) *Server {
+	srv := &Server{
+		Addr:      addr,
+		Scheduler: s,
+		mux:       http.NewServeMux(),
+	}
+
+	srv.server = &http.Server{Addr: addr, Handler: srv}
+	srv.mux.HandleFunc("/", srv.handleDashboard)
+	srv.mux.HandleFunc(apiPrefix, srv.handleJobs)
+	srv.mux.HandleFunc(apiPrefix+"/", srv.handleJob)
+	return srv
+}
+
+// Start starts listening on the server address, it blocks until the server is
+// shutdown
+func (s *Server) Start() error {
+	var err error
+	if s.TLSCert != "" || s.TLSKey != "" {
+		err = s.server.ListenAndServeTLS(s.TLSCert, s.TLSKey)
+	} else {
+		err = s.server.ListenAndServe()
+	}
+
+	if err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+// Shutdown gracefully stops the server
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// ServeHTTP implements http.Handler, the requests without valid credentials
+// are rejected, as the ones with credentials lacking the required scope
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	scope, ok := s.Auth.authenticate(r)
+	if !ok {
+		s.Auth.challenge(w)
+		return
+	}
+
+	if scope < requiredScope(r) {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	if !isCrossSiteSafe(r) {
+		writeError(w, http.StatusForbidden, "the POST requests require the Content-Type application/json or a bearer token")
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// isCrossSiteSafe returns true if the request can't be sent by the form of
+// another site, which browsers send with the basic auth credentials, or
+// without any when the API isn't authenticated: reading, or with a JSON
+// body, only sent cross-origin after a CORS preflight, or with a bearer
+// token, never attached by the browsers.
+func isCrossSiteSafe(r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return true
+	}
+
+	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && t == "application/json"
+}
+
+// requiredScope returns the scope required by the request, reading is allowed
+// to any scope while the job actions require the scope of jobActions
+func requiredScope(r *http.Request) Scope {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return ScopeRead
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, apiPrefix+"/")
+	if scope, ok := jobActions[path[strings.LastIndex(path, "/")+1:]]; ok {
+		return scope
+	}
+
+	return ScopeAdmin
+}
+
+// handleJobs handles `GET /api/jobs`
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	all := s.Scheduler.GetJobs()
+	jobs := make([]*jobResponse, 0, len(all))
+	for _, j := range all {
+		jobs = append(jobs, s.newJobResponse(j))
+	}
+
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// handleJob handles `GET /api/jobs/{name}/history`,
+// `GET /api/jobs/{name}/next`, `GET /api/jobs/{name}/logs`,
+// `POST /api/jobs/{name}/run`, `POST /api/jobs/{name}/pause` and
+// `POST /api/jobs/{name}/resume`
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, apiPrefix+"/")
+	i := strings.LastIndex(path, "/")
+	if i == -1 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	name, action := path[:i], path[i+1:]
+	j := s.Scheduler.GetJob(name)
+	if j == nil {
+		writeError(w, http.StatusNotFound, core.ErrJobNotFound.Error())
+		return
+	}
+
+	switch {
+	case action == "history" && r.Method == http.MethodGet:
+		s.handleHistory(w, j)
+	case action == "next" && r.Method == http.MethodGet:
+		s.handleNext(w, r, j)
+	case action == "logs" && r.Method == http.MethodGet:
+		s.handleLogs(w, r, j)
+	case action == "run" && r.Method == http.MethodPost:
+		s.handleRun(w, r, j)
+	case (action == "pause" || action == "resume") && r.Method == http.MethodPost:
+		s.handlePause(w, j, action == "pause")
+	case jobActions[action] != 0:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, j core.Job) {
+	history := j.History()
+	executions := make([]*executionResponse, 0, len(history))
+	for _, e := range history {
+		executions = append(executions, newExecutionResponse(e))
+	}
+
+	writeJSON(w, http.StatusOK, executions)
+}
+
+// handleNext returns the next run times of the job, as many as the `count`
+// query parameter
+func (s *Server) handleNext(w http.ResponseWriter, r *http.Request, j core.Job) {
+	count := defaultNextRuns
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxNextRuns {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("count must be between 1 and %d", maxNextRuns))
+			return
+		}
+
+		count = n
+	}
+
+	runs, err := core.NextRuns(j.GetSchedule(), s.Scheduler.CronFormat, time.Now(), count)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if runs == nil {
+		runs = []time.Time{}
+	}
+
+	writeJSON(w, http.StatusOK, runs)
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, j core.Job, pause bool) {
+	var err error
+	if pause {
+		err = s.Scheduler.PauseJob(j.GetName())
+	} else {
+		err = s.Scheduler.ResumeJob(j.GetName())
+	}
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.newJobResponse(j))
+}
+
+// handleRun runs the job, with the parameters of the request, see
+// parseRunParams
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request, j core.Job) {
+	p, err := parseRunParams(r)
+	if err == nil {
+		err = p.Validate(j)
+	}
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.Scheduler.RunJobWithParams(j.GetName(), p); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, s.newJobResponse(j))
+}
+
+// parseRunParams returns the parameters of a manual run: the arguments of the
+// `arg` query parameters followed by the `args` array of the JSON body, and
+// the environment variables of the `env` query parameters, as `NAME=value`,
+// followed by the `env` object of the JSON body.
+func parseRunParams(r *http.Request) (core.RunParams, error) {
+	q := r.URL.Query()
+	p := core.RunParams{Args: q["arg"], Env: q["env"]}
+
+	var body struct {
+		Args []string          `json:"args"`
+		Env  map[string]string `json:"env"`
+	}
+
+	if r.ContentLength != 0 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return p, fmt.Errorf("invalid body: %s", err)
+		}
+	}
+
+	p.Args = append(p.Args, body.Args...)
+
+	names := make([]string, 0, len(body.Env))
+	for name := range body.Env {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		p.Env = append(p.Env, name+"="+body.Env[name])
+	}
+
+	return p, nil
+}
+
+type jobResponse struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Command  string    `json:"command"`
+	Tags     core.Tags `json:"tags,omitempty"`
+	Running  int32     `json:"running"`
+	Paused   bool      `json:"paused"`
+}
+
+func (s *Server) newJobResponse(j core.Job) *jobResponse {
+	return &jobResponse{
+		Name:     j.GetName(),
+		Schedule: j.GetSchedule(),
+		Command:  j.GetCommand(),
+		Tags:     j.GetTags(),
+		Running:  j.Running(),
+		Paused:   s.Scheduler.IsPaused(j.GetName()),
+	}
+}
+
+type executionResponse struct {
+	ID           string        `json:"id"`
+	Date         time.Time     `json:"date"`
+	Duration     time.Duration `json:"duration"`
+	PullDuration time.Duration `json:"pull_duration,omitempty"`
+	IsRunning    bool          `json:"is_running"`
+	Failed       bool          `json:"failed"`
+	Skipped      bool          `json:"skipped"`
+	Warning      bool          `json:"warning"`
+	Slow         bool          `json:"slow,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	ExitCode     int           `json:"exit_code,omitempty"`
+	OOMKilled    bool          `json:"oom_killed,omitempty"`
+	Reason       string        `json:"reason,omitempty"`
+	Output       string        `json:"output"`
+	ErrorOutput  string        `json:"error_output"`
+	Args         []string      `json:"args,omitempty"`
+	Env          []string      `json:"env,omitempty"`
+}
+
+func newExecutionResponse(e *core.Execution) *executionResponse {
+	e = e.Snapshot()
+	r := &executionResponse{
+		ID:           e.ID,
+		Date:         e.Date,
+		Duration:     e.Duration,
+		PullDuration: e.PullDuration,
+		IsRunning:    e.IsRunning,
+		Failed:       e.Failed,
+		Skipped:      e.Skipped,
+		Warning:      e.Warning,
+		Slow:         e.Slow,
+		Args:         e.Args,
+		Env:          core.EnvNames(e.Environment),
+	}
+
+	if e.Error != nil {
+		r.Error = e.Error.Error()
+	}
+
+	if err, ok := e.Error.(*core.ExitCodeError); ok {
+		r.ExitCode = err.ExitCode
+	}
+
+	if e.Container != nil {
+		r.OOMKilled = e.Container.OOMKilled
+		r.Reason = e.Container.Reason()
+	}
+
+	// the output of the running executions is still being written
+	if !e.IsRunning {
+		r.Output = core.TailOutput(e.Output(), outputTailSize)
+		r.ErrorOutput = core.TailOutput(e.ErrorOutput(), outputTailSize)
+	}
+
+	return r
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
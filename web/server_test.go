@@ -0,0 +1,232 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcuadros/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type SuiteServer struct {
+	scheduler *core.Scheduler
+	job       *TestJob
+	server    *Server
+}
+
+var _ = Suite(&SuiteServer{})
+
+func (s *SuiteServer) SetUpTest(c *C) {
+	s.job = &TestJob{}
+	s.job.Name = "foo"
+	s.job.Schedule = "@hourly"
+	s.job.Command = "echo foo"
+
+	s.scheduler = core.NewScheduler(&TestLogger{})
+	c.Assert(s.scheduler.AddJob(s.job), IsNil)
+
+	s.server = NewServer(":0", s.scheduler)
+}
+
+func (s *SuiteServer) TestJobs(c *C) {
+	w := s.do("GET", "/api/jobs")
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	var jobs []*jobResponse
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &jobs), IsNil)
+	c.Assert(jobs, HasLen, 1)
+	c.Assert(jobs[0].Name, Equals, "foo")
+	c.Assert(jobs[0].Schedule, Equals, "@hourly")
+	c.Assert(jobs[0].Command, Equals, "echo foo")
+}
+
+func (s *SuiteServer) TestRunAndHistory(c *C) {
+	w := s.do("POST", "/api/jobs/foo/run")
+	c.Assert(w.Code, Equals, http.StatusAccepted)
+
+	s.scheduler.Stop()
+
+	w = s.do("GET", "/api/jobs/foo/history")
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	var executions []*executionResponse
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &executions), IsNil)
+	c.Assert(executions, HasLen, 1)
+	c.Assert(executions[0].Failed, Equals, false)
+	c.Assert(executions[0].Output, Equals, "foo output")
+	c.Assert(s.job.Called, Equals, 1)
+}
+
+func (s *SuiteServer) TestRunWithEnv(c *C) {
+	s.job.AllowEnv = []string{"FOO", "BAR", "QUX"}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/jobs/foo/run?env=FOO=foo", strings.NewReader(`{"env": {"QUX": "qux", "BAR": "bar"}}`))
+	r.Header.Set("Content-Type", "application/json")
+	s.server.ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusAccepted)
+
+	s.scheduler.Stop()
+	c.Assert(s.job.Env, DeepEquals, []string{"FOO=foo", "BAR=bar", "QUX=qux"})
+
+	w = s.do("GET", "/api/jobs/foo/history")
+	var executions []*executionResponse
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &executions), IsNil)
+	c.Assert(executions[0].Env, DeepEquals, []string{"FOO", "BAR", "QUX"})
+}
+
+func (s *SuiteServer) TestRunWithArgs(c *C) {
+	s.job.AllowArgs = true
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/jobs/foo/run?arg=--force", strings.NewReader(`{"args": ["v1.2.0", "a b"]}`))
+	r.Header.Set("Content-Type", "application/json")
+	s.server.ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusAccepted)
+
+	s.scheduler.Stop()
+	c.Assert(s.job.Args, DeepEquals, []string{"--force", "v1.2.0", "a b"})
+
+	w = s.do("GET", "/api/jobs/foo/history")
+	var executions []*executionResponse
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &executions), IsNil)
+	c.Assert(executions[0].Args, DeepEquals, []string{"--force", "v1.2.0", "a b"})
+}
+
+func (s *SuiteServer) TestRunWithArgsNotAllowed(c *C) {
+	w := s.do("POST", "/api/jobs/foo/run?arg=--force")
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+	c.Assert(w.Body.String(), Matches, `.*arguments not allowed by the job \\"foo\\".*\n`)
+
+	s.scheduler.Stop()
+	c.Assert(s.job.Called, Equals, 0)
+}
+
+func (s *SuiteServer) TestRunCrossSite(c *C) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/jobs/foo/run", strings.NewReader("env=FOO%3Dfoo"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.server.ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusForbidden)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/api/jobs/foo/pause", nil)
+	s.server.ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusForbidden)
+
+	s.scheduler.Stop()
+	c.Assert(s.job.Called, Equals, 0)
+	c.Assert(s.scheduler.IsPaused("foo"), Equals, false)
+}
+
+func (s *SuiteServer) TestRunWithInvalidEnv(c *C) {
+	w := s.do("POST", "/api/jobs/foo/run?env=FOO")
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+	c.Assert(w.Body.String(), Matches, `.*invalid environment variable \\"FOO\\".*\n`)
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/jobs/foo/run", strings.NewReader(`{"env": ["FOO=foo"]}`))
+	r.Header.Set("Content-Type", "application/json")
+	s.server.ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+
+	s.scheduler.Stop()
+	c.Assert(s.job.Called, Equals, 0)
+}
+
+func (s *SuiteServer) TestRunWithEnvNotAllowed(c *C) {
+	s.job.AllowEnv = []string{"FOO"}
+
+	w := s.do("POST", "/api/jobs/foo/run?env=FOO=foo&env=LD_PRELOAD=/tmp/x.so")
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+	c.Assert(w.Body.String(), Matches, `.*environment variable \\"LD_PRELOAD\\" not allowed by the job \\"foo\\".*\n`)
+
+	s.scheduler.Stop()
+	c.Assert(s.job.Called, Equals, 0)
+}
+
+func (s *SuiteServer) TestPauseAndResume(c *C) {
+	w := s.do("POST", "/api/jobs/foo/pause")
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	var job *jobResponse
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &job), IsNil)
+	c.Assert(job.Paused, Equals, true)
+	c.Assert(s.scheduler.IsPaused("foo"), Equals, true)
+
+	w = s.do("POST", "/api/jobs/foo/resume")
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &job), IsNil)
+	c.Assert(job.Paused, Equals, false)
+	c.Assert(s.scheduler.IsPaused("foo"), Equals, false)
+
+	c.Assert(s.do("GET", "/api/jobs/foo/pause").Code, Equals, http.StatusMethodNotAllowed)
+}
+
+func (s *SuiteServer) TestNext(c *C) {
+	w := s.do("GET", "/api/jobs/foo/next?count=3")
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	var runs []time.Time
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &runs), IsNil)
+	c.Assert(runs, HasLen, 3)
+	c.Assert(runs[0].After(time.Now()), Equals, true)
+	c.Assert(runs[1].Sub(runs[0]), Equals, time.Hour)
+
+	w = s.do("GET", "/api/jobs/foo/next")
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &runs), IsNil)
+	c.Assert(runs, HasLen, defaultNextRuns)
+
+	c.Assert(s.do("GET", "/api/jobs/foo/next?count=0").Code, Equals, http.StatusBadRequest)
+	c.Assert(s.do("GET", "/api/jobs/foo/next?count=qux").Code, Equals, http.StatusBadRequest)
+}
+
+func (s *SuiteServer) TestErrors(c *C) {
+	c.Assert(s.do("GET", "/api/jobs/bar/history").Code, Equals, http.StatusNotFound)
+	c.Assert(s.do("POST", "/api/jobs/bar/run").Code, Equals, http.StatusNotFound)
+	c.Assert(s.do("GET", "/api/jobs/foo/run").Code, Equals, http.StatusMethodNotAllowed)
+	c.Assert(s.do("GET", "/api/jobs/foo/qux").Code, Equals, http.StatusNotFound)
+	c.Assert(s.do("POST", "/api/jobs").Code, Equals, http.StatusMethodNotAllowed)
+}
+
+func (s *SuiteServer) do(method, url string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, url, nil)
+	if method == "POST" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	s.server.ServeHTTP(w, r)
+
+	return w
+}
+
+type TestJob struct {
+	core.BareJob
+	Called int
+	Args   []string
+	Env    []string
+}
+
+func (j *TestJob) Run(ctx *core.Context) error {
+	j.Called++
+	j.Args = ctx.Execution.Args
+	j.Env = ctx.Execution.Environment
+	ctx.Execution.OutputStream.Write([]byte("foo output"))
+	return nil
+}
+
+type TestLogger struct{}
+
+func (*TestLogger) Criticalf(format string, args ...interface{}) {}
+func (*TestLogger) Debugf(format string, args ...interface{})    {}
+func (*TestLogger) Errorf(format string, args ...interface{})    {}
+func (*TestLogger) Noticef(format string, args ...interface{})   {}
+func (*TestLogger) Warningf(format string, args ...interface{})  {}